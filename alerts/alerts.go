@@ -0,0 +1,219 @@
+// Package alerts scores new transactions against a user's history and
+// flags the ones worth a second look: amounts far above what a merchant
+// or category usually costs, large first purchases at a merchant, and
+// the same charge repeated within minutes.
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Finding kinds.
+const (
+	KindMerchantOutlier = "merchant_outlier"
+	KindCategoryOutlier = "category_outlier"
+	KindNewMerchant     = "new_merchant"
+	KindDuplicate       = "duplicate_charge"
+)
+
+// Defaults for the zero Options fields.
+const (
+	DefaultMinHistory        = 4
+	DefaultDeviations        = 3
+	DefaultNewMerchantAmount = 200
+	DefaultDuplicateWindow   = 10 * time.Minute
+)
+
+// Options tune the analyzer; zero fields take the defaults above.
+type Options struct {
+	// MinHistory is how many earlier purchases a merchant or category
+	// needs before its amounts count as usual, and how many the user
+	// needs before any merchant counts as new.
+	MinHistory int
+	// Deviations is how many standard deviations above the mean an
+	// amount must be to be an outlier.
+	Deviations float64
+	// NewMerchantAmount is the smallest first purchase at a merchant
+	// that is flagged, in the transaction's currency.
+	NewMerchantAmount float64
+	// DuplicateWindow is how close in time two equal charges at the
+	// same merchant on the same card must be to look doubled.
+	DuplicateWindow time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.MinHistory <= 0 {
+		o.MinHistory = DefaultMinHistory
+	}
+	if o.Deviations <= 0 {
+		o.Deviations = DefaultDeviations
+	}
+	if o.NewMerchantAmount <= 0 {
+		o.NewMerchantAmount = DefaultNewMerchantAmount
+	}
+	if o.DuplicateWindow <= 0 {
+		o.DuplicateWindow = DefaultDuplicateWindow
+	}
+	return o
+}
+
+// Finding is one reason a transaction was flagged. Score is how far
+// past its threshold it is: standard deviations for outliers, multiples
+// of NewMerchantAmount for new merchants and 1 for duplicates.
+// RelatedID is the earlier charge a duplicate repeats.
+type Finding struct {
+	Kind      string
+	Score     float64
+	Reason    string
+	RelatedID uint64
+}
+
+// Analyzer holds the history transactions are scored against.
+type Analyzer struct {
+	opts       Options
+	purchases  int
+	byMerchant map[string][]*store.Transaction
+	byCategory map[string][]float64
+}
+
+// New builds an Analyzer over history. Only expenses count.
+func New(history []store.Transaction, opts Options) *Analyzer {
+	a := &Analyzer{
+		opts:       opts.withDefaults(),
+		byMerchant: map[string][]*store.Transaction{},
+		byCategory: map[string][]float64{},
+	}
+	for i := range history {
+		a.Add(&history[i])
+	}
+	return a
+}
+
+// Add makes t part of the history, so later transactions of the same
+// batch are scored against it too.
+func (a *Analyzer) Add(t *store.Transaction) {
+	if t.KindOrDefault() != store.KindExpense || t.Amount <= 0 {
+		return
+	}
+	a.purchases++
+	key := merchantKey(t)
+	a.byMerchant[key] = append(a.byMerchant[key], t)
+	if t.Category != "" {
+		key := categoryKey(t)
+		a.byCategory[key] = append(a.byCategory[key], t.Amount)
+	}
+}
+
+// Score returns t's findings against the history, without adding t to
+// it. Only expenses are scored; amounts are compared within a currency.
+func (a *Analyzer) Score(t *store.Transaction) []Finding {
+	if t.KindOrDefault() != store.KindExpense || t.Amount <= 0 {
+		return nil
+	}
+	var out []Finding
+	seen := a.byMerchant[merchantKey(t)]
+	if d := a.duplicateOf(t, seen); d != nil {
+		out = append(out, Finding{
+			Kind:      KindDuplicate,
+			Score:     1,
+			Reason:    fmt.Sprintf("%s charged %s again within %s", t.Merchant, money(t.Amount, t.Currency), roundDuration(t.OccurredAt.Sub(d.OccurredAt))),
+			RelatedID: d.ID,
+		})
+	}
+
+	amounts := make([]float64, 0, len(seen))
+	for _, p := range seen {
+		if p.ID != t.ID {
+			amounts = append(amounts, p.Amount)
+		}
+	}
+	if f, ok := a.outlier(t.Amount, amounts); ok {
+		f.Kind = KindMerchantOutlier
+		f.Reason = fmt.Sprintf("%s at %s; usually %s", money(t.Amount, t.Currency), t.Merchant, money(mean(amounts), t.Currency))
+		out = append(out, f)
+	} else if f, ok := a.outlier(t.Amount, a.byCategory[categoryKey(t)]); t.Category != "" && ok {
+		f.Kind = KindCategoryOutlier
+		f.Reason = fmt.Sprintf("%s in %s; usually %s", money(t.Amount, t.Currency), t.Category, money(mean(a.byCategory[categoryKey(t)]), t.Currency))
+		out = append(out, f)
+	}
+
+	if len(amounts) == 0 && a.purchases >= a.opts.MinHistory && t.Amount >= a.opts.NewMerchantAmount {
+		out = append(out, Finding{
+			Kind:   KindNewMerchant,
+			Score:  src.RoundCents(t.Amount / a.opts.NewMerchantAmount),
+			Reason: fmt.Sprintf("First purchase at %s is %s", t.Merchant, money(t.Amount, t.Currency)),
+		})
+	}
+	return out
+}
+
+// duplicateOf finds an earlier or later charge in seen with t's amount
+// and card within the window.
+func (a *Analyzer) duplicateOf(t *store.Transaction, seen []*store.Transaction) *store.Transaction {
+	for _, p := range seen {
+		if p.ID == t.ID || p.Amount != t.Amount || !strings.EqualFold(p.Card, t.Card) || !strings.EqualFold(p.Currency, t.Currency) {
+			continue
+		}
+		if d := t.OccurredAt.Sub(p.OccurredAt); d.Abs() <= a.opts.DuplicateWindow {
+			return p
+		}
+	}
+	return nil
+}
+
+// outlier reports whether amount is more than Deviations standard
+// deviations above the mean of amounts. The deviation is floored at a
+// tenth of the mean (and one unit), so a bill that never varies does
+// not flag every cent of change.
+func (a *Analyzer) outlier(amount float64, amounts []float64) (Finding, bool) {
+	if len(amounts) < a.opts.MinHistory {
+		return Finding{}, false
+	}
+	m := mean(amounts)
+	variance := 0.0
+	for _, v := range amounts {
+		variance += (v - m) * (v - m)
+	}
+	sd := math.Max(math.Sqrt(variance/float64(len(amounts))), math.Max(m/10, 1))
+	z := (amount - m) / sd
+	if z < a.opts.Deviations {
+		return Finding{}, false
+	}
+	return Finding{Score: src.RoundCents(z)}, true
+}
+
+// merchantKey groups spellings of a merchant that differ only in case,
+// digits or punctuation ("STARBUCKS #1234", "Starbucks 5678"), per
+// currency.
+func merchantKey(t *store.Transaction) string {
+	return strings.ToUpper(t.Currency) + "|" + src.NormalizeMerchant(t.Merchant)
+}
+
+func categoryKey(t *store.Transaction) string {
+	return strings.ToUpper(t.Currency) + "|" + strings.ToLower(t.Category)
+}
+
+func mean(vs []float64) float64 {
+	if len(vs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+func money(v float64, currency string) string {
+	return strings.TrimSpace(fmt.Sprintf("%.2f %s", v, strings.ToUpper(currency)))
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	return d.Abs().Round(time.Second)
+}
@@ -0,0 +1,64 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestScore(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var history []store.Transaction
+	add := func(id uint64, merchant, category string, amount float64, on time.Time) {
+		history = append(history, store.Transaction{ID: id, Merchant: merchant, Category: category, Card: "Visa", Currency: "CAD", Amount: amount, OccurredAt: on})
+	}
+	for i, amount := range []float64{40, 45, 38, 42, 41} {
+		add(uint64(i+1), "Grocer #12", "food", amount, at.AddDate(0, 0, -7*(i+1)))
+	}
+	for i, amount := range []float64{20, 25, 22, 18} {
+		add(uint64(i+10), "Cafe "+string(rune('A'+i)), "dining", amount, at.AddDate(0, 0, -i-1))
+	}
+	add(20, "Rent", "", 1500, at.AddDate(0, -1, 0))
+	add(21, "Payroll", "", 3000, at.AddDate(0, 0, -3))
+	history[len(history)-1].Kind = store.KindIncome
+	a := New(history, Options{})
+
+	score := func(merchant, category string, amount float64, on time.Time) []Finding {
+		return a.Score(&store.Transaction{ID: 99, Merchant: merchant, Category: category, Card: "visa", Currency: "cad", Amount: amount, OccurredAt: on})
+	}
+	if got := score("GROCER #7", "food", 44, at); len(got) != 0 {
+		t.Errorf("usual grocery = %+v", got)
+	}
+	if got := score("Grocer #12", "food", 160, at); len(got) != 1 || got[0].Kind != KindMerchantOutlier || got[0].Score < 3 {
+		t.Errorf("large grocery = %+v", got)
+	}
+	if got := score("Cafe Z", "dining", 90, at); len(got) != 1 || got[0].Kind != KindCategoryOutlier {
+		t.Errorf("large dining at a new cafe = %+v", got)
+	}
+	if got := score("Electronics", "", 900, at); len(got) != 1 || got[0].Kind != KindNewMerchant || got[0].Score != 4.5 {
+		t.Errorf("new merchant = %+v", got)
+	}
+	if got := score("Payroll", "", 250, at); len(got) != 1 || got[0].Kind != KindNewMerchant {
+		t.Errorf("income is not a purchase history = %+v", got)
+	}
+
+	dup := &store.Transaction{ID: 30, Merchant: "Cafe A", Card: "Visa", Currency: "CAD", Amount: 7.5, OccurredAt: at}
+	a.Add(dup)
+	if got := score("CAFE A", "", 7.5, at.Add(4*time.Minute)); len(got) != 1 || got[0].Kind != KindDuplicate || got[0].RelatedID != 30 {
+		t.Errorf("duplicate = %+v", got)
+	}
+	if got := score("Cafe A", "", 7.5, at.Add(time.Hour)); len(got) != 0 {
+		t.Errorf("same charge an hour later = %+v", got)
+	}
+	if got := a.Score(&store.Transaction{ID: 31, Merchant: "Cafe A", Card: "Mastercard", Currency: "CAD", Amount: 7.5, OccurredAt: at}); len(got) != 0 {
+		t.Errorf("same charge on another card = %+v", got)
+	}
+}
+
+func TestScoreNeedsHistory(t *testing.T) {
+	a := New(nil, Options{})
+	if got := a.Score(&store.Transaction{Merchant: "Electronics", Currency: "CAD", Amount: 900}); len(got) != 0 {
+		t.Errorf("first purchases of a new user = %+v", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Command fxrates imports exchange-rate files into the bbolt store.
+// Run it while the server is stopped (bbolt holds an exclusive lock).
+//
+// Usage:
+//
+//	go run ./cli/fxrates -db ./data/transaction.db eurofxref-hist.xml
+//	go run ./cli/fxrates -format csv rates.csv
+//
+// The format is inferred from the file extension unless -format is
+// given. Re-importing the same file is a no-op; rates are upserted per
+// (pair, day).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.sirenko.ca/transaction/fx"
+	"code.sirenko.ca/transaction/server"
+	"code.sirenko.ca/transaction/store"
+)
+
+func main() {
+	dbPath := flag.String("db", "./data/transaction.db", "path to the bbolt file")
+	format := flag.String("format", "", "xml or csv (default: from file extension)")
+	source := flag.String("source", "ecb", "source label stored with CSV rates")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: fxrates [-db path] [-format xml|csv] [-source label] <file>...")
+		os.Exit(2)
+	}
+
+	s, err := store.Open(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+	if err := server.ApplyMigrationsBbolt(s); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		kind := *format
+		if kind == "" {
+			kind = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		}
+		var rates []store.ExchangeRate
+		switch kind {
+		case "xml":
+			rates, err = fx.ParseECBXML(f)
+		case "csv":
+			rates, err = fx.ParseCSV(f, *source)
+		default:
+			err = fmt.Errorf("unknown format %q (want xml or csv)", kind)
+		}
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		if err := s.PutExchangeRates(rates); err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		log.Printf("%s: imported %d rates", path, len(rates))
+	}
+}
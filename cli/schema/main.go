@@ -0,0 +1,161 @@
+// Command schema inspects and drives the bbolt migrations in
+// server/migrations_bbolt. Stop the server first: bbolt holds an
+// exclusive file lock.
+//
+// Examples:
+//
+//	go run ./cli/schema status
+//	go run ./cli/schema dry-run 004_comments
+//	go run ./cli/schema up
+//	go run ./cli/schema down --to 002_exchange_rates
+//
+// `up` and `down` write a backup next to the database before changing
+// anything.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"code.sirenko.ca/transaction/server"
+	"code.sirenko.ca/transaction/store"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	rest := os.Args[1:]
+
+	// Same convention as dbtool: -db <path> before the subcommand.
+	dbPath := "./data/transaction.db"
+	for len(rest) >= 2 && rest[0] == "-db" {
+		dbPath = rest[1]
+		rest = rest[2:]
+	}
+	if len(rest) < 1 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, args := rest[0], rest[1:]
+
+	s, err := store.Open(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	switch cmd {
+	case "status":
+		runStatus(s)
+	case "dry-run":
+		runDryRun(s, args)
+	case "up":
+		must(server.ApplyMigrationsBbolt(s))
+		runStatus(s)
+	case "down":
+		runDown(s, args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: schema [-db <path>] <command> [flags]
+
+commands:
+  status              list migrations, applied or pending, with timestamps
+  dry-run <version>   apply one migration in a rolled-back transaction and
+                      print what it would change
+  up                  apply all pending migrations
+  down --to <version> roll back every migration newer than <version>
+`)
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runStatus(s *store.Store) {
+	info, err := server.ReadSchemaInfo(s)
+	must(err)
+	if info.Writer != nil {
+		fmt.Printf("schema %s, last written by %s (built %s) at %s\n",
+			info.Version, info.Writer.GitCommit, info.Writer.BuildTime, info.Writer.At.Local().Format(time.DateTime))
+	}
+	for _, v := range info.Unknown {
+		fmt.Printf("unknown to this build: %s\n", v)
+	}
+
+	statuses, err := server.MigrationStatus(s)
+	must(err)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tDOWN")
+	for _, st := range statuses {
+		state, at := "pending", ""
+		if st.InProgress {
+			state = fmt.Sprintf("in progress (%d records)", st.Processed)
+		}
+		if st.Applied {
+			state = "applied"
+			at = "unknown"
+			if !st.AppliedAt.IsZero() {
+				at = st.AppliedAt.Local().Format(time.DateTime)
+			}
+		}
+		down := "no"
+		if st.Reversible {
+			down = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", st.Version, state, at, down)
+	}
+	w.Flush()
+}
+
+func runDryRun(s *store.Store, args []string) {
+	if len(args) != 1 {
+		log.Fatal("dry-run needs exactly one migration version")
+	}
+	changes, err := server.DryRunMigration(s, args[0])
+	must(err)
+	if len(changes) == 0 {
+		fmt.Println("no changes")
+		return
+	}
+	for _, c := range changes {
+		switch {
+		case c.Created:
+			fmt.Printf("+ bucket %s (%d keys)\n", c.Bucket, c.Added)
+		case c.Deleted:
+			fmt.Printf("- bucket %s (%d keys)\n", c.Bucket, c.Removed)
+		default:
+			fmt.Printf("~ bucket %s: +%d -%d ~%d keys\n", c.Bucket, c.Added, c.Removed, c.Modified)
+		}
+	}
+	fmt.Println("(rolled back; nothing was written)")
+}
+
+func runDown(s *store.Store, args []string) {
+	fs := flag.NewFlagSet("down", flag.ExitOnError)
+	to := fs.String("to", "", "roll back every migration newer than this version")
+	fs.Parse(args)
+	if *to == "" {
+		log.Fatal("down needs --to <version>")
+	}
+
+	must(server.BackupBeforeMigrate(s, "rollback"))
+	undone, err := server.RollbackMigrations(s, *to)
+	must(err)
+	for _, v := range undone {
+		fmt.Printf("rolled back %s\n", v)
+	}
+	runStatus(s)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -46,11 +47,30 @@ var (
 	BuildTime = "-"
 )
 
+// envDuration parses the environment variable name as a
+// time.Duration, falling back to def when it is unset or malformed.
+func envDuration(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		log.Printf("ignoring %s=%q: not a duration", name, v)
+	}
+	return def
+}
+
 func main() {
+	allowDowngrade := flag.Bool("allow-schema-downgrade", os.Getenv("ALLOW_SCHEMA_DOWNGRADE") == "1",
+		"start even if the database has migrations this build does not know (or set ALLOW_SCHEMA_DOWNGRADE=1)")
+	undoWindow := flag.Duration("undo-window", envDuration("UNDO_WINDOW", route.DefaultUndoWindow),
+		"how long undo tokens stay valid (or set UNDO_WINDOW)")
+	flag.Parse()
+
 	log.Printf("Init %s (built: %s)\n", GitCommit, BuildTime)
 
 	// Set the build time in the server package for use in route handlers
 	server.BuildTime = BuildTime
+	server.GitCommit = GitCommit
 
 	path := os.Getenv("BBOLT_PATH")
 	if path == "" {
@@ -62,11 +82,11 @@ func main() {
 	}
 	defer s.Close()
 
-	if err := server.ApplyMigrationsBbolt(s); err != nil {
+	if err := server.ApplyMigrationsBboltWith(s, server.MigrateOptions{AllowDowngrade: *allowDowngrade}); err != nil {
 		log.Fatal(err)
 	}
 
-	router := route.NewWithStore(s)
+	router := route.NewWithStore(s).WithUndoWindow(*undoWindow)
 
 	port := os.Getenv("PORT")
 	if port == "" {
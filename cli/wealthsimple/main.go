@@ -3,79 +3,56 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"strconv"
-	"time"
 
-	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/importer"
+	"code.sirenko.ca/transaction/rules"
+	"code.sirenko.ca/transaction/store"
 	"golang.org/x/sync/errgroup"
 
 	_ "github.com/lib/pq"
 )
 
-type Raw struct {
-	Node struct {
-		Amount     string `json:"amount"`
-		Currency   string `json:"currency"`
-		OccurredAt string `json:"occurredAt"`
-		Merchant   string `json:"spendMerchant"`
-		Sign       string `json:"amountSign"`
-	} `json:"node"`
-}
-
-func parseFile(filename string) ([]src.Transaction, error) {
-	content, err := os.ReadFile(filename)
+func parseFile(filename string, engine *rules.Engine) ([]importer.Row, error) {
+	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-
-	// Now let's unmarshall the data into `payload`
-	var payload []Raw
-	err = json.Unmarshal(content, &payload)
+	defer f.Close()
+	rows, err := importer.Wealthsimple{}.Parse(f)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", filename, err)
 	}
-
-	newTransactions := make([]src.Transaction, len(payload))
-	i := 0
-	k := 0
-	for i < len(payload) {
-		node := payload[i].Node
-		if node.Sign == "negative" {
-			date, err := time.Parse("2006-01-02T15:04:05.999999-07:00", node.OccurredAt)
-			if err != nil {
-				return nil, err
-			}
-			amount, err := strconv.ParseFloat(node.Amount, 64)
-			if err != nil {
-				return nil, err
-			}
-			newTransactions[k] = src.Transaction{
-				Amount:     amount,
-				Currency:   node.Currency,
-				OccurredAt: date,
-				Merchant:   node.Merchant,
-				Card:       "wealthsimple",
-				PersonName: "Vlad",
-			}
-			k += 1
-		}
-		i += 1
-	}
-	return newTransactions[:k], nil
+	importer.Categorize(rows, engine)
+	return rows, nil
 }
 
-func printTransaction(t src.Transaction) {
+func printTransaction(t importer.Row) {
 	fmt.Println(t.Amount, t.Currency, t.OccurredAt.Format("2006-01-02 15:04:05"), t.Merchant)
 }
 
-func loadTransactions(stmt *sql.Stmt, transactions <-chan src.Transaction, cancel func(cause error)) error {
+// addKindColumn adds the kind column to tables created before it
+// existed; their rows were all expenses.
+func addKindColumn(db *sql.DB) error {
+	_, err := db.Exec("ALTER TABLE transactions ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT '" + store.KindExpense + "'")
+	return err
+}
+
+func getStatement(db *sql.DB) (*sql.Stmt, error) {
+	return db.Prepare("INSERT INTO transactions(amount, currency, occurred_at, merchant, card, category, person_name, kind) VALUES($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT (merchant, occurred_at) DO UPDATE SET amount = $1, currency = $2, card = $5, category = $6, person_name = $7, kind = $8")
+}
+
+func insertTransaction(stmt *sql.Stmt, t importer.Row) error {
+	_, err := stmt.Exec(t.Amount, t.Currency, t.OccurredAt, t.Merchant, t.Card, t.Category, "Vlad", t.Kind)
+	return err
+}
+
+func loadTransactions(stmt *sql.Stmt, transactions <-chan importer.Row, cancel func(cause error)) error {
 	for t := range transactions {
 		printTransaction(t)
-		err := src.InsertTransaction(stmt, t)
+		err := insertTransaction(stmt, t)
 		fmt.Println("transaction finished", err)
 		if err != nil {
 			log.Println(err)
@@ -88,9 +65,9 @@ func loadTransactions(stmt *sql.Stmt, transactions <-chan src.Transaction, cance
 	return nil
 }
 
-func load(listTransactions chan<- src.Transaction, ctx context.Context, filename string) func() error {
+func load(listTransactions chan<- importer.Row, ctx context.Context, filename string, engine *rules.Engine) func() error {
 	return func() error {
-		ts, err := parseFile(filename)
+		ts, err := parseFile(filename, engine)
 		if err != nil {
 			return err
 		}
@@ -113,13 +90,21 @@ func main() {
 	}
 	defer db.Close()
 
-	stmt, err := src.GetStatement(db)
+	if err := addKindColumn(db); err != nil {
+		log.Fatal(err)
+	}
+	stmt, err := getStatement(db)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer stmt.Close()
 
-	listTransactions := make(chan src.Transaction)
+	engine, err := rules.Compile(rules.Defaults)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listTransactions := make(chan importer.Row)
 	ctx, cancel := context.WithCancelCause(context.Background())
 	var gr errgroup.Group
 	gr.Go(func() error { return loadTransactions(stmt, listTransactions, cancel) })
@@ -127,10 +112,10 @@ func main() {
 	gr.Go(func() error {
 		defer close(listTransactions)
 		var gr2 errgroup.Group
-		gr2.Go(load(listTransactions, ctx, "data/t1.json"))
-		gr2.Go(load(listTransactions, ctx, "data/t2.json"))
-		gr2.Go(load(listTransactions, ctx, "data/t3.json"))
-		gr2.Go(load(listTransactions, ctx, "data/t4.json"))
+		gr2.Go(load(listTransactions, ctx, "data/t1.json", engine))
+		gr2.Go(load(listTransactions, ctx, "data/t2.json", engine))
+		gr2.Go(load(listTransactions, ctx, "data/t3.json", engine))
+		gr2.Go(load(listTransactions, ctx, "data/t4.json", engine))
 		err := gr2.Wait()
 		return err
 	})
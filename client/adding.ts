@@ -2,16 +2,19 @@ import van, { type ChildDom, type State } from "vanjs-core";
 import "./adding.css";
 import {
 	addTransactions,
+	type BalanceSnapshot,
 	categories,
 	categoryRules,
-	getDateStr,
+	commitImport,
+	getDateTimeStr,
+	type ImportFormat,
+	type ImportPreviewRow,
 	loggedIn,
 	type NewTransaction,
+	previewImport,
 	subGroupMap,
-	transactions,
 	updateSetting,
 } from "./common.ts";
-import { type Categories, defaultCategoriesMap } from "./const.ts";
 
 const { div, span, p, input, button, option, select, textarea, label, a } =
 	van.tags;
@@ -25,6 +28,8 @@ const LabeledField = (labelText: string, field: ChildDom, className?: string) =>
 
 // Parsed transaction shape used in import modal.
 // Tags are stored as comma-separated string in the UI and converted to array on save.
+// Parsing, categorization and duplicate detection happen on the server
+// (POST /api/v1/imports/preview) so every client imports the same way.
 type ParsedImportRow = {
 	datetime: string;
 	merchant: string;
@@ -32,241 +37,58 @@ type ParsedImportRow = {
 	category: string;
 	card?: string;
 	tags: string;
+	currency: string;
+	kind?: NewTransaction["kind"];
+	details?: string;
+	fitid?: string;
+	mcc?: string;
+	duplicate: boolean;
 };
 
-function parseCSV(data: string): ParsedImportRow[] {
-	const lines = data.trim().split("\n");
-	if (lines.length < 1) {
-		return [];
-	}
-	const header = lines
-		.shift()!
-		.split(",")
-		.map((h) => h.trim().toLowerCase());
-
-	const transactions = lines.map((line) => {
-		const values = line.split(",");
-		const row: { [key: string]: string } = {};
-		header.forEach((key, i) => {
-			row[key] = values[i] ? values[i].trim() : "";
-		});
-		return row;
-	});
-
-	return transactions.map((t) => {
-		const amountStr = t.amount || t.debit || t.credit;
-		let amount = parseFloat(amountStr || "0");
-		if (t.debit && amount > 0) {
-			amount = -amount;
-		}
-
-		let datetime = t.datetime || t.date || "";
-		if (datetime && !datetime.includes("T")) {
-			const d = new Date(datetime);
-			if (!isNaN(d.getTime())) {
-				const year = d.getFullYear();
-				const month = (d.getMonth() + 1).toString().padStart(2, "0");
-				const day = d.getDate().toString().padStart(2, "0");
-				datetime = `${year}-${month}-${day}T00:00`;
-			}
-		}
-
-		return {
-			datetime,
-			merchant: t.merchant || t.description || "",
-			amount: amount || 0,
-			category: t.category || "",
-			tags: t.tags || "",
-		} satisfies ParsedImportRow;
-	});
-}
-
-const cibcMerchant: Record<string, Categories> = {
-	"0001": "home goods",
-	"0002": "unknown",
-	"0004": "transportation",
-	"0005": "hotel",
-	"0003": "food & other",
-	"0006": "takeouts",
-	"0007": "home goods",
-	"0008": "health",
-	"0009": "unknown",
-	"0010": "unknown",
-	"0011": "unknown",
+type ParsedImport = {
+	format: ImportFormat;
+	fileHash: string;
+	rows: ParsedImportRow[];
+	balances?: BalanceSnapshot[];
 };
 
-function categoryFallback(merchantCategoryId: string): Categories {
-	return cibcMerchant[merchantCategoryId] || "unknown";
-}
-
-function parseCIBC(data: string): ParsedImportRow[] {
-	let payload: any[] = [];
-
-	try {
-		const parsed = JSON.parse(data);
-		if (Array.isArray(parsed)) {
-			payload = parsed;
-		} else if (parsed && Array.isArray(parsed.transactions)) {
-			payload = parsed.transactions;
-		} else {
-			console.error("Unexpected CIBC payload format");
-			return [];
-		}
-	} catch (e) {
-		console.error("Failed to parse CIBC JSON", e);
-		return [];
-	}
-
-	return payload
-		.filter((e) => e.descriptionLine1 !== "PAYMENT THANK YOU/PAIEMEN")
-		.filter((e) => e.pendingIndicator !== true)
-		.map((item) => {
-			const merchant = item.descriptionLine1.includes("E-TRANSFER")
-				? item.descriptionLine2
-				: item.descriptionLine1 || item.transactionDescription || "";
-			const categoryFromMap = getCategory(merchant);
-			const category =
-				categoryFromMap && categoryFromMap !== "unknown"
-					? categoryFromMap
-					: categoryFallback(item.merchantCategoryId);
-
-			let amount = 0;
-			if (item.debit != null) {
-				amount = Math.abs(Number(item.debit) || 0);
-			} else if (item.credit != null) {
-				amount = -Math.abs(Number(item.credit) || 0);
-			}
-
-			let datetime = item.date || item.postedDate || "";
-			if (datetime) {
-				const d = new Date(datetime.split("T")[0] + "T00:00");
-				if (!isNaN(d.getTime())) {
-					const year = d.getFullYear();
-					const month = (d.getMonth() + 1).toString().padStart(2, "0");
-					const day = d.getDate().toString().padStart(2, "0");
-					const hours = d.getHours().toString().padStart(2, "0");
-					const minutes = d.getMinutes().toString().padStart(2, "0");
-					datetime = `${year}-${month}-${day}T${hours}:${minutes}`;
-				}
-			}
-
-			return {
-				datetime,
-				merchant,
-				amount,
-				category,
-				card: "cibc",
-				tags: "",
-			} satisfies ParsedImportRow;
-		});
-}
-
-function getCategory(merchant: string): Categories {
-	for (const [category, merchants] of Object.entries(categoryRules.val)) {
-		for (const pattern of merchants) {
-			if (merchant.toLowerCase().includes(pattern.toLowerCase())) {
-				return category as Categories;
-			}
-		}
-	}
-	// Fallback to defaults if not found in dynamic rules
-	for (const [category, merchants] of Object.entries(defaultCategoriesMap)) {
-		for (const pattern of merchants) {
-			if (merchant.toLowerCase().includes(pattern.toLowerCase())) {
-				return category as Categories;
-			}
-		}
-	}
-	return "unknown";
-}
-
-function parseWealthsimple(data: string): ParsedImportRow[] {
-	const payload = JSON.parse(data) as {
-		node: {
-			amountSign: string;
-			amount: string;
-			occurredAt: string;
-			spendMerchant?: string;
-			eTransferName?: string;
-			type: string;
-			unifiedStatus: string; // "PENDING", "COMPLETED"
-		};
-	}[];
-
-	return payload
-		.filter((e) => e.node.unifiedStatus !== "PENDING")
-		.map((item) => {
-			const node = item.node;
-			if (["CREDIT_CARD_PAYMENT", "DEPOSIT"].includes(node.type)) {
-				console.log("skip 1", node);
-				return null;
-			}
-			let amount = parseFloat(node.amount);
-			if (node.amountSign === "positive") {
-				amount = -amount;
-			}
-
-			const d = new Date(node.occurredAt);
-			const year = d.getFullYear();
-			const month = (d.getMonth() + 1).toString().padStart(2, "0");
-			const day = d.getDate().toString().padStart(2, "0");
-			const hours = d.getHours().toString().padStart(2, "0");
-			const minutes = d.getMinutes().toString().padStart(2, "0");
-			const datetime = `${year}-${month}-${day}T${hours}:${minutes}`;
-
-			const merchant =
-				node.spendMerchant ||
-				node.eTransferName ||
-				(node.type === "INTEREST" && "Interest") ||
-				(node.type === "REIMBURSEMENT" && "Cashback");
-			if (!merchant) {
-				console.log("skip 2", node);
-				return null;
-			}
-			const category = getCategory(merchant);
-
-			return {
-				datetime,
-				merchant,
-				amount,
-				category,
-				card: "wealthsimple",
-				tags: "",
-			} satisfies ParsedImportRow;
-		})
-		.filter((e) => !!e);
-}
-
-function buildExistingIndex(existing: NewTransaction[]): Set<string> {
-	const index = new Set<string>();
-
-	for (const tx of existing) {
-		if (!tx.occurredAt || tx.amount == null || !tx.merchant) continue;
-		const date = getDateStr(new Date(tx.occurredAt));
-		const amt = Number(tx.amount).toFixed(2);
-		const merchant = tx.merchant.trim().toLowerCase();
-		const cardKey = (tx.card || "").trim().toLowerCase();
-		index.add(`${date}|${amt}|${merchant}|${cardKey}`);
-	}
-
-	return index;
+function toParsedRow(row: ImportPreviewRow): ParsedImportRow {
+	return {
+		datetime: getDateTimeStr(new Date(row.occurredAt)),
+		merchant: row.merchant,
+		amount: row.amount,
+		category: row.category,
+		card: row.card,
+		tags: row.tags.join(", "),
+		currency: row.currency,
+		kind: row.kind,
+		details: row.details ?? undefined,
+		fitid: row.fitid,
+		mcc: row.mcc,
+		duplicate: row.duplicate,
+	};
 }
 
-function isDuplicateImport(row: ParsedImportRow, index: Set<string>): boolean {
-	if (!row.datetime || row.amount == null || !row.merchant) return false;
-	const date = getDateStr(new Date(row.datetime));
-	const amt = Number(row.amount).toFixed(2);
-	const merchant = row.merchant.trim().toLowerCase();
-	const cardKey = (row.card || "").trim().toLowerCase();
-	return index.has(`${date}|${amt}|${merchant}|${cardKey}`);
+async function parseImport(
+	format: ImportFormat,
+	data: string,
+): Promise<ParsedImport | null> {
+	const preview = await previewImport(format, data);
+	if (!preview) return null;
+	return {
+		format: preview.format,
+		fileHash: preview.fileHash,
+		rows: preview.rows.map(toParsedRow),
+		balances: preview.balances,
+	};
 }
 
 function renderParsedTransactions(
-	data: ParsedImportRow[],
+	parsed: ParsedImport,
 	card: string | undefined,
 	openImportModal: State<boolean>,
-	existingTransactions: NewTransaction[],
 ) {
+	const data = parsed.rows;
 	const container = div();
 
 	const allTagsInput = input({ type: "text", placeholder: "Add tag to all" });
@@ -291,12 +113,10 @@ function renderParsedTransactions(
 		"Add Tag to All",
 	);
 
-	const duplicateIndex = buildExistingIndex(existingTransactions);
-
 	const list = div(
 		{ class: "import-transactions-list" },
-		...data.map((item) => {
-			const isDup = isDuplicateImport(item, duplicateIndex);
+		...data.map((item, index) => {
+			const isDup = item.duplicate;
 
 			const merchantInput = input({
 				type: "text",
@@ -335,6 +155,7 @@ function renderParsedTransactions(
 			const root = div(
 				{
 					class: `import-transaction-item${isDup ? " import-transaction-duplicate" : ""}`,
+					"data-index": index,
 				},
 				div(
 					{ class: "import-transaction-row" },
@@ -390,6 +211,7 @@ function renderParsedTransactions(
 
 				rows.forEach((rowEl) => {
 					const row = rowEl as HTMLElement;
+					const item = data[Number(row.dataset.index)];
 
 					// Skip rows already marked as duplicate
 					if (row.classList.contains("import-transaction-duplicate")) {
@@ -438,13 +260,17 @@ function renderParsedTransactions(
 						amount,
 						category,
 						tags,
-						currency: "CAD",
+						currency: item.currency,
+						kind: item.kind,
+						details: item.details,
+						fitid: item.fitid,
+						mcc: item.mcc,
 						card: cardValue,
 					});
 				});
 
 				if (transactionsToSave.length > 0) {
-					addTransactions(transactionsToSave).then(() => {
+					commitImport(parsed, transactionsToSave).then(() => {
 						openImportModal.val = false;
 					});
 				}
@@ -731,7 +557,7 @@ const openNewTransactionModal = van.state(false);
 const openScanReceiptModal = van.state(false);
 const openImportModal = van.state(false);
 const openSettingsModal = van.state(false);
-const externalImportData = van.state<ParsedImportRow[] | null>(null);
+const externalImportData = van.state<unknown[] | null>(null);
 
 export function SettingsModal() {
 	const active = van.state<"categories_map" | "subgroup_map">("categories_map");
@@ -822,8 +648,10 @@ export function setupAdding() {
 	const ImportModalComponent = () => {
 		if (!openImportModal.val) return "";
 
-		const active = van.state<"Wealthsimple" | "CSV" | "CIBC">("Wealthsimple");
-		const parsedDataState = van.state<ParsedImportRow[]>([]);
+		const active = van.state<"Wealthsimple" | "CSV" | "CIBC" | "OFX">(
+			"Wealthsimple",
+		);
+		const parsedDataState = van.state<ParsedImport | null>(null);
 
 		const Tab = (type: typeof active.val, ...children: ChildDom[]) =>
 			div(
@@ -832,9 +660,11 @@ export function setupAdding() {
 			);
 
 		// Initialize parsedDataState if external data exists
-		if (externalImportData.val && parsedDataState.val.length === 0) {
+		if (externalImportData.val && !parsedDataState.val) {
 			const rawWealthsimple = JSON.stringify(externalImportData.val);
-			parsedDataState.val = parseWealthsimple(rawWealthsimple);
+			parseImport("wealthsimple", rawWealthsimple).then((parsed) => {
+				parsedDataState.val = parsed;
+			});
 		}
 
 		const wealthsimpleInput = textarea({
@@ -848,21 +678,22 @@ export function setupAdding() {
 		const csvInput = textarea({
 			id: "csv-input",
 			placeholder:
-				"2024-01-01,The Coffee Shop,-3.50,Food,coffee\n2024-01-02,Book Store,-25.00,Shopping,books",
+				"date,merchant,amount,category,tags\n2024-01-01,The Coffee Shop,3.50,Food,coffee\n2024-01-02,Book Store,25.00,Shopping,books",
 		});
 
-		const parseData = (
-			inputEl: HTMLTextAreaElement,
-			parser: (data: string) => ParsedImportRow[],
-		) => {
-			return () => {
+		const ofxInput = input({
+			type: "file",
+			id: "ofx-input",
+			accept: ".ofx,.qfx",
+		});
+
+		const parseData = (inputEl: HTMLTextAreaElement, format: ImportFormat) => {
+			return async () => {
 				const data = inputEl.value;
-				parsedDataState.val = parser(data);
+				parsedDataState.val = await parseImport(format, data);
 			};
 		};
 
-		const existing = transactions?.val || [];
-
 		const modal = div(
 			{
 				id: "import-modal",
@@ -890,7 +721,7 @@ export function setupAdding() {
 				),
 				div(
 					{ class: "tab-container" },
-					(["Wealthsimple", "CIBC", "CSV"] as const).map((type) =>
+					(["Wealthsimple", "CIBC", "CSV", "OFX"] as const).map((type) =>
 						div(
 							{
 								class: () => `tab${active.val === type ? " active" : ""}`,
@@ -912,7 +743,7 @@ export function setupAdding() {
 							class: "apply-btn",
 							onclick: parseData(
 								wealthsimpleInput as HTMLTextAreaElement,
-								parseWealthsimple,
+								"wealthsimple",
 							),
 						},
 						"Preview",
@@ -925,7 +756,7 @@ export function setupAdding() {
 						{
 							id: "parse-cibc-btn",
 							class: "apply-btn",
-							onclick: parseData(cibcInput as HTMLTextAreaElement, parseCIBC),
+							onclick: parseData(cibcInput as HTMLTextAreaElement, "cibc"),
 						},
 						"Preview",
 					),
@@ -944,18 +775,34 @@ export function setupAdding() {
 						{
 							id: "parse-csv-btn",
 							class: "apply-btn",
-							onclick: parseData(csvInput as HTMLTextAreaElement, parseCSV),
+							onclick: parseData(csvInput as HTMLTextAreaElement, "csv"),
+						},
+						"Preview",
+					),
+				),
+				Tab(
+					"OFX",
+					p("Upload an OFX or QFX statement from your bank."),
+					ofxInput,
+					button(
+						{
+							id: "parse-ofx-btn",
+							class: "apply-btn",
+							onclick: async () => {
+								const file = (ofxInput as HTMLInputElement).files?.[0];
+								if (!file) return;
+								parsedDataState.val = await parseImport("ofx", await file.text());
+							},
 						},
 						"Preview",
 					),
 				),
 				div({ id: "parsed-transactions-container" }, () =>
-					parsedDataState.val.length > 0
+					parsedDataState.val && parsedDataState.val.rows.length > 0
 						? renderParsedTransactions(
 							parsedDataState.val,
 							undefined,
 							openImportModal,
-							existing,
 						)
 						: "",
 				),
@@ -17,6 +17,14 @@ export type Transaction = {
 	tags: string[];
 	details?: string;
 	photos?: string[];
+	kind?: "expense" | "income" | "refund" | "transfer";
+	refundOf?: number;
+	commentCount?: number;
+	baseAmount?: number;
+	exchangeRate?: number;
+	fitid?: string;
+	// mcc is the merchant category code, when the source had one.
+	mcc?: string;
 };
 
 export const loggedIn = van.state(!!localStorage.getItem("token"));
@@ -180,6 +188,138 @@ export const filteredTransactions = van.derive(() => {
 	});
 });
 
+export type ImportFormat = "csv" | "cibc" | "wealthsimple" | "ofx";
+
+// A parsed import row, as returned by POST /api/v1/imports/preview.
+// duplicate is set when the transaction is already stored.
+export type ImportPreviewRow = NewTransaction & { duplicate: boolean };
+
+// The response of POST /api/v1/imports/preview. format and fileHash go
+// back with the commit and are recorded on its import batch.
+export type ImportPreview = {
+	format: ImportFormat;
+	fileHash: string;
+	rows: ImportPreviewRow[];
+	duplicates: number;
+	// balances are the statement balances, for formats that carry them.
+	balances?: BalanceSnapshot[];
+};
+
+export type BalanceSnapshot = {
+	account: string;
+	balance: number;
+	currency: string;
+	on: string;
+};
+
+// previewImport sends raw export data to the server's importer, which
+// parses, categorizes and flags duplicates. Nothing is stored.
+export async function previewImport(
+	format: ImportFormat,
+	data: string,
+): Promise<ImportPreview | null> {
+	if (!token.val) {
+		error.val = "Not logged in";
+		return null;
+	}
+	const form = new FormData();
+	form.append("file", new Blob([data]), "import");
+	try {
+		const response = await fetch(`/api/v1/imports/preview?format=${format}`, {
+			method: "POST",
+			headers: { Authorization: `Bearer ${token.val}` },
+			body: form,
+		});
+		if (response.status === 401) {
+			token.val = "";
+			error.val = "Session expired. Please log in again.";
+			return null;
+		}
+		const body = await response.json();
+		if (!response.ok) {
+			throw new Error(`Failed to parse import: ${body.error?.message}`);
+		}
+		return body;
+	} catch (e: any) {
+		error.val = e.message;
+		return null;
+	}
+}
+
+// commitImport stores previewed rows as one import batch, tagged with
+// the preview's format and file hash; the server skips any that are
+// already stored. The preview's statement balances are kept as
+// snapshots.
+export async function commitImport(
+	preview: Pick<ImportPreview, "format" | "fileHash" | "balances">,
+	rows: NewTransaction[],
+) {
+	if (!token.val) {
+		error.val = "Not logged in";
+		return;
+	}
+	try {
+		const response = await fetch("/api/v1/imports/commit", {
+			method: "POST",
+			headers: {
+				"Content-Type": "application/json",
+				Authorization: `Bearer ${token.val}`,
+			},
+			body: JSON.stringify({
+				source: preview.format,
+				fileHash: preview.fileHash,
+				transactions: rows,
+				balances: preview.balances ?? [],
+			}),
+		});
+		if (response.status === 401) {
+			token.val = "";
+			error.val = "Session expired. Please log in again.";
+			return;
+		}
+		if (!response.ok) {
+			const body = await response.json();
+			throw new Error(`Failed to import transactions: ${body.error?.message}`);
+		}
+		await fetchTransactions();
+	} catch (e: any) {
+		error.val = e.message;
+	}
+}
+
+export type MerchantSuggestion = {
+	merchant: string;
+	uses: number;
+	lastUsed: string;
+	category?: string;
+	tags: string[];
+	amount: number;
+	currency?: string;
+	kind: string;
+};
+
+// suggestMerchants completes a merchant name from the caller's and
+// connected users' history, most used and most recent first, with what
+// the latest transaction there was filed as. Failures give no
+// suggestions.
+export async function suggestMerchants(
+	q: string,
+	limit = 10,
+): Promise<MerchantSuggestion[]> {
+	if (!token.val) return [];
+	try {
+		const params = new URLSearchParams({ q, limit: String(limit) });
+		const response = await fetch(`/api/v1/merchants/suggest?${params}`, {
+			headers: { Authorization: `Bearer ${token.val}` },
+		});
+		if (!response.ok) return [];
+		return await response.json();
+	} catch (e) {
+		console.error("Failed to suggest merchants", e);
+		return [];
+	}
+}
+
 export async function fetchSettings() {
 	if (!token.val) return;
 	try {
@@ -3,8 +3,10 @@ import {
 	categories,
 	fetchTransactions,
 	merchants,
+	suggestMerchants,
 	token,
 	transactions,
+	type MerchantSuggestion,
 	type Transaction,
 } from "./common.ts";
 import "./popup.css";
@@ -348,6 +350,7 @@ export function TransactionPopup() {
 								const suggestion = van.state("");
 								const matches = van.state<string[]>([]);
 								const matchIndex = van.state(-1);
+								const details = new Map<string, MerchantSuggestion>();
 
 								const updateSuggestions = (val: string) => {
 									if (!val) {
@@ -357,21 +360,48 @@ export function TransactionPopup() {
 										return;
 									}
 
-									const all = merchants.val;
-									const ms = all.filter(
-										(m) =>
-											m.toLowerCase().startsWith(val.toLowerCase()) &&
-											m.toLowerCase() !== val.toLowerCase(),
-									);
-									matches.val = ms;
-
-									if (ms.length > 0) {
-										matchIndex.val = 0;
-										suggestion.val = ms[0]!.substring(val.length);
-									} else {
-										matchIndex.val = -1;
-										suggestion.val = "";
+									const show = (all: string[]) => {
+										const ms = all.filter(
+											(m) =>
+												m.toLowerCase().startsWith(val.toLowerCase()) &&
+												m.toLowerCase() !== val.toLowerCase(),
+										);
+										matches.val = ms;
+
+										if (ms.length > 0) {
+											matchIndex.val = 0;
+											suggestion.val = ms[0]!.substring(val.length);
+										} else {
+											matchIndex.val = -1;
+											suggestion.val = "";
+										}
+									};
+									// Complete from the loaded transactions at once, then
+									// from the server's ranking, which also knows older
+									// and connected users' merchants.
+									show(merchants.val);
+									suggestMerchants(val).then((found) => {
+										if (merchant.val !== val || found.length === 0) return;
+										for (const f of found) {
+											details.set(f.merchant.toLowerCase(), f);
+										}
+										show(found.map((f) => f.merchant));
+									});
+								};
+
+								// accept completes the merchant and fills the fields
+								// still empty from its latest transaction.
+								const accept = () => {
+									merchant.val += suggestion.val;
+									suggestion.val = "";
+									matches.val = [];
+									const last = details.get(merchant.val.toLowerCase());
+									if (!last) return;
+									if (!category.val && last.category) {
+										category.val = last.category;
 									}
+									if (tags.val.length === 0) tags.val = [...last.tags];
+									if (!amount.val) amount.val = last.amount;
 								};
 
 								return div(
@@ -393,9 +423,7 @@ export function TransactionPopup() {
 										onkeydown: (e: KeyboardEvent) => {
 											if (e.key === "Tab" && suggestion.val) {
 												e.preventDefault();
-												merchant.val += suggestion.val;
-												suggestion.val = "";
-												matches.val = [];
+												accept();
 											} else if (
 												(e.key === "ArrowDown" || e.key === "ArrowUp") &&
 												matches.val.length > 1
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultColumns are the CSV columns used when Options.Columns is nil.
+var DefaultColumns = []string{"date", "merchant", "amount", "currency", "category", "tags", "card", "details"}
+
+// csvColumns maps each column name accepted in Options.Columns to how
+// it is rendered.
+var csvColumns = map[string]func(*Record, Options) string{
+	"id":       func(r *Record, _ Options) string { return strconv.FormatUint(r.ID, 10) },
+	"date":     func(r *Record, _ Options) string { return r.OccurredAt.Format("2006-01-02") },
+	"time":     func(r *Record, _ Options) string { return r.OccurredAt.Format(time.RFC3339) },
+	"kind":     func(r *Record, _ Options) string { return r.KindOrDefault() },
+	"amount":   func(r *Record, _ Options) string { return formatAmount(r.Amount) },
+	"currency": func(r *Record, o Options) string { return o.currency(r) },
+	"merchant": func(r *Record, _ Options) string { return r.Merchant },
+	"card":     func(r *Record, _ Options) string { return r.Card },
+	"category": func(r *Record, _ Options) string { return r.Category },
+	"tags":     func(r *Record, _ Options) string { return strings.Join(r.Tags, ";") },
+	"details":  func(r *Record, _ Options) string { return r.Details },
+	"mcc":      func(r *Record, _ Options) string { return r.MCC },
+	"person":   func(r *Record, _ Options) string { return r.Person },
+	"account":  func(r *Record, o Options) string { return o.Accounts.Category(r) },
+	"refundOf": func(r *Record, _ Options) string {
+		if r.RefundOf == 0 {
+			return ""
+		}
+		return strconv.FormatUint(r.RefundOf, 10)
+	},
+}
+
+// ValidateColumns reports the first name in cols that is not a CSV
+// column.
+func ValidateColumns(cols []string) error {
+	for _, c := range cols {
+		if _, ok := csvColumns[c]; !ok {
+			return fmt.Errorf("export: unknown column %q", c)
+		}
+	}
+	return nil
+}
+
+// writeCSV writes a header row of column names, then one row per
+// record. Tags are joined with ";".
+func writeCSV(w io.Writer, recs []Record, opts Options) error {
+	cols := opts.Columns
+	if cols == nil {
+		cols = DefaultColumns
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return err
+	}
+	row := make([]string, len(cols))
+	for i := range recs {
+		for j, c := range cols {
+			row[j] = csvColumns[c](&recs[i], opts)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,256 @@
+// Package export renders transactions in formats other tools import:
+//
+//   - CSV with a configurable list of columns
+//   - OFX 2.x, one statement per card and currency
+//   - QIF, one account section per card
+//   - ledger, hledger and beancount journals
+//
+// The journal formats are double-entry: every transaction becomes a
+// posting to the account its category maps to (see Accounts) balanced
+// against the account of the card it was paid with. Tags become ledger
+// tags, hledger tags or beancount tags and the transaction ID, person
+// and details become metadata.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Formats accepted by Write.
+const (
+	FormatCSV       = "csv"
+	FormatOFX       = "ofx"
+	FormatQIF       = "qif"
+	FormatLedger    = "ledger"
+	FormatHledger   = "hledger"
+	FormatBeancount = "beancount"
+)
+
+// ErrUnknownFormat is returned by Write for a format not in Formats.
+var ErrUnknownFormat = errors.New("export: unknown format")
+
+// Record is one transaction to export, with what the store keeps
+// outside the transaction row.
+type Record struct {
+	store.Transaction
+	Tags []string
+	// Person is the owner's PersonName.
+	Person string
+}
+
+// Balance is an account's balance at the end of the day On, as in
+// store.BalanceSnapshot. Account is a card name.
+type Balance struct {
+	Account  string
+	Amount   float64
+	Currency string
+	On       time.Time
+}
+
+// Options tune the output. The zero value is usable.
+type Options struct {
+	// Columns are the CSV columns, in order; nil means DefaultColumns.
+	Columns []string
+	// Accounts maps categories and cards to journal accounts.
+	Accounts Accounts
+	// Currency is used for records that have none. Default CAD.
+	Currency string
+	// Now stamps the OFX signon response. Default time.Now().
+	Now time.Time
+	// Balances become balance assertions in the journals and the
+	// LEDGERBAL of the matching OFX statement.
+	Balances []Balance
+}
+
+func (o Options) currency(r *Record) string {
+	if r.Currency != "" {
+		return strings.ToUpper(r.Currency)
+	}
+	if o.Currency != "" {
+		return o.Currency
+	}
+	return store.DefaultBaseCurrency
+}
+
+func (o Options) balanceCurrency(b *Balance) string {
+	if b.Currency != "" {
+		return strings.ToUpper(b.Currency)
+	}
+	return o.currency(&Record{})
+}
+
+type format struct {
+	contentType string
+	ext         string
+	write       func(io.Writer, []Record, Options) error
+}
+
+var formats = map[string]format{
+	FormatCSV:       {"text/csv; charset=utf-8", "csv", writeCSV},
+	FormatOFX:       {"application/x-ofx", "ofx", writeOFX},
+	FormatQIF:       {"application/qif", "qif", writeQIF},
+	FormatLedger:    {"text/plain; charset=utf-8", "ledger", writeLedger},
+	FormatHledger:   {"text/plain; charset=utf-8", "journal", writeHledger},
+	FormatBeancount: {"text/plain; charset=utf-8", "beancount", writeBeancount},
+}
+
+// Formats lists the format names Write accepts, sorted.
+func Formats() []string {
+	out := make([]string, 0, len(formats))
+	for name := range formats {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ContentType and Extension describe a format for an HTTP response.
+// Both return "" for an unknown format.
+func ContentType(name string) string { return formats[name].contentType }
+func Extension(name string) string   { return formats[name].ext }
+
+// Write renders recs in the named format. Records are written oldest
+// first regardless of their order in recs.
+func Write(w io.Writer, name string, recs []Record, opts Options) error {
+	f, ok := formats[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownFormat, name)
+	}
+	if name == FormatCSV {
+		if err := ValidateColumns(opts.Columns); err != nil {
+			return err
+		}
+	}
+	opts.Balances = append([]Balance(nil), opts.Balances...)
+	sort.SliceStable(opts.Balances, func(i, j int) bool { return opts.Balances[i].On.Before(opts.Balances[j].On) })
+	sorted := append([]Record(nil), recs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].OccurredAt.Equal(sorted[j].OccurredAt) {
+			return sorted[i].OccurredAt.Before(sorted[j].OccurredAt)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return f.write(w, sorted, opts)
+}
+
+// Accounts maps transactions to journal accounts. A transaction posts
+// to its category account and balances against its card account.
+//
+// The category account is Categories[category] if set, otherwise the
+// category under the root for its kind: Expenses (expenses and
+// refunds), Income or Transfers. The card account is Cards[card] if
+// set, otherwise the card under CardRoot, or Cash for transactions
+// without a card. Empty fields take the defaults in the field docs.
+//
+// The JSON form is what the export_accounts setting holds.
+type Accounts struct {
+	// Expenses is the root for expense and refund categories. Default
+	// "Expenses".
+	Expenses string `json:"expenses,omitempty"`
+	// Income is the root for income categories. Default "Income".
+	Income string `json:"income,omitempty"`
+	// Transfers is the root for transfer categories. Default
+	// "Assets:Transfers".
+	Transfers string `json:"transfers,omitempty"`
+	// CardRoot is the root for card accounts. Default
+	// "Liabilities:Cards".
+	CardRoot string `json:"cardRoot,omitempty"`
+	// Cash is the account of transactions with no card. Default
+	// "Assets:Cash".
+	Cash string `json:"cash,omitempty"`
+
+	Categories map[string]string `json:"categories,omitempty"`
+	Cards      map[string]string `json:"cards,omitempty"`
+}
+
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// Category returns the account r's category maps to.
+func (a Accounts) Category(r *Record) string {
+	if acct, ok := a.Categories[r.Category]; ok && acct != "" {
+		return acct
+	}
+	root := or(a.Expenses, "Expenses")
+	switch r.KindOrDefault() {
+	case store.KindIncome:
+		root = or(a.Income, "Income")
+	case store.KindTransfer:
+		root = or(a.Transfers, "Assets:Transfers")
+	}
+	return root + ":" + accountName(or(r.Category, "Uncategorized"))
+}
+
+// Card returns the account r was paid from or into.
+func (a Accounts) Card(r *Record) string {
+	return a.card(r.Card)
+}
+
+func (a Accounts) card(name string) string {
+	if acct, ok := a.Cards[name]; ok && acct != "" {
+		return acct
+	}
+	if name == "" {
+		return or(a.Cash, "Assets:Cash")
+	}
+	return or(a.CardRoot, "Liabilities:Cards") + ":" + accountName(name)
+}
+
+// posting is the amount posted to the category account; the card
+// account gets its negation. Expenses and transfers move Amount out of
+// the card as stored (a negative expense is a credit), refunds always
+// move money back in and income always comes in.
+func posting(r *Record) float64 {
+	switch r.KindOrDefault() {
+	case store.KindRefund, store.KindIncome:
+		return -math.Abs(r.Amount)
+	}
+	return r.Amount
+}
+
+// accountName turns s into one account name component: letters and
+// digits are kept, runs of anything else become "-", and the first
+// letter is upper-cased as ledger and beancount require.
+func accountName(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range s {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(c)
+			continue
+		}
+		dash = true
+	}
+	out := []rune(b.String())
+	if len(out) == 0 {
+		return "Unknown"
+	}
+	out[0] = unicode.ToUpper(out[0])
+	if !unicode.IsUpper(out[0]) && !unicode.IsDigit(out[0]) {
+		return "X" + string(out)
+	}
+	return string(out)
+}
+
+func formatAmount(v float64) string {
+	return strconv.FormatFloat(src.RoundCents(v), 'f', 2, 64)
+}
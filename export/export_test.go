@@ -0,0 +1,193 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func sample() []Record {
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return []Record{
+		{Transaction: store.Transaction{ID: 2, Amount: 5, Currency: "CAD", OccurredAt: day.AddDate(0, 0, 1), Merchant: "Costco", Card: "Visa", Category: "Groceries", Kind: store.KindRefund, RefundOf: 1}},
+		{
+			Transaction: store.Transaction{ID: 1, Amount: 12.345, Currency: "cad", OccurredAt: day, Merchant: "Costco", Card: "Visa", Category: "Groceries", Details: "bulk, \"big\" run"},
+			Tags:        []string{"family", "road trip"},
+			Person:      "Alice",
+		},
+		{Transaction: store.Transaction{ID: 3, Amount: 1000, Currency: "USD", OccurredAt: day.AddDate(0, 0, 2), Merchant: "Acme", Category: "Salary", Kind: store.KindIncome}},
+	}
+}
+
+func render(t *testing.T, format string, opts Options) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, format, sample(), opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestWriteCSV(t *testing.T) {
+	out := render(t, FormatCSV, Options{Columns: []string{"id", "date", "amount", "currency", "tags", "account", "details"}})
+	rows, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != "id,date,amount,currency,tags,account,details" {
+		t.Fatalf("got %q", rows)
+	}
+	want := []string{"1", "2026-03-01", "12.35", "CAD", "family;road trip", "Expenses:Groceries", "bulk, \"big\" run"}
+	if strings.Join(rows[1], "|") != strings.Join(want, "|") {
+		t.Errorf("row 1 = %q, want %q", rows[1], want)
+	}
+	if rows[3][5] != "Income:Salary" {
+		t.Errorf("income account = %q", rows[3][5])
+	}
+
+	if err := Write(&bytes.Buffer{}, FormatCSV, nil, Options{Columns: []string{"nope"}}); err == nil {
+		t.Error("want error for unknown column")
+	}
+	if err := Write(&bytes.Buffer{}, "xlsx", nil, Options{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("got %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestWriteOFX(t *testing.T) {
+	out := render(t, FormatOFX, Options{Now: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)})
+	if !strings.HasPrefix(out, "<?xml") || !strings.Contains(out, `OFXHEADER="200"`) {
+		t.Fatalf("missing headers:\n%s", out)
+	}
+	var doc ofxDoc
+	if err := xml.Unmarshal([]byte(out[strings.Index(out, "<OFX>"):]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Statements) != 2 {
+		t.Fatalf("want a statement per card and currency, got %d", len(doc.Statements))
+	}
+	visa := doc.Statements[0]
+	if visa.CurDef != "CAD" || visa.Bank.AcctID != "Visa" || len(visa.List.Txns) != 2 {
+		t.Fatalf("got %+v", visa)
+	}
+	if tx := visa.List.Txns[0]; tx.Type != "DEBIT" || tx.Amount != "-12.35" || tx.FITID != "1" || tx.Memo != `Groceries: bulk, "big" run` {
+		t.Errorf("purchase = %+v", tx)
+	}
+	if tx := visa.List.Txns[1]; tx.Type != "CREDIT" || tx.Amount != "5.00" {
+		t.Errorf("refund = %+v", tx)
+	}
+	if visa.Balance.Amount != "-7.35" {
+		t.Errorf("balance = %s", visa.Balance.Amount)
+	}
+	if cash := doc.Statements[1]; cash.CurDef != "USD" || cash.Bank.AcctID != "cash" || cash.List.Txns[0].Amount != "1000.00" {
+		t.Errorf("got %+v", cash)
+	}
+}
+
+func TestWriteQIF(t *testing.T) {
+	out := render(t, FormatQIF, Options{})
+	want := "!Account\nNVisa\nTBank\n^\n!Type:Bank\n" +
+		"D03/01/2026\nT-12.35\nPCostco\nMbulk, \"big\" run #family #road trip\nLGroceries\n^\n" +
+		"D03/02/2026\nT5.00\nPCostco\nLGroceries\n^\n"
+	if !strings.HasPrefix(out, want) {
+		t.Fatalf("got\n%s", out)
+	}
+	if !strings.Contains(out, "!Account\nNCash\n") {
+		t.Error("missing cash account")
+	}
+}
+
+func TestWriteLedger(t *testing.T) {
+	out := render(t, FormatLedger, Options{Accounts: Accounts{Categories: map[string]string{"Groceries": "Expenses:Food:Groceries"}}})
+	for _, want := range []string{
+		"2026/03/01 * Costco\n    ; id: 1\n    ; person: Alice\n    ; details: bulk, \"big\" run\n    ; :family:road-trip:\n",
+		"    Expenses:Food:Groceries" + strings.Repeat(" ", postingWidth-len("Expenses:Food:Groceries")) + "  12.35 CAD\n",
+		"Liabilities:Cards:Visa",
+		"Expenses:Food:Groceries" + strings.Repeat(" ", postingWidth-len("Expenses:Food:Groceries")) + "  -5.00 CAD\n",
+		"Income:Salary" + strings.Repeat(" ", postingWidth-len("Income:Salary")) + "  -1000.00 USD\n",
+		"Assets:Cash" + strings.Repeat(" ", postingWidth-len("Assets:Cash")) + "  1000.00 USD\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteHledger(t *testing.T) {
+	out := render(t, FormatHledger, Options{})
+	want := "2026-03-01 * Costco  ; id:1, person:Alice, details:bulk \"big\" run, family:, road-trip:\n"
+	if !strings.HasPrefix(out, want) {
+		t.Fatalf("got\n%s", out)
+	}
+}
+
+func TestWriteBeancount(t *testing.T) {
+	out := render(t, FormatBeancount, Options{})
+	for _, want := range []string{
+		"2026-03-01 open Expenses:Groceries\n2026-03-01 open Liabilities:Cards:Visa\n2026-03-03 open Income:Salary\n2026-03-03 open Assets:Cash\n\n",
+		"2026-03-01 * \"Costco\" \"bulk, \\\"big\\\" run\" #family #road-trip\n  id: \"1\"\n  person: \"Alice\"\n",
+		"2026-03-02 * \"Costco\" \"\"\n  id: \"2\"\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Count(out, " open ") != 4 {
+		t.Errorf("want each account opened once:\n%s", out)
+	}
+}
+
+func TestWriteBalances(t *testing.T) {
+	balances := []Balance{
+		{Account: "Visa", Amount: -250.5, Currency: "CAD", On: time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{Account: "Visa", Amount: -300, Currency: "CAD", On: time.Date(2026, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{Account: "Visa", Amount: -1, Currency: "CAD", On: time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)},
+	}
+	opts := Options{Balances: balances}
+	assertion := "2026/03/02 * Balance\n    Liabilities:Cards:Visa" + strings.Repeat(" ", postingWidth-len("Liabilities:Cards:Visa")) + "  0 CAD = -250.50 CAD\n"
+	out := render(t, FormatLedger, opts)
+	if i := strings.Index(out, assertion); i < 0 || i < strings.Index(out, "2026/03/02 * Costco") || i > strings.Index(out, "2026/03/03 * Acme") {
+		t.Errorf("want the assertion after the day's transactions:\n%s", out)
+	}
+	if !strings.HasPrefix(out, "2026/02/28 * Balance\n") || !strings.HasSuffix(out, "0 CAD = -1.00 CAD\n\n") {
+		t.Errorf("want earlier and later balances around the transactions:\n%s", out)
+	}
+
+	out = render(t, FormatBeancount, opts)
+	for _, want := range []string{
+		"2026-02-28 open Liabilities:Cards:Visa\n2026-03-01 open Expenses:Groceries\n",
+		"2026-03-03 balance Liabilities:Cards:Visa -250.50 CAD\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+
+	out = render(t, FormatOFX, opts)
+	var doc ofxDoc
+	if err := xml.Unmarshal([]byte(out[strings.Index(out, "<OFX>"):]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if b := doc.Statements[0].Balance; b.Amount != "-250.50" || b.AsOf != "20260302235959" {
+		t.Errorf("visa LEDGERBAL = %+v, want the latest balance within the statement", b)
+	}
+}
+
+func TestAccountName(t *testing.T) {
+	for in, want := range map[string]string{
+		"groceries":         "Groceries",
+		"Eating out / bars": "Eating-out-bars",
+		"продукты":          "Продукты",
+		"  ":                "Unknown",
+		"2fa":               "2fa",
+	} {
+		if got := accountName(in); got != want {
+			t.Errorf("accountName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
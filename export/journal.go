@@ -0,0 +1,199 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// postingWidth pads account names so amounts line up.
+const postingWidth = 44
+
+func writePostings(bw *bufio.Writer, indent string, r *Record, opts Options) {
+	amount := posting(r)
+	cur := opts.currency(r)
+	fmt.Fprintf(bw, "%s%-*s  %s %s\n", indent, postingWidth, opts.Accounts.Category(r), formatAmount(amount), cur)
+	fmt.Fprintf(bw, "%s%-*s  %s %s\n", indent, postingWidth, opts.Accounts.Card(r), formatAmount(-amount), cur)
+}
+
+// assertions hands out opts.Balances, which Write sorted by day, in
+// step with the records.
+type assertions struct {
+	balances []Balance
+	next     int
+}
+
+// through calls fn for each balance not yet handed out dated before
+// day (YYYY-MM-DD), or for all of them when day is "".
+func (a *assertions) through(day string, fn func(*Balance)) {
+	for ; a.next < len(a.balances); a.next++ {
+		b := &a.balances[a.next]
+		if day != "" && b.On.Format("2006-01-02") >= day {
+			return
+		}
+		fn(b)
+	}
+}
+
+// writeAssertion writes a transaction with one zero posting asserting
+// the balance, a form ledger and hledger both accept. It is dated on
+// the balance's day and written after that day's transactions.
+func writeAssertion(bw *bufio.Writer, layout string, b *Balance, opts Options) {
+	cur := opts.balanceCurrency(b)
+	fmt.Fprintf(bw, "%s * Balance\n", b.On.Format(layout))
+	fmt.Fprintf(bw, "    %-*s  0 %s = %s %s\n\n", postingWidth, opts.Accounts.card(b.Account), cur, formatAmount(b.Amount), cur)
+}
+
+// writeLedger writes ledger-cli entries. The ID, person and details
+// are "; key: value" metadata and tags are a ":tag1:tag2:" line.
+func writeLedger(w io.Writer, recs []Record, opts Options) error {
+	bw := bufio.NewWriter(w)
+	asserts := assertions{balances: opts.Balances}
+	assert := func(b *Balance) { writeAssertion(bw, "2006/01/02", b, opts) }
+	for i := range recs {
+		r := &recs[i]
+		asserts.through(r.OccurredAt.Format("2006-01-02"), assert)
+		fmt.Fprintf(bw, "%s * %s\n", r.OccurredAt.Format("2006/01/02"), oneLine(r.Merchant))
+		fmt.Fprintf(bw, "    ; id: %d\n", r.ID)
+		if r.Person != "" {
+			fmt.Fprintf(bw, "    ; person: %s\n", oneLine(r.Person))
+		}
+		if r.Details != "" {
+			fmt.Fprintf(bw, "    ; details: %s\n", oneLine(r.Details))
+		}
+		if tags := tagNames(r.Tags, ledgerTagRune); len(tags) > 0 {
+			fmt.Fprintf(bw, "    ; :%s:\n", strings.Join(tags, ":"))
+		}
+		writePostings(bw, "    ", r, opts)
+		bw.WriteString("\n")
+	}
+	asserts.through("", assert)
+	return bw.Flush()
+}
+
+// writeHledger writes hledger entries. Everything ledger keeps as
+// metadata is an hledger tag on the transaction line: id:, person:,
+// details: and one valueless tag per transaction tag.
+func writeHledger(w io.Writer, recs []Record, opts Options) error {
+	bw := bufio.NewWriter(w)
+	asserts := assertions{balances: opts.Balances}
+	assert := func(b *Balance) { writeAssertion(bw, "2006-01-02", b, opts) }
+	for i := range recs {
+		r := &recs[i]
+		asserts.through(r.OccurredAt.Format("2006-01-02"), assert)
+		tags := []string{"id:" + strconv.FormatUint(r.ID, 10)}
+		if r.Person != "" {
+			tags = append(tags, "person:"+hledgerValue(r.Person))
+		}
+		if r.Details != "" {
+			tags = append(tags, "details:"+hledgerValue(r.Details))
+		}
+		for _, t := range tagNames(r.Tags, ledgerTagRune) {
+			tags = append(tags, t+":")
+		}
+		fmt.Fprintf(bw, "%s * %s  ; %s\n", r.OccurredAt.Format("2006-01-02"), oneLine(r.Merchant), strings.Join(tags, ", "))
+		writePostings(bw, "    ", r, opts)
+		bw.WriteString("\n")
+	}
+	asserts.through("", assert)
+	return bw.Flush()
+}
+
+// writeBeancount writes an open directive for every account used,
+// dated at its first use, then one transaction per record with the
+// merchant as payee, the details as narration, tags as #tags and the
+// ID and person as metadata, then a balance directive per balance.
+// Beancount checks a balance at the start of its day, so an end-of-day
+// balance is dated the day after.
+func writeBeancount(w io.Writer, recs []Record, opts Options) error {
+	bw := bufio.NewWriter(w)
+	type open struct{ acct, day string }
+	var opens []open
+	opened := map[string]int{}
+	use := func(acct, day string) {
+		if i, ok := opened[acct]; !ok {
+			opened[acct] = len(opens)
+			opens = append(opens, open{acct, day})
+		} else if day < opens[i].day {
+			opens[i].day = day
+		}
+	}
+	for i := range recs {
+		r := &recs[i]
+		for _, acct := range []string{opts.Accounts.Category(r), opts.Accounts.Card(r)} {
+			use(acct, r.OccurredAt.Format("2006-01-02"))
+		}
+	}
+	for _, b := range opts.Balances {
+		use(opts.Accounts.card(b.Account), b.On.Format("2006-01-02"))
+	}
+	sort.SliceStable(opens, func(i, j int) bool { return opens[i].day < opens[j].day })
+	for _, o := range opens {
+		fmt.Fprintf(bw, "%s open %s\n", o.day, o.acct)
+	}
+	if len(opens) > 0 {
+		bw.WriteString("\n")
+	}
+	for i := range recs {
+		r := &recs[i]
+		fmt.Fprintf(bw, "%s * %s %s", r.OccurredAt.Format("2006-01-02"), beancountString(r.Merchant), beancountString(r.Details))
+		for _, t := range tagNames(r.Tags, beancountTagRune) {
+			bw.WriteString(" #" + t)
+		}
+		bw.WriteString("\n")
+		fmt.Fprintf(bw, "  id: \"%d\"\n", r.ID)
+		if r.Person != "" {
+			fmt.Fprintf(bw, "  person: %s\n", beancountString(r.Person))
+		}
+		writePostings(bw, "  ", r, opts)
+		bw.WriteString("\n")
+	}
+	for _, b := range opts.Balances {
+		fmt.Fprintf(bw, "%s balance %s %s %s\n", b.On.AddDate(0, 0, 1).Format("2006-01-02"), opts.Accounts.card(b.Account), formatAmount(b.Amount), opts.balanceCurrency(&b))
+	}
+	return bw.Flush()
+}
+
+func ledgerTagRune(c rune) bool {
+	return !unicode.IsSpace(c) && c != ':' && c != ',' && c != ';'
+}
+
+func beancountTagRune(c rune) bool {
+	return c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("-_/.", c))
+}
+
+// tagNames rewrites tags so each is a single valid tag name: runes
+// that keep fails on become "-". Tags left empty are dropped.
+func tagNames(tags []string, keep func(rune) bool) []string {
+	var out []string
+	for _, t := range tags {
+		t = strings.Map(func(c rune) rune {
+			if keep(c) {
+				return c
+			}
+			return '-'
+		}, strings.TrimSpace(t))
+		if strings.Trim(t, "-") != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// hledgerValue keeps a tag value from ending early: values run to the
+// next comma.
+func hledgerValue(s string) string {
+	return oneLine(strings.ReplaceAll(s, ",", " "))
+}
+
+func beancountString(s string) string {
+	return strconv.Quote(oneLine(s))
+}
@@ -0,0 +1,155 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+const ofxTime = "20060102150405"
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+var ofxOK = ofxStatus{Code: 0, Severity: "INFO"}
+
+type ofxDoc struct {
+	XMLName xml.Name `xml:"OFX"`
+	Signon  struct {
+		Status   ofxStatus `xml:"STATUS"`
+		DTServer string    `xml:"DTSERVER"`
+		Language string    `xml:"LANGUAGE"`
+	} `xml:"SIGNONMSGSRSV1>SONRS"`
+	Statements []ofxStatement `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type ofxStatement struct {
+	TrnUID string    `xml:"TRNUID"`
+	Status ofxStatus `xml:"STATUS"`
+	CurDef string    `xml:"STMTRS>CURDEF"`
+	Bank   struct {
+		BankID   string `xml:"BANKID"`
+		AcctID   string `xml:"ACCTID"`
+		AcctType string `xml:"ACCTTYPE"`
+	} `xml:"STMTRS>BANKACCTFROM"`
+	List struct {
+		Start string   `xml:"DTSTART"`
+		End   string   `xml:"DTEND"`
+		Txns  []ofxTxn `xml:"STMTTRN"`
+	} `xml:"STMTRS>BANKTRANLIST"`
+	Balance struct {
+		Amount string `xml:"BALAMT"`
+		AsOf   string `xml:"DTASOF"`
+	} `xml:"STMTRS>LEDGERBAL"`
+}
+
+type ofxTxn struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	FITID  string `xml:"FITID"`
+	Name   string `xml:"NAME,omitempty"`
+	Memo   string `xml:"MEMO,omitempty"`
+}
+
+// writeOFX writes one bank statement per card and currency, in order
+// of first appearance. Amounts are from the card's side: spending is
+// negative. OFX has no field for categories or tags, so the category
+// goes into MEMO ahead of the details. LEDGERBAL is the card's latest
+// balance in opts.Balances on or before the statement's last day, in
+// the statement's currency; without one it is the net of the listed
+// transactions.
+func writeOFX(w io.Writer, recs []Record, opts Options) error {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var doc ofxDoc
+	doc.Signon.Status = ofxOK
+	doc.Signon.DTServer = now.Format(ofxTime)
+	doc.Signon.Language = "ENG"
+
+	type key struct{ card, currency string }
+	index := map[key]int{}
+	totals := map[key]float64{}
+	for i := range recs {
+		r := &recs[i]
+		k := key{r.Card, opts.currency(r)}
+		n, ok := index[k]
+		if !ok {
+			n = len(doc.Statements)
+			index[k] = n
+			st := ofxStatement{TrnUID: strconv.Itoa(n + 1), Status: ofxOK, CurDef: k.currency}
+			st.Bank.BankID = "0"
+			st.Bank.AcctID = or(r.Card, "cash")
+			st.Bank.AcctType = "CHECKING"
+			st.List.Start = r.OccurredAt.Format(ofxTime)
+			doc.Statements = append(doc.Statements, st)
+		}
+		st := &doc.Statements[n]
+		amount := -posting(r)
+		totals[k] += amount
+		t := ofxTxn{
+			Type:   "DEBIT",
+			Posted: r.OccurredAt.Format(ofxTime),
+			Amount: formatAmount(amount),
+			FITID:  strconv.FormatUint(r.ID, 10),
+			Name:   truncate(r.Merchant, 32),
+			Memo:   r.Category,
+		}
+		if amount > 0 {
+			t.Type = "CREDIT"
+		}
+		if r.Details != "" {
+			if t.Memo != "" {
+				t.Memo += ": "
+			}
+			t.Memo += r.Details
+		}
+		t.Memo = truncate(t.Memo, 255)
+		st.List.Txns = append(st.List.Txns, t)
+		st.List.End = t.Posted
+		st.Balance.Amount = formatAmount(totals[k])
+		st.Balance.AsOf = t.Posted
+	}
+
+	for k, n := range index {
+		st := &doc.Statements[n]
+		for _, b := range opts.Balances {
+			if !strings.EqualFold(b.Account, k.card) || opts.balanceCurrency(&b) != k.currency || b.On.Format("20060102") > st.List.End[:8] {
+				continue
+			}
+			y, m, d := b.On.Date()
+			st.Balance.Amount = formatAmount(b.Amount)
+			st.Balance.AsOf = time.Date(y, m, d, 23, 59, 59, 0, b.On.Location()).Format(ofxTime)
+		}
+	}
+
+	if _, err := io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// truncate cuts s to at most n runes, the OFX field limits.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
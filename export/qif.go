@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// writeQIF writes one !Account section per card, each followed by its
+// transactions as a !Type:Bank list. Amounts are from the card's side,
+// as in OFX. Categories go in L; QIF has no tags, so they are appended
+// to the memo as #tag.
+func writeQIF(w io.Writer, recs []Record, opts Options) error {
+	var cards []string
+	byCard := map[string][]*Record{}
+	for i := range recs {
+		card := recs[i].Card
+		if _, ok := byCard[card]; !ok {
+			cards = append(cards, card)
+		}
+		byCard[card] = append(byCard[card], &recs[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, card := range cards {
+		bw.WriteString("!Account\n")
+		bw.WriteString("N" + qifLine(or(card, "Cash")) + "\n")
+		bw.WriteString("TBank\n^\n")
+		bw.WriteString("!Type:Bank\n")
+		for _, r := range byCard[card] {
+			bw.WriteString("D" + r.OccurredAt.Format("01/02/2006") + "\n")
+			bw.WriteString("T" + formatAmount(-posting(r)) + "\n")
+			if r.Merchant != "" {
+				bw.WriteString("P" + qifLine(r.Merchant) + "\n")
+			}
+			memo := r.Details
+			for _, tag := range r.Tags {
+				if memo != "" {
+					memo += " "
+				}
+				memo += "#" + tag
+			}
+			if memo != "" {
+				bw.WriteString("M" + qifLine(memo) + "\n")
+			}
+			if r.Category != "" {
+				// "/" starts a class in L, so keep it out of the name.
+				bw.WriteString("L" + qifLine(strings.ReplaceAll(r.Category, "/", "-")) + "\n")
+			}
+			bw.WriteString("^\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// qifLine keeps a value on its one line.
+func qifLine(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+}
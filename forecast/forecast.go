@@ -0,0 +1,244 @@
+// Package forecast projects account balances forward from their
+// current values, recurring transactions detected in the history and
+// user-entered scheduled items.
+//
+// Like reports it does no I/O: the caller supplies starting balances
+// and items, all in each account's own currency.
+package forecast
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Frequencies an item can repeat at. Once items happen on Next only.
+const (
+	Once      = "once"
+	Weekly    = "weekly"
+	Biweekly  = "biweekly"
+	Monthly   = "monthly"
+	Quarterly = "quarterly"
+	Yearly    = "yearly"
+)
+
+// Where an item came from.
+const (
+	SourceScheduled = "scheduled"
+	SourceRecurring = "recurring"
+)
+
+// DefaultDays is the horizon when Options.Days is zero.
+const DefaultDays = 90
+
+func ValidFrequency(f string) bool {
+	switch f {
+	case Once, Weekly, Biweekly, Monthly, Quarterly, Yearly:
+		return true
+	}
+	return false
+}
+
+// Advance returns the n-th occurrence after anchor. Monthly and longer
+// frequencies keep anchor's day of month, clamped to the month's last
+// day, so an item on the 31st falls on the 30th in April and back on
+// the 31st in May.
+func Advance(anchor time.Time, freq string, n int) time.Time {
+	switch freq {
+	case Weekly:
+		return anchor.AddDate(0, 0, 7*n)
+	case Biweekly:
+		return anchor.AddDate(0, 0, 14*n)
+	case Monthly:
+		return addMonths(anchor, n)
+	case Quarterly:
+		return addMonths(anchor, 3*n)
+	case Yearly:
+		return addMonths(anchor, 12*n)
+	}
+	return anchor
+}
+
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+// Effect is how a transaction moves its account's balance: expenses
+// and transfers out lower it, income and refunds raise it.
+func Effect(t *store.Transaction) float64 {
+	switch t.KindOrDefault() {
+	case store.KindIncome:
+		return math.Abs(t.Amount)
+	case store.KindRefund:
+		return -t.SpendAmount()
+	}
+	return -t.Amount
+}
+
+// Item is a future cash movement: Amount (signed, see Effect) on
+// Account at Next and then every Frequency, through Until when set.
+type Item struct {
+	Name      string
+	Account   string
+	Amount    float64
+	Frequency string
+	Next      time.Time
+	Until     *time.Time
+	Source    string
+	// Occurrences is how many past transactions a detected item is
+	// based on.
+	Occurrences int
+}
+
+// Account is a starting point: Balance at the start of the forecast.
+type Account struct {
+	Name     string
+	Currency string
+	Balance  float64
+}
+
+type Options struct {
+	// Start is the first day of the forecast, in the location days are
+	// cut in.
+	Start time.Time
+	Days  int
+}
+
+type Point struct {
+	Date    string  `json:"date"`
+	Balance float64 `json:"balance"`
+}
+
+type Event struct {
+	Date    string  `json:"date"`
+	Account string  `json:"account"`
+	Name    string  `json:"name"`
+	Amount  float64 `json:"amount"`
+	Source  string  `json:"source"`
+}
+
+// AccountForecast is one account's daily closing balances. Low is the
+// lowest of them, first reached on LowOn.
+type AccountForecast struct {
+	Account  string  `json:"account"`
+	Currency string  `json:"currency"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Low      float64 `json:"low"`
+	LowOn    string  `json:"lowOn"`
+	Series   []Point `json:"series"`
+}
+
+// Warning flags the first day an account closes below zero.
+type Warning struct {
+	Account string  `json:"account"`
+	Date    string  `json:"date"`
+	Balance float64 `json:"balance"`
+}
+
+// Forecast covers From..To, both inclusive (YYYY-MM-DD).
+type Forecast struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Accounts []AccountForecast `json:"accounts"`
+	Events   []Event           `json:"events"`
+	Warnings []Warning         `json:"warnings"`
+}
+
+const dateLayout = "2006-01-02"
+
+// Project runs items over accounts day by day. Items on an account not
+// in accounts are ignored; occurrences before Start are skipped.
+func Project(accounts []Account, items []Item, opts Options) *Forecast {
+	days := opts.Days
+	if days <= 0 {
+		days = DefaultDays
+	}
+	start := startOfDay(opts.Start)
+	end := start.AddDate(0, 0, days)
+	f := &Forecast{
+		From:     start.Format(dateLayout),
+		To:       end.AddDate(0, 0, -1).Format(dateLayout),
+		Accounts: []AccountForecast{},
+		Events:   []Event{},
+		Warnings: []Warning{},
+	}
+
+	byName := map[string]int{}
+	deltas := make([][]float64, len(accounts))
+	for i, a := range accounts {
+		byName[strings.ToLower(a.Name)] = i
+		deltas[i] = make([]float64, days)
+	}
+	for _, it := range items {
+		i, ok := byName[strings.ToLower(it.Account)]
+		if !ok {
+			continue
+		}
+		for k := 0; k == 0 || it.Frequency != Once && ValidFrequency(it.Frequency); k++ {
+			at := startOfDay(Advance(it.Next.In(start.Location()), it.Frequency, k))
+			if !at.Before(end) || it.Until != nil && at.After(*it.Until) {
+				break
+			}
+			if at.Before(start) {
+				continue
+			}
+			deltas[i][dayIndex(start, at)] += it.Amount
+			f.Events = append(f.Events, Event{
+				Date:    at.Format(dateLayout),
+				Account: accounts[i].Name,
+				Name:    it.Name,
+				Amount:  src.RoundCents(it.Amount),
+				Source:  it.Source,
+			})
+		}
+	}
+	sort.SliceStable(f.Events, func(i, j int) bool {
+		if f.Events[i].Date != f.Events[j].Date {
+			return f.Events[i].Date < f.Events[j].Date
+		}
+		return f.Events[i].Account < f.Events[j].Account
+	})
+
+	for i, a := range accounts {
+		af := AccountForecast{Account: a.Name, Currency: a.Currency, Start: src.RoundCents(a.Balance), Series: make([]Point, days)}
+		bal := a.Balance
+		warned := false
+		for d := 0; d < days; d++ {
+			bal += deltas[i][d]
+			p := Point{Date: start.AddDate(0, 0, d).Format(dateLayout), Balance: src.RoundCents(bal)}
+			af.Series[d] = p
+			if d == 0 || p.Balance < af.Low {
+				af.Low, af.LowOn = p.Balance, p.Date
+			}
+			if p.Balance < 0 && !warned {
+				warned = true
+				f.Warnings = append(f.Warnings, Warning{Account: a.Name, Date: p.Date, Balance: p.Balance})
+			}
+		}
+		af.End = af.Series[days-1].Balance
+		f.Accounts = append(f.Accounts, af)
+	}
+	sort.SliceStable(f.Warnings, func(i, j int) bool { return f.Warnings[i].Date < f.Warnings[j].Date })
+	return f
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// dayIndex counts calendar days from start to day, both midnights.
+// Rounding absorbs DST changes.
+func dayIndex(start, day time.Time) int {
+	return int(math.Round(day.Sub(start).Hours() / 24))
+}
@@ -0,0 +1,86 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAdvance(t *testing.T) {
+	for _, tc := range []struct {
+		freq string
+		n    int
+		want time.Time
+	}{
+		{Weekly, 2, date(2024, 2, 14)},
+		{Biweekly, 1, date(2024, 2, 14)},
+		{Monthly, 1, date(2024, 2, 29)},
+		{Monthly, 2, date(2024, 3, 31)},
+		{Quarterly, 1, date(2024, 4, 30)},
+		{Yearly, 1, date(2025, 1, 31)},
+		{Once, 3, date(2024, 1, 31)},
+	} {
+		if got := Advance(date(2024, 1, 31), tc.freq, tc.n); !got.Equal(tc.want) {
+			t.Errorf("Advance(%s, %d) = %v, want %v", tc.freq, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestEffect(t *testing.T) {
+	for _, tc := range []struct {
+		t    store.Transaction
+		want float64
+	}{
+		{store.Transaction{Amount: 12}, -12},
+		{store.Transaction{Amount: 12, Kind: store.KindRefund}, 12},
+		{store.Transaction{Amount: -12, Kind: store.KindIncome}, 12},
+		{store.Transaction{Amount: 100, Kind: store.KindTransfer}, -100},
+	} {
+		if got := Effect(&tc.t); got != tc.want {
+			t.Errorf("Effect(%+v) = %v, want %v", tc.t, got, tc.want)
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	until := date(2024, 3, 20)
+	accounts := []Account{
+		{Name: "Chequing", Currency: "CAD", Balance: 500},
+		{Name: "Visa", Currency: "CAD", Balance: -50},
+	}
+	items := []Item{
+		{Name: "Rent", Account: "chequing", Amount: -1200, Frequency: Monthly, Next: date(2024, 2, 1), Source: SourceScheduled},
+		{Name: "Pay", Account: "Chequing", Amount: 1000, Frequency: Biweekly, Next: date(2024, 2, 23), Until: &until, Source: SourceScheduled},
+		{Name: "Bonus", Account: "Chequing", Amount: 300, Frequency: Once, Next: date(2024, 3, 25), Source: SourceScheduled},
+		{Name: "Gift", Account: "Savings", Amount: 50, Frequency: Once, Next: date(2024, 3, 2)},
+	}
+	f := Project(accounts, items, Options{Start: date(2024, 3, 1).Add(15 * time.Hour), Days: 31})
+	if f.From != "2024-03-01" || f.To != "2024-03-31" {
+		t.Fatalf("range = %s..%s", f.From, f.To)
+	}
+	// Rent on the 1st; pay on the 8th (the 23rd was before the start)
+	// and the 22nd is past until; the bonus on the 25th.
+	if len(f.Events) != 3 || f.Events[0].Name != "Rent" || f.Events[1].Date != "2024-03-08" || f.Events[2].Name != "Bonus" {
+		t.Fatalf("events = %+v", f.Events)
+	}
+	chq := f.Accounts[0]
+	if len(chq.Series) != 31 || chq.Start != 500 || chq.Series[0].Balance != -700 || chq.End != 600 {
+		t.Errorf("chequing = %+v", chq)
+	}
+	if chq.Low != -700 || chq.LowOn != "2024-03-01" {
+		t.Errorf("low = %v on %s", chq.Low, chq.LowOn)
+	}
+	if len(f.Warnings) != 2 || f.Warnings[0].Account != "Chequing" || f.Warnings[1].Account != "Visa" || f.Warnings[1].Date != "2024-03-01" {
+		t.Errorf("warnings = %+v", f.Warnings)
+	}
+
+	f = Project([]Account{{Name: "Chequing", Balance: 10}}, nil, Options{Start: date(2024, 3, 1)})
+	if len(f.Accounts[0].Series) != DefaultDays || len(f.Warnings) != 0 {
+		t.Errorf("default horizon = %d points, warnings %+v", len(f.Accounts[0].Series), f.Warnings)
+	}
+}
@@ -0,0 +1,169 @@
+package forecast
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+// cadence is the range of gaps, in days, that counts as a frequency.
+type cadence struct {
+	freq     string
+	nominal  int
+	min, max int
+}
+
+var cadences = []cadence{
+	{Weekly, 7, 6, 8},
+	{Biweekly, 14, 13, 15},
+	{Monthly, 30, 27, 33},
+	{Quarterly, 91, 86, 96},
+	{Yearly, 365, 355, 375},
+}
+
+// minOccurrences is how many charges make a series, except yearly
+// ones where two a year apart are enough.
+const minOccurrences = 3
+
+// Detect finds recurring transactions: at least three on the same card
+// and merchant (ignoring case, digits and punctuation), at a regular
+// weekly, biweekly, monthly, quarterly or yearly gap, with similar
+// amounts. Three quarters of the gaps and of the amounts (within 20% of
+// the median) must agree, so one late or unusual charge does not hide
+// a series. Each becomes an Item with the median amount, due one
+// period after the last charge. A charge overdue by up to a quarter
+// period (at least three days) is expected today; past that the
+// series has stopped and is dropped.
+// Transactions without a card, and refunds of a purchase, are skipped.
+func Detect(txns []store.Transaction, now time.Time) []Item {
+	type key struct {
+		card, merchant string
+		in             bool
+	}
+	groups := map[key][]*store.Transaction{}
+	var keys []key
+	for i := range txns {
+		t := &txns[i]
+		m := src.NormalizeMerchant(t.Merchant)
+		if t.Card == "" || m == "" || t.RefundOf != 0 {
+			continue
+		}
+		k := key{strings.ToLower(t.Card), m, Effect(t) > 0}
+		if groups[k] == nil {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], t)
+	}
+
+	today := startOfDay(now)
+	out := []Item{}
+	for _, k := range keys {
+		rows := groups[k]
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].OccurredAt.Before(rows[j].OccurredAt) })
+		if len(rows) < 2 {
+			continue
+		}
+		gaps := make([]float64, len(rows)-1)
+		for i := 1; i < len(rows); i++ {
+			gaps[i-1] = float64(dayIndex(startOfDay(rows[i-1].OccurredAt.In(now.Location())), startOfDay(rows[i].OccurredAt.In(now.Location()))))
+		}
+		c, ok := classify(median(gaps))
+		if !ok || len(rows) < minOccurrences && c.freq != Yearly {
+			continue
+		}
+		regular := 0
+		for _, g := range gaps {
+			if g >= float64(c.min) && g <= float64(c.max) {
+				regular++
+			}
+		}
+		if regular*4 < len(gaps)*3 {
+			continue
+		}
+		amounts := make([]float64, len(rows))
+		for i, t := range rows {
+			amounts[i] = Effect(t)
+		}
+		amount := median(amounts)
+		similar := 0
+		for _, a := range amounts {
+			if math.Abs(a-amount) <= math.Abs(amount)*0.2 {
+				similar++
+			}
+		}
+		if amount == 0 || similar*4 < len(amounts)*3 {
+			continue
+		}
+
+		last := rows[len(rows)-1]
+		anchor := startOfDay(last.OccurredAt.In(now.Location()))
+		next := Advance(anchor, c.freq, 1)
+		grace := max(3, c.nominal/4)
+		if next.AddDate(0, 0, grace).Before(today) {
+			continue
+		}
+		if next.Before(today) {
+			next = today
+		}
+		out = append(out, Item{
+			Name:        last.Merchant,
+			Account:     last.Card,
+			Amount:      src.RoundCents(amount),
+			Frequency:   c.freq,
+			Next:        next,
+			Source:      SourceRecurring,
+			Occurrences: len(rows),
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].Next.Equal(out[j].Next) {
+			return out[i].Next.Before(out[j].Next)
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Combine returns scheduled followed by the detected items that are not
+// already scheduled: same account and the same merchant once
+// normalized. User-entered items win.
+func Combine(scheduled, detected []Item) []Item {
+	type key struct{ account, name string }
+	seen := map[key]bool{}
+	out := append([]Item{}, scheduled...)
+	for _, it := range scheduled {
+		seen[key{strings.ToLower(it.Account), src.NormalizeMerchant(it.Name)}] = true
+	}
+	for _, it := range detected {
+		if !seen[key{strings.ToLower(it.Account), src.NormalizeMerchant(it.Name)}] {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+func classify(gap float64) (cadence, bool) {
+	for _, c := range cadences {
+		if gap >= float64(c.min) && gap <= float64(c.max) {
+			return c, true
+		}
+	}
+	return cadence{}, false
+}
+
+func median(vs []float64) float64 {
+	s := append([]float64(nil), vs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
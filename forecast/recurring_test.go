@@ -0,0 +1,67 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestDetect(t *testing.T) {
+	var txns []store.Transaction
+	add := func(merchant, card string, amount float64, kind string, on ...time.Time) {
+		for _, at := range on {
+			txns = append(txns, store.Transaction{Merchant: merchant, Card: card, Amount: amount, Kind: kind, OccurredAt: at.Add(10 * time.Hour)})
+		}
+	}
+	add("NETFLIX.COM 1234", "Visa", 16.99, "", date(2024, 1, 15), date(2024, 2, 15), date(2024, 3, 14), date(2024, 4, 15))
+	add("Employer", "Chequing", -2000, store.KindIncome, date(2024, 3, 8), date(2024, 3, 22), date(2024, 4, 5), date(2024, 4, 19))
+	add("Insurance", "Chequing", 600, "", date(2023, 5, 2), date(2024, 5, 1))
+	// Irregular, too few, and a series that stopped in February.
+	add("Cafe", "Visa", 5, "", date(2024, 4, 1), date(2024, 4, 3), date(2024, 4, 12), date(2024, 4, 13))
+	add("Gym", "Visa", 40, "", date(2024, 3, 1), date(2024, 4, 1))
+	add("Old Stream", "Visa", 9, "", date(2023, 12, 1), date(2024, 1, 1), date(2024, 2, 1))
+	// Rows without a card cannot be projected.
+	add("Phone", "", 50, "", date(2024, 2, 20), date(2024, 3, 20), date(2024, 4, 20))
+
+	got := Detect(txns, date(2024, 4, 24).Add(9*time.Hour))
+	if len(got) != 3 {
+		t.Fatalf("detected %+v", got)
+	}
+	pay, netflix, ins := got[0], got[1], got[2]
+	if pay.Name != "Employer" || pay.Frequency != Biweekly || pay.Amount != 2000 || !pay.Next.Equal(date(2024, 5, 3)) {
+		t.Errorf("pay = %+v", pay)
+	}
+	if netflix.Frequency != Monthly || netflix.Amount != -16.99 || netflix.Account != "Visa" || !netflix.Next.Equal(date(2024, 5, 15)) || netflix.Occurrences != 4 {
+		t.Errorf("netflix = %+v", netflix)
+	}
+	if ins.Frequency != Yearly || !ins.Next.Equal(date(2025, 5, 1)) {
+		t.Errorf("insurance = %+v", ins)
+	}
+}
+
+func TestDetectLateCharge(t *testing.T) {
+	var txns []store.Transaction
+	for _, d := range []time.Time{date(2024, 1, 10), date(2024, 2, 10), date(2024, 3, 10)} {
+		txns = append(txns, store.Transaction{Merchant: "Hydro", Card: "Chequing", Amount: 80, OccurredAt: d})
+	}
+	got := Detect(txns, date(2024, 4, 14))
+	if len(got) != 1 || !got[0].Next.Equal(date(2024, 4, 14)) {
+		t.Fatalf("late bill = %+v, want it expected today", got)
+	}
+	if got := Detect(txns, date(2024, 4, 20)); len(got) != 0 {
+		t.Fatalf("stopped bill = %+v", got)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	scheduled := []Item{{Name: "Netflix", Account: "Visa", Source: SourceScheduled}}
+	detected := []Item{
+		{Name: "NETFLIX 123", Account: "visa", Source: SourceRecurring},
+		{Name: "Netflix", Account: "Mastercard", Source: SourceRecurring},
+	}
+	got := Combine(scheduled, detected)
+	if len(got) != 2 || got[1].Account != "Mastercard" {
+		t.Fatalf("combine = %+v", got)
+	}
+}
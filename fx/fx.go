@@ -0,0 +1,163 @@
+// Package fx parses exchange-rate files into store.ExchangeRate rows.
+//
+// Two inputs are supported, both meant to be downloaded once and
+// imported offline with cli/fxrates:
+//
+//   - the ECB reference-rate XML (eurofxref-daily.xml, eurofxref-hist.xml)
+//   - CSV, either the ECB "wide" layout (Date,USD,JPY,... against EUR)
+//     or a "long" layout with date,base,quote,rate columns.
+package fx
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+const dateLayout = "2006-01-02"
+
+// ecbEnvelope mirrors the subset of the ECB gesmes envelope we need:
+//
+//	<Cube><Cube time="..."><Cube currency="USD" rate="1.09"/>...</Cube></Cube>
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECBXML reads an ECB reference-rate XML document. Every rate is
+// quoted against EUR.
+func ParseECBXML(r io.Reader) ([]store.ExchangeRate, error) {
+	var env ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&env); err != nil {
+		return nil, fmt.Errorf("decode ECB xml: %w", err)
+	}
+	var out []store.ExchangeRate
+	for _, d := range env.Days {
+		date, err := time.Parse(dateLayout, d.Time)
+		if err != nil {
+			return nil, fmt.Errorf("cube time %q: %w", d.Time, err)
+		}
+		for _, c := range d.Rates {
+			rate, err := strconv.ParseFloat(c.Rate, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s rate %q: %w", d.Time, c.Currency, c.Rate, err)
+			}
+			out = append(out, store.ExchangeRate{
+				Base:   store.PivotCurrency,
+				Quote:  c.Currency,
+				Date:   date,
+				Rate:   rate,
+				Source: "ecb",
+			})
+		}
+	}
+	return out, nil
+}
+
+// ParseCSV reads rates from CSV. The header decides the layout: if it
+// has base, quote and rate columns (any order, case-insensitive) each
+// row is one rate; otherwise the first column is the date and every
+// other column is a currency quoted against EUR, as in the ECB
+// eurofxref-hist.csv download. Empty and "N/A" cells are skipped.
+func ParseCSV(r io.Reader, source string) ([]store.ExchangeRate, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	_, hasBase := cols["base"]
+	_, hasQuote := cols["quote"]
+	_, hasRate := cols["rate"]
+	if hasBase && hasQuote && hasRate {
+		return parseLongCSV(cr, cols, source)
+	}
+	return parseWideCSV(cr, header, source)
+}
+
+func parseLongCSV(cr *csv.Reader, cols map[string]int, source string) ([]store.ExchangeRate, error) {
+	dateCol, ok := cols["date"]
+	if !ok {
+		return nil, fmt.Errorf("csv: missing date column")
+	}
+	need := max(dateCol, cols["base"], cols["quote"], cols["rate"]) + 1
+	var out []store.ExchangeRate
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < need {
+			return nil, fmt.Errorf("line %d: want %d columns, got %d", line, need, len(rec))
+		}
+		date, err := time.Parse(dateLayout, strings.TrimSpace(rec[dateCol]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: date: %w", line, err)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rec[cols["rate"]]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: rate: %w", line, err)
+		}
+		out = append(out, store.ExchangeRate{
+			Base:   strings.TrimSpace(rec[cols["base"]]),
+			Quote:  strings.TrimSpace(rec[cols["quote"]]),
+			Date:   date,
+			Rate:   rate,
+			Source: source,
+		})
+	}
+}
+
+func parseWideCSV(cr *csv.Reader, header []string, source string) ([]store.ExchangeRate, error) {
+	var out []store.ExchangeRate
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		date, err := time.Parse(dateLayout, strings.TrimSpace(rec[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: date: %w", line, err)
+		}
+		for i := 1; i < len(rec) && i < len(header); i++ {
+			cur := strings.TrimSpace(header[i])
+			cell := strings.TrimSpace(rec[i])
+			if cur == "" || cell == "" || cell == "N/A" {
+				continue
+			}
+			rate, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, cur, err)
+			}
+			out = append(out, store.ExchangeRate{
+				Base:   store.PivotCurrency,
+				Quote:  cur,
+				Date:   date,
+				Rate:   rate,
+				Source: source,
+			})
+		}
+	}
+}
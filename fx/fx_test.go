@@ -0,0 +1,63 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+)
+
+const ecbSample = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2026-01-02">
+			<Cube currency="USD" rate="1.0956"/>
+			<Cube currency="CAD" rate="1.4612"/>
+		</Cube>
+		<Cube time="2026-01-01">
+			<Cube currency="USD" rate="1.1000"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestParseECBXML(t *testing.T) {
+	rates, err := ParseECBXML(strings.NewReader(ecbSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 3 {
+		t.Fatalf("expected 3 rates, got %d", len(rates))
+	}
+	r := rates[1]
+	if r.Base != "EUR" || r.Quote != "CAD" || r.Rate != 1.4612 || r.Date.Format(dateLayout) != "2026-01-02" {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestParseCSVWide(t *testing.T) {
+	in := "Date,USD,JPY,\n2026-01-02,1.0956,N/A,\n"
+	rates, err := ParseCSV(strings.NewReader(in), "ecb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0].Quote != "USD" || rates[0].Base != "EUR" {
+		t.Errorf("got %+v", rates)
+	}
+}
+
+func TestParseCSVLong(t *testing.T) {
+	in := "rate,date,base,quote\n1.37,2026-01-02,USD,CAD\n"
+	rates, err := ParseCSV(strings.NewReader(in), "manual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0].Base != "USD" || rates[0].Quote != "CAD" || rates[0].Rate != 1.37 {
+		t.Errorf("got %+v", rates)
+	}
+}
+
+func TestParseCSVLongShortRow(t *testing.T) {
+	in := "date,base,quote,rate\n2026-01-02,USD,CAD,1.37\n2026-01-03,USD\n"
+	if _, err := ParseCSV(strings.NewReader(in), "manual"); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+// CIBC parses the transaction list CIBC's online banking loads, either
+// the bare array or the {"transactions": [...]} response around it.
+// Pending transactions and card payments are skipped. Debits are
+// expenses and credits negative expenses; everything is in CAD on the
+// "cibc" card. CIBC's merchant category, where we know it, becomes the
+// CategoryHint.
+type CIBC struct{}
+
+type cibcItem struct {
+	DescriptionLine1       string     `json:"descriptionLine1"`
+	DescriptionLine2       string     `json:"descriptionLine2"`
+	TransactionDescription string     `json:"transactionDescription"`
+	Debit                  *flexFloat `json:"debit"`
+	Credit                 *flexFloat `json:"credit"`
+	Date                   string     `json:"date"`
+	PostedDate             string     `json:"postedDate"`
+	PendingIndicator       bool       `json:"pendingIndicator"`
+	MerchantCategoryID     string     `json:"merchantCategoryId"`
+}
+
+// cibcCategories maps CIBC merchantCategoryId values to our categories.
+var cibcCategories = map[string]string{
+	"0001": "home goods",
+	"0003": "food & other",
+	"0004": "transportation",
+	"0005": "hotel",
+	"0006": "takeouts",
+	"0007": "home goods",
+	"0008": "health",
+}
+
+const cibcPayment = "PAYMENT THANK YOU/PAIEMEN"
+
+func (CIBC) Parse(r io.Reader) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var items []cibcItem
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var wrapped struct {
+			Transactions *[]cibcItem `json:"transactions"`
+		}
+		if err := json.Unmarshal(trimmed, &wrapped); err != nil {
+			return nil, fmt.Errorf("importer: cibc: %w", err)
+		}
+		if wrapped.Transactions == nil {
+			return nil, errors.New("importer: cibc: expected an array or an object with transactions")
+		}
+		items = *wrapped.Transactions
+	} else if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, fmt.Errorf("importer: cibc: %w", err)
+	}
+
+	rows := make([]Row, 0, len(items))
+	for i, item := range items {
+		if item.DescriptionLine1 == cibcPayment || item.PendingIndicator {
+			continue
+		}
+		merchant := item.DescriptionLine1
+		if strings.Contains(merchant, "E-TRANSFER") {
+			merchant = item.DescriptionLine2
+		} else if merchant == "" {
+			merchant = item.TransactionDescription
+		}
+		date := item.Date
+		if date == "" {
+			date = item.PostedDate
+		}
+		occurredAt, err := localDate(date)
+		if err != nil {
+			return nil, fmt.Errorf("importer: cibc: transaction %d: invalid date %q", i, date)
+		}
+		var amount float64
+		if item.Debit != nil {
+			amount = math.Abs(float64(*item.Debit))
+		} else if item.Credit != nil {
+			amount = -math.Abs(float64(*item.Credit))
+		}
+		rows = append(rows, Row{
+			OccurredAt:   occurredAt,
+			Amount:       amount,
+			Currency:     store.DefaultBaseCurrency,
+			Merchant:     merchant,
+			Card:         "cibc",
+			Kind:         store.KindExpense,
+			CategoryHint: cibcCategories[item.MerchantCategoryID],
+		})
+	}
+	return rows, nil
+}
+
+// flexFloat accepts a JSON number or a numeric string; CIBC has sent
+// both.
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*f = flexFloat(v)
+	return nil
+}
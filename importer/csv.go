@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/rules"
+	"code.sirenko.ca/transaction/store"
+)
+
+// CSV parses comma-separated rows under a header. Column names are
+// case-insensitive:
+//
+//   - date or datetime: "2006-01-02", "2006-01-02T15:04", RFC3339,
+//     "2006/01/02" or "01/02/2006"; without an offset, local time
+//   - merchant or description
+//   - amount, or debit and credit: a debit is money spent (positive)
+//     and a credit money back (negative); "$" and thousands
+//     separators are ignored
+//   - currency (default CAD), category, card, details, kind
+//   - mcc, the merchant category code; leading zeros a spreadsheet
+//     dropped are put back
+//   - tags, separated by "," or ";" within the field
+//
+// The export package's CSV output reads back with this parser.
+type CSV struct{}
+
+var csvDateLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"01/02/2006",
+}
+
+func (CSV) Parse(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := firstColumn(col, "date", "datetime"); !ok {
+		return nil, errors.New("importer: csv header needs a date or datetime column")
+	}
+	if _, ok := firstColumn(col, "amount", "debit", "credit"); !ok {
+		return nil, errors.New("importer: csv header needs an amount, debit or credit column")
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(names ...string) string {
+			for _, name := range names {
+				if i, ok := col[name]; ok && i < len(rec) {
+					if v := strings.TrimSpace(rec[i]); v != "" {
+						return v
+					}
+				}
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(rec, "")) == "" {
+			continue
+		}
+
+		row := Row{
+			Merchant: get("merchant", "description"),
+			Currency: strings.ToUpper(get("currency")),
+			Card:     get("card"),
+			Category: get("category"),
+			Details:  get("details"),
+			Kind:     strings.ToLower(get("kind")),
+			Tags:     splitTags(get("tags")),
+		}
+		if row.Currency == "" {
+			row.Currency = store.DefaultBaseCurrency
+		}
+		if !store.ValidKind(row.Kind) {
+			return nil, fmt.Errorf("importer: line %d: unknown kind %q", line, row.Kind)
+		}
+		if mcc := get("mcc"); mcc != "" {
+			if len(mcc) < 4 {
+				mcc = strings.Repeat("0", 4-len(mcc)) + mcc
+			}
+			if !rules.ValidMCC(mcc) {
+				return nil, fmt.Errorf("importer: line %d: invalid mcc %q", line, get("mcc"))
+			}
+			row.MCC = mcc
+		}
+		if row.OccurredAt, err = parseCSVDate(get("datetime", "date")); err != nil {
+			return nil, fmt.Errorf("importer: line %d: %w", line, err)
+		}
+		switch {
+		case get("amount") != "":
+			row.Amount, err = parseAmount(get("amount"))
+		case get("debit") != "":
+			row.Amount, err = parseAmount(get("debit"))
+			row.Amount = math.Abs(row.Amount)
+		case get("credit") != "":
+			row.Amount, err = parseAmount(get("credit"))
+			row.Amount = -math.Abs(row.Amount)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("importer: line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func firstColumn(col map[string]int, names ...string) (int, bool) {
+	for _, name := range names {
+		if i, ok := col[name]; ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func parseCSVDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.New("missing date")
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range csvDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// parseAmount reads a number, ignoring a currency sign and thousands
+// separators.
+func parseAmount(s string) (float64, error) {
+	s = strings.NewReplacer("$", "", ",", "", " ", "").Replace(s)
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return v, nil
+}
+
+func splitTags(s string) []string {
+	var out []string
+	for _, t := range strings.FieldsFunc(s, func(c rune) bool { return c == ',' || c == ';' }) {
+		if t = strings.TrimSpace(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
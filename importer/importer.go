@@ -0,0 +1,226 @@
+// Package importer turns bank and broker exports into transactions.
+//
+// Each supported format is a Parser, looked up by name with Lookup:
+//
+//   - csv: a header row naming the columns (date or datetime, merchant
+//     or description, amount or debit/credit, and optionally currency,
+//     category, tags, card, details and kind)
+//   - cibc: the JSON of CIBC's online-banking transaction list
+//   - wealthsimple: the JSON activity nodes the browser extension
+//     collects from Wealthsimple
+//   - ofx (or qfx): OFX 1.x and 2.x bank and credit-card statements
+//
+// Parsers only read the input. Categorize fills in categories from the
+// rules package and Duplicates flags rows already in the store. The
+// server's import endpoints and the web UI parse and store through
+// this package; cli/wealthsimple parses with it too, but writes to its
+// own Postgres table rather than the store.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/rules"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Unknown is the category of rows no rule matches.
+const Unknown = rules.Unknown
+
+// Row is one parsed transaction, in the store's conventions: Amount is
+// positive for money spent, and credits on a card are negative
+// expenses unless the source says what they are.
+type Row struct {
+	OccurredAt time.Time
+	Amount     float64
+	Currency   string
+	Merchant   string
+	Card       string
+	Category   string
+	Details    string
+	Tags       []string
+	Kind       string
+	// FITID is the source's own transaction ID, when it has one.
+	FITID string
+	// MCC is the source's merchant category code, when it has one.
+	MCC string
+	// CategoryHint is the source's own category, used by Categorize
+	// when no rule matches the merchant.
+	CategoryHint string
+}
+
+// Transaction returns r as a store transaction owned by userID.
+func (r *Row) Transaction(userID uint64) *store.Transaction {
+	return &store.Transaction{
+		UserID:     userID,
+		Amount:     r.Amount,
+		Currency:   r.Currency,
+		OccurredAt: r.OccurredAt.UTC(),
+		Merchant:   r.Merchant,
+		Card:       r.Card,
+		Category:   r.Category,
+		Details:    r.Details,
+		Kind:       r.Kind,
+		FITID:      r.FITID,
+		MCC:        r.MCC,
+	}
+}
+
+// Parser reads one export format.
+type Parser interface {
+	Parse(r io.Reader) ([]Row, error)
+}
+
+// Balance is an account balance a statement reports at the end of the
+// local day AsOf. Amount is from the account's side, as in
+// store.BalanceSnapshot: a card that is owed money is negative.
+type Balance struct {
+	Card     string
+	Amount   float64
+	Currency string
+	AsOf     time.Time
+}
+
+// BalanceParser is a Parser whose format also carries statement
+// balances.
+type BalanceParser interface {
+	Parser
+	ParseBalances(r io.Reader) ([]Row, []Balance, error)
+}
+
+var parsers = map[string]Parser{
+	"csv":          CSV{},
+	"ofx":          OFX{},
+	"qfx":          OFX{},
+	"cibc":         CIBC{},
+	"wealthsimple": Wealthsimple{},
+}
+
+// Lookup returns the parser registered under name.
+func Lookup(name string) (Parser, bool) {
+	p, ok := parsers[strings.ToLower(name)]
+	return p, ok
+}
+
+// Names lists the registered parser names, sorted.
+func Names() []string {
+	out := make([]string, 0, len(parsers))
+	for name := range parsers {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Categorize runs e over every row and fills in what its rules set
+// (see rules.Engine.Apply): the category, details, kind and extra tags.
+// The engine's MCC fallback sees the row's MCC. Rows still without a
+// category take their CategoryHint, then Unknown.
+func Categorize(rows []Row, e *rules.Engine) {
+	for i := range rows {
+		r := &rows[i]
+		t := r.Transaction(0)
+		t.OccurredAt = r.OccurredAt // weekdays in the source's zone
+		r.Tags = e.Apply(t, r.Tags, false)
+		r.Category, r.Details, r.Kind = t.Category, t.Details, t.Kind
+		if r.Category == "" || r.Category == Unknown {
+			r.Category = r.CategoryHint
+		}
+		if r.Category == "" {
+			r.Category = Unknown
+		}
+	}
+}
+
+// Duplicates finds imported transactions that are already stored.
+// Transactions with a FITID match on card and FITID; otherwise on
+// DuplicateKey.
+type Duplicates struct {
+	fitids map[string]bool
+	// keys holds every transaction's DuplicateKey; plain only those of
+	// transactions without a FITID, which a row with a FITID can still
+	// duplicate (e.g. it was entered by hand or from a CSV).
+	keys, plain map[string]bool
+}
+
+// DuplicateKey is what an imported row must share with a stored
+// transaction to count as the same one: the local calendar day, the
+// amount to the cent, and the merchant and card ignoring case and
+// surrounding space. Time of day is ignored because several sources
+// only have dates.
+func DuplicateKey(occurredAt time.Time, amount float64, merchant, card string) string {
+	return fmt.Sprintf("%s|%.2f|%s|%s",
+		occurredAt.Local().Format("2006-01-02"), amount,
+		strings.ToLower(strings.TrimSpace(merchant)), strings.ToLower(strings.TrimSpace(card)))
+}
+
+func fitidKey(t *store.Transaction) string {
+	return strings.ToLower(strings.TrimSpace(t.Card)) + "|" + t.FITID
+}
+
+// NewDuplicates indexes existing.
+func NewDuplicates(existing []store.Transaction) *Duplicates {
+	d := &Duplicates{fitids: map[string]bool{}, keys: map[string]bool{}, plain: map[string]bool{}}
+	for i := range existing {
+		d.Add(&existing[i])
+	}
+	return d
+}
+
+// merchantNames are the names t is known by: its merchant and, when it
+// was normalized to a catalog name, the raw string it was imported with.
+func merchantNames(t *store.Transaction) []string {
+	var out []string
+	for _, m := range []string{t.Merchant, t.RawMerchant} {
+		if strings.TrimSpace(m) != "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Add records t so later matching rows are duplicates. A normalized
+// transaction is recorded under its raw merchant too, so a file
+// imported again after an alias was added still matches.
+func (d *Duplicates) Add(t *store.Transaction) {
+	if t.FITID != "" {
+		d.fitids[fitidKey(t)] = true
+	}
+	for _, m := range merchantNames(t) {
+		key := DuplicateKey(t.OccurredAt, t.Amount, m, t.Card)
+		d.keys[key] = true
+		if t.FITID == "" {
+			d.plain[key] = true
+		}
+	}
+}
+
+// Contains reports whether a transaction matching t was added. Two
+// transactions that both have FITIDs are only compared by FITID, so
+// two identical purchases on one day stay apart. Rows without a
+// merchant or FITID never match.
+func (d *Duplicates) Contains(t *store.Transaction) bool {
+	if t.FITID != "" && d.fitids[fitidKey(t)] {
+		return true
+	}
+	for _, m := range merchantNames(t) {
+		key := DuplicateKey(t.OccurredAt, t.Amount, m, t.Card)
+		if t.FITID != "" && d.plain[key] || t.FITID == "" && d.keys[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// localDate parses the date part of s ("2006-01-02", optionally
+// followed by a time that is ignored) as midnight local time.
+func localDate(s string) (time.Time, error) {
+	if len(s) > 10 {
+		s = s[:10]
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
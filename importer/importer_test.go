@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/rules"
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestCSV(t *testing.T) {
+	in := "Date,Description,Debit,Credit,Tags,Card,MCC\n" +
+		"2024-01-01,The Coffee Shop,3.50,,\"coffee, morning\",visa,5814\n" +
+		"2024-01-02,Book Store,,\"$1,025.00\",,,742\n" +
+		",,,,,,\n"
+	rows, err := CSV{}.Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	r := rows[0]
+	if r.Merchant != "The Coffee Shop" || r.Amount != 3.5 || r.Currency != "CAD" || r.Card != "visa" || r.MCC != "5814" ||
+		strings.Join(r.Tags, "|") != "coffee|morning" || !r.OccurredAt.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("row 0 = %+v", r)
+	}
+	if rows[1].Amount != -1025 || rows[1].MCC != "0742" {
+		t.Errorf("credit = %v, mcc %q", rows[1].Amount, rows[1].MCC)
+	}
+
+	for _, bad := range []string{
+		"merchant,amount\nx,1\n",
+		"date,amount\n2024-13-40,1\n",
+		"date,amount\n2024-01-01,abc\n",
+		"date,amount,kind\n2024-01-01,1,gift\n",
+		"date,amount,mcc\n2024-01-01,1,58x2\n",
+	} {
+		if _, err := (CSV{}).Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("want error for %q", bad)
+		}
+	}
+}
+
+func TestCIBC(t *testing.T) {
+	in := `{"transactions": [
+		{"descriptionLine1": "SAVE ON FOODS #123", "debit": 42.1, "date": "2024-02-03T00:00:00", "merchantCategoryId": "0006"},
+		{"descriptionLine1": "E-TRANSFER 1234", "descriptionLine2": "Bob", "credit": "20.00", "date": "2024-02-04"},
+		{"descriptionLine1": "PAYMENT THANK YOU/PAIEMEN", "credit": 500, "date": "2024-02-05"},
+		{"descriptionLine1": "PENDING CO", "debit": 1, "date": "2024-02-05", "pendingIndicator": true},
+		{"descriptionLine1": "MYSTERY", "debit": 5, "postedDate": "2024-02-06", "merchantCategoryId": "0006"}
+	]}`
+	rows, err := CIBC{}.Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	if r := rows[0]; r.Amount != 42.1 || r.Card != "cibc" || r.OccurredAt.Day() != 3 || r.MCC != "" || r.CategoryHint != "takeouts" {
+		t.Errorf("row 0 = %+v", r)
+	}
+	if r := rows[1]; r.Merchant != "Bob" || r.Amount != -20 {
+		t.Errorf("e-transfer = %+v", r)
+	}
+	Categorize(rows, defaults(t))
+	if rows[0].Category != "food & other" {
+		t.Errorf("rules should beat the CIBC category, got %q", rows[0].Category)
+	}
+	if rows[1].Category != Unknown || rows[2].Category != "takeouts" {
+		t.Errorf("got %q, %q", rows[1].Category, rows[2].Category)
+	}
+
+	if _, err := (CIBC{}).Parse(strings.NewReader(`{"other": []}`)); err == nil {
+		t.Error("want error for unexpected object")
+	}
+}
+
+func TestWealthsimple(t *testing.T) {
+	in := `[
+		{"node": {"amount": "12.00", "currency": "CAD", "occurredAt": "2024-03-01T10:15:00.123456-08:00", "spendMerchant": "LYFT", "amountSign": "negative", "type": "SPEND", "unifiedStatus": "COMPLETED"}},
+		{"node": {"amount": "3.00", "occurredAt": "2024-03-02T10:15:00-08:00", "spendMerchant": "LYFT", "amountSign": "positive", "type": "SPEND_REFUND"}},
+		{"node": {"amount": "0.42", "occurredAt": "2024-03-03T00:00:00Z", "amountSign": "positive", "type": "INTEREST"}},
+		{"node": {"amount": "100", "occurredAt": "2024-03-03T00:00:00Z", "amountSign": "positive", "type": "DEPOSIT", "eTransferName": "Bob"}},
+		{"node": {"amount": "1", "occurredAt": "2024-03-03T00:00:00Z", "amountSign": "negative", "type": "SPEND", "spendMerchant": "X", "unifiedStatus": "PENDING"}},
+		{"node": {"amount": "1", "occurredAt": "2024-03-03T00:00:00Z", "amountSign": "negative", "type": "FEE"}}
+	]`
+	rows, err := Wealthsimple{}.Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	want := []struct {
+		merchant, kind string
+		amount         float64
+	}{
+		{"LYFT", store.KindExpense, 12},
+		{"LYFT", store.KindRefund, 3},
+		{"Interest", store.KindIncome, 0.42},
+	}
+	for i, w := range want {
+		if r := rows[i]; r.Merchant != w.merchant || r.Kind != w.kind || r.Amount != w.amount || r.Card != "wealthsimple" {
+			t.Errorf("row %d = %+v", i, r)
+		}
+	}
+}
+
+func defaults(t *testing.T) *rules.Engine {
+	t.Helper()
+	e, err := rules.Compile(rules.Defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestCategorizeOrder(t *testing.T) {
+	rows := []Row{{Merchant: "Uber Eats"}, {Merchant: "UBER TRIP"}, {Merchant: "x", Category: "kept"}}
+	user, err := rules.Compile(rules.FromCategories(map[string][]string{"takeouts": {"uber eats"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Categorize(rows, rules.Chain(user, defaults(t)))
+	if rows[0].Category != "takeouts" || rows[1].Category != "transportation" || rows[2].Category != "kept" {
+		t.Errorf("got %q %q %q", rows[0].Category, rows[1].Category, rows[2].Category)
+	}
+
+	// The merchant category code comes after every merchant rule and
+	// before the source's own category.
+	rows = []Row{{Merchant: "Uber Eats", MCC: "4121"}, {Merchant: "Noodle Bar", MCC: "5812", CategoryHint: "hint"}, {Merchant: "y", MCC: "9999", CategoryHint: "hint"}}
+	Categorize(rows, rules.Chain(defaults(t), rules.FromMCC(rules.DefaultMCC)))
+	if rows[0].Category != "transportation" || rows[1].Category != "takeouts" || rows[2].Category != "hint" {
+		t.Errorf("with mcc got %q %q %q", rows[0].Category, rows[1].Category, rows[2].Category)
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	day := time.Date(2024, 1, 1, 9, 30, 0, 0, time.Local)
+	d := NewDuplicates([]store.Transaction{
+		{OccurredAt: day, Amount: 3.5, Merchant: "Coffee ", Card: "Visa"},
+		{OccurredAt: day, Amount: 2, Merchant: "Bus", Card: "cibc 1234", FITID: "A1"},
+	})
+	if !d.Contains(&store.Transaction{OccurredAt: day.Add(5 * time.Hour), Amount: 3.499999, Merchant: "coffee", Card: "VISA"}) {
+		t.Error("same day, amount, merchant and card should match")
+	}
+	if d.Contains(&store.Transaction{OccurredAt: day, Amount: 3.5, Merchant: "coffee", Card: "mc"}) ||
+		d.Contains(&store.Transaction{OccurredAt: day.AddDate(0, 0, 1), Amount: 3.5, Merchant: "coffee", Card: "visa"}) {
+		t.Error("different card or day should not match")
+	}
+	d.Add(&store.Transaction{OccurredAt: day, Amount: 1})
+	if d.Contains(&store.Transaction{OccurredAt: day, Amount: 1}) {
+		t.Error("rows without a merchant never match")
+	}
+
+	if !d.Contains(&store.Transaction{OccurredAt: day.AddDate(0, 0, 3), Amount: 9, Merchant: "renamed", Card: "cibc 1234", FITID: "A1"}) {
+		t.Error("same FITID and card should match whatever else changed")
+	}
+	if d.Contains(&store.Transaction{OccurredAt: day, Amount: 2, Merchant: "Bus", Card: "cibc 1234", FITID: "A2"}) {
+		t.Error("a second identical purchase with its own FITID is not a duplicate")
+	}
+	if !d.Contains(&store.Transaction{OccurredAt: day, Amount: 3.5, Merchant: "Coffee", Card: "visa", FITID: "B7"}) {
+		t.Error("a FITID row should match a stored row without one")
+	}
+	if !d.Contains(&store.Transaction{OccurredAt: day, Amount: 2, Merchant: "Bus", Card: "cibc 1234"}) {
+		t.Error("a row without a FITID should match on the key")
+	}
+}
@@ -0,0 +1,331 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"code.sirenko.ca/transaction/rules"
+	"code.sirenko.ca/transaction/store"
+)
+
+// OFX parses bank and credit-card statements in OFX 1.x (SGML, also
+// sold as QFX) and OFX 2.x (XML). Every STMTTRN of every statement
+// becomes a row carrying its FITID, so re-importing the same download
+// is a no-op (see Duplicates).
+//
+// The statement's account becomes the card: the institution's ORG,
+// lower-cased, and the last four digits of ACCTID, e.g. "cibc 4321",
+// or the ACCTID as is when it has fewer than four digits.
+//
+// TRNAMT is from the account's side, so money out becomes a positive
+// expense. Interest, dividends and deposits are income, transfers and
+// card payments are transfers, and any other money in is a negative
+// expense, as for CIBC.
+//
+// A transaction's SIC, where the bank fills it in, is its merchant
+// category code.
+type OFX struct{}
+
+// ofxNode is an element of the parsed document. Leaf elements have a
+// value and no children.
+type ofxNode struct {
+	name     string
+	value    string
+	children []*ofxNode
+}
+
+// child follows path, a list of element names one level apart, and
+// returns the first element it reaches, or nil.
+func (n *ofxNode) child(path ...string) *ofxNode {
+	if len(path) == 0 {
+		return n
+	}
+	for _, c := range n.children {
+		if c.name == path[0] {
+			if found := c.child(path[1:]...); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// text returns the value at path, or "".
+func (n *ofxNode) text(path ...string) string {
+	if c := n.child(path...); c != nil {
+		return c.value
+	}
+	return ""
+}
+
+// walk calls fn for n and every descendant, depth first.
+func (n *ofxNode) walk(fn func(*ofxNode)) {
+	fn(n)
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+func (p OFX) Parse(r io.Reader) ([]Row, error) {
+	rows, _, err := p.ParseBalances(r)
+	return rows, err
+}
+
+// ParseBalances also returns each statement's LEDGERBAL, dated by the
+// local day of its DTASOF.
+func (OFX) ParseBalances(r io.Reader) ([]Row, []Balance, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := parseOFXTree(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	org := strings.ToLower(root.text("SIGNONMSGSRSV1", "SONRS", "FI", "ORG"))
+	var rows []Row
+	var balances []Balance
+	var stmtErr error
+	root.walk(func(n *ofxNode) {
+		if stmtErr != nil || (n.name != "STMTRS" && n.name != "CCSTMTRS") {
+			return
+		}
+		account := n.child("BANKACCTFROM")
+		if n.name == "CCSTMTRS" {
+			account = n.child("CCACCTFROM")
+		}
+		card := ofxCard(org, account)
+		currency := strings.ToUpper(n.text("CURDEF"))
+		if currency == "" {
+			currency = store.DefaultBaseCurrency
+		}
+		if bal := n.child("LEDGERBAL"); bal != nil {
+			b, err := ofxBalance(bal, card, currency)
+			if err != nil {
+				stmtErr = err
+				return
+			}
+			balances = append(balances, b)
+		}
+		list := n.child("BANKTRANLIST")
+		if list == nil {
+			return
+		}
+		for _, t := range list.children {
+			if t.name != "STMTTRN" {
+				continue
+			}
+			row, err := ofxRow(t, card, currency, n.name == "CCSTMTRS")
+			if err != nil {
+				stmtErr = err
+				return
+			}
+			rows = append(rows, row)
+		}
+	})
+	if stmtErr != nil {
+		return nil, nil, stmtErr
+	}
+	return rows, balances, nil
+}
+
+func ofxBalance(n *ofxNode, card, currency string) (Balance, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(n.text("BALAMT"), ",", "."), 64)
+	if err != nil {
+		return Balance{}, fmt.Errorf("importer: ofx: invalid BALAMT %q", n.text("BALAMT"))
+	}
+	asOf, err := parseOFXDate(n.text("DTASOF"))
+	if err != nil {
+		return Balance{}, fmt.Errorf("importer: ofx: balance: %w", err)
+	}
+	y, m, d := asOf.Local().Date()
+	return Balance{Card: card, Amount: amount, Currency: currency, AsOf: time.Date(y, m, d, 0, 0, 0, 0, time.Local)}, nil
+}
+
+func ofxCard(org string, account *ofxNode) string {
+	if account == nil {
+		return org
+	}
+	id := account.text("ACCTID")
+	var digits []rune
+	for _, c := range id {
+		if unicode.IsDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits) >= 4 {
+		id = string(digits[len(digits)-4:])
+	}
+	return strings.TrimSpace(org + " " + id)
+}
+
+func ofxRow(t *ofxNode, card, currency string, creditCard bool) (Row, error) {
+	fitid := t.text("FITID")
+	posted, err := parseOFXDate(t.text("DTPOSTED"))
+	if err != nil {
+		return Row{}, fmt.Errorf("importer: ofx: transaction %q: %w", fitid, err)
+	}
+	trnamt, err := strconv.ParseFloat(strings.ReplaceAll(t.text("TRNAMT"), ",", "."), 64)
+	if err != nil {
+		return Row{}, fmt.Errorf("importer: ofx: transaction %q: invalid TRNAMT %q", fitid, t.text("TRNAMT"))
+	}
+	merchant := t.text("NAME")
+	if merchant == "" {
+		merchant = t.text("PAYEE", "NAME")
+	}
+	memo := t.text("MEMO")
+	if merchant == "" {
+		merchant, memo = memo, ""
+	}
+	if sym := t.text("CURRENCY", "CURSYM"); sym != "" {
+		currency = strings.ToUpper(sym)
+	} else if sym := t.text("ORIGCURRENCY", "CURSYM"); sym != "" {
+		currency = strings.ToUpper(sym)
+	}
+
+	row := Row{
+		OccurredAt: posted,
+		Amount:     -trnamt,
+		Currency:   currency,
+		Merchant:   merchant,
+		Card:       card,
+		Details:    memo,
+		Kind:       store.KindExpense,
+		FITID:      fitid,
+	}
+	if sic := t.text("SIC"); rules.ValidMCC(sic) {
+		row.MCC = sic
+	}
+	switch trnType := strings.ToUpper(t.text("TRNTYPE")); {
+	case trnamt > 0 && (trnType == "INT" || trnType == "DIV" || trnType == "DEP" || trnType == "DIRECTDEP"):
+		row.Kind, row.Amount = store.KindIncome, math.Abs(trnamt)
+	case trnType == "XFER" || (creditCard && trnType == "PAYMENT" && trnamt > 0):
+		row.Kind = store.KindTransfer
+	}
+	return row, nil
+}
+
+// parseOFXDate reads an OFX datetime: YYYYMMDD, optionally followed by
+// HHMMSS, fractional seconds and a [offset:TZ] zone. Without a zone it
+// is UTC, as the spec says; a bare date is local midnight, as for the
+// other importers.
+func parseOFXDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	zone, offset := time.UTC, ""
+	if i := strings.IndexByte(s, '['); i >= 0 {
+		offset, _, _ = strings.Cut(strings.Trim(s[i:], "[]"), ":")
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		s = s[:i]
+	}
+	if offset != "" {
+		hours, err := strconv.ParseFloat(offset, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date zone %q", offset)
+		}
+		zone = time.FixedZone("", int(hours*3600))
+	}
+	switch len(s) {
+	case 8:
+		if offset == "" {
+			zone = time.Local
+		}
+		return time.ParseInLocation("20060102", s, zone)
+	case 12:
+		return time.ParseInLocation("200601021504", s, zone)
+	case 14:
+		return time.ParseInLocation("20060102150405", s, zone)
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseOFXTree parses the body of an OFX file of either version into
+// a tree rooted at the OFX element. The headers (the OFXHEADER lines of
+// 1.x, the XML declaration and processing instruction of 2.x) are
+// skipped. SGML leaf elements have no end tag, so an element followed
+// by text is a leaf whatever comes after it, and an end tag closes
+// every element opened since its start tag.
+func parseOFXTree(data []byte) (*ofxNode, error) {
+	if !utf8.Valid(data) {
+		// 1.x files are usually CHARSET:1252; read bytes as Latin-1,
+		// which agrees with it on letters.
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		data = []byte(string(runes))
+	}
+	s := string(data)
+	start := strings.Index(strings.ToUpper(s), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("importer: ofx: no <OFX> element")
+	}
+	s = s[start:]
+
+	root := &ofxNode{name: "document"}
+	stack := []*ofxNode{root}
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			break
+		}
+		gt := strings.IndexByte(s[lt:], '>')
+		if gt < 0 {
+			return nil, errors.New("importer: ofx: unterminated tag")
+		}
+		tag := strings.TrimSpace(s[lt+1 : lt+gt])
+		s = s[lt+gt+1:]
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+		if tag == "" || tag == "/" {
+			return nil, errors.New("importer: ofx: empty tag")
+		}
+		if name, ok := strings.CutPrefix(tag, "/"); ok {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+			continue
+		}
+		name := strings.ToUpper(strings.TrimSuffix(strings.Fields(tag + " ")[0], "/"))
+		n := &ofxNode{name: name}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, n)
+
+		end := strings.IndexByte(s, '<')
+		if end < 0 {
+			end = len(s)
+		}
+		if text := strings.TrimSpace(s[:end]); text != "" {
+			n.value = html.UnescapeString(text)
+			s = s[end:]
+			// An XML leaf closes itself; skip its end tag.
+			if closing := "</" + name + ">"; len(s) >= len(closing) && strings.EqualFold(s[:len(closing)], closing) {
+				s = s[len(closing):]
+			}
+			continue
+		}
+		if !strings.HasSuffix(tag, "/") {
+			stack = append(stack, n)
+		}
+	}
+	ofx := root.child("OFX")
+	if ofx == nil {
+		return nil, errors.New("importer: ofx: no <OFX> element")
+	}
+	return ofx, nil
+}
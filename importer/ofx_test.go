@@ -0,0 +1,148 @@
+package importer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/export"
+	"code.sirenko.ca/transaction/store"
+)
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+SECURITY:NONE
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS>
+<DTSERVER>20240305120000<LANGUAGE>ENG<FI><ORG>CIBC<FID>10001</FI></SONRS></SIGNONMSGSRSV1>
+<CREDITCARDMSGSRSV1><CCSTMTTRNRS><TRNUID>1<STATUS><CODE>0<SEVERITY>INFO</STATUS>
+<CCSTMTRS><CURDEF>CAD<CCACCTFROM><ACCTID>4500123456789876</CCACCTFROM>
+<BANKTRANLIST><DTSTART>20240301<DTEND>20240305
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240301120000[-8:PST]<TRNAMT>-42.10<FITID>2024030100001<SIC>5411<NAME>SAVE ON FOODS<MEMO>Groceries &amp; more
+</STMTTRN>
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20240302<TRNAMT>5.00<FITID>2024030200002<NAME>SAVE ON FOODS
+</STMTTRN>
+<STMTTRN><TRNTYPE>PAYMENT<DTPOSTED>20240304<TRNAMT>500.00<FITID>2024030400003<NAME>PAYMENT THANK YOU
+</STMTTRN>
+</BANKTRANLIST><LEDGERBAL><BALAMT>-37.10<DTASOF>20240305</LEDGERBAL>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+const ofxXML = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <BANKMSGSRSV1><STMTTRNRS><TRNUID>1</TRNUID>
+    <STMTRS>
+      <CURDEF>USD</CURDEF>
+      <BANKACCTFROM><BANKID>0</BANKID><ACCTID>12</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>
+      <BANKTRANLIST>
+        <STMTTRN><TRNTYPE>INT</TRNTYPE><DTPOSTED>20240301000000.000[0:GMT]</DTPOSTED><TRNAMT>0.42</TRNAMT><FITID>X1</FITID><NAME>Interest</NAME></STMTTRN>
+        <STMTTRN><TRNTYPE>POS</TRNTYPE><DTPOSTED>20240302</DTPOSTED><TRNAMT>-10</TRNAMT><FITID>X2</FITID><PAYEE><NAME>Cafe</NAME></PAYEE><CURRENCY><CURRATE>1.35</CURRATE><CURSYM>CAD</CURSYM></CURRENCY></STMTTRN>
+      </BANKTRANLIST>
+    </STMTRS>
+  </STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+func TestOFXSGML(t *testing.T) {
+	rows, err := OFX{}.Parse(strings.NewReader(ofxSGML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	r := rows[0]
+	want := time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC)
+	if r.FITID != "2024030100001" || r.Card != "cibc 9876" || r.Currency != "CAD" || r.Amount != 42.1 ||
+		r.Merchant != "SAVE ON FOODS" || r.Details != "Groceries & more" || r.Kind != store.KindExpense || !r.OccurredAt.Equal(want) || r.MCC != "5411" {
+		t.Errorf("row 0 = %+v", r)
+	}
+	if r := rows[1]; r.Amount != -5 || r.Kind != store.KindExpense || !r.OccurredAt.Equal(time.Date(2024, 3, 2, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("credit = %+v", r)
+	}
+	if r := rows[2]; r.Kind != store.KindTransfer || r.MCC != "" {
+		t.Errorf("card payment = %+v", r)
+	}
+}
+
+func TestOFXBalances(t *testing.T) {
+	rows, balances, err := OFX{}.ParseBalances(strings.NewReader(ofxSGML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || len(balances) != 1 {
+		t.Fatalf("got %d rows, balances %+v", len(rows), balances)
+	}
+	b := balances[0]
+	if b.Card != "cibc 9876" || b.Amount != -37.1 || b.Currency != "CAD" || !b.AsOf.Equal(time.Date(2024, 3, 5, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("balance = %+v", b)
+	}
+	if _, balances, _ := (OFX{}).ParseBalances(strings.NewReader(ofxXML)); len(balances) != 0 {
+		t.Errorf("statement without LEDGERBAL = %+v", balances)
+	}
+}
+
+func TestOFXXML(t *testing.T) {
+	rows, err := OFX{}.Parse(strings.NewReader(ofxXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	if r := rows[0]; r.Kind != store.KindIncome || r.Amount != 0.42 || r.Card != "12" || r.Currency != "USD" {
+		t.Errorf("interest = %+v", r)
+	}
+	if r := rows[1]; r.Merchant != "Cafe" || r.Amount != 10 || r.Currency != "CAD" {
+		t.Errorf("purchase = %+v", r)
+	}
+
+	if _, err := (OFX{}).Parse(strings.NewReader("not ofx")); err == nil {
+		t.Error("want error without an OFX element")
+	}
+	for _, bad := range []string{"<OFX><>x</OFX>", "<OFX>< >x</OFX>", "<OFX></>", "<OFX><STMTTRN><"} {
+		if _, err := (OFX{}).Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("want error for %q", bad)
+		}
+	}
+}
+
+func TestOFXReimportIsIdempotent(t *testing.T) {
+	rows, err := OFX{}.Parse(strings.NewReader(ofxSGML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored []store.Transaction
+	for i := range rows {
+		stored = append(stored, *rows[i].Transaction(1))
+	}
+	again, _ := OFX{}.Parse(strings.NewReader(strings.ReplaceAll(ofxSGML, "SAVE ON FOODS", "SAVE-ON-FOODS #12")))
+	d := NewDuplicates(stored)
+	for i := range again {
+		if !d.Contains(again[i].Transaction(1)) {
+			t.Errorf("row %d not recognised by FITID", i)
+		}
+	}
+}
+
+func TestOFXReadsExport(t *testing.T) {
+	var buf bytes.Buffer
+	recs := []export.Record{{Transaction: store.Transaction{ID: 7, Amount: 12.5, Currency: "CAD", OccurredAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), Merchant: "Costco", Card: "Visa"}}}
+	if err := export.Write(&buf, export.FormatOFX, recs, export.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := OFX{}.Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].FITID != "7" || rows[0].Amount != 12.5 || rows[0].Card != "Visa" || rows[0].Merchant != "Costco" {
+		t.Fatalf("got %+v", rows)
+	}
+}
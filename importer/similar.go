@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Defaults for the zero SimilarOptions fields.
+const (
+	DefaultSimilarWindow     = 72 * time.Hour
+	DefaultAmountTolerance   = 0.01
+	DefaultMerchantThreshold = 0.6
+)
+
+// SimilarOptions tune FindSimilar; zero fields take the defaults.
+type SimilarOptions struct {
+	// Window is how far apart in time two transactions may be. Cards
+	// often post a purchase a day or two after it was entered by hand.
+	Window time.Duration
+	// AmountTolerance is how far apart the amounts may be, as a
+	// fraction of the larger one.
+	AmountTolerance float64
+	// MerchantThreshold is the smallest MerchantSimilarity of a pair.
+	MerchantThreshold float64
+}
+
+func (o SimilarOptions) withDefaults() SimilarOptions {
+	if o.Window <= 0 {
+		o.Window = DefaultSimilarWindow
+	}
+	if o.AmountTolerance <= 0 {
+		o.AmountTolerance = DefaultAmountTolerance
+	}
+	if o.MerchantThreshold <= 0 {
+		o.MerchantThreshold = DefaultMerchantThreshold
+	}
+	return o
+}
+
+// SimilarPair is two transactions that may be the same purchase
+// recorded twice, A the earlier. Score, from 0 to 1, weighs the
+// merchant similarity most, then how close the times and amounts are.
+type SimilarPair struct {
+	A, B     *store.Transaction
+	Score    float64
+	Merchant float64
+}
+
+// FindSimilar returns the pairs of txns that look like one purchase
+// recorded twice, best first: same currency and kind, amounts within
+// the tolerance, times within the window, similar merchants and, when
+// both have one, the same card. The exact matches Duplicates catches
+// are found too. Two rows that both carry a FITID are distinct
+// statement lines and never pair.
+func FindSimilar(txns []store.Transaction, opts SimilarOptions) []SimilarPair {
+	opts = opts.withDefaults()
+	sorted := make([]*store.Transaction, len(txns))
+	for i := range txns {
+		sorted[i] = &txns[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].OccurredAt.Before(sorted[j].OccurredAt) })
+
+	var out []SimilarPair
+	for i, a := range sorted {
+		for _, b := range sorted[i+1:] {
+			apart := b.OccurredAt.Sub(a.OccurredAt)
+			if apart > opts.Window {
+				break
+			}
+			if a.FITID != "" && b.FITID != "" {
+				continue
+			}
+			if !strings.EqualFold(a.Currency, b.Currency) || a.KindOrDefault() != b.KindOrDefault() {
+				continue
+			}
+			if a.Card != "" && b.Card != "" && !strings.EqualFold(a.Card, b.Card) {
+				continue
+			}
+			larger := math.Max(math.Abs(a.Amount), math.Abs(b.Amount))
+			diff := math.Abs(a.Amount - b.Amount)
+			if diff > larger*opts.AmountTolerance+1e-9 {
+				continue
+			}
+			m := MerchantSimilarity(a.Merchant, b.Merchant)
+			if m < opts.MerchantThreshold {
+				continue
+			}
+			amountScore := 1.0
+			if larger > 0 {
+				amountScore = 1 - diff/(larger*opts.AmountTolerance)
+			}
+			score := 0.6*m + 0.25*(1-float64(apart)/float64(opts.Window)) + 0.15*amountScore
+			out = append(out, SimilarPair{A: a, B: b, Score: math.Round(score*100) / 100, Merchant: math.Round(m*100) / 100})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
+
+// MerchantSimilarity rates two merchant strings from 0 to 1. Both are
+// reduced to their words (letters only, lower-cased), so store numbers
+// and punctuation do not count. The result is the better of the edit
+// similarity of the whole strings and the share of the shorter one's
+// words found in the longer, which matches "Blue Bottle" with
+// "SQ *BLUE BOTTLE COFFEE 0042".
+func MerchantSimilarity(a, b string) float64 {
+	wa, wb := src.MerchantWords(a), src.MerchantWords(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		if len(wa) == 0 && len(wb) == 0 {
+			return 1
+		}
+		return 0
+	}
+	sa, sb := strings.Join(wa, " "), strings.Join(wb, " ")
+	if sa == sb {
+		return 1
+	}
+	best := 1 - float64(levenshtein(sa, sb))/float64(max(len([]rune(sa)), len([]rune(sb))))
+
+	if len(wa) > len(wb) {
+		wa, wb = wb, wa
+	}
+	set := map[string]bool{}
+	for _, w := range wb {
+		set[w] = true
+	}
+	shared, chars := 0, 0
+	for _, w := range wa {
+		if set[w] {
+			shared++
+			chars += len(w)
+		}
+	}
+	// A single short shared word ("the", "ca") is not enough.
+	if chars >= 4 {
+		best = math.Max(best, float64(shared)/float64(len(wa)))
+	}
+	return best
+}
+
+// levenshtein is the edit distance between a and b, in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
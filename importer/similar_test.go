@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestMerchantSimilarity(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"Blue Bottle", "SQ *BLUE BOTTLE COFFEE 0042", 1, 1},
+		{"STARBUCKS #1234", "Starbucks 5678", 1, 1},
+		{"Safeway", "Safeway Store", 1, 1},
+		{"Amazon.ca", "AMAZON CA MARKETPLACE", 0.6, 1},
+		{"Netflix", "Netflx", 0.8, 0.9},
+		{"The Keg", "The Brick", 0, 0.5},
+		{"Shell", "Esso", 0, 0.3},
+	} {
+		if got := MerchantSimilarity(c.a, c.b); got < c.min || got > c.max {
+			t.Errorf("MerchantSimilarity(%q, %q) = %v, want [%v, %v]", c.a, c.b, got, c.min, c.max)
+		}
+	}
+}
+
+func TestFindSimilar(t *testing.T) {
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	txns := []store.Transaction{
+		{ID: 1, Merchant: "Blue Bottle", Amount: 6.5, Currency: "CAD", OccurredAt: day},
+		{ID: 2, Merchant: "SQ *BLUE BOTTLE COFFEE", Amount: 6.5, Currency: "CAD", Card: "Visa", FITID: "F1", OccurredAt: day.AddDate(0, 0, 1)},
+		// Another statement line: both have FITIDs.
+		{ID: 3, Merchant: "SQ *BLUE BOTTLE COFFEE", Amount: 6.5, Currency: "CAD", Card: "Visa", FITID: "F2", OccurredAt: day.AddDate(0, 0, 1)},
+		// Too late, other amount, other currency, other card.
+		{ID: 4, Merchant: "Blue Bottle", Amount: 6.5, Currency: "CAD", OccurredAt: day.AddDate(0, 0, 5)},
+		{ID: 5, Merchant: "Blue Bottle", Amount: 9, Currency: "CAD", OccurredAt: day},
+		{ID: 6, Merchant: "Blue Bottle", Amount: 6.5, Currency: "USD", OccurredAt: day},
+		{ID: 7, Merchant: "Blue Bottle", Amount: 6.5, Currency: "CAD", Card: "Amex", OccurredAt: day.AddDate(0, 0, 1)},
+	}
+	got := FindSimilar(txns, SimilarOptions{})
+	pairs := map[[2]uint64]float64{}
+	for _, p := range got {
+		pairs[[2]uint64{p.A.ID, p.B.ID}] = p.Score
+	}
+	if len(got) != 3 || pairs[[2]uint64{1, 2}] == 0 || pairs[[2]uint64{1, 3}] == 0 || pairs[[2]uint64{1, 7}] == 0 {
+		t.Fatalf("pairs = %v", pairs)
+	}
+	if closer := FindSimilar(txns[:2], SimilarOptions{Window: 48 * time.Hour}); len(closer) != 1 || closer[0].Score >= pairs[[2]uint64{1, 2}] {
+		t.Errorf("a narrower window should score the same day apart lower: %+v", closer)
+	}
+}
@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+// Wealthsimple parses the activity feed the browser extension saves:
+// an array of {"node": {...}} objects. Pending activity, card payments
+// and deposits are skipped, as is activity with no merchant to show.
+//
+// Amounts are stored as magnitudes with the direction in the kind:
+// money out is an expense, money in a refund when Wealthsimple says
+// so and income otherwise (e-transfers in, interest, cashback).
+type Wealthsimple struct{}
+
+type wealthsimpleNode struct {
+	Node struct {
+		Amount        string `json:"amount"`
+		Currency      string `json:"currency"`
+		OccurredAt    string `json:"occurredAt"`
+		SpendMerchant string `json:"spendMerchant"`
+		ETransferName string `json:"eTransferName"`
+		Sign          string `json:"amountSign"`
+		Type          string `json:"type"`
+		Status        string `json:"unifiedStatus"`
+	} `json:"node"`
+}
+
+var wealthsimpleSkipped = map[string]bool{"CREDIT_CARD_PAYMENT": true, "DEPOSIT": true}
+
+func (Wealthsimple) Parse(r io.Reader) ([]Row, error) {
+	var payload []wealthsimpleNode
+	if err := json.NewDecoder(r).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("importer: wealthsimple: %w", err)
+	}
+	rows := make([]Row, 0, len(payload))
+	for i, raw := range payload {
+		node := raw.Node
+		if node.Status == "PENDING" || wealthsimpleSkipped[node.Type] {
+			continue
+		}
+		merchant := node.SpendMerchant
+		if merchant == "" {
+			merchant = node.ETransferName
+		}
+		if merchant == "" {
+			switch node.Type {
+			case "INTEREST":
+				merchant = "Interest"
+			case "REIMBURSEMENT":
+				merchant = "Cashback"
+			default:
+				continue
+			}
+		}
+		occurredAt, err := time.Parse(time.RFC3339Nano, node.OccurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("importer: wealthsimple: node %d: invalid occurredAt %q", i, node.OccurredAt)
+		}
+		amount, err := strconv.ParseFloat(node.Amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("importer: wealthsimple: node %d: invalid amount %q", i, node.Amount)
+		}
+		currency := strings.ToUpper(node.Currency)
+		if currency == "" {
+			currency = store.DefaultBaseCurrency
+		}
+		rows = append(rows, Row{
+			OccurredAt: occurredAt,
+			Amount:     math.Abs(amount),
+			Currency:   currency,
+			Merchant:   merchant,
+			Card:       "wealthsimple",
+			Kind:       wealthsimpleKind(node.Sign, node.Type),
+		})
+	}
+	return rows, nil
+}
+
+func wealthsimpleKind(sign, nodeType string) string {
+	if sign == "negative" {
+		return store.KindExpense
+	}
+	if strings.Contains(strings.ToUpper(nodeType), "REFUND") {
+		return store.KindRefund
+	}
+	return store.KindIncome
+}
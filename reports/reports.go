@@ -0,0 +1,294 @@
+// Package reports aggregates transaction amounts by a dimension
+// (category, subgroup, tag, person, merchant, card or merchant category
+// code) and by calendar period, with period-over-period deltas.
+//
+// The package does no I/O: callers resolve visibility, currency
+// conversion, tags and names into Entries and Build does the
+// arithmetic, so every client gets the same numbers.
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"code.sirenko.ca/transaction/src"
+)
+
+// Dimensions a report can group by.
+const (
+	GroupCategory = "category"
+	GroupSubgroup = "subgroup"
+	GroupTag      = "tag"
+	GroupPerson   = "person"
+	GroupMerchant = "merchant"
+	GroupCard     = "card"
+	GroupMCC      = "mcc"
+)
+
+// Intervals a report can bucket by. IntervalNone puts everything in
+// one period.
+const (
+	IntervalNone  = ""
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// MaxPeriods caps the periods one report may cover.
+const MaxPeriods = 1000
+
+var (
+	ErrUnknownGroup    = errors.New("reports: unknown group")
+	ErrUnknownInterval = errors.New("reports: unknown interval")
+	ErrTooManyPeriods  = errors.New("reports: too many periods")
+)
+
+// ValidGroup and ValidInterval report whether a name is accepted by
+// Build.
+func ValidGroup(g string) bool {
+	switch g {
+	case GroupCategory, GroupSubgroup, GroupTag, GroupPerson, GroupMerchant, GroupCard, GroupMCC:
+		return true
+	}
+	return false
+}
+
+func ValidInterval(i string) bool {
+	switch i {
+	case IntervalNone, IntervalDay, IntervalWeek, IntervalMonth, IntervalYear:
+		return true
+	}
+	return false
+}
+
+// Entry is one transaction's contribution. Keys are its values for the
+// report's dimension: usually one, several for tags, none for a
+// transaction without any (it is reported under the empty key).
+type Entry struct {
+	Time   time.Time
+	Amount float64
+	Keys   []string
+}
+
+// Stats summarize the entries of one group or period.
+type Stats struct {
+	Sum     float64 `json:"sum"`
+	Count   int     `json:"count"`
+	Average float64 `json:"average"`
+}
+
+func (s *Stats) add(v float64) {
+	s.Sum += v
+	s.Count++
+}
+
+func (s *Stats) finish() {
+	s.Sum = src.RoundCents(s.Sum)
+	if s.Count > 0 {
+		s.Average = src.RoundCents(s.Sum / float64(s.Count))
+	}
+}
+
+// Delta compares a sum with the same group's sum in the previous
+// period. Percent is nil when the previous sum was zero.
+type Delta struct {
+	Sum     float64  `json:"sum"`
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+func delta(cur, prev float64) *Delta {
+	d := &Delta{Sum: src.RoundCents(cur - prev)}
+	if prev != 0 {
+		p := src.RoundCents((cur - prev) / math.Abs(prev) * 100)
+		d.Percent = &p
+	}
+	return d
+}
+
+type Group struct {
+	Key string `json:"key"`
+	Stats
+	// Delta is against the previous period; nil in the first period
+	// and without an interval.
+	Delta *Delta `json:"delta,omitempty"`
+}
+
+// Period is one bucket, [Start, End).
+type Period struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Total  Stats     `json:"total"`
+	Delta  *Delta    `json:"delta,omitempty"`
+	Groups []Group   `json:"groups"`
+}
+
+type Report struct {
+	GroupBy  string   `json:"groupBy"`
+	Interval string   `json:"interval"`
+	Periods  []Period `json:"periods"`
+}
+
+// Options select the dimension and buckets. From and To bound the
+// periods generated, To exclusive; a zero bound is the start of the
+// first entry's day or the end of the last one's. Location is the zone periods are cut in; nil means
+// time.Local.
+type Options struct {
+	GroupBy  string
+	Interval string
+	From, To time.Time
+	Location *time.Location
+}
+
+// Build aggregates entries. With an interval every period between From
+// and To is present, empty ones included, so deltas compare adjacent
+// periods; more than MaxPeriods is ErrTooManyPeriods. Within a period
+// groups are ordered by descending sum, then key. A transaction with
+// several keys counts once in each group but once in the period total.
+func Build(entries []Entry, opts Options) (*Report, error) {
+	if !ValidGroup(opts.GroupBy) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownGroup, opts.GroupBy)
+	}
+	if !ValidInterval(opts.Interval) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownInterval, opts.Interval)
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	rep := &Report{GroupBy: opts.GroupBy, Interval: opts.Interval, Periods: []Period{}}
+
+	from, to := opts.From, opts.To
+	if len(entries) > 0 && (from.IsZero() || to.IsZero()) {
+		first, last := entries[0].Time, entries[0].Time
+		for _, e := range entries[1:] {
+			if e.Time.Before(first) {
+				first = e.Time
+			}
+			if e.Time.After(last) {
+				last = e.Time
+			}
+		}
+		if from.IsZero() {
+			from = Truncate(first.In(loc), IntervalDay)
+		}
+		if to.IsZero() {
+			to = Next(Truncate(last.In(loc), IntervalDay), IntervalDay)
+		}
+	}
+	if from.IsZero() || to.IsZero() || !from.Before(to) {
+		return rep, nil
+	}
+
+	type bucket struct {
+		period Period
+		groups map[string]*Group
+	}
+	var buckets []*bucket
+	if opts.Interval == IntervalNone {
+		buckets = append(buckets, &bucket{period: Period{Start: from, End: to}})
+	} else {
+		for start := Truncate(from.In(loc), opts.Interval); start.Before(to); {
+			if len(buckets) == MaxPeriods {
+				return nil, fmt.Errorf("%w: more than %d", ErrTooManyPeriods, MaxPeriods)
+			}
+			end := Next(start, opts.Interval)
+			buckets = append(buckets, &bucket{period: Period{Start: start, End: end}})
+			start = end
+		}
+	}
+	for _, b := range buckets {
+		b.groups = map[string]*Group{}
+	}
+
+	for _, e := range entries {
+		if e.Time.Before(from) || !e.Time.Before(to) {
+			continue
+		}
+		i := sort.Search(len(buckets), func(i int) bool { return e.Time.Before(buckets[i].period.End) })
+		if i == len(buckets) {
+			continue
+		}
+		b := buckets[i]
+		b.period.Total.add(e.Amount)
+		keys := e.Keys
+		if len(keys) == 0 {
+			keys = []string{""}
+		}
+		seen := map[string]bool{}
+		for _, k := range keys {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			g := b.groups[k]
+			if g == nil {
+				g = &Group{Key: k}
+				b.groups[k] = g
+			}
+			g.add(e.Amount)
+		}
+	}
+
+	for i, b := range buckets {
+		p := b.period
+		p.Total.finish()
+		p.Groups = make([]Group, 0, len(b.groups))
+		for _, g := range b.groups {
+			g.finish()
+			p.Groups = append(p.Groups, *g)
+		}
+		if i > 0 && opts.Interval != IntervalNone {
+			prev := buckets[i-1]
+			p.Delta = delta(p.Total.Sum, src.RoundCents(prev.period.Total.Sum))
+			for j := range p.Groups {
+				var prevSum float64
+				if pg := prev.groups[p.Groups[j].Key]; pg != nil {
+					prevSum = pg.Sum
+				}
+				p.Groups[j].Delta = delta(p.Groups[j].Sum, prevSum)
+			}
+		}
+		sort.Slice(p.Groups, func(i, j int) bool {
+			if p.Groups[i].Sum != p.Groups[j].Sum {
+				return p.Groups[i].Sum > p.Groups[j].Sum
+			}
+			return p.Groups[i].Key < p.Groups[j].Key
+		})
+		rep.Periods = append(rep.Periods, p)
+	}
+	return rep, nil
+}
+
+// Truncate returns the start of the period containing t, in t's
+// location. Weeks start on Monday.
+func Truncate(t time.Time, interval string) time.Time {
+	y, m, d := t.Date()
+	switch interval {
+	case IntervalWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+	case IntervalMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	case IntervalYear:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// Next returns the start of the period after the one starting at
+// start.
+func Next(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	case IntervalYear:
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
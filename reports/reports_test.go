@@ -0,0 +1,145 @@
+package reports
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func day(m time.Month, d int) time.Time {
+	return time.Date(2024, m, d, 12, 0, 0, 0, time.UTC)
+}
+
+func build(t *testing.T, entries []Entry, opts Options) *Report {
+	t.Helper()
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	rep, err := Build(entries, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rep
+}
+
+func group(p Period, key string) *Group {
+	for i := range p.Groups {
+		if p.Groups[i].Key == key {
+			return &p.Groups[i]
+		}
+	}
+	return nil
+}
+
+func TestBuildMonthlyDeltas(t *testing.T) {
+	entries := []Entry{
+		{Time: day(1, 5), Amount: 40, Keys: []string{"food"}},
+		{Time: day(1, 20), Amount: 60, Keys: []string{"food"}},
+		{Time: day(1, 21), Amount: 10, Keys: []string{"fun"}},
+		{Time: day(3, 2), Amount: 150, Keys: []string{"food"}},
+	}
+	rep := build(t, entries, Options{GroupBy: GroupCategory, Interval: IntervalMonth})
+	if len(rep.Periods) != 3 {
+		t.Fatalf("periods = %d, want Jan..Mar", len(rep.Periods))
+	}
+	jan, feb, mar := rep.Periods[0], rep.Periods[1], rep.Periods[2]
+	if !jan.Start.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !jan.End.Equal(feb.Start) {
+		t.Errorf("jan = %v..%v", jan.Start, jan.End)
+	}
+	if jan.Total != (Stats{Sum: 110, Count: 3, Average: 36.67}) || jan.Delta != nil {
+		t.Errorf("jan total = %+v delta %+v", jan.Total, jan.Delta)
+	}
+	if g := jan.Groups[0]; g.Key != "food" || g.Sum != 100 || g.Average != 50 {
+		t.Errorf("jan top group = %+v", g)
+	}
+	if len(feb.Groups) != 0 || feb.Delta == nil || feb.Delta.Sum != -110 || *feb.Delta.Percent != -100 {
+		t.Errorf("feb = %+v", feb)
+	}
+	food := group(mar, "food")
+	if food == nil || food.Delta == nil || food.Delta.Sum != 150 || food.Delta.Percent != nil {
+		t.Errorf("mar food = %+v, want +150 with no percent against an empty month", food)
+	}
+}
+
+func TestBuildWeeksStartMonday(t *testing.T) {
+	// 2024-03-03 is a Sunday, 03-04 a Monday.
+	entries := []Entry{
+		{Time: day(3, 3), Amount: 1, Keys: []string{"a"}},
+		{Time: day(3, 4), Amount: 2, Keys: []string{"a"}},
+	}
+	rep := build(t, entries, Options{GroupBy: GroupCategory, Interval: IntervalWeek})
+	if len(rep.Periods) != 2 {
+		t.Fatalf("periods = %d, want 2", len(rep.Periods))
+	}
+	if got := rep.Periods[1].Start; got.Weekday() != time.Monday || got.Day() != 4 {
+		t.Errorf("second week starts %v", got)
+	}
+	if d := rep.Periods[1].Groups[0].Delta; d == nil || d.Sum != 1 || *d.Percent != 100 {
+		t.Errorf("delta = %+v", d)
+	}
+}
+
+func TestBuildMultipleAndMissingKeys(t *testing.T) {
+	entries := []Entry{
+		{Time: day(1, 1), Amount: 10, Keys: []string{"trip", "work", "trip"}},
+		{Time: day(1, 2), Amount: 5},
+	}
+	rep := build(t, entries, Options{GroupBy: GroupTag})
+	if len(rep.Periods) != 1 {
+		t.Fatalf("periods = %d, want one without an interval", len(rep.Periods))
+	}
+	p := rep.Periods[0]
+	if p.Total.Sum != 15 || p.Total.Count != 2 {
+		t.Errorf("total = %+v, want each transaction once", p.Total)
+	}
+	if g := group(p, "trip"); g == nil || g.Count != 1 || g.Delta != nil {
+		t.Errorf("trip = %+v", g)
+	}
+	if g := group(p, "work"); g == nil || g.Sum != 10 {
+		t.Errorf("work = %+v", g)
+	}
+	if g := group(p, ""); g == nil || g.Sum != 5 {
+		t.Errorf("untagged = %+v", g)
+	}
+	if !p.Start.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !p.End.Equal(time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("bounds = %v..%v, want whole days", p.Start, p.End)
+	}
+}
+
+func TestBuildBounds(t *testing.T) {
+	entries := []Entry{
+		{Time: day(1, 31), Amount: 1, Keys: []string{"a"}},
+		{Time: day(2, 1), Amount: 2, Keys: []string{"a"}},
+	}
+	from := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)
+	rep := build(t, entries, Options{GroupBy: GroupCategory, Interval: IntervalDay, From: from, To: to})
+	if len(rep.Periods) != 3 {
+		t.Fatalf("periods = %d, want 3 days", len(rep.Periods))
+	}
+	if rep.Periods[0].Total.Sum != 2 || rep.Periods[2].Total.Count != 0 {
+		t.Errorf("periods = %+v", rep.Periods)
+	}
+
+	rep = build(t, nil, Options{GroupBy: GroupCard, Interval: IntervalYear})
+	if rep.Periods == nil || len(rep.Periods) != 0 {
+		t.Errorf("empty report = %+v", rep)
+	}
+}
+
+func TestBuildRejectsUnknownOptions(t *testing.T) {
+	if _, err := Build(nil, Options{GroupBy: "colour"}); !errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("group err = %v", err)
+	}
+	if _, err := Build(nil, Options{GroupBy: GroupCard, Interval: "fortnight"}); !errors.Is(err, ErrUnknownInterval) {
+		t.Errorf("interval err = %v", err)
+	}
+	from := time.Date(2, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := Build(nil, Options{GroupBy: GroupCard, Interval: IntervalDay, From: from, To: to}); !errors.Is(err, ErrTooManyPeriods) {
+		t.Errorf("periods err = %v", err)
+	}
+	if rep, err := Build(nil, Options{GroupBy: GroupCard, Interval: IntervalYear, From: from, To: from.AddDate(MaxPeriods, 0, 0)}); err != nil || len(rep.Periods) != MaxPeriods {
+		t.Errorf("max periods = %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"code.sirenko.ca/transaction/src"
+)
+
+// MCCSetting holds the MCCTable that overrides DefaultMCC, see Load.
+const MCCSetting = "mcc_map"
+
+// MCCTable maps merchant category codes to categories. A key is a
+// four-digit code ("5812") or an inclusive range of them
+// ("3000-3299"). An exact key wins over ranges and a narrower range
+// over a wider one.
+type MCCTable map[string]string
+
+// DefaultMCC is the built-in table.
+var DefaultMCC = MCCTable(src.MCCCategories)
+
+// ValidMCC reports whether s is a four-digit merchant category code.
+func ValidMCC(s string) bool {
+	if len(s) != 4 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMCCRange reads a code or a "lo-hi" range of codes.
+func parseMCCRange(s string) (lo, hi int, ok bool) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	if !isRange {
+		to = from
+	}
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ValidMCC(from) || !ValidMCC(to) {
+		return 0, 0, false
+	}
+	lo, _ = strconv.Atoi(from)
+	hi, _ = strconv.Atoi(to)
+	return lo, hi, lo <= hi
+}
+
+// inMCCRange reports whether the code mcc falls in the key r.
+func inMCCRange(r, mcc string) bool {
+	lo, hi, ok := parseMCCRange(r)
+	if !ok || !ValidMCC(mcc) {
+		return false
+	}
+	code, _ := strconv.Atoi(mcc)
+	return code >= lo && code <= hi
+}
+
+// Category returns the category m gives the code mcc, or "".
+func (m MCCTable) Category(mcc string) string {
+	if c, ok := m[mcc]; ok {
+		return c
+	}
+	best, width := "", -1
+	for key, c := range m {
+		lo, hi, ok := parseMCCRange(key)
+		if !ok || !inMCCRange(key, mcc) {
+			continue
+		}
+		if w := hi - lo; width < 0 || w < width || w == width && c < best {
+			best, width = c, w
+		}
+	}
+	return best
+}
+
+// Merge returns m with over's entries on top. An entry of over with an
+// empty category removes m's entry for the same key.
+func (m MCCTable) Merge(over MCCTable) MCCTable {
+	out := MCCTable{}
+	for k, c := range m {
+		out[k] = c
+	}
+	for k, c := range over {
+		k = strings.TrimSpace(k)
+		if c == "" {
+			delete(out, k)
+			continue
+		}
+		out[k] = c
+	}
+	return out
+}
+
+// ValidateMCCTable reports keys that are not a code or a range, keyed
+// by the key itself.
+func ValidateMCCTable(m MCCTable) map[string]string {
+	fields := map[string]string{}
+	for k := range m {
+		if _, _, ok := parseMCCRange(k); !ok {
+			fields[k] = fmt.Sprintf("%q is not a four-digit code or a lo-hi range of codes", k)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,51 @@
+package rules
+
+import (
+	"slices"
+	"testing"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestMCCTable(t *testing.T) {
+	m := MCCTable{"3000-3999": "travel", "3500-3999": "hotel", "3501": "motel", "5812": "takeouts"}
+	for mcc, want := range map[string]string{"3501": "motel", "3600": "hotel", "3100": "travel", "5812": "takeouts", "5813": "", "": "", "12ab": ""} {
+		if got := m.Category(mcc); got != want {
+			t.Errorf("Category(%q) = %q, want %q", mcc, got, want)
+		}
+	}
+	merged := m.Merge(MCCTable{"5812": "restaurants", "3501": ""})
+	if merged.Category("5812") != "restaurants" || merged.Category("3501") != "hotel" || m.Category("5812") != "takeouts" {
+		t.Errorf("merged = %v", merged)
+	}
+	if fields := ValidateMCCTable(MCCTable{"581": "x", "5814-5811": "x", "5811-5814": "x"}); len(fields) != 2 {
+		t.Errorf("invalid keys = %v", fields)
+	}
+}
+
+func TestMCCFallback(t *testing.T) {
+	e := Chain(compile(t, []Rule{{Name: "gym", When: Condition{MerchantContains: "gym"}, Then: Action{SetCategory: "sport"}}}),
+		FromMCC(MCCTable{"5812": "takeouts", "7997": "clubs"}))
+
+	tr := &store.Transaction{Merchant: "Corner Gym", MCC: "7997"}
+	if o := e.Eval(tr); o.Category != "sport" || o.FromMCC {
+		t.Errorf("rule should win: %+v", o)
+	}
+	tr = &store.Transaction{Merchant: "Noodle Bar", MCC: "5812"}
+	o := e.Eval(tr)
+	if o.Category != "takeouts" || !o.FromMCC || !slices.Equal(o.Rules, []string{"mcc 5812"}) {
+		t.Errorf("fallback = %+v", o)
+	}
+
+	// The code only fills in, even when overwriting.
+	tr.Category = "date night"
+	e.Apply(tr, nil, true)
+	if tr.Category != "date night" {
+		t.Errorf("overwrote with the MCC category: %q", tr.Category)
+	}
+	tr.Category = Unknown
+	e.Apply(tr, nil, false)
+	if tr.Category != "takeouts" {
+		t.Errorf("unknown not filled: %q", tr.Category)
+	}
+}
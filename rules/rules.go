@@ -0,0 +1,414 @@
+// Package rules categorizes transactions with an ordered list of
+// user-defined rules.
+//
+// A rule has conditions (When) and actions (Then). It matches a
+// transaction when every condition it sets holds; unset conditions are
+// ignored. Rules run in order and every matching rule contributes its
+// actions: the first one to set the category or details wins, tags
+// accumulate and any of them can mark the transaction a transfer.
+//
+// The server runs the rules on every insert and import, and can re-run
+// them over stored transactions. They come from three places, in order:
+// the rules setting, the merchant substrings of the categories_map
+// setting, then Defaults (see Load). A transaction no rule gives a
+// category falls back to its merchant category code (see MCCTable).
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Settings keys Load reads.
+const (
+	// Setting holds the []Rule of users who have not set their own
+	// (see store.User.Rules).
+	Setting = "rules"
+	// CategoriesSetting holds the older category → merchant substrings
+	// map, see FromCategories.
+	CategoriesSetting = "categories_map"
+)
+
+// Unknown is the category given to transactions no rule matches. A
+// stored category of Unknown counts as unset.
+const Unknown = "unknown"
+
+// Condition is what a transaction must look like for a rule to match.
+// Text comparisons ignore case.
+type Condition struct {
+	// MerchantContains is a substring of the merchant. Merchant
+	// conditions match the canonical name of a normalized transaction
+	// or its raw string (see store.Merchant).
+	MerchantContains string `json:"merchantContains,omitempty"`
+	// MerchantRegex is a Go regular expression matched against the
+	// merchant; prefix it with (?i) to ignore case.
+	MerchantRegex string `json:"merchantRegex,omitempty"`
+	// AmountMin and AmountMax bound the amount as stored, inclusive.
+	AmountMin *float64 `json:"amountMin,omitempty"`
+	AmountMax *float64 `json:"amountMax,omitempty"`
+	Card      string   `json:"card,omitempty"`
+	Currency  string   `json:"currency,omitempty"`
+	// Weekdays lists the days the transaction may fall on, as English
+	// names or their three-letter abbreviations.
+	Weekdays []string `json:"weekdays,omitempty"`
+	// MCC is a merchant category code or an inclusive range of them,
+	// as in "5812" or "5811-5814".
+	MCC string `json:"mcc,omitempty"`
+}
+
+// Action is what a matching rule does.
+type Action struct {
+	SetCategory string   `json:"setCategory,omitempty"`
+	AddTags     []string `json:"addTags,omitempty"`
+	SetDetails  string   `json:"setDetails,omitempty"`
+	// MarkTransfer sets the kind to transfer. Linked refunds are left
+	// alone.
+	MarkTransfer bool `json:"markTransfer,omitempty"`
+}
+
+type Rule struct {
+	Name     string    `json:"name"`
+	When     Condition `json:"when"`
+	Then     Action    `json:"then"`
+	Disabled bool      `json:"disabled,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) < 3 {
+		return 0, false
+	}
+	d, ok := weekdays[s[:3]]
+	if !ok || (len(s) > 3 && s != strings.ToLower(d.String())) {
+		return 0, false
+	}
+	return d, true
+}
+
+// Validate reports what is wrong with each rule, keyed
+// [index].field with JSON field names. An empty map means rs compiles.
+func Validate(rs []Rule) map[string]string {
+	fields := map[string]string{}
+	for i, r := range rs {
+		key := fmt.Sprintf("[%d]", i)
+		w := r.When
+		if w.MerchantContains == "" && w.MerchantRegex == "" && w.AmountMin == nil && w.AmountMax == nil &&
+			w.Card == "" && w.Currency == "" && len(w.Weekdays) == 0 && w.MCC == "" {
+			fields[key+".when"] = "at least one condition is required"
+		}
+		if w.MerchantRegex != "" {
+			if _, err := regexp.Compile(w.MerchantRegex); err != nil {
+				fields[key+".when.merchantRegex"] = err.Error()
+			}
+		}
+		if w.AmountMin != nil && w.AmountMax != nil && *w.AmountMin > *w.AmountMax {
+			fields[key+".when.amountMax"] = "must not be less than amountMin"
+		}
+		if w.MCC != "" {
+			if _, _, ok := parseMCCRange(w.MCC); !ok {
+				fields[key+".when.mcc"] = "must be a four-digit code or a lo-hi range of codes"
+			}
+		}
+		for _, d := range w.Weekdays {
+			if _, ok := parseWeekday(d); !ok {
+				fields[key+".when.weekdays"] = fmt.Sprintf("unknown weekday %q", d)
+			}
+		}
+		t := r.Then
+		if t.SetCategory == "" && len(t.AddTags) == 0 && t.SetDetails == "" && !t.MarkTransfer {
+			fields[key+".then"] = "at least one action is required"
+		}
+	}
+	return fields
+}
+
+type compiled struct {
+	Rule
+	re   *regexp.Regexp
+	days map[time.Weekday]bool
+}
+
+func (c *compiled) match(t *store.Transaction) bool {
+	w := &c.When
+	if w.MerchantContains != "" && !anyMerchant(t, func(m string) bool {
+		return strings.Contains(strings.ToLower(m), strings.ToLower(w.MerchantContains))
+	}) {
+		return false
+	}
+	if c.re != nil && !anyMerchant(t, c.re.MatchString) {
+		return false
+	}
+	if w.AmountMin != nil && t.Amount < *w.AmountMin {
+		return false
+	}
+	if w.AmountMax != nil && t.Amount > *w.AmountMax {
+		return false
+	}
+	if w.Card != "" && !strings.EqualFold(w.Card, t.Card) {
+		return false
+	}
+	if w.Currency != "" && !strings.EqualFold(w.Currency, t.Currency) {
+		return false
+	}
+	if w.MCC != "" && !inMCCRange(w.MCC, t.MCC) {
+		return false
+	}
+	return c.days == nil || c.days[t.OccurredAt.Weekday()]
+}
+
+// anyMerchant reports whether fn holds for t's merchant or, when it was
+// normalized, its raw merchant string.
+func anyMerchant(t *store.Transaction, fn func(string) bool) bool {
+	return fn(t.Merchant) || t.RawMerchant != "" && fn(t.RawMerchant)
+}
+
+// Engine evaluates rules in order, then looks up the merchant category
+// code of transactions no rule gave a category. The zero value and nil
+// have no rules.
+type Engine struct {
+	rules []compiled
+	mcc   []MCCTable
+}
+
+// ErrInvalid is returned by Compile for rules Validate rejects.
+var ErrInvalid = errors.New("rules: invalid rule")
+
+// Compile checks rs and prepares them for evaluation. Disabled rules
+// are validated but never match.
+func Compile(rs []Rule) (*Engine, error) {
+	if fields := Validate(rs); len(fields) > 0 {
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalid, keys[0], fields[keys[0]])
+	}
+	e := &Engine{}
+	for _, r := range rs {
+		if r.Disabled {
+			continue
+		}
+		c := compiled{Rule: r}
+		if r.When.MerchantRegex != "" {
+			c.re = regexp.MustCompile(r.When.MerchantRegex)
+		}
+		if len(r.When.Weekdays) > 0 {
+			c.days = map[time.Weekday]bool{}
+			for _, d := range r.When.Weekdays {
+				wd, _ := parseWeekday(d)
+				c.days[wd] = true
+			}
+		}
+		e.rules = append(e.rules, c)
+	}
+	return e, nil
+}
+
+// Chain returns an engine running the rules of each engine in turn,
+// and consulting their MCC tables in turn. Nil engines are skipped.
+func Chain(engines ...*Engine) *Engine {
+	out := &Engine{}
+	for _, e := range engines {
+		if e != nil {
+			out.rules = append(out.rules, e.rules...)
+			out.mcc = append(out.mcc, e.mcc...)
+		}
+	}
+	return out
+}
+
+// FromMCC returns an engine with no rules that categorizes by t.
+func FromMCC(t MCCTable) *Engine {
+	return &Engine{mcc: []MCCTable{t}}
+}
+
+// FromCategories turns a category → merchant substrings map, the
+// shape of the categories_map setting, into one rule per substring.
+// Categories are taken in name order so the result does not depend on
+// map iteration.
+func FromCategories(m map[string][]string) []Rule {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out []Rule
+	for _, name := range names {
+		for _, pattern := range m[name] {
+			if pattern == "" {
+				continue
+			}
+			out = append(out, Rule{
+				Name: name,
+				When: Condition{MerchantContains: pattern},
+				Then: Action{SetCategory: name},
+			})
+		}
+	}
+	return out
+}
+
+// Defaults are the built-in rules, consulted after the user's.
+var Defaults = FromCategories(src.Categories)
+
+var defaultEngine, _ = Compile(Defaults)
+
+// Outcome is the combined actions of the rules matching a
+// transaction.
+type Outcome struct {
+	Category string
+	Details  string
+	Tags     []string
+	Transfer bool
+	// Rules are the names of the matching rules, in order, followed by
+	// "mcc NNNN" when the category came from the merchant category
+	// code.
+	Rules []string
+	// FromMCC is set when Category came from the merchant category
+	// code rather than a rule.
+	FromMCC bool
+}
+
+// Eval runs the rules against t without changing it.
+func (e *Engine) Eval(t *store.Transaction) Outcome {
+	var o Outcome
+	if e == nil {
+		return o
+	}
+	for i := range e.rules {
+		c := &e.rules[i]
+		if !c.match(t) {
+			continue
+		}
+		o.Rules = append(o.Rules, c.Name)
+		if o.Category == "" {
+			o.Category = c.Then.SetCategory
+		}
+		if o.Details == "" {
+			o.Details = c.Then.SetDetails
+		}
+		o.Tags = appendNew(o.Tags, c.Then.AddTags...)
+		o.Transfer = o.Transfer || c.Then.MarkTransfer
+	}
+	if o.Category == "" && t.MCC != "" {
+		for _, tbl := range e.mcc {
+			if c := tbl.Category(t.MCC); c != "" {
+				o.Category, o.FromMCC = c, true
+				o.Rules = append(o.Rules, "mcc "+t.MCC)
+				break
+			}
+		}
+	}
+	return o
+}
+
+// Apply runs the rules against t and its tags and writes the outcome
+// into t, returning the new tags. Matching tags are added to the
+// existing ones. Without overwrite the rules only fill in: the category
+// if it is empty or Unknown, details if empty, and the kind if the
+// transaction is a plain expense. With overwrite a rule's category and
+// details replace what is there. A transaction linked to a purchase as
+// its refund is never made a transfer. A category from the merchant
+// category code only ever fills in.
+func (e *Engine) Apply(t *store.Transaction, tags []string, overwrite bool) []string {
+	o := e.Eval(t)
+	if o.Category != "" && (overwrite && !o.FromMCC || t.Category == "" || strings.EqualFold(t.Category, Unknown)) {
+		t.Category = o.Category
+	}
+	if o.Details != "" && (overwrite || t.Details == "") {
+		t.Details = o.Details
+	}
+	if o.Transfer && t.RefundOf == 0 && (overwrite || t.KindOrDefault() == store.KindExpense) {
+		t.Kind = store.KindTransfer
+	}
+	return appendNew(tags, o.Tags...)
+}
+
+func appendNew(tags []string, add ...string) []string {
+	for _, tag := range add {
+		if tag == "" {
+			continue
+		}
+		dup := false
+		for _, have := range tags {
+			dup = dup || have == tag
+		}
+		if !dup {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Load returns the engine the server runs for userID: the user's own
+// rules, or the rules setting if they have none, then the
+// categories_map setting, then Defaults, falling back to DefaultMCC
+// overridden by the mcc_map setting. A setting that is missing is
+// skipped; one that does not parse or compile is skipped and reported
+// in the returned error, which callers may log and otherwise ignore.
+func Load(s *store.Store, userID uint64) (*Engine, error) {
+	var errs []error
+	var user, legacy *Engine
+	raw, err := UserRules(s, userID)
+	if err == nil {
+		var rs []Rule
+		if err := json.Unmarshal(raw, &rs); err != nil {
+			errs = append(errs, fmt.Errorf("rules of user %d: %w", userID, err))
+		} else if user, err = Compile(rs); err != nil {
+			errs = append(errs, fmt.Errorf("rules of user %d: %w", userID, err))
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		errs = append(errs, err)
+	}
+	if raw, err := s.GetSetting(CategoriesSetting); err == nil {
+		var m map[string][]string
+		if err := json.Unmarshal(raw, &m); err != nil {
+			errs = append(errs, fmt.Errorf("%s setting: %w", CategoriesSetting, err))
+		} else {
+			legacy, _ = Compile(FromCategories(m))
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		errs = append(errs, err)
+	}
+	mcc := DefaultMCC
+	if raw, err := s.GetSetting(MCCSetting); err == nil {
+		var over MCCTable
+		if err := json.Unmarshal(raw, &over); err != nil {
+			errs = append(errs, fmt.Errorf("%s setting: %w", MCCSetting, err))
+		} else {
+			mcc = mcc.Merge(over)
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		errs = append(errs, err)
+	}
+	return Chain(user, legacy, defaultEngine, FromMCC(mcc)), errors.Join(errs...)
+}
+
+// UserRules returns the stored []Rule JSON that applies to userID: their
+// own, or the rules setting. It returns store.ErrNotFound if neither is
+// set.
+func UserRules(s *store.Store, userID uint64) (json.RawMessage, error) {
+	u, err := s.GetUserByID(userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && u.Rules != nil {
+		return u.Rules, nil
+	}
+	return s.GetSetting(Setting)
+}
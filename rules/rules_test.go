@@ -0,0 +1,119 @@
+package rules
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func ptr(f float64) *float64 { return &f }
+
+func compile(t *testing.T, rs []Rule) *Engine {
+	t.Helper()
+	e, err := Compile(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestConditions(t *testing.T) {
+	sat := time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)
+	base := store.Transaction{Merchant: "UBER *TRIP", RawMerchant: "UBER CANADA/UBERTRIP 8005928996", Amount: 25, Card: "Visa", Currency: "CAD", MCC: "4121", OccurredAt: sat}
+	for _, tc := range []struct {
+		name string
+		when Condition
+		want bool
+	}{
+		{"substring ignores case", Condition{MerchantContains: "uber"}, true},
+		{"substring", Condition{MerchantContains: "lyft"}, false},
+		{"regex", Condition{MerchantRegex: `(?i)^uber \*`}, true},
+		{"regex is case-sensitive", Condition{MerchantRegex: `^uber`}, false},
+		{"raw merchant", Condition{MerchantContains: "canada/uber"}, true},
+		{"raw merchant regex", Condition{MerchantRegex: `\d{10}$`}, true},
+		{"amount in range", Condition{AmountMin: ptr(25), AmountMax: ptr(30)}, true},
+		{"amount below", Condition{AmountMin: ptr(25.01)}, false},
+		{"card", Condition{Card: "visa"}, true},
+		{"currency", Condition{Currency: "usd"}, false},
+		{"weekday", Condition{Weekdays: []string{"Saturday", "sun"}}, true},
+		{"weekday", Condition{Weekdays: []string{"mon"}}, false},
+		{"mcc", Condition{MCC: "4121"}, true},
+		{"mcc range", Condition{MCC: "4000-4799"}, true},
+		{"mcc outside range", Condition{MCC: "5811-5814"}, false},
+		{"all must hold", Condition{MerchantContains: "uber", Currency: "USD"}, false},
+	} {
+		e := compile(t, []Rule{{Name: tc.name, When: tc.when, Then: Action{SetCategory: "x"}}})
+		tr := base
+		if got := e.Eval(&tr).Category == "x"; got != tc.want {
+			t.Errorf("%s: matched = %v", tc.name, got)
+		}
+	}
+}
+
+func TestOrderAndApply(t *testing.T) {
+	e := compile(t, []Rule{
+		{Name: "off", When: Condition{MerchantContains: "uber"}, Then: Action{SetCategory: "never"}, Disabled: true},
+		{Name: "eats", When: Condition{MerchantContains: "uber eats"}, Then: Action{SetCategory: "takeouts", AddTags: []string{"delivery"}}},
+		{Name: "uber", When: Condition{MerchantContains: "uber"}, Then: Action{SetCategory: "transportation", AddTags: []string{"uber", "delivery"}, SetDetails: "ride"}},
+		{Name: "card payment", When: Condition{MerchantRegex: "PAYMENT"}, Then: Action{MarkTransfer: true}},
+	})
+
+	tr := &store.Transaction{Merchant: "Uber Eats", Category: "unknown"}
+	o := e.Eval(tr)
+	if o.Category != "takeouts" || !slices.Equal(o.Rules, []string{"eats", "uber"}) {
+		t.Errorf("outcome = %+v", o)
+	}
+	tags := e.Apply(tr, []string{"food"}, false)
+	if tr.Category != "takeouts" || tr.Details != "ride" || !slices.Equal(tags, []string{"food", "delivery", "uber"}) {
+		t.Errorf("applied = %+v %v", tr, tags)
+	}
+
+	// Without overwrite what is set stays; with it the rules win.
+	tr = &store.Transaction{Merchant: "UBER", Category: "work", Details: "client"}
+	e.Apply(tr, nil, false)
+	if tr.Category != "work" || tr.Details != "client" {
+		t.Errorf("fill changed %+v", tr)
+	}
+	e.Apply(tr, nil, true)
+	if tr.Category != "transportation" || tr.Details != "ride" {
+		t.Errorf("overwrite = %+v", tr)
+	}
+
+	tr = &store.Transaction{Merchant: "PAYMENT THANK YOU"}
+	e.Apply(tr, nil, false)
+	if tr.Kind != store.KindTransfer {
+		t.Errorf("kind = %q", tr.Kind)
+	}
+	tr = &store.Transaction{Merchant: "PAYMENT", Kind: store.KindRefund, RefundOf: 3}
+	e.Apply(tr, nil, true)
+	if tr.Kind != store.KindRefund {
+		t.Errorf("linked refund became %q", tr.Kind)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fields := Validate([]Rule{
+		{Then: Action{SetCategory: "x"}},
+		{When: Condition{MerchantRegex: "(", AmountMin: ptr(5), AmountMax: ptr(1), Weekdays: []string{"funday"}, MCC: "5814-5811"}},
+	})
+	for _, k := range []string{"[0].when", "[1].when.merchantRegex", "[1].when.amountMax", "[1].when.weekdays", "[1].when.mcc", "[1].then"} {
+		if fields[k] == "" {
+			t.Errorf("missing %s in %v", k, fields)
+		}
+	}
+	if _, err := Compile([]Rule{{}}); err == nil {
+		t.Error("Compile should reject an empty rule")
+	}
+}
+
+func TestFromCategoriesIsOrdered(t *testing.T) {
+	m := map[string][]string{"b": {"shop"}, "a": {"", "shop"}}
+	for range 10 {
+		e := compile(t, FromCategories(m))
+		if got := e.Eval(&store.Transaction{Merchant: "The Shop"}).Category; got != "a" {
+			t.Fatalf("got %q", got)
+		}
+	}
+}
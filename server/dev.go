@@ -4,4 +4,7 @@ package server
 
 const Production = false
 
-var BuildTime = "-"
+var (
+	BuildTime = "-"
+	GitCommit = "-"
+)
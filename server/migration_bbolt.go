@@ -1,37 +1,329 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"sort"
+	"time"
 
-	bolt "go.etcd.io/bbolt"
 	"code.sirenko.ca/transaction/server/migrations_bbolt"
 	"code.sirenko.ca/transaction/store"
+	bolt "go.etcd.io/bbolt"
 )
 
+// appliedKey is the meta key recording that a migration ran. The value
+// is the RFC3339 time it was applied; databases migrated before that
+// was recorded hold "1" instead.
+func appliedKey(version string) []byte { return []byte("applied:" + version) }
+
 // ApplyMigrationsBbolt runs every registered migration exactly once, in
 // lexicographic Version order. Already-applied versions are recorded in
 // the `meta` bucket under key "applied:"+Version.
+//
+// Each migration commits in its own transaction together with its
+// applied marker; data migrations (Migration.Data) commit once per
+// batch and resume from their checkpoint if interrupted.
+//
+// If anything is pending on a database that already has migrations
+// applied, a copy of the file is written next to it first (see
+// BackupBeforeMigrate).
+//
+// It refuses to touch a database that has migrations applied which
+// this build does not know about; see ApplyMigrationsBboltWith to
+// override that.
 func ApplyMigrationsBbolt(s *store.Store) error {
+	return applyMigrations(s, migrationsbbolt.All, MigrateOptions{})
+}
+
+// ApplyMigrationsBboltWith is ApplyMigrationsBbolt with options.
+func ApplyMigrationsBboltWith(s *store.Store, opts MigrateOptions) error {
+	return applyMigrations(s, migrationsbbolt.All, opts)
+}
+
+func applyMigrations(s *store.Store, all []migrationsbbolt.Migration, opts MigrateOptions) error {
+	if err := checkSchemaNotNewer(s, all, opts); err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(s, all)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		if err := BackupBeforeMigrate(s, pending[0].Version); err != nil {
+			return fmt.Errorf("pre-migration backup: %w", err)
+		}
+	}
 	if err := s.Init(); err != nil {
 		return fmt.Errorf("init buckets: %w", err)
 	}
-	return s.Update(func(tx *bolt.Tx) error {
+	isPending := map[string]bool{}
+	for _, m := range pending {
+		isPending[m.Version] = true
+	}
+	for _, m := range all {
+		if !isPending[m.Version] {
+			log.Printf("migration %s already applied", m.Version)
+			continue
+		}
+		if m.Data != nil {
+			if err := runDataMigration(s, m); err != nil {
+				return err
+			}
+			continue
+		}
+		err := s.Update(func(tx *bolt.Tx) error {
+			log.Printf("applying migration %s", m.Version)
+			if err := m.Apply(tx); err != nil {
+				return fmt.Errorf("migration %s: %w", m.Version, err)
+			}
+			return markApplied(tx.Bucket([]byte("meta")), m.Version)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return recordSchemaWriter(s)
+}
+
+func markApplied(meta *bolt.Bucket, version string) error {
+	return meta.Put(appliedKey(version), []byte(time.Now().UTC().Format(time.RFC3339)))
+}
+
+// pendingMigrations returns the registered migrations not yet recorded
+// in meta. A database without a meta bucket has everything pending.
+func pendingMigrations(s *store.Store, all []migrationsbbolt.Migration) ([]migrationsbbolt.Migration, error) {
+	var pending []migrationsbbolt.Migration
+	err := s.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		for _, m := range all {
+			if meta == nil || meta.Get(appliedKey(m.Version)) == nil {
+				pending = append(pending, m)
+			}
+		}
+		return nil
+	})
+	return pending, err
+}
+
+// BackupBeforeMigrate copies the database to
+// "<path>.pre-<version>-<timestamp>.bak" before `version` is applied.
+// Fresh databases (nothing applied yet) are skipped: there is nothing
+// to lose.
+func BackupBeforeMigrate(s *store.Store, version string) error {
+	statuses, err := MigrationStatus(s)
+	if err != nil {
+		return err
+	}
+	anyApplied := false
+	for _, st := range statuses {
+		anyApplied = anyApplied || st.Applied
+	}
+	if !anyApplied {
+		return nil
+	}
+	dst := fmt.Sprintf("%s.pre-%s-%s.bak", s.Path(), version, time.Now().UTC().Format("20060102T150405Z"))
+	log.Printf("backing up %s to %s", s.Path(), dst)
+	return s.Backup(dst)
+}
+
+// MigrationState describes one registered migration against a database.
+type MigrationState struct {
+	Version string
+	Applied bool
+	// AppliedAt is zero for pending migrations and for ones applied
+	// before timestamps were recorded.
+	AppliedAt time.Time
+	// Reversible is true when the migration has a Down step.
+	Reversible bool
+	// Processed is set for a data migration that was interrupted: the
+	// number of records already rewritten.
+	Processed  int
+	InProgress bool
+}
+
+// MigrationStatus lists every registered migration in order with
+// whether (and when) it was applied.
+func MigrationStatus(s *store.Store) ([]MigrationState, error) {
+	var out []MigrationState
+	err := s.View(func(tx *bolt.Tx) error {
 		meta := tx.Bucket([]byte("meta"))
 		for _, m := range migrationsbbolt.All {
-			key := []byte("applied:" + m.Version)
-			if meta.Get(key) != nil {
-				log.Printf("migration %s already applied", m.Version)
-				continue
+			st := MigrationState{Version: m.Version, Reversible: m.Down != nil}
+			if meta != nil {
+				if v := meta.Get(appliedKey(m.Version)); v != nil {
+					st.Applied = true
+					if t, err := time.Parse(time.RFC3339, string(v)); err == nil {
+						st.AppliedAt = t
+					}
+				} else if raw := meta.Get(checkpointKey(m.Version)); raw != nil {
+					var cp dataCheckpoint
+					if err := json.Unmarshal(raw, &cp); err == nil {
+						st.InProgress, st.Processed = true, cp.Processed
+					}
+				}
 			}
-			log.Printf("applying migration %s", m.Version)
+			out = append(out, st)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// BucketChange summarises how one top-level bucket differs after a
+// dry run.
+type BucketChange struct {
+	Bucket   string
+	Created  bool
+	Deleted  bool
+	Added    int
+	Removed  int
+	Modified int
+}
+
+var errDryRun = errors.New("dry run: rolled back")
+
+// DryRunMigration applies the named migration (pending or not) inside
+// a write transaction that is always rolled back, and reports how each
+// top-level bucket would change. Nested buckets are compared by key
+// only. A data migration is run over its whole bucket in that one
+// transaction.
+func DryRunMigration(s *store.Store, version string) ([]BucketChange, error) {
+	m, ok := findMigration(version)
+	if !ok {
+		return nil, fmt.Errorf("unknown migration %q", version)
+	}
+	var changes []BucketChange
+	err := s.Update(func(tx *bolt.Tx) error {
+		before := snapshotBuckets(tx)
+		if m.Apply != nil {
 			if err := m.Apply(tx); err != nil {
 				return fmt.Errorf("migration %s: %w", m.Version, err)
 			}
-			if err := meta.Put(key, []byte("1")); err != nil {
+		}
+		if m.Data != nil {
+			if _, _, _, err := rewriteBatch(tx, m.Data, nil, 0); err != nil {
+				return fmt.Errorf("migration %s: %w", m.Version, err)
+			}
+		}
+		changes = diffSnapshots(before, snapshotBuckets(tx))
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return changes, err
+}
+
+// RollbackMigrations runs Down for every applied migration newer than
+// target, newest first, and clears their applied markers. All steps
+// share one transaction: if any Down fails, or any migration to undo
+// has no Down, nothing changes. An empty target rolls back everything.
+func RollbackMigrations(s *store.Store, target string) ([]string, error) {
+	if target != "" {
+		if _, ok := findMigration(target); !ok {
+			return nil, fmt.Errorf("unknown migration %q", target)
+		}
+	}
+	var undone []string
+	err := s.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if meta == nil {
+			return nil
+		}
+		for i := len(migrationsbbolt.All) - 1; i >= 0; i-- {
+			m := migrationsbbolt.All[i]
+			if m.Version <= target {
+				break
+			}
+			if meta.Get(appliedKey(m.Version)) == nil {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("migration %s has no down step", m.Version)
+			}
+			log.Printf("rolling back migration %s", m.Version)
+			if err := m.Down(tx); err != nil {
+				return fmt.Errorf("rollback %s: %w", m.Version, err)
+			}
+			if err := meta.Delete(appliedKey(m.Version)); err != nil {
 				return err
 			}
+			if err := meta.Delete(checkpointKey(m.Version)); err != nil {
+				return err
+			}
+			undone = append(undone, m.Version)
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return undone, nil
+}
+
+func findMigration(version string) (migrationsbbolt.Migration, bool) {
+	for _, m := range migrationsbbolt.All {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return migrationsbbolt.Migration{}, false
+}
+
+// snapshotBuckets maps bucket name → key → hash of value. Values of
+// nested buckets hash to 0.
+func snapshotBuckets(tx *bolt.Tx) map[string]map[string]uint64 {
+	out := map[string]map[string]uint64{}
+	_ = tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		keys := map[string]uint64{}
+		_ = b.ForEach(func(k, v []byte) error {
+			var sum uint64
+			if v != nil {
+				h := fnv.New64a()
+				h.Write(v)
+				sum = h.Sum64()
+			}
+			keys[string(k)] = sum
+			return nil
+		})
+		out[string(name)] = keys
+		return nil
+	})
+	return out
+}
+
+func diffSnapshots(before, after map[string]map[string]uint64) []BucketChange {
+	names := map[string]bool{}
+	for n := range before {
+		names[n] = true
+	}
+	for n := range after {
+		names[n] = true
+	}
+	var out []BucketChange
+	for n := range names {
+		b, inBefore := before[n]
+		a, inAfter := after[n]
+		c := BucketChange{Bucket: n, Created: !inBefore, Deleted: !inAfter}
+		for k, av := range a {
+			if bv, ok := b[k]; !ok {
+				c.Added++
+			} else if bv != av {
+				c.Modified++
+			}
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				c.Removed++
+			}
+		}
+		if c.Created || c.Deleted || c.Added+c.Removed+c.Modified > 0 {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Bucket < out[j].Bucket })
+	return out
 }
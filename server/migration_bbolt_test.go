@@ -4,7 +4,9 @@ import (
 	"path/filepath"
 	"testing"
 
+	"code.sirenko.ca/transaction/server/migrations_bbolt"
 	"code.sirenko.ca/transaction/store"
+	bolt "go.etcd.io/bbolt"
 )
 
 func TestApplyMigrationsBboltIdempotent(t *testing.T) {
@@ -22,3 +24,85 @@ func TestApplyMigrationsBboltIdempotent(t *testing.T) {
 		t.Fatalf("second run: %v", err)
 	}
 }
+
+func TestRollbackAndStatus(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open(filepath.Join(dir, "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	first := migrationsbbolt.All[0].Version
+	undone, err := RollbackMigrations(s, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(undone) != len(migrationsbbolt.All)-1 {
+		t.Errorf("undone %v", undone)
+	}
+	statuses, err := MigrationStatus(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statuses {
+		if st.Applied != (st.Version == first) {
+			t.Errorf("%s: applied=%v", st.Version, st.Applied)
+		}
+		if st.Applied && st.AppliedAt.IsZero() {
+			t.Errorf("%s: missing applied time", st.Version)
+		}
+	}
+	if err := s.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("comments")) != nil {
+			t.Error("comments bucket should be dropped by rollback")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-applying takes a backup first, since the DB is not fresh.
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "t.db.pre-*.bak"))
+	if len(backups) != 1 {
+		t.Errorf("expected one backup, got %v", backups)
+	}
+}
+
+func TestDryRunRollsBack(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RollbackMigrations(s, "003_refunds"); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := DryRunMigration(s, "004_comments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || !changes[0].Created || changes[0].Bucket != "comments" {
+		t.Errorf("changes = %+v", changes)
+	}
+	statuses, _ := MigrationStatus(s)
+	if statuses[len(statuses)-1].Applied {
+		t.Error("dry run must not record the migration")
+	}
+	if err := s.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("comments")) != nil {
+			t.Error("dry run must not create buckets")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"code.sirenko.ca/transaction/server/migrations_bbolt"
+	"code.sirenko.ca/transaction/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+// checkpointKey is the meta key holding a data migration's progress
+// while it is partially applied.
+func checkpointKey(version string) []byte { return []byte("checkpoint:" + version) }
+
+// dataCheckpoint is the JSON value under checkpointKey. LastKey is the
+// last key of Data.Bucket that has been rewritten and committed.
+type dataCheckpoint struct {
+	LastKey   []byte `json:"last_key"`
+	Processed int    `json:"processed"`
+}
+
+// runDataMigration applies m.Apply (once, in the first batch) and then
+// rewrites m.Data.Bucket in batches, resuming from the checkpoint left
+// by an interrupted run. The migration is marked applied in the same
+// transaction as the final batch.
+func runDataMigration(s *store.Store, m migrationsbbolt.Migration) error {
+	size := m.Data.BatchSize
+	if size <= 0 {
+		size = migrationsbbolt.DefaultBatchSize
+	}
+	for {
+		var done bool
+		err := s.Update(func(tx *bolt.Tx) error {
+			meta := tx.Bucket([]byte("meta"))
+			var cp dataCheckpoint
+			raw := meta.Get(checkpointKey(m.Version))
+			if raw == nil {
+				log.Printf("applying data migration %s", m.Version)
+				if m.Apply != nil {
+					if err := m.Apply(tx); err != nil {
+						return fmt.Errorf("migration %s: %w", m.Version, err)
+					}
+				}
+			} else if err := json.Unmarshal(raw, &cp); err != nil {
+				return fmt.Errorf("migration %s: bad checkpoint: %w", m.Version, err)
+			} else if cp.Processed > 0 {
+				log.Printf("resuming data migration %s after %d records", m.Version, cp.Processed)
+			}
+
+			last, n, finished, err := rewriteBatch(tx, m.Data, cp.LastKey, size)
+			if err != nil {
+				return fmt.Errorf("migration %s: %w", m.Version, err)
+			}
+			cp.Processed += n
+			if n > 0 {
+				cp.LastKey = last
+			}
+			if finished {
+				done = true
+				log.Printf("data migration %s: done, %d records", m.Version, cp.Processed)
+				if err := meta.Delete(checkpointKey(m.Version)); err != nil {
+					return err
+				}
+				return markApplied(meta, m.Version)
+			}
+			log.Printf("data migration %s: %d records so far", m.Version, cp.Processed)
+			buf, err := json.Marshal(&cp)
+			if err != nil {
+				return err
+			}
+			return meta.Put(checkpointKey(m.Version), buf)
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// rewriteBatch rewrites up to limit keys after `after` (nil means from
+// the start; limit <= 0 means no limit). It reports the last key
+// handled, how many were handled, and whether the bucket is exhausted.
+// Keys and values are copied out before Rewrite runs so it can modify
+// the bucket being walked.
+func rewriteBatch(tx *bolt.Tx, d *migrationsbbolt.DataMigration, after []byte, limit int) ([]byte, int, bool, error) {
+	b := tx.Bucket([]byte(d.Bucket))
+	if b == nil {
+		return nil, 0, false, fmt.Errorf("bucket %q does not exist", d.Bucket)
+	}
+	type kv struct{ k, v []byte }
+	var batch []kv
+	c := b.Cursor()
+	var k, v []byte
+	if after == nil {
+		k, v = c.First()
+	} else {
+		k, v = c.Seek(after)
+		if k != nil && string(k) == string(after) {
+			k, v = c.Next()
+		}
+	}
+	for ; k != nil && (limit <= 0 || len(batch) < limit); k, v = c.Next() {
+		batch = append(batch, kv{append([]byte(nil), k...), append([]byte(nil), v...)})
+	}
+	finished := k == nil
+	for _, e := range batch {
+		if err := d.Rewrite(tx, e.k, e.v); err != nil {
+			return nil, 0, false, fmt.Errorf("key %x: %w", e.k, err)
+		}
+	}
+	if len(batch) == 0 {
+		return nil, 0, finished, nil
+	}
+	return batch[len(batch)-1].k, len(batch), finished, nil
+}
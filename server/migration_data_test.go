@@ -0,0 +1,162 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/server/migrations_bbolt"
+	"code.sirenko.ca/transaction/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestDataMigrationResumesAfterInterrupt(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("widgets"))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 25; i++ {
+			if err := b.Put([]byte(fmt.Sprintf("w%03d", i)), []byte("old")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]int{}
+	crashAt := "w013"
+	m := migrationsbbolt.Migration{
+		Version: "999_rewrite_widgets",
+		Data: &migrationsbbolt.DataMigration{
+			Bucket:    "widgets",
+			BatchSize: 10,
+			Rewrite: func(tx *bolt.Tx, k, v []byte) error {
+				if string(k) == crashAt {
+					return errors.New("simulated crash")
+				}
+				seen[string(k)]++
+				return tx.Bucket([]byte("widgets")).Put(k, []byte("new"))
+			},
+		},
+	}
+	all := append(append([]migrationsbbolt.Migration{}, migrationsbbolt.All...), m)
+
+	if err := applyMigrations(s, all, MigrateOptions{}); err == nil {
+		t.Fatal("expected the simulated crash to surface")
+	}
+	crashAt = ""
+	if err := applyMigrations(s, all, MigrateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != 25 {
+		t.Errorf("rewrote %d keys, want 25", len(seen))
+	}
+	// The first batch (w000-w009) committed before the crash; the
+	// rolled-back second batch is retried, so only its keys before the
+	// crash point are seen twice.
+	for k, n := range seen {
+		want := 1
+		if k >= "w010" && k < "w013" {
+			want = 2
+		}
+		if n != want {
+			t.Errorf("%s rewritten %d times, want %d", k, n, want)
+		}
+	}
+	if err := s.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if meta.Get(appliedKey(m.Version)) == nil {
+			t.Error("data migration not marked applied")
+		}
+		if meta.Get(checkpointKey(m.Version)) != nil {
+			t.Error("checkpoint should be cleared when done")
+		}
+		return tx.Bucket([]byte("widgets")).ForEach(func(k, v []byte) error {
+			if string(v) != "new" {
+				t.Errorf("%s = %s", k, v)
+			}
+			return nil
+		})
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCategoriesBackfill(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	u := &store.User{Username: "alice", HashPassword: "x"}
+	if err := s.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"Film", "film", "travel", ""} {
+		if err := s.CreateTransaction(&store.Transaction{UserID: u.ID, Merchant: "m", Category: c, OccurredAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetSetting("subgroup_map", []byte(`{"film": "hobbies"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Drop the catalog the inserts filled in, then let 007 rebuild it.
+	if _, err := RollbackMigrations(s, "006_import_batches"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	cats, err := s.ListCategories(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cats) != 2 || cats[0].Name != "Film" || cats[0].Parent != "hobbies" || cats[1].Name != "travel" {
+		t.Errorf("catalog = %+v", cats)
+	}
+}
+
+func TestSnapshotsBackfill(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	asOf := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	if err := s.PutAccountBalance(&store.AccountBalance{UserID: 1, Account: "Chequing", Balance: 250, Currency: "CAD", AsOf: asOf}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RollbackMigrations(s, "008_forecast"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.ListSnapshots(1, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Balance != 250 || !got[0].On.Equal(asOf) || got[0].Source != store.SnapshotManual {
+		t.Errorf("snapshots = %+v", got)
+	}
+}
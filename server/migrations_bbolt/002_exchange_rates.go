@@ -0,0 +1,14 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+var v002ExchangeRates = Migration{
+	Version: "002_exchange_rates",
+	Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("exchange_rates"))
+		return err
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "exchange_rates")
+	},
+}
@@ -0,0 +1,18 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+// v003Refunds adds the refund link index. Transaction.Kind needs no
+// backfill: records without it read as expenses.
+var v003Refunds = Migration{
+	Version: "003_refunds",
+	Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("refunds_by_txn"))
+		return err
+	},
+	// Down drops the index only; kind and refund_of stay on the
+	// records, where older binaries ignore them.
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "refunds_by_txn")
+	},
+}
@@ -0,0 +1,18 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+var v004Comments = Migration{
+	Version: "004_comments",
+	Apply: func(tx *bolt.Tx) error {
+		for _, name := range []string{"seq_comments", "comments"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "seq_comments", "comments")
+	},
+}
@@ -0,0 +1,14 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+var v005Undo = Migration{
+	Version: "005_undo",
+	Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("undo"))
+		return err
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "undo")
+	},
+}
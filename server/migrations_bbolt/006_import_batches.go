@@ -0,0 +1,18 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+var v006ImportBatches = Migration{
+	Version: "006_import_batches",
+	Apply: func(tx *bolt.Tx) error {
+		for _, name := range []string{"seq_import_batches", "import_batches", "txn_by_batch"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "seq_import_batches", "import_batches", "txn_by_batch")
+	},
+}
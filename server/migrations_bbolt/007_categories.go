@@ -0,0 +1,101 @@
+package migrationsbbolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// v007Categories adds the category catalog and backfills it with every
+// category in use: one entry per (user, category) of the existing
+// transactions, with the parent group the subgroup_map setting gives
+// it. The records are written in their 007 shape here rather than
+// through the store, so later changes to store.Category do not change
+// what this migration did.
+var v007Categories = Migration{
+	Version: "007_categories",
+	Apply: func(tx *bolt.Tx) error {
+		for _, name := range []string{"seq_categories", "categories", "categories_by_owner"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "seq_categories", "categories", "categories_by_owner")
+	},
+	Data: &DataMigration{
+		Bucket:  "transactions",
+		Rewrite: backfillCategory,
+	},
+}
+
+type category007 struct {
+	ID        uint64    `json:"id"`
+	OwnerID   uint64    `json:"owner_id"`
+	Name      string    `json:"name"`
+	Parent    string    `json:"parent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func backfillCategory(tx *bolt.Tx, _, v []byte) error {
+	var t struct {
+		UserID   uint64 `json:"user_id"`
+		Category string `json:"category"`
+	}
+	if err := json.Unmarshal(v, &t); err != nil {
+		return err
+	}
+	if t.Category == "" {
+		return nil
+	}
+	idx := tx.Bucket([]byte("categories_by_owner"))
+	key := append(binary.BigEndian.AppendUint64(nil, t.UserID), strings.ToLower(t.Category)...)
+	if idx.Get(key) != nil {
+		return nil
+	}
+	id, err := tx.Bucket([]byte("seq_categories")).NextSequence()
+	if err != nil {
+		return err
+	}
+	c := category007{ID: id, OwnerID: t.UserID, Name: t.Category, CreatedAt: time.Now()}
+	c.Parent = subgroupOf(tx, t.Category)
+	buf, err := json.Marshal(&c)
+	if err != nil {
+		return err
+	}
+	idKey := binary.BigEndian.AppendUint64(nil, id)
+	if err := tx.Bucket([]byte("categories")).Put(idKey, buf); err != nil {
+		return err
+	}
+	return idx.Put(key, idKey)
+}
+
+// subgroupOf looks name up in the subgroup_map setting, case-
+// insensitively. A missing or malformed setting gives "".
+func subgroupOf(tx *bolt.Tx, name string) string {
+	b := tx.Bucket([]byte("settings"))
+	if b == nil {
+		return ""
+	}
+	raw := b.Get([]byte("subgroup_map"))
+	if raw == nil {
+		return ""
+	}
+	var st struct {
+		Value map[string]string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return ""
+	}
+	for k, parent := range st.Value {
+		if strings.EqualFold(k, name) {
+			return parent
+		}
+	}
+	return ""
+}
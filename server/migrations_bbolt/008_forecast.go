@@ -0,0 +1,18 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+var v008Forecast = Migration{
+	Version: "008_forecast",
+	Apply: func(tx *bolt.Tx) error {
+		for _, name := range []string{"account_balances", "seq_scheduled_items", "scheduled_items", "scheduled_by_user"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "account_balances", "seq_scheduled_items", "scheduled_items", "scheduled_by_user")
+	},
+}
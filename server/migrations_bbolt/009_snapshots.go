@@ -0,0 +1,86 @@
+package migrationsbbolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// v009Snapshots adds balance snapshots and turns every balance entered
+// for the forecast into a manual snapshot of its account on its asOf
+// day, in the 009 record shape.
+var v009Snapshots = Migration{
+	Version: "009_snapshots",
+	Apply: func(tx *bolt.Tx) error {
+		for _, name := range []string{"seq_snapshots", "snapshots", "snapshots_by_user"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "seq_snapshots", "snapshots", "snapshots_by_user")
+	},
+	Data: &DataMigration{
+		Bucket:  "account_balances",
+		Rewrite: backfillSnapshot,
+	},
+}
+
+type snapshot009 struct {
+	ID        uint64    `json:"id"`
+	UserID    uint64    `json:"user_id"`
+	Account   string    `json:"account"`
+	Balance   float64   `json:"balance"`
+	Currency  string    `json:"currency"`
+	On        time.Time `json:"on"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func backfillSnapshot(tx *bolt.Tx, _, v []byte) error {
+	var b struct {
+		UserID   uint64    `json:"user_id"`
+		Account  string    `json:"account"`
+		Balance  float64   `json:"balance"`
+		Currency string    `json:"currency"`
+		AsOf     time.Time `json:"as_of"`
+	}
+	if err := json.Unmarshal(v, &b); err != nil {
+		return err
+	}
+	idx := tx.Bucket([]byte("snapshots_by_user"))
+	key := binary.BigEndian.AppendUint64(nil, b.UserID)
+	key = binary.BigEndian.AppendUint64(key, uint64(b.AsOf.Unix()))
+	key = append(key, strings.ToLower(b.Account)...)
+	if idx.Get(key) != nil {
+		return nil
+	}
+	id, err := tx.Bucket([]byte("seq_snapshots")).NextSequence()
+	if err != nil {
+		return err
+	}
+	sn := snapshot009{
+		ID:        id,
+		UserID:    b.UserID,
+		Account:   b.Account,
+		Balance:   b.Balance,
+		Currency:  b.Currency,
+		On:        b.AsOf,
+		Source:    "manual",
+		CreatedAt: time.Now(),
+	}
+	buf, err := json.Marshal(&sn)
+	if err != nil {
+		return err
+	}
+	idKey := binary.BigEndian.AppendUint64(nil, id)
+	if err := tx.Bucket([]byte("snapshots")).Put(idKey, buf); err != nil {
+		return err
+	}
+	return idx.Put(key, idKey)
+}
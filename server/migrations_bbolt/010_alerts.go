@@ -0,0 +1,21 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+// v010Alerts adds the alert buckets. Existing transactions are not
+// scored: alerts start with the next insert rather than flagging the
+// whole history at once.
+var v010Alerts = Migration{
+	Version: "010_alerts",
+	Apply: func(tx *bolt.Tx) error {
+		for _, name := range []string{"seq_alerts", "alerts", "alerts_by_user", "alerts_by_txn"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "seq_alerts", "alerts", "alerts_by_user", "alerts_by_txn")
+	},
+}
@@ -0,0 +1,20 @@
+package migrationsbbolt
+
+import bolt "go.etcd.io/bbolt"
+
+// v011Merchants adds the merchant catalog. It starts empty: merchants
+// exist once a user names one and gives it aliases.
+var v011Merchants = Migration{
+	Version: "011_merchants",
+	Apply: func(tx *bolt.Tx) error {
+		for _, name := range []string{"seq_merchants", "merchants", "merchants_by_owner"} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "seq_merchants", "merchants", "merchants_by_owner")
+	},
+}
@@ -0,0 +1,48 @@
+package migrationsbbolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// v012MerchantIndex adds the merchant prefix index merchant
+// suggestions read and backfills it with the existing transactions.
+// Keys are built in their 012 shape here, as store.merchantIndexKey
+// builds them today.
+var v012MerchantIndex = Migration{
+	Version: "012_merchant_index",
+	Apply: func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("merchant_index"))
+		return err
+	},
+	Down: func(tx *bolt.Tx) error {
+		return deleteBuckets(tx, "merchant_index")
+	},
+	Data: &DataMigration{
+		Bucket:  "transactions",
+		Rewrite: backfillMerchantIndex,
+	},
+}
+
+func backfillMerchantIndex(tx *bolt.Tx, k, v []byte) error {
+	var t struct {
+		UserID     uint64    `json:"user_id"`
+		Merchant   string    `json:"merchant"`
+		OccurredAt time.Time `json:"occurred_at"`
+	}
+	if err := json.Unmarshal(v, &t); err != nil {
+		return err
+	}
+	if t.Merchant == "" {
+		return nil
+	}
+	key := append(binary.BigEndian.AppendUint64(nil, t.UserID), strings.ToLower(t.Merchant)...)
+	key = append(key, 0)
+	key = binary.BigEndian.AppendUint64(key, uint64(t.OccurredAt.UnixNano()))
+	key = append(key, k...)
+	return tx.Bucket([]byte("merchant_index")).Put(key, []byte{})
+}
@@ -1,15 +1,65 @@
 package migrationsbbolt
 
 import (
+	"errors"
+
 	bolt "go.etcd.io/bbolt"
 )
 
 // Migration creates or updates schema. Applied in slice order, each at most once.
+// Down, when set, reverses Apply; migrations without it cannot be
+// rolled back.
 type Migration struct {
 	Version string
 	Apply   func(tx *bolt.Tx) error
+	Down    func(tx *bolt.Tx) error
+	// Data, when set, makes this a data migration: after Apply (which
+	// may be nil) the runner walks Data.Bucket in batches, each in its
+	// own write transaction, instead of rewriting everything at once.
+	Data *DataMigration
+}
+
+// DataMigration rewrites the records of one bucket in resumable
+// batches. After each batch the last processed key is checkpointed in
+// `meta`, in the same transaction as the rewrites, so a restart picks
+// up exactly where the previous run stopped.
+type DataMigration struct {
+	Bucket string
+	// BatchSize is the number of keys per transaction. Zero means
+	// DefaultBatchSize.
+	BatchSize int
+	// Rewrite is called once per key, in key order, with copies of the
+	// key and value. It may Put or Delete in any bucket via tx,
+	// including the one being walked.
+	Rewrite func(tx *bolt.Tx, k, v []byte) error
 }
 
+// DefaultBatchSize bounds how many records one data-migration
+// transaction touches.
+const DefaultBatchSize = 500
+
 var All = []Migration{
 	v001InitialBuckets,
+	v002ExchangeRates,
+	v003Refunds,
+	v004Comments,
+	v005Undo,
+	v006ImportBatches,
+	v007Categories,
+	v008Forecast,
+	v009Snapshots,
+	v010Alerts,
+	v011Merchants,
+	v012MerchantIndex,
+}
+
+// deleteBuckets drops each named top-level bucket, ignoring ones that
+// are already gone. Shared by Down functions.
+func deleteBuckets(tx *bolt.Tx, names ...string) error {
+	for _, name := range names {
+		if err := tx.DeleteBucket([]byte(name)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+	}
+	return nil
 }
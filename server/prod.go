@@ -4,4 +4,7 @@ package server
 
 const Production = true
 
-var BuildTime = "-"
+var (
+	BuildTime = "-"
+	GitCommit = "-"
+)
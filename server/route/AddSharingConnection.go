@@ -14,30 +14,30 @@ type AddConnectionPayload struct {
 
 func (h WithStore) AddSharingConnection(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload AddConnectionPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	connectedUserId, err := h.s.GetTokenOwner(payload.Token)
 	if err != nil {
 		if err == store.ErrNotFound {
-			http.Error(w, "Invalid sharing token", http.StatusBadRequest)
+			writeError(w, r, "Invalid sharing token", http.StatusBadRequest)
 			return
 		}
 		log.Printf("Error validating sharing token: %v", err)
-		http.Error(w, "Failed to validate sharing token", http.StatusInternalServerError)
+		writeError(w, r, "Failed to validate sharing token", http.StatusInternalServerError)
 		return
 	}
 
 	if err := h.s.AddConnection(userId, connectedUserId); err != nil {
 		log.Printf("Error creating sharing connection for user %d: %v", userId, err)
-		http.Error(w, "Failed to create sharing connection", http.StatusInternalServerError)
+		writeError(w, r, "Failed to create sharing connection", http.StatusInternalServerError)
 		return
 	}
 
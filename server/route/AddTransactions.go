@@ -1,12 +1,18 @@
 package route
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"code.sirenko.ca/transaction/rules"
 	"code.sirenko.ca/transaction/store"
 )
 
@@ -19,31 +25,106 @@ type AddTransactionPayload struct {
 	Category   string   `json:"category"`
 	Details    *string  `json:"details"`
 	Tags       []string `json:"tags"`
+	// Kind is one of expense, income, refund or transfer. Empty means
+	// expense.
+	Kind string `json:"kind"`
+	// RefundOf is the ID of the purchase a refund reverses.
+	RefundOf uint64 `json:"refundOf"`
+	// FITID is the bank's transaction ID from an OFX import.
+	FITID string `json:"fitid,omitempty"`
+	// MCC is the merchant category code, four digits.
+	MCC string `json:"mcc,omitempty"`
 }
 
+// validate reports malformed fields, keyed by JSON name. It does not
+// touch the store.
+func (p AddTransactionPayload) validate() map[string]string {
+	fields := map[string]string{}
+	if _, err := parseOccurredAt(p.OccurredAt); err != nil {
+		fields["occurredAt"] = err.Error()
+	}
+	if !store.ValidKind(p.Kind) {
+		fields["kind"] = "must be one of expense, income, refund, transfer"
+	}
+	if p.RefundOf != 0 && p.Kind != store.KindRefund {
+		fields["refundOf"] = "only allowed when kind is refund"
+	}
+	if p.MCC != "" && !rules.ValidMCC(p.MCC) {
+		fields["mcc"] = "must be four digits"
+	}
+	return fields
+}
+
+// AddTransactions creates a batch of transactions, recorded as one
+// "manual" import batch (see ImportBatch). On /api/v1 it replies with
+// the created transactions; the legacy route replies with an empty 201.
 func (h WithStore) AddTransactions(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 	var payload []AddTransactionPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	batch := &store.ImportBatch{Source: batchSourceManual, FileHash: hashHex(body)}
+	created, ok := h.createTransactions(w, r, userId, "", batch, payload)
+	if !ok {
+		return
+	}
+
+	h.recordUndo(w, userId, "add transactions", createdRecords(created))
+	if !isV1(r) {
+		writeUndo(w, http.StatusCreated)
 		return
 	}
+	out, ok := h.toTransactions(w, r, userId, created)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// createTransactions validates payload, drops repeated (merchant,
+// occurredAt, amount) entries, runs the rules over the rest (filling in
+// only what the payload left empty) and stores them with their tags,
+// under batch, which it creates unless there is nothing to store, and
+// raises alerts on them (see scoreTransactions). It writes the error
+// response itself and returns false on failure.
+// Validation fields are keyed prefix[i].field.
+func (h WithStore) createTransactions(w http.ResponseWriter, r *http.Request, userId uint64, prefix string, batch *store.ImportBatch, payload []AddTransactionPayload) ([]*store.Transaction, bool) {
+	fields := map[string]string{}
+	for i, t := range payload {
+		for k, msg := range t.validate() {
+			fields[fmt.Sprintf("%s[%d].%s", prefix, i, k)] = msg
+		}
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return nil, false
+	}
 
-	// Dedupe the payload by (merchant, occurred_at, amount) — the SQL
-	// unique constraint moved to client-side. First occurrence wins.
+	// Dedupe the payload by (merchant, occurred_at, amount, fitid) — the
+	// SQL unique constraint moved to client-side. First occurrence wins.
 	seen := make(map[string]struct{}, len(payload))
 	deduped := make([]AddTransactionPayload, 0, len(payload))
 	for _, t := range payload {
-		occurredAt, err := parseOccurredAt(t.OccurredAt)
-		if err != nil {
-			http.Error(w, "Invalid occurredAt: "+err.Error(), http.StatusBadRequest)
-			return
+		occurredAt, _ := parseOccurredAt(t.OccurredAt)
+		if t.RefundOf != 0 {
+			if status, msg := h.checkRefundTarget(userId, t.RefundOf); status != 0 {
+				writeError(w, r, msg, status)
+				return nil, false
+			}
 		}
-		key := t.Merchant + "|" + occurredAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatFloat(t.Amount, 'f', -1, 64)
+		key := t.Merchant + "|" + occurredAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatFloat(t.Amount, 'f', -1, 64) + "|" + t.FITID
 		if _, ok := seen[key]; ok {
 			continue
 		}
@@ -52,6 +133,9 @@ func (h WithStore) AddTransactions(w http.ResponseWriter, r *http.Request, userI
 		deduped = append(deduped, t)
 	}
 
+	engine := h.rulesEngine(userId)
+	created := make([]*store.Transaction, 0, len(deduped))
+	tags := make([][]string, 0, len(deduped))
 	for _, t := range deduped {
 		occurredAt, _ := parseOccurredAt(t.OccurredAt)
 		txn := &store.Transaction{
@@ -62,35 +146,69 @@ func (h WithStore) AddTransactions(w http.ResponseWriter, r *http.Request, userI
 			Merchant:   t.Merchant,
 			Card:       t.Card,
 			Category:   t.Category,
+			Kind:       t.Kind,
+			RefundOf:   t.RefundOf,
+			FITID:      t.FITID,
+			MCC:        t.MCC,
+		}
+		if txn.RefundOf != 0 && txn.Category == "" {
+			// Book the refund against the purchase's category so net
+			// category spend comes out right.
+			if orig, err := h.s.GetTransaction(txn.RefundOf); err == nil {
+				txn.Category = orig.Category
+			}
 		}
 		if t.Details != nil {
 			txn.Details = *t.Details
 		}
-		if err := h.s.CreateTransaction(txn); err != nil {
-			log.Printf("Failed to insert transaction: %v", err)
-			http.Error(w, "Failed to insert transaction", http.StatusInternalServerError)
-			return
+		// Rules see the canonical merchant; CreateTransaction would
+		// normalize it anyway.
+		if err := h.s.NormalizeMerchant(txn); err != nil {
+			log.Printf("Failed to normalize merchant %q: %v", txn.Merchant, err)
+		}
+		created = append(created, txn)
+		tags = append(tags, engine.Apply(txn, t.Tags, false))
+	}
+	if len(created) == 0 {
+		return created, true
+	}
+
+	// The batch, its rows and their tags are stored in one write, so a
+	// failure leaves nothing behind.
+	batch.UserID = userId
+	if err := h.s.CreateImportBatchWithTransactions(batch, created, tags); err != nil {
+		if errors.Is(err, store.ErrInvalidRefund) {
+			writeError(w, r, "refundOf must point at an expense and kind must be refund", http.StatusBadRequest)
+			return nil, false
 		}
+		log.Printf("Failed to insert transactions: %v", err)
+		writeError(w, r, "Failed to insert transaction", http.StatusInternalServerError)
+		return nil, false
+	}
 
-		if len(t.Tags) > 0 {
-			for _, tagName := range t.Tags {
-				if tagName == "" {
-					continue
-				}
-				tag, err := h.s.GetOrCreateTag(tagName)
-				if err != nil {
-					log.Printf("Failed to get or create tag %s: %v", tagName, err)
-					http.Error(w, "Failed to get or create tag", http.StatusInternalServerError)
-					return
-				}
-				if err := h.s.AddTagToTransaction(txn.ID, tag.ID); err != nil {
-					log.Printf("Failed to add tag to transaction %d: %v", txn.ID, err)
-					http.Error(w, "Failed to add tag to transaction", http.StatusInternalServerError)
-					return
-				}
-			}
+	h.scoreTransactions(userId, created)
+	return created, true
+}
+
+// toTransactions builds the API view of created, writing a 500 and
+// returning false if that fails.
+func (h WithStore) toTransactions(w http.ResponseWriter, r *http.Request, userId uint64, created []*store.Transaction) ([]Transaction, bool) {
+	baseCurrency := h.baseCurrency(userId)
+	out := make([]Transaction, 0, len(created))
+	for _, txn := range created {
+		t, err := h.toTransaction(txn, baseCurrency)
+		if err != nil {
+			log.Printf("Error building transaction %d: %v", txn.ID, err)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
+			return nil, false
 		}
+		out = append(out, t)
 	}
+	return out, true
+}
 
-	w.WriteHeader(http.StatusCreated)
+// hashHex is the hex SHA-256 of b, as ImportBatch.FileHash holds it.
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
 }
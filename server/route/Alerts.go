@@ -0,0 +1,166 @@
+package route
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"code.sirenko.ca/transaction/alerts"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Alert is a flagged transaction. Kind is one of the alerts.Kind*
+// constants, Score how far past its threshold the transaction is and
+// RelatedID the earlier charge a duplicate repeats. Transaction is
+// omitted once the transaction is gone.
+type Alert struct {
+	ID          uint64       `json:"id"`
+	Kind        string       `json:"kind"`
+	Score       float64      `json:"score"`
+	Reason      string       `json:"reason"`
+	Status      string       `json:"status"`
+	CreatedAt   string       `json:"createdAt"`
+	ResolvedAt  *string      `json:"resolvedAt,omitempty"`
+	RelatedID   uint64       `json:"relatedId,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+}
+
+func (h WithStore) toAlert(a *store.Alert, baseCurrency string) (Alert, error) {
+	out := Alert{
+		ID:        a.ID,
+		Kind:      a.Kind,
+		Score:     a.Score,
+		Reason:    a.Reason,
+		Status:    a.Status,
+		CreatedAt: a.CreatedAt.Format(time.RFC3339),
+		RelatedID: a.RelatedID,
+	}
+	if a.ResolvedAt != nil {
+		at := a.ResolvedAt.Format(time.RFC3339)
+		out.ResolvedAt = &at
+	}
+	t, err := h.s.GetTransaction(a.TransactionID)
+	if errors.Is(err, store.ErrNotFound) {
+		return out, nil
+	} else if err != nil {
+		return out, err
+	}
+	txn, err := h.toTransaction(t, baseCurrency)
+	if err != nil {
+		return out, err
+	}
+	out.Transaction = &txn
+	return out, nil
+}
+
+// scoreTransactions runs the anomaly analyzer over created, a batch the
+// caller just stored, against the rest of userId's transactions and
+// stores an alert per finding. Rows of the batch are scored against
+// the ones before them, so a charge entered twice in one import is
+// caught. Alerts are best effort: failures are logged and the insert
+// stands.
+func (h WithStore) scoreTransactions(userId uint64, created []*store.Transaction) {
+	if len(created) == 0 {
+		return
+	}
+	all, err := h.s.ListTransactionsForUser(userId)
+	if err != nil {
+		log.Printf("Error listing transactions for alerts of user %d: %v", userId, err)
+		return
+	}
+	fresh := make(map[uint64]bool, len(created))
+	for _, t := range created {
+		fresh[t.ID] = true
+	}
+	history := make([]store.Transaction, 0, len(all))
+	for _, t := range all {
+		if !fresh[t.ID] {
+			history = append(history, t)
+		}
+	}
+	a := alerts.New(history, alerts.Options{})
+	for _, t := range created {
+		for _, f := range a.Score(t) {
+			alert := &store.Alert{UserID: userId, TransactionID: t.ID, Kind: f.Kind, Score: f.Score, Reason: f.Reason, RelatedID: f.RelatedID}
+			if err := h.s.CreateAlert(alert); err != nil {
+				log.Printf("Error storing %s alert for transaction %d: %v", f.Kind, t.ID, err)
+			}
+		}
+		a.Add(t)
+	}
+}
+
+// ListAlerts lists the caller's alerts, newest first. ?status= picks
+// open (the default), acknowledged, dismissed or all.
+func (h WithStore) ListAlerts(w http.ResponseWriter, r *http.Request, userId uint64) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = store.AlertOpen
+	case store.AlertOpen, store.AlertAcknowledged, store.AlertDismissed, "all":
+	default:
+		writeValidationError(w, r, map[string]string{"status": "must be open, acknowledged, dismissed or all"})
+		return
+	}
+	list, err := h.s.ListAlerts(userId)
+	if err != nil {
+		log.Printf("Error listing alerts for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	baseCurrency := h.baseCurrency(userId)
+	out := []Alert{}
+	for i := range list {
+		if status != "all" && list[i].Status != status {
+			continue
+		}
+		a, err := h.toAlert(&list[i], baseCurrency)
+		if err != nil {
+			log.Printf("Error building alert %d: %v", list[i].ID, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, a)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// AcknowledgeAlert marks one of the caller's alerts as seen.
+func (h WithStore) AcknowledgeAlert(w http.ResponseWriter, r *http.Request, userId uint64) {
+	h.setAlertStatus(w, r, userId, store.AlertAcknowledged)
+}
+
+// DismissAlert marks one of the caller's alerts as a false alarm.
+func (h WithStore) DismissAlert(w http.ResponseWriter, r *http.Request, userId uint64) {
+	h.setAlertStatus(w, r, userId, store.AlertDismissed)
+}
+
+func (h WithStore) setAlertStatus(w http.ResponseWriter, r *http.Request, userId uint64, status string) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	a, err := h.s.GetAlert(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error querying alert %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || a.UserID != userId {
+		writeError(w, r, "Alert not found", http.StatusNotFound)
+		return
+	}
+	if a, err = h.s.SetAlertStatus(id, status); err != nil {
+		log.Printf("Error updating alert %d: %v", id, err)
+		writeError(w, r, "Failed to update alert", http.StatusInternalServerError)
+		return
+	}
+	out, err := h.toAlert(a, h.baseCurrency(userId))
+	if err != nil {
+		log.Printf("Error building alert %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
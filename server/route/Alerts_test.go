@@ -0,0 +1,91 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/alerts"
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestAlerts(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	bob := &store.User{Username: "bob", PersonName: "Bob"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(&store.Session{Code: "bobtok", UserID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, amount := range []float64{40, 45, 38, 42, 41} {
+		if err := s.CreateTransaction(&store.Transaction{UserID: alice.ID, Amount: amount, Currency: "CAD", Card: "Visa", Merchant: "Grocer", OccurredAt: base.AddDate(0, 0, -7*(i+1))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := do(mux, "POST", "/api/v1/transactions", token, `[
+		{"amount":43,"currency":"CAD","card":"Visa","occurredAt":"2024-03-01T12:00:00Z","merchant":"Grocer"},
+		{"amount":180,"currency":"CAD","card":"Visa","occurredAt":"2024-03-02T12:00:00Z","merchant":"Grocer"},
+		{"amount":12.5,"currency":"CAD","card":"Visa","occurredAt":"2024-03-03T09:00:00Z","merchant":"Cafe"},
+		{"amount":12.5,"currency":"CAD","card":"Visa","occurredAt":"2024-03-03T09:03:00Z","merchant":"CAFE"}
+	]`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("add = %d %s", rec.Code, rec.Body)
+	}
+
+	list := func(query, tok string) []Alert {
+		t.Helper()
+		rec := do(mux, "GET", "/api/v1/alerts"+query, tok, "")
+		var out []Alert
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("list %s = %d %v", query, rec.Code, err)
+		}
+		return out
+	}
+	open := list("", token)
+	if len(open) != 2 || open[0].Kind != alerts.KindDuplicate || open[1].Kind != alerts.KindMerchantOutlier {
+		t.Fatalf("alerts = %+v", open)
+	}
+	if dup := open[0]; dup.Transaction == nil || dup.Transaction.OccurredAt != "2024-03-03T09:03:00Z" || dup.RelatedID == 0 {
+		t.Errorf("duplicate = %+v", dup)
+	}
+	if out := open[1]; out.Transaction == nil || out.Transaction.Amount != 180 || out.Score < 3 {
+		t.Errorf("outlier = %+v", out)
+	}
+	if got := list("", "bobtok"); len(got) != 0 {
+		t.Errorf("bob sees %+v", got)
+	}
+
+	path := fmt.Sprintf("/api/v1/alerts/%d", open[0].ID)
+	if rec := do(mux, "POST", path+"/dismiss", "bobtok", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("dismiss by bob = %d", rec.Code)
+	}
+	rec = do(mux, "POST", path+"/dismiss", token, "")
+	var dismissed Alert
+	if err := json.NewDecoder(rec.Body).Decode(&dismissed); err != nil || dismissed.Status != store.AlertDismissed || dismissed.ResolvedAt == nil {
+		t.Errorf("dismiss = %d %+v %v", rec.Code, dismissed, err)
+	}
+	if rec := do(mux, "POST", fmt.Sprintf("/api/v1/alerts/%d/acknowledge", open[1].ID), token, ""); rec.Code != http.StatusOK {
+		t.Errorf("acknowledge = %d", rec.Code)
+	}
+	if got := list("", token); len(got) != 0 {
+		t.Errorf("open after resolving = %+v", got)
+	}
+	if got := list("?status=dismissed", token); len(got) != 1 || got[0].ID != open[0].ID {
+		t.Errorf("dismissed = %+v", got)
+	}
+	if got := list("?status=all", token); len(got) != 2 {
+		t.Errorf("all = %+v", got)
+	}
+	if rec := do(mux, "GET", "/api/v1/alerts?status=new", token, ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("bad status = %d", rec.Code)
+	}
+	if rec := do(mux, "GET", "/api/alerts?status=all", token, ""); rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("legacy = %d %v", rec.Code, rec.Header())
+	}
+}
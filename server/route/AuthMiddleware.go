@@ -40,7 +40,7 @@ func (h WithStore) AuthMiddleware(next func(w http.ResponseWriter, r *http.Reque
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userId, err := GetUserId(h.s, r)
 		if err != nil {
-			http.Error(w, err.Err.Error(), err.Code)
+			writeError(w, r, err.Err.Error(), err.Code)
 			return
 		}
 		// TODO add userId - transaction validation
@@ -0,0 +1,227 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+const maxBatchOps = 1000
+
+// BatchOperation is one entry of a batch request. Op is one of update,
+// add_tag, remove_tag, set_category or delete; Fields is used by update
+// and Tag and Category by the tag and category ops.
+type BatchOperation struct {
+	Op            string                    `json:"op"`
+	TransactionID uint64                    `json:"transactionId"`
+	Fields        *UpdateTransactionPayload `json:"fields,omitempty"`
+	Tag           string                    `json:"tag,omitempty"`
+	Category      string                    `json:"category,omitempty"`
+}
+
+type BatchPayload struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchResult reports one operation. Status is "ok", "failed", or
+// "rolled_back" for an operation that would have succeeded but was
+// undone because another one failed.
+type BatchResult struct {
+	Index         int       `json:"index"`
+	TransactionID uint64    `json:"transactionId"`
+	Status        string    `json:"status"`
+	Error         *APIError `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Applied bool          `json:"applied"`
+	Results []BatchResult `json:"results"`
+	// UndoToken reverts the whole batch, see Undo.
+	UndoToken string `json:"undoToken,omitempty"`
+}
+
+var errBatchForbidden = errors.New("You do not have permission to change this transaction")
+
+func (p BatchPayload) validate() map[string]string {
+	fields := map[string]string{}
+	if len(p.Operations) == 0 {
+		fields["operations"] = "at least one operation is required"
+	}
+	if len(p.Operations) > maxBatchOps {
+		fields["operations"] = fmt.Sprintf("at most %d operations", maxBatchOps)
+	}
+	for i, op := range p.Operations {
+		key := fmt.Sprintf("operations[%d]", i)
+		if op.TransactionID == 0 {
+			fields[key+".transactionId"] = "is required"
+		}
+		switch op.Op {
+		case store.BatchUpdate:
+			if op.Fields == nil {
+				fields[key+".fields"] = "is required for update"
+				continue
+			}
+			if op.Fields.Tags != nil {
+				fields[key+".fields.tags"] = "use add_tag and remove_tag"
+			}
+			for k, msg := range op.Fields.validate() {
+				fields[key+".fields."+k] = msg
+			}
+		case store.BatchAddTag, store.BatchRemoveTag:
+			if op.Tag == "" {
+				fields[key+".tag"] = "is required"
+			}
+		case store.BatchSetCategory:
+			if op.Category == "" {
+				fields[key+".category"] = "is required"
+			}
+		case store.BatchDelete:
+		default:
+			fields[key+".op"] = "must be one of update, add_tag, remove_tag, set_category, delete"
+		}
+	}
+	return fields
+}
+
+// BatchTransactions applies a list of operations atomically: either
+// all of them are written, in order, or none are. Each operation is
+// authorized on its own with the rules of the single-transaction
+// endpoints: edits need canAccessOwner, deletes need ownership.
+func (h WithStore) BatchTransactions(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload BatchPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if fields := payload.validate(); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+
+	// authorize runs inside the write transaction, so work out up front
+	// whose transactions the caller may edit: their own, and those of
+	// users who have connected to them (see canAccessOwner).
+	subscribers, err := h.s.ListSubscribers(userId)
+	if err != nil {
+		log.Printf("Error listing subscribers of user %d: %v", userId, err)
+		writeError(w, r, "Failed to check transaction permissions", http.StatusInternalServerError)
+		return
+	}
+	editable := map[uint64]bool{userId: true}
+	for _, id := range subscribers {
+		editable[id] = true
+	}
+	for i, op := range payload.Operations {
+		if op.Fields != nil && op.Fields.RefundOf != nil && *op.Fields.RefundOf != 0 {
+			if status, msg := h.checkRefundTarget(userId, *op.Fields.RefundOf); status != 0 {
+				writeError(w, r, fmt.Sprintf("operations[%d]: %s", i, msg), status)
+				return
+			}
+		}
+	}
+
+	ids := make([]uint64, len(payload.Operations))
+	cascade := false
+	for i, op := range payload.Operations {
+		ids[i] = op.TransactionID
+		cascade = cascade || op.Op == store.BatchDelete
+	}
+	undo, ok := h.snapshot(w, r, cascade, ids...)
+	if !ok {
+		return
+	}
+	// Scope each record to what its operations change. Refunds pulled in
+	// by the cascade keep Fields: the delete clears their refundOf.
+	byID := make(map[uint64]*store.UndoRecord, len(undo))
+	for i := range undo {
+		byID[undo[i].TransactionID] = &undo[i]
+	}
+	for _, id := range ids {
+		if rec := byID[id]; rec != nil {
+			rec.Whole, rec.Fields = false, false
+		}
+	}
+	deleted := map[uint64]bool{}
+	for _, op := range payload.Operations {
+		rec := byID[op.TransactionID]
+		if rec == nil {
+			continue
+		}
+		switch op.Op {
+		case store.BatchDelete:
+			rec.Whole = true
+			deleted[op.TransactionID] = true
+		case store.BatchUpdate, store.BatchSetCategory:
+			rec.Fields = true
+		case store.BatchAddTag, store.BatchRemoveTag:
+			undoTag(rec, op.Tag)
+		}
+	}
+	for i := range undo {
+		if deleted[undo[i].Before.RefundOf] {
+			undo[i].Fields = true
+		}
+	}
+
+	ops := make([]store.BatchOp, len(payload.Operations))
+	for i, op := range payload.Operations {
+		ops[i] = store.BatchOp{Action: op.Op, TransactionID: op.TransactionID, Tag: op.Tag, Category: op.Category}
+		if op.Fields != nil {
+			fields := *op.Fields
+			ops[i].Update = func(t *store.Transaction) { applyFields(t, fields) }
+		}
+	}
+	opErrs, err := h.s.ApplyBatch(ops, func(op *store.BatchOp, t *store.Transaction) error {
+		if op.Action == store.BatchDelete {
+			if t.UserID != userId {
+				return errBatchForbidden
+			}
+			return nil
+		}
+		if !editable[t.UserID] {
+			return errBatchForbidden
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, store.ErrBatchFailed) {
+		log.Printf("Error applying batch for user %d: %v", userId, err)
+		writeError(w, r, "Failed to apply batch", http.StatusInternalServerError)
+		return
+	}
+
+	resp := BatchResponse{Applied: err == nil, Results: make([]BatchResult, len(ops))}
+	for i, opErr := range opErrs {
+		res := BatchResult{Index: i, TransactionID: ops[i].TransactionID, Status: "ok"}
+		switch {
+		case opErr != nil:
+			res.Status = "failed"
+			res.Error = batchError(opErr)
+		case !resp.Applied:
+			res.Status = "rolled_back"
+		}
+		resp.Results[i] = res
+	}
+	status := http.StatusOK
+	if resp.Applied {
+		resp.UndoToken = h.recordUndo(w, userId, "batch", undo)
+	} else {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, resp)
+}
+
+func batchError(err error) *APIError {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return &APIError{Code: CodeNotFound, Message: "Transaction not found"}
+	case errors.Is(err, errBatchForbidden):
+		return &APIError{Code: CodeForbidden, Message: err.Error()}
+	case errors.Is(err, store.ErrInvalidRefund):
+		return &APIError{Code: CodeValidation, Message: "refundOf must point at an expense and kind must be refund"}
+	}
+	return &APIError{Code: CodeBadRequest, Message: err.Error()}
+}
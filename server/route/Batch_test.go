@@ -0,0 +1,69 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestBatchTransactions(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	bob := &store.User{Username: "bob", HashPassword: "x"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	mine := &store.Transaction{UserID: alice.ID, Amount: 5, Currency: "CAD", OccurredAt: time.Now(), Merchant: "Cafe"}
+	theirs := &store.Transaction{UserID: bob.ID, Amount: 7, Currency: "CAD", OccurredAt: time.Now(), Merchant: "Shop"}
+	for _, txn := range []*store.Transaction{mine, theirs} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := fmt.Sprintf(`{"operations":[
+		{"op":"update","transactionId":%d,"fields":{"merchant":"Bakery"}},
+		{"op":"set_category","transactionId":%d,"category":"Food"},
+		{"op":"set_category","transactionId":%d,"category":"Food"}]}`, mine.ID, mine.ID, theirs.ID)
+	rec := do(mux, "POST", "/api/v1/transactions/batch", token, body)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp BatchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Applied || resp.Results[0].Status != "rolled_back" || resp.Results[2].Status != "failed" || resp.Results[2].Error.Code != CodeForbidden {
+		t.Fatalf("got %+v", resp)
+	}
+	if got, _ := s.GetTransaction(mine.ID); got.Merchant != "Cafe" {
+		t.Fatalf("merchant changed to %q despite rollback", got.Merchant)
+	}
+
+	// Once bob connects to alice she may edit his transactions, but
+	// still not delete them.
+	if err := s.AddConnection(bob.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = do(mux, "POST", "/api/v1/transactions/batch", token, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if got, _ := s.GetTransaction(theirs.ID); got.Category != "Food" {
+		t.Fatalf("category %q", got.Category)
+	}
+	rec = do(mux, "POST", "/api/v1/transactions/batch", token,
+		fmt.Sprintf(`{"operations":[{"op":"delete","transactionId":%d}]}`, theirs.ID))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("delete someone else's: status %d", rec.Code)
+	}
+
+	rec = do(mux, "POST", "/api/v1/transactions/batch", token, `{"operations":[{"op":"rename","transactionId":1}]}`)
+	if rec.Code != http.StatusUnprocessableEntity || decodeError(t, rec).Fields["operations[0].op"] == "" {
+		t.Fatalf("unknown op: status %d", rec.Code)
+	}
+}
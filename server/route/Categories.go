@@ -0,0 +1,330 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+const (
+	maxCategoryName = 64
+	maxCategoryIcon = 32
+)
+
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Category is an entry of the category catalog. Owner is the owner's
+// name; Mine is set on the caller's own categories.
+type Category struct {
+	ID       uint64 `json:"id"`
+	Name     string `json:"name"`
+	Parent   string `json:"parent,omitempty"`
+	Color    string `json:"color,omitempty"`
+	Icon     string `json:"icon,omitempty"`
+	Archived bool   `json:"archived"`
+	Owner    string `json:"owner"`
+	Mine     bool   `json:"mine"`
+}
+
+// CategoryFields creates a category (Name required) or, on PATCH,
+// changes the fields that are set.
+type CategoryFields struct {
+	Name     *string `json:"name"`
+	Parent   *string `json:"parent"`
+	Color    *string `json:"color"`
+	Icon     *string `json:"icon"`
+	Archived *bool   `json:"archived"`
+}
+
+type MergeCategoryPayload struct {
+	// Into is the ID of the category that absorbs this one.
+	Into uint64 `json:"into"`
+}
+
+// CategoryChange answers a rename or merge. Recategorized counts the
+// transactions whose category was rewritten.
+type CategoryChange struct {
+	Category      Category `json:"category"`
+	Recategorized int      `json:"recategorized"`
+}
+
+func (p CategoryFields) validate(create bool) map[string]string {
+	fields := map[string]string{}
+	if p.Name == nil && create {
+		fields["name"] = "is required"
+	}
+	if p.Name != nil {
+		switch name := strings.TrimSpace(*p.Name); {
+		case name == "":
+			fields["name"] = "must not be empty"
+		case len(name) > maxCategoryName:
+			fields["name"] = "is too long"
+		}
+	}
+	if p.Color != nil && *p.Color != "" && !colorPattern.MatchString(*p.Color) {
+		fields["color"] = "must be #rgb or #rrggbb"
+	}
+	if p.Icon != nil && len(*p.Icon) > maxCategoryIcon {
+		fields["icon"] = "is too long"
+	}
+	if p.Parent != nil && p.Name != nil && strings.EqualFold(strings.TrimSpace(*p.Parent), strings.TrimSpace(*p.Name)) {
+		fields["parent"] = "must differ from name"
+	}
+	return fields
+}
+
+func (p CategoryFields) apply(c *store.Category) {
+	if p.Name != nil {
+		c.Name = strings.TrimSpace(*p.Name)
+	}
+	if p.Parent != nil {
+		c.Parent = strings.TrimSpace(*p.Parent)
+	}
+	if p.Color != nil {
+		c.Color = *p.Color
+	}
+	if p.Icon != nil {
+		c.Icon = *p.Icon
+	}
+	if p.Archived != nil {
+		c.Archived = *p.Archived
+	}
+}
+
+func (h WithStore) toCategory(c *store.Category, userId uint64) Category {
+	owner := ""
+	if u, err := h.s.GetUserByID(c.OwnerID); err == nil {
+		owner = u.PersonName
+	}
+	return Category{
+		ID:       c.ID,
+		Name:     c.Name,
+		Parent:   c.Parent,
+		Color:    c.Color,
+		Icon:     c.Icon,
+		Archived: c.Archived,
+		Owner:    owner,
+		Mine:     c.OwnerID == userId,
+	}
+}
+
+// GetCategories lists the categories of the caller's household: their
+// own, then those of connected users. Archived ones are left out
+// unless ?archived=true. The legacy route replies with the distinct
+// names only.
+func (h WithStore) GetCategories(w http.ResponseWriter, r *http.Request, userId uint64) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	archived := r.URL.Query().Get("archived") == "true"
+
+	owners, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	out := []Category{}
+	for _, owner := range owners {
+		cats, err := h.s.ListCategories(owner)
+		if err != nil {
+			log.Printf("Error listing categories of user %d: %v", owner, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		for i := range cats {
+			if cats[i].Archived && !archived {
+				continue
+			}
+			out = append(out, h.toCategory(&cats[i], userId))
+		}
+	}
+
+	if isV1(r) {
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+	names := []string{}
+	seen := map[string]bool{}
+	for _, c := range out {
+		if key := strings.ToLower(c.Name); !seen[key] {
+			seen[key] = true
+			names = append(names, c.Name)
+		}
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+// CreateCategory adds a category to the caller's catalog.
+func (h WithStore) CreateCategory(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload CategoryFields
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if fields := payload.validate(true); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	c := &store.Category{OwnerID: userId}
+	payload.apply(c)
+	if err := h.s.CreateCategory(c); err != nil {
+		if errors.Is(err, store.ErrCategoryExists) {
+			writeError(w, r, "A category with this name already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating category: %v", err)
+		writeError(w, r, "Failed to create category", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, h.toCategory(c, userId))
+}
+
+// loadCategory resolves the {id} path value to a category the caller
+// can see and, with modify set, change (see canAccessOwner). On
+// failure it has already written the response and returns nil.
+func (h WithStore) loadCategory(w http.ResponseWriter, r *http.Request, userId uint64, name string, modify bool) *store.Category {
+	id, ok := pathID(w, r, name)
+	if !ok {
+		return nil
+	}
+	c, err := h.s.GetCategory(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error querying category %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return nil
+	}
+	if err != nil {
+		writeError(w, r, "Category not found", http.StatusNotFound)
+		return nil
+	}
+	return h.checkCategoryAccess(w, r, userId, c, modify)
+}
+
+func (h WithStore) checkCategoryAccess(w http.ResponseWriter, r *http.Request, userId uint64, c *store.Category, modify bool) *store.Category {
+	visible, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to check category permissions", http.StatusInternalServerError)
+		return nil
+	}
+	seen := false
+	for _, id := range visible {
+		seen = seen || id == c.OwnerID
+	}
+	canModify, err := h.canAccessOwner(userId, c.OwnerID)
+	if err != nil {
+		log.Printf("Error checking user connection: %v", err)
+		writeError(w, r, "Failed to check category permissions", http.StatusInternalServerError)
+		return nil
+	}
+	if !seen && !canModify {
+		writeError(w, r, "Category not found", http.StatusNotFound)
+		return nil
+	}
+	if modify && !canModify {
+		writeError(w, r, "You do not have permission to change this category", http.StatusForbidden)
+		return nil
+	}
+	return c
+}
+
+func (h WithStore) GetCategoryByID(w http.ResponseWriter, r *http.Request, userId uint64) {
+	c := h.loadCategory(w, r, userId, "id", false)
+	if c == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.toCategory(c, userId))
+}
+
+// PatchCategory changes the given fields. A new name is applied to the
+// owner's transactions in the category and to the category rules, in
+// the same request.
+func (h WithStore) PatchCategory(w http.ResponseWriter, r *http.Request, userId uint64) {
+	c := h.loadCategory(w, r, userId, "id", true)
+	if c == nil {
+		return
+	}
+	var payload CategoryFields
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if fields := payload.validate(false); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	payload.apply(c)
+	if strings.EqualFold(c.Parent, c.Name) {
+		writeValidationError(w, r, map[string]string{"parent": "must differ from name"})
+		return
+	}
+	n, err := h.s.UpdateCategory(c)
+	if err != nil {
+		if errors.Is(err, store.ErrCategoryExists) {
+			writeError(w, r, "A category with this name already exists; merge into it instead", http.StatusConflict)
+			return
+		}
+		log.Printf("Error updating category %d: %v", c.ID, err)
+		writeError(w, r, "Failed to update category", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, CategoryChange{Category: h.toCategory(c, userId), Recategorized: n})
+}
+
+// MergeCategory moves the transactions of category {id} to category
+// into and deletes {id}. Both must belong to the same owner. The rules
+// settings are shared by every user and are left alone.
+func (h WithStore) MergeCategory(w http.ResponseWriter, r *http.Request, userId uint64) {
+	from := h.loadCategory(w, r, userId, "id", true)
+	if from == nil {
+		return
+	}
+	var payload MergeCategoryPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload.Into == 0 || payload.Into == from.ID {
+		writeValidationError(w, r, map[string]string{"into": "must be another category's ID"})
+		return
+	}
+	into, err := h.s.GetCategory(payload.Into)
+	if err != nil || into.OwnerID != from.OwnerID {
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Error querying category %d: %v", payload.Into, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		writeValidationError(w, r, map[string]string{"into": "must be a category of the same owner"})
+		return
+	}
+	n, err := h.s.MergeCategory(from.ID, into.ID)
+	if err != nil {
+		log.Printf("Error merging category %d into %d: %v", from.ID, into.ID, err)
+		writeError(w, r, "Failed to merge category", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, CategoryChange{Category: h.toCategory(into, userId), Recategorized: n})
+}
+
+// DeleteCategory drops a category from the catalog. Its transactions
+// keep the name.
+func (h WithStore) DeleteCategory(w http.ResponseWriter, r *http.Request, userId uint64) {
+	c := h.loadCategory(w, r, userId, "id", true)
+	if c == nil {
+		return
+	}
+	if err := h.s.DeleteCategory(c.ID); err != nil {
+		log.Printf("Error deleting category %d: %v", c.ID, err)
+		writeError(w, r, "Failed to delete category", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
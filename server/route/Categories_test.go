@@ -0,0 +1,86 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCategoryCatalog(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	if err := s.SetSetting("rules", []byte(`[{"name":"gym","when":{"merchantContains":"gym"},"then":{"setCategory":"Sport"}}]`)); err != nil {
+		t.Fatal(err)
+	}
+	rec := do(mux, "POST", "/api/v1/transactions", token, `[
+		{"amount":12,"currency":"CAD","occurredAt":"2024-03-02T10:00:00Z","merchant":"Corner Gym"},
+		{"amount":5,"currency":"CAD","occurredAt":"2024-03-03T10:00:00Z","merchant":"Pool","category":"swim"}]`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = do(mux, "POST", "/api/v1/categories", token, `{"name":"sport","color":"red"}`)
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["color"] == "" {
+		t.Errorf("bad color = %d %+v", rec.Code, e)
+	}
+	rec = do(mux, "POST", "/api/v1/categories", token, `{"name":"sport"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("duplicate name = %d", rec.Code)
+	}
+	rec = do(mux, "POST", "/api/v1/categories", token, `{"name":"hobbies","color":"#0a0","icon":"🎨"}`)
+	var hobbies Category
+	if err := json.NewDecoder(rec.Body).Decode(&hobbies); err != nil || rec.Code != http.StatusCreated || !hobbies.Mine || hobbies.Owner != "Alice" {
+		t.Fatalf("create = %d %+v %v", rec.Code, hobbies, err)
+	}
+
+	rec = do(mux, "GET", "/api/v1/categories", token, "")
+	var cats []Category
+	if err := json.NewDecoder(rec.Body).Decode(&cats); err != nil || len(cats) != 3 {
+		t.Fatalf("list = %d %+v %v", rec.Code, cats, err)
+	}
+	if cats[0].Name != "hobbies" || cats[1].Name != "Sport" || cats[2].Name != "swim" {
+		t.Errorf("order = %+v", cats)
+	}
+	sport, swim := cats[1], cats[2]
+
+	// Renaming rewrites the owner's transactions but not the rules,
+	// which every user shares.
+	rec = do(mux, "PATCH", fmt.Sprintf("/api/v1/categories/%d", sport.ID), token, `{"name":"fitness","parent":"health"}`)
+	var change CategoryChange
+	if err := json.NewDecoder(rec.Body).Decode(&change); err != nil || change.Recategorized != 1 || change.Category.Parent != "health" {
+		t.Fatalf("rename = %d %+v %v", rec.Code, change, err)
+	}
+	raw, _ := s.GetSetting("rules")
+	if want := `"setCategory":"Sport"`; !strings.Contains(string(raw), want) {
+		t.Errorf("rules = %s", raw)
+	}
+
+	rec = do(mux, "POST", fmt.Sprintf("/api/v1/categories/%d/merge", swim.ID), token, fmt.Sprintf(`{"into":%d}`, sport.ID))
+	if err := json.NewDecoder(rec.Body).Decode(&change); err != nil || change.Recategorized != 1 || change.Category.Name != "fitness" {
+		t.Fatalf("merge = %d %+v %v", rec.Code, change, err)
+	}
+	alice, _ := s.GetUserByUsername("alice")
+	txns, _ := s.ListTransactionsForUser(alice.ID)
+	for _, tx := range txns {
+		if tx.Category != "fitness" {
+			t.Errorf("%s category = %q", tx.Merchant, tx.Category)
+		}
+	}
+
+	rec = do(mux, "PATCH", fmt.Sprintf("/api/v1/categories/%d", hobbies.ID), token, `{"archived":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("archive = %d", rec.Code)
+	}
+	rec = do(mux, "GET", "/api/categories", token, "")
+	var names []string
+	if err := json.NewDecoder(rec.Body).Decode(&names); err != nil || len(names) != 1 || names[0] != "fitness" {
+		t.Errorf("legacy names = %v %v", names, err)
+	}
+	if rec := do(mux, "DELETE", fmt.Sprintf("/api/v1/categories/%d", hobbies.ID), token, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d", rec.Code)
+	}
+	if rec := do(mux, "GET", fmt.Sprintf("/api/v1/categories/%d", hobbies.ID), token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted = %d", rec.Code)
+	}
+}
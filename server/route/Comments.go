@@ -0,0 +1,152 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+const maxCommentLength = 2000
+
+type CommentPayload struct {
+	Text string `json:"text"`
+}
+
+type Comment struct {
+	ID         uint64 `json:"id"`
+	AuthorName string `json:"authorName"`
+	Mine       bool   `json:"mine"`
+	Text       string `json:"text"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// loadVisibleTransaction resolves the {id} path value and checks that
+// the caller can see the transaction. On failure it has already
+// written the response and returns nil.
+func (h WithStore) loadVisibleTransaction(w http.ResponseWriter, r *http.Request, userId uint64) *store.Transaction {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil
+	}
+	t, err := h.s.GetTransaction(id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Transaction not found", http.StatusNotFound)
+			return nil
+		}
+		log.Printf("Error querying transaction %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return nil
+	}
+	ok, err = h.canSeeTransaction(userId, t)
+	if err != nil {
+		log.Printf("Error checking user connection: %v", err)
+		writeError(w, r, "Failed to check transaction permissions", http.StatusInternalServerError)
+		return nil
+	}
+	if !ok {
+		// Same answer as a missing row, so IDs of other households'
+		// transactions are not confirmed.
+		writeError(w, r, "Transaction not found", http.StatusNotFound)
+		return nil
+	}
+	return t
+}
+
+func (h WithStore) toComment(c store.Comment, userId uint64) Comment {
+	name := ""
+	if u, err := h.s.GetUserByID(c.AuthorID); err == nil {
+		name = u.PersonName
+	}
+	return Comment{
+		ID:         c.ID,
+		AuthorName: name,
+		Mine:       c.AuthorID == userId,
+		Text:       c.Text,
+		CreatedAt:  c.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func (h WithStore) ListComments(w http.ResponseWriter, r *http.Request, userId uint64) {
+	t := h.loadVisibleTransaction(w, r, userId)
+	if t == nil {
+		return
+	}
+	rows, err := h.s.ListCommentsForTransaction(t.ID)
+	if err != nil {
+		log.Printf("Error listing comments for transaction %d: %v", t.ID, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	comments := make([]Comment, 0, len(rows))
+	for _, c := range rows {
+		comments = append(comments, h.toComment(c, userId))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comments)
+}
+
+func (h WithStore) AddComment(w http.ResponseWriter, r *http.Request, userId uint64) {
+	t := h.loadVisibleTransaction(w, r, userId)
+	if t == nil {
+		return
+	}
+	var payload CommentPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	text := strings.TrimSpace(payload.Text)
+	if text == "" || len(text) > maxCommentLength {
+		writeError(w, r, "Comment text must be 1-2000 characters", http.StatusBadRequest)
+		return
+	}
+
+	c := &store.Comment{TransactionID: t.ID, AuthorID: userId, Text: text}
+	if err := h.s.CreateComment(c); err != nil {
+		log.Printf("Error creating comment on transaction %d: %v", t.ID, err)
+		writeError(w, r, "Failed to create comment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.toComment(*c, userId))
+}
+
+// DeleteComment removes a comment. Authors can delete their own
+// comments; the transaction owner can delete any comment on it.
+func (h WithStore) DeleteComment(w http.ResponseWriter, r *http.Request, userId uint64) {
+	t := h.loadVisibleTransaction(w, r, userId)
+	if t == nil {
+		return
+	}
+	commentID, ok := pathID(w, r, "commentId")
+	if !ok {
+		return
+	}
+	c, err := h.s.GetComment(t.ID, commentID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Comment not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error querying comment %d: %v", commentID, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	if c.AuthorID != userId && t.UserID != userId {
+		writeError(w, r, "You do not have permission to delete this comment", http.StatusForbidden)
+		return
+	}
+	if err := h.s.DeleteComment(t.ID, commentID); err != nil {
+		log.Printf("Error deleting comment %d: %v", commentID, err)
+		writeError(w, r, "Failed to delete comment", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,183 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+var currencyCodeRe = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type BaseCurrencyPayload struct {
+	BaseCurrency string `json:"baseCurrency"`
+}
+
+func (h WithStore) GetBaseCurrency(w http.ResponseWriter, r *http.Request, userId uint64) {
+	u, err := h.s.GetUserByID(userId)
+	if err != nil {
+		log.Printf("Error looking up user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BaseCurrencyPayload{BaseCurrency: u.BaseCurrencyOrDefault()})
+}
+
+func (h WithStore) UpdateBaseCurrency(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload BaseCurrencyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(payload.BaseCurrency))
+	if !currencyCodeRe.MatchString(code) {
+		writeError(w, r, "baseCurrency must be a 3-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.s.GetUserByID(userId)
+	if err != nil {
+		log.Printf("Error looking up user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	u.BaseCurrency = code
+	if err := h.s.UpdateUser(u); err != nil {
+		log.Printf("Error updating base currency for user %d: %v", userId, err)
+		writeError(w, r, "Failed to update base currency", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+type CurrencyTotal struct {
+	Currency  string  `json:"currency"`
+	Count     int     `json:"count"`
+	Amount    float64 `json:"amount"`
+	Converted float64 `json:"converted"`
+	// Rate is the effective rate, Converted / Amount. When every
+	// transaction fell on the same rate it is exactly that rate.
+	Rate float64 `json:"rate"`
+	// Unconverted counts transactions with no known rate for their
+	// date; they are in Amount but not in Converted.
+	Unconverted int `json:"unconverted"`
+}
+
+type TotalsResponse struct {
+	BaseCurrency string `json:"baseCurrency"`
+	// Total is net spending (expenses minus refunds) in BaseCurrency.
+	Total float64 `json:"total"`
+	// Income is the converted sum of income transactions.
+	Income     float64         `json:"income"`
+	Currencies []CurrencyTotal `json:"currencies"`
+}
+
+// GetTotals sums the spend of every visible transaction in [from, to]
+// (YYYY-MM-DD, both optional and inclusive) and converts each one into
+// the caller's base currency at the rate for its own date. Per-currency
+// amounts are net spend, see store.Transaction.SpendAmount.
+func (h WithStore) GetTotals(w http.ResponseWriter, r *http.Request, userId uint64) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, err := h.s.GetUserByID(userId)
+	if err != nil {
+		log.Printf("Error looking up user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	base := u.BaseCurrencyOrDefault()
+
+	userIDs, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+
+	byCurrency := map[string]*CurrencyTotal{}
+	resp := TotalsResponse{BaseCurrency: base, Currencies: []CurrencyTotal{}}
+	for _, uid := range userIDs {
+		rows, err := h.s.ListTransactionsForUser(uid)
+		if err != nil {
+			log.Printf("Error listing transactions for user %d: %v", uid, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		for _, t := range rows {
+			if (!from.IsZero() && t.OccurredAt.Before(from)) || (!to.IsZero() && !t.OccurredAt.Before(to)) {
+				continue
+			}
+			cur := strings.ToUpper(t.Currency)
+			if t.KindOrDefault() == store.KindIncome {
+				if converted, _, err := h.s.ConvertAmount(math.Abs(t.Amount), cur, base, t.OccurredAt); err == nil {
+					resp.Income += converted
+				}
+				continue
+			}
+			spend := t.SpendAmount()
+			ct := byCurrency[cur]
+			if ct == nil {
+				ct = &CurrencyTotal{Currency: cur}
+				byCurrency[cur] = ct
+			}
+			ct.Count++
+			ct.Amount += spend
+			converted, _, err := h.s.ConvertAmount(spend, cur, base, t.OccurredAt)
+			if err != nil {
+				if !errors.Is(err, store.ErrNoExchangeRate) {
+					log.Printf("Error converting transaction %d: %v", t.ID, err)
+					writeError(w, r, "Failed to convert amounts", http.StatusInternalServerError)
+					return
+				}
+				ct.Unconverted++
+				continue
+			}
+			ct.Converted += converted
+			resp.Total += converted
+		}
+	}
+
+	for _, ct := range byCurrency {
+		if ct.Amount != 0 {
+			ct.Rate = ct.Converted / ct.Amount
+		}
+		resp.Currencies = append(resp.Currencies, *ct)
+	}
+	sort.Slice(resp.Currencies, func(i, j int) bool { return resp.Currencies[i].Currency < resp.Currencies[j].Currency })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseDateRange reads the optional `from` and `to` query parameters
+// (YYYY-MM-DD, server-local days). The returned `to` is exclusive: the
+// start of the day after the one given.
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	var from, to time.Time
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return from, to, errors.New("invalid from: want YYYY-MM-DD")
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return from, to, errors.New("invalid to: want YYYY-MM-DD")
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
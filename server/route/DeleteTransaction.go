@@ -12,32 +12,56 @@ type DeleteTransactionPayload struct {
 
 func (h WithStore) DeleteTransaction(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload DeleteTransactionPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if payload.ID == 0 {
-		http.Error(w, "Transaction ID is required", http.StatusBadRequest)
+		writeError(w, r, "Transaction ID is required", http.StatusBadRequest)
 		return
 	}
 
-	deleted, err := h.s.DeleteTransaction(payload.ID, userId)
-	if err != nil {
-		log.Printf("Error deleting transaction %d: %v", payload.ID, err)
-		http.Error(w, "Failed to delete transaction", http.StatusInternalServerError)
+	if !h.deleteTransaction(w, r, userId, payload.ID) {
 		return
 	}
+	writeUndo(w, http.StatusOK)
+}
 
-	if !deleted {
-		http.Error(w, "Transaction not found", http.StatusNotFound)
+// DeleteTransactionByID is DELETE /api/v1/transactions/{id}.
+func (h WithStore) DeleteTransactionByID(w http.ResponseWriter, r *http.Request, userId uint64) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
 		return
 	}
+	if !h.deleteTransaction(w, r, userId, id) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	w.WriteHeader(http.StatusOK)
+// deleteTransaction deletes one of the caller's own transactions. On
+// failure it has already written the response and returns false.
+func (h WithStore) deleteTransaction(w http.ResponseWriter, r *http.Request, userId, id uint64) bool {
+	undo, ok := h.snapshot(w, r, true, id)
+	if !ok {
+		return false
+	}
+	deleted, err := h.s.DeleteTransaction(id, userId)
+	if err != nil {
+		log.Printf("Error deleting transaction %d: %v", id, err)
+		writeError(w, r, "Failed to delete transaction", http.StatusInternalServerError)
+		return false
+	}
+	if !deleted {
+		writeError(w, r, "Transaction not found", http.StatusNotFound)
+		return false
+	}
+	h.recordUndo(w, userId, "delete transaction", undo)
+	return true
 }
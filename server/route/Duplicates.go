@@ -0,0 +1,163 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/importer"
+	"code.sirenko.ca/transaction/store"
+)
+
+// maxDuplicateDays caps the ?days= time window of the duplicate finder.
+const maxDuplicateDays = 31
+
+// DuplicateCandidate is a pair of transactions of one owner that may be
+// the same purchase recorded twice, the earlier first. Score and
+// MerchantSimilarity run from 0 to 1, see importer.FindSimilar.
+type DuplicateCandidate struct {
+	Score              float64       `json:"score"`
+	MerchantSimilarity float64       `json:"merchantSimilarity"`
+	Transactions       []Transaction `json:"transactions"`
+}
+
+type MergeTransactionPayload struct {
+	// From is the ID of the transaction merged into {id} and deleted.
+	From uint64 `json:"from"`
+}
+
+type MergeTransactionResponse struct {
+	Transaction Transaction `json:"transaction"`
+	UndoToken   string      `json:"undoToken,omitempty"`
+}
+
+// GetDuplicateCandidates lists likely duplicates among the transactions
+// the caller can see, best first: similar merchant, same currency and
+// kind, amounts within 1% and at most ?days= (default 3) apart, within
+// the from/to range. Pairs never span two owners.
+func (h WithStore) GetDuplicateCandidates(w http.ResponseWriter, r *http.Request, userId uint64) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := importer.SimilarOptions{}
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days < 1 || days > maxDuplicateDays {
+			writeValidationError(w, r, map[string]string{"days": "must be a whole number from 1 to " + strconv.Itoa(maxDuplicateDays)})
+			return
+		}
+		opts.Window = time.Duration(days) * 24 * time.Hour
+	}
+	owners, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+
+	baseCurrency := h.baseCurrency(userId)
+	out := []DuplicateCandidate{}
+	for _, owner := range owners {
+		var txns []store.Transaction
+		err := h.s.WalkTransactionsForUser(owner, from, to, exportBatch, func(t *store.Transaction) error {
+			txns = append(txns, *t)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error listing transactions for user %d: %v", owner, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		for _, p := range importer.FindSimilar(txns, opts) {
+			c := DuplicateCandidate{Score: p.Score, MerchantSimilarity: p.Merchant}
+			for _, t := range []*store.Transaction{p.A, p.B} {
+				row, err := h.toTransaction(t, baseCurrency)
+				if err != nil {
+					log.Printf("Error building transaction %d: %v", t.ID, err)
+					writeError(w, r, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				c.Transactions = append(c.Transactions, row)
+			}
+			out = append(out, c)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// MergeTransaction folds the transaction in the body into {id} and
+// deletes it (see store.MergeTransactions): {id} keeps its values,
+// filling the empty ones from the other, and gains its tags, photos,
+// comments and refunds. Both must belong to the caller, since the
+// merge deletes one, and have the same currency. The undo token
+// restores both transactions with their tags, comments and photos.
+func (h WithStore) MergeTransaction(w http.ResponseWriter, r *http.Request, userId uint64) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	var payload MergeTransactionPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload.From == 0 || payload.From == id {
+		writeValidationError(w, r, map[string]string{"from": "must be another transaction's ID"})
+		return
+	}
+
+	var txns [2]*store.Transaction
+	for i, tid := range []uint64{id, payload.From} {
+		t, err := h.s.GetTransaction(tid)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, "Transaction not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying transaction %d: %v", tid, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		txns[i] = t
+	}
+	keep, drop := txns[0], txns[1]
+	if keep.UserID != userId {
+		writeError(w, r, "You do not have permission to merge this transaction", http.StatusForbidden)
+		return
+	}
+	switch {
+	case drop.UserID != keep.UserID:
+		writeValidationError(w, r, map[string]string{"from": "must belong to the same owner"})
+		return
+	case !strings.EqualFold(drop.Currency, keep.Currency):
+		writeValidationError(w, r, map[string]string{"from": "must be in the same currency"})
+		return
+	}
+
+	undo, ok := h.snapshot(w, r, true, keep.ID, drop.ID)
+	if !ok {
+		return
+	}
+	merged, err := h.s.MergeTransactions(keep.ID, drop.ID, keep.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidMerge) {
+			writeValidationError(w, r, map[string]string{"from": "must not be a refund of, or refunded by, this transaction"})
+			return
+		}
+		log.Printf("Error merging transaction %d into %d: %v", drop.ID, keep.ID, err)
+		writeError(w, r, "Failed to merge transactions", http.StatusInternalServerError)
+		return
+	}
+	resp := MergeTransactionResponse{UndoToken: h.recordUndo(w, userId, "merge transactions", undo)}
+	if resp.Transaction, err = h.toTransaction(merged, h.baseCurrency(userId)); err != nil {
+		log.Printf("Error building transaction %d: %v", merged.ID, err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,90 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestDuplicateCandidatesAndMerge(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	manual := &store.Transaction{UserID: alice.ID, Amount: 6.5, Currency: "CAD", Merchant: "Blue Bottle", Category: "coffee", OccurredAt: at}
+	imported := &store.Transaction{UserID: alice.ID, Amount: 6.5, Currency: "CAD", Merchant: "SQ *BLUE BOTTLE COFFEE 42", Card: "Visa", FITID: "F1", OccurredAt: at.Add(30 * time.Hour)}
+	other := &store.Transaction{UserID: alice.ID, Amount: 6.5, Currency: "CAD", Merchant: "Grocer", OccurredAt: at}
+	for _, txn := range []*store.Transaction{manual, imported, other} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tag, _ := s.GetOrCreateTag("travel")
+	if err := s.AddTagToTransaction(imported.ID, tag.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := do(mux, "GET", "/api/v1/transactions/duplicates", token, "")
+	var pairs []DuplicateCandidate
+	if err := json.NewDecoder(rec.Body).Decode(&pairs); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("duplicates = %d %v", rec.Code, err)
+	}
+	if len(pairs) != 1 || pairs[0].Transactions[0].ID != manual.ID || pairs[0].Transactions[1].ID != imported.ID || pairs[0].MerchantSimilarity != 1 {
+		t.Fatalf("pairs = %+v", pairs)
+	}
+	if rec := do(mux, "GET", "/api/v1/transactions/duplicates?days=1", token, ""); rec.Body.String() != "[]\n" {
+		t.Errorf("one-day window = %s", rec.Body)
+	}
+	if rec := do(mux, "GET", "/api/v1/transactions/duplicates?days=90", token, ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("days=90 = %d", rec.Code)
+	}
+
+	path := fmt.Sprintf("/api/v1/transactions/%d/merge", manual.ID)
+	if rec := do(mux, "POST", path, token, fmt.Sprintf(`{"from":%d}`, manual.ID)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("merge into itself = %d", rec.Code)
+	}
+	// A user alice has connected to may edit her transactions but not
+	// merge, which deletes one.
+	bob := &store.User{Username: "bob", HashPassword: "x"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(&store.Session{Code: "bob", UserID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddConnection(alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(mux, "POST", path, "bob", fmt.Sprintf(`{"from":%d}`, imported.ID)); rec.Code != http.StatusForbidden {
+		t.Errorf("merge by connected user = %d", rec.Code)
+	}
+
+	rec = do(mux, "POST", path, token, fmt.Sprintf(`{"from":%d}`, imported.ID))
+	var merged MergeTransactionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&merged); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("merge = %d %v", rec.Code, err)
+	}
+	if m := merged.Transaction; m.Merchant != "Blue Bottle" || m.Card != "Visa" || m.Category != "coffee" || len(m.Tags) != 1 || merged.UndoToken == "" {
+		t.Errorf("merged = %+v", merged)
+	}
+	if _, err := s.GetTransaction(imported.ID); err != store.ErrNotFound {
+		t.Errorf("imported copy still there: %v", err)
+	}
+
+	if rec := do(mux, "POST", "/api/v1/undo/"+merged.UndoToken, token, ""); rec.Code != http.StatusOK {
+		t.Fatalf("undo = %d %s", rec.Code, rec.Body)
+	}
+	back, err := s.GetTransaction(imported.ID)
+	if err != nil || back.FITID != "F1" {
+		t.Fatalf("restored = %+v %v", back, err)
+	}
+	if m, _ := s.GetTransaction(manual.ID); m.Card != "" {
+		t.Errorf("kept transaction not restored: %+v", m)
+	}
+	if tags, _ := s.ListTagsForTransaction(manual.ID); len(tags) != 0 {
+		t.Errorf("kept tags after undo = %v", tags)
+	}
+}
@@ -0,0 +1,189 @@
+package route
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/export"
+	"code.sirenko.ca/transaction/store"
+)
+
+// exportAccountsSetting is the settings key holding the export.Accounts
+// used for journal exports.
+const exportAccountsSetting = "export_accounts"
+
+// exportBatch is how many rows ExportTransactions reads per bbolt read
+// transaction.
+const exportBatch = 256
+
+// ExportTransactions streams every visible transaction matching the
+// list filters as newline-delimited JSON, one Transaction per line,
+// oldest first per user. Rows are read from the txn_by_user_time index
+// in batches and written as they are read, so memory does not grow
+// with the number of transactions. The body is gzipped when the client
+// accepts it.
+//
+// Once streaming has started the status can no longer change: an error
+// midway is logged and the response is cut short.
+//
+// With ?format= set to one of export.Formats the matching rows are
+// rendered by the export package instead, see exportFormatted.
+func (h WithStore) ExportTransactions(w http.ResponseWriter, r *http.Request, userId uint64) {
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format := r.URL.Query().Get("format"); format != "" && format != "ndjson" {
+		h.exportFormatted(w, r, userId, format, filter)
+		return
+	}
+	userIDs, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	baseCurrency := h.baseCurrency(userId)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Vary", "Accept-Encoding")
+	var out io.Writer = w
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	enc := json.NewEncoder(out)
+	flusher, _ := w.(http.Flusher)
+
+	n := 0
+	for _, uid := range userIDs {
+		err := h.s.WalkTransactionsForUser(uid, filter.From, filter.To, exportBatch, func(t *store.Transaction) error {
+			if !filter.match(t) {
+				return nil
+			}
+			row, err := h.toTransaction(t, baseCurrency)
+			if err != nil {
+				return err
+			}
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+			if n++; n%exportBatch == 0 && flusher != nil {
+				if gz, ok := out.(*gzip.Writer); ok {
+					gz.Flush()
+				}
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error exporting transactions for user %d after %d rows: %v", uid, n, err)
+			return
+		}
+	}
+}
+
+// exportFormatted answers ExportTransactions for the export package
+// formats as a download. The formats need every row before they can be
+// written (OFX and QIF group by card, beancount opens accounts up
+// front), so unlike NDJSON this collects the rows first. ?columns=
+// picks the CSV columns, comma separated.
+func (h WithStore) exportFormatted(w http.ResponseWriter, r *http.Request, userId uint64, format string, filter transactionFilter) {
+	if export.ContentType(format) == "" {
+		writeError(w, r, "format must be one of ndjson, "+strings.Join(export.Formats(), ", "), http.StatusBadRequest)
+		return
+	}
+	opts := export.Options{Currency: h.baseCurrency(userId)}
+	if cols := r.URL.Query().Get("columns"); cols != "" {
+		opts.Columns = strings.Split(cols, ",")
+		if err := export.ValidateColumns(opts.Columns); err != nil {
+			writeError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if raw, err := h.s.GetSetting(exportAccountsSetting); err == nil {
+		if err := json.Unmarshal(raw, &opts.Accounts); err != nil {
+			log.Printf("Error parsing %s setting: %v", exportAccountsSetting, err)
+			writeError(w, r, "The "+exportAccountsSetting+" setting is not valid", http.StatusInternalServerError)
+			return
+		}
+	} else if !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error reading %s setting: %v", exportAccountsSetting, err)
+		writeError(w, r, "Failed to query settings", http.StatusInternalServerError)
+		return
+	}
+
+	userIDs, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	var recs []export.Record
+	for _, uid := range userIDs {
+		person := ""
+		if u, err := h.s.GetUserByID(uid); err == nil {
+			person = u.PersonName
+		}
+		err := h.s.WalkTransactionsForUser(uid, filter.From, filter.To, exportBatch, func(t *store.Transaction) error {
+			if !filter.match(t) {
+				return nil
+			}
+			tags, err := h.s.ListTagsForTransaction(t.ID)
+			if err != nil {
+				return err
+			}
+			recs = append(recs, export.Record{Transaction: *t, Tags: tags, Person: person})
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error exporting transactions for user %d: %v", uid, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+	}
+	// The caller's own snapshots become balance assertions; connected
+	// users' balances are private to them.
+	snaps, err := h.s.ListSnapshots(userId, filter.From, filter.To)
+	if err != nil {
+		log.Printf("Error listing snapshots for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	for _, sn := range snaps {
+		opts.Balances = append(opts.Balances, export.Balance{Account: sn.Account, Amount: sn.Balance, Currency: sn.Currency, On: sn.On.In(time.Local)})
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="transactions.`+export.Extension(format)+`"`)
+	w.Header().Set("Vary", "Accept-Encoding")
+	var out io.Writer = w
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	if err := export.Write(out, format, recs, opts); err != nil {
+		log.Printf("Error writing %s export for user %d: %v", format, userId, err)
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, q, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(enc), "gzip") && strings.ReplaceAll(q, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
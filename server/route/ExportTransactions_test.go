@@ -0,0 +1,116 @@
+package route
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestExportTransactionsNDJSON(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	u, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	for i := 0; i < exportBatch+3; i++ {
+		txn := &store.Transaction{UserID: u.ID, Amount: float64(i), Currency: "CAD", OccurredAt: day.Add(time.Duration(i) * time.Minute), Merchant: "M"}
+		if i == 0 {
+			txn.Kind = store.KindIncome
+		}
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/transactions/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []Transaction
+	sc := bufio.NewScanner(gz)
+	for sc.Scan() {
+		var row Transaction
+		if err := json.Unmarshal(sc.Bytes(), &row); err != nil {
+			t.Fatalf("line %d: %v", len(rows)+1, err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != exportBatch+3 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	if rows[0].Amount != 0 || rows[len(rows)-1].Amount != exportBatch+2 {
+		t.Fatal("want oldest first")
+	}
+
+	rec = do(mux, "GET", "/api/v1/transactions/export?kind=income", token, "")
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("gzip without Accept-Encoding")
+	}
+	var one Transaction
+	dec := json.NewDecoder(rec.Body)
+	if err := dec.Decode(&one); err != nil || one.Kind != store.KindIncome || dec.More() {
+		t.Fatalf("kind filter: %+v, %v", one, err)
+	}
+
+	if rec := do(mux, "GET", "/api/v1/transactions/export?from=yesterday", token, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad from: status %d", rec.Code)
+	}
+}
+
+func TestExportTransactionsFormats(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	u, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := &store.Transaction{UserID: u.ID, Amount: 12.5, Currency: "CAD", OccurredAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local), Merchant: "Costco", Card: "Visa", Category: "Groceries"}
+	if err := s.CreateTransaction(txn); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := s.GetOrCreateTag("family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTagToTransaction(txn.ID, tag.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSetting(exportAccountsSetting, json.RawMessage(`{"categories":{"Groceries":"Expenses:Food"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := do(mux, "GET", "/api/v1/transactions/export?format=csv&columns=merchant,amount,tags", token, "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "merchant,amount,tags\nCostco,12.50,family\n" {
+		t.Fatalf("csv: %d %q", rec.Code, rec.Body.String())
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="transactions.csv"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	rec = do(mux, "GET", "/api/v1/transactions/export?format=beancount", token, "")
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "#family") || !strings.Contains(body, "open Expenses:Food") {
+		t.Fatalf("beancount: %d\n%s", rec.Code, body)
+	}
+
+	if rec := do(mux, "GET", "/api/v1/transactions/export?format=xlsx", token, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d", rec.Code)
+	}
+	if rec := do(mux, "GET", "/api/v1/transactions/export?format=csv&columns=nope", token, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown column: status %d", rec.Code)
+	}
+}
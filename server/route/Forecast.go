@@ -0,0 +1,310 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/forecast"
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+const (
+	dayLayout = "2006-01-02"
+	// maxForecastDays caps the horizon of GET /api/v1/forecast.
+	maxForecastDays = 366
+	// recurringLookback is how much history recurring detection reads;
+	// a little over a year so yearly charges show up twice.
+	recurringLookback = 400 * 24 * time.Hour
+)
+
+// AccountBalance is the balance of one account (a card name on
+// transactions) at the end of AsOf (YYYY-MM-DD). Current is the
+// balance today, from the nearest manual or statement snapshot of the
+// account and the caller's transactions on it since.
+type AccountBalance struct {
+	Account  string   `json:"account"`
+	Balance  float64  `json:"balance"`
+	Currency string   `json:"currency"`
+	AsOf     string   `json:"asOf"`
+	Current  *float64 `json:"current,omitempty"`
+}
+
+// ForecastItem is a recurring transaction detected in the history.
+// Amount is signed: negative for money going out.
+type ForecastItem struct {
+	Name        string  `json:"name"`
+	Account     string  `json:"account"`
+	Amount      float64 `json:"amount"`
+	Frequency   string  `json:"frequency"`
+	Next        string  `json:"next"`
+	Occurrences int     `json:"occurrences"`
+}
+
+// ForecastResponse is the projection plus the recurring transactions it
+// used. Unconverted counts transactions left out of current balances
+// and detection for lack of an exchange rate into the account's
+// currency.
+type ForecastResponse struct {
+	forecast.Forecast
+	Recurring   []ForecastItem `json:"recurring"`
+	Unconverted int            `json:"unconverted"`
+}
+
+// parseDay parses YYYY-MM-DD as a local day, like parseDateRange.
+func parseDay(s string) (time.Time, error) {
+	return time.ParseInLocation(dayLayout, s, time.Local)
+}
+
+// GetAccountBalances lists the caller's entered balances with their
+// current values.
+func (h WithStore) GetAccountBalances(w http.ResponseWriter, r *http.Request, userId uint64) {
+	balances, err := h.s.ListAccountBalances(userId)
+	if err != nil {
+		log.Printf("Error listing balances for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	current, _, err := h.currentBalances(userId, balances, time.Now())
+	if err != nil {
+		log.Printf("Error computing balances for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	out := make([]AccountBalance, len(balances))
+	for i, b := range balances {
+		cur := src.RoundCents(current[i].Balance)
+		out[i] = toAccountBalance(&b)
+		out[i].Current = &cur
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// PutAccountBalance sets the balance of payload.Account, replacing any
+// earlier one, and records it as a manual snapshot. Currency defaults
+// to the caller's base currency and asOf to today.
+func (h WithStore) PutAccountBalance(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload AccountBalance
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	b := store.AccountBalance{
+		UserID:   userId,
+		Account:  strings.TrimSpace(payload.Account),
+		Balance:  payload.Balance,
+		Currency: strings.ToUpper(strings.TrimSpace(payload.Currency)),
+		AsOf:     forecastToday(),
+	}
+	fields := map[string]string{}
+	if b.Account == "" {
+		fields["account"] = "is required"
+	}
+	if b.Currency != "" && !currencyCodeRe.MatchString(b.Currency) {
+		fields["currency"] = "must be a 3-letter ISO 4217 code"
+	}
+	if payload.AsOf != "" {
+		day, err := parseDay(payload.AsOf)
+		if err != nil {
+			fields["asOf"] = "must be YYYY-MM-DD"
+		}
+		b.AsOf = day
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	if b.Currency == "" {
+		u, err := h.s.GetUserByID(userId)
+		if err != nil {
+			log.Printf("Error looking up user %d: %v", userId, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		b.Currency = u.BaseCurrencyOrDefault()
+	}
+	sn := &store.BalanceSnapshot{UserID: userId, Account: b.Account, Balance: b.Balance, Currency: b.Currency, On: b.AsOf, Source: store.SnapshotManual}
+	if err := h.s.PutAccountBalance(&b); err != nil {
+		log.Printf("Error storing balance for user %d: %v", userId, err)
+		writeError(w, r, "Failed to store balance", http.StatusInternalServerError)
+		return
+	}
+	if err := h.s.PutSnapshots(sn); err != nil {
+		log.Printf("Error storing snapshot for user %d: %v", userId, err)
+		writeError(w, r, "Failed to store balance", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAccountBalance(&b))
+}
+
+// DeleteAccountBalance forgets the balance of {account}.
+func (h WithStore) DeleteAccountBalance(w http.ResponseWriter, r *http.Request, userId uint64) {
+	err := h.s.DeleteAccountBalance(userId, r.PathValue("account"))
+	if errors.Is(err, store.ErrNotFound) {
+		writeError(w, r, "Balance not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error deleting balance for user %d: %v", userId, err)
+		writeError(w, r, "Failed to delete balance", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetForecast projects the caller's accounts with a balance over the
+// next `days` days (default 90): from current balances, recurring
+// transactions detected in the last year on those accounts and the
+// caller's scheduled items. Each account is projected in its own
+// currency; warnings flag the first day an account closes below zero.
+func (h WithStore) GetForecast(w http.ResponseWriter, r *http.Request, userId uint64) {
+	days := forecast.DefaultDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxForecastDays {
+			writeValidationError(w, r, map[string]string{"days": "must be between 1 and " + strconv.Itoa(maxForecastDays)})
+			return
+		}
+		days = n
+	}
+
+	balances, err := h.s.ListAccountBalances(userId)
+	if err != nil {
+		log.Printf("Error listing balances for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	scheduled, err := h.s.ListScheduledItems(userId)
+	if err != nil {
+		log.Printf("Error listing scheduled items for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	accounts, unconverted, err := h.currentBalances(userId, balances, now)
+	if err != nil {
+		log.Printf("Error computing balances for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	history, n, err := h.recurringHistory(userId, accounts, now)
+	if err != nil {
+		log.Printf("Error reading history for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	unconverted += n
+
+	detected := forecast.Detect(history, now)
+	items := make([]forecast.Item, 0, len(scheduled))
+	for _, it := range scheduled {
+		items = append(items, scheduledToItem(&it))
+	}
+	f := forecast.Project(accounts, forecast.Combine(items, detected), forecast.Options{Start: now, Days: days})
+
+	resp := ForecastResponse{Forecast: *f, Recurring: []ForecastItem{}, Unconverted: unconverted}
+	for _, it := range detected {
+		resp.Recurring = append(resp.Recurring, ForecastItem{
+			Name:        it.Name,
+			Account:     it.Account,
+			Amount:      it.Amount,
+			Frequency:   it.Frequency,
+			Next:        it.Next.Format(dayLayout),
+			Occurrences: it.Occurrences,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// currentBalances returns the balance today of each account with an
+// entered balance, see balanceOn. The entered balance itself anchors
+// accounts that have no manual or statement snapshot.
+func (h WithStore) currentBalances(userId uint64, balances []store.AccountBalance, now time.Time) ([]forecast.Account, int, error) {
+	anchors, err := h.balanceAnchors(userId)
+	if err != nil {
+		return nil, 0, err
+	}
+	accounts := make([]forecast.Account, len(balances))
+	unconverted := 0
+	for i, b := range balances {
+		own := anchors[strings.ToLower(b.Account)]
+		if len(own) == 0 {
+			own = []store.BalanceSnapshot{{Account: b.Account, Balance: b.Balance, Currency: b.Currency, On: b.AsOf}}
+		}
+		bal, cur, n, err := h.balanceOn(userId, b.Account, own, b.Currency, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		accounts[i] = forecast.Account{Name: b.Account, Currency: cur, Balance: bal}
+		unconverted += n
+	}
+	return accounts, unconverted, nil
+}
+
+// recurringHistory returns the caller's transactions of the last
+// recurringLookback on accounts, converted into each account's
+// currency, for recurring detection, and how many had no rate.
+func (h WithStore) recurringHistory(userId uint64, accounts []forecast.Account, now time.Time) ([]store.Transaction, int, error) {
+	if len(accounts) == 0 {
+		return nil, 0, nil
+	}
+	currency := map[string]string{}
+	for _, a := range accounts {
+		currency[strings.ToLower(a.Name)] = a.Currency
+	}
+	var history []store.Transaction
+	unconverted := 0
+	err := h.s.WalkTransactionsForUser(userId, now.Add(-recurringLookback), now, 0, func(t *store.Transaction) error {
+		cur, ok := currency[strings.ToLower(t.Card)]
+		if !ok {
+			return nil
+		}
+		amount, _, err := h.s.ConvertAmount(t.Amount, strings.ToUpper(t.Currency), cur, t.OccurredAt)
+		if errors.Is(err, store.ErrNoExchangeRate) {
+			unconverted++
+			return nil
+		} else if err != nil {
+			return err
+		}
+		c := *t
+		c.Amount, c.Currency = amount, cur
+		history = append(history, c)
+		return nil
+	})
+	return history, unconverted, err
+}
+
+func scheduledToItem(it *store.ScheduledItem) forecast.Item {
+	amount := -it.Amount
+	if it.Kind == store.KindIncome {
+		amount = it.Amount
+	}
+	return forecast.Item{
+		Name:      it.Name,
+		Account:   it.Account,
+		Amount:    amount,
+		Frequency: it.Frequency,
+		Next:      it.Next,
+		Until:     it.Until,
+		Source:    forecast.SourceScheduled,
+	}
+}
+
+func toAccountBalance(b *store.AccountBalance) AccountBalance {
+	return AccountBalance{
+		Account:  b.Account,
+		Balance:  b.Balance,
+		Currency: b.Currency,
+		AsOf:     b.AsOf.In(time.Local).Format(dayLayout),
+	}
+}
+
+// forecastToday is the start of the current local day.
+func forecastToday() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,117 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestForecast(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 12, 0, 0, 0, time.Local)
+	day := func(offset int) string { return today.AddDate(0, 0, offset).Format("2006-01-02") }
+
+	rec := do(mux, "PUT", "/api/v1/balances", token, fmt.Sprintf(`{"account":"Chequing","balance":100,"asOf":%q}`, day(-10)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put balance = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(mux, "PUT", "/api/v1/balances", token, `{"account":"","currency":"dollars"}`)
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["account"] == "" || e.Fields["currency"] == "" {
+		t.Errorf("invalid balance = %d %+v", rec.Code, e)
+	}
+
+	base := today.AddDate(0, 0, -20)
+	for _, txn := range []*store.Transaction{
+		{UserID: alice.ID, Amount: 30, Currency: "CAD", Card: "Chequing", Merchant: "Grocer", OccurredAt: today.AddDate(0, 0, -2)},
+		{UserID: alice.ID, Amount: 99, Currency: "CAD", Card: "Chequing", Merchant: "Before", OccurredAt: today.AddDate(0, 0, -11)},
+		{UserID: alice.ID, Amount: 15, Currency: "CAD", Card: "Chequing", Merchant: "Streaming", OccurredAt: base.AddDate(0, -2, 0)},
+		{UserID: alice.ID, Amount: 15, Currency: "CAD", Card: "Chequing", Merchant: "Streaming", OccurredAt: base.AddDate(0, -1, 0)},
+		{UserID: alice.ID, Amount: 15, Currency: "CAD", Card: "chequing", Merchant: "Streaming", OccurredAt: base},
+		{UserID: alice.ID, Amount: 5, Currency: "CAD", Card: "Visa", Merchant: "Cafe", OccurredAt: today.AddDate(0, 0, -1)},
+	} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec = do(mux, "GET", "/api/v1/balances", token, "")
+	var balances []AccountBalance
+	if err := json.NewDecoder(rec.Body).Decode(&balances); err != nil || len(balances) != 1 || balances[0].Currency != "CAD" || balances[0].AsOf != day(-10) {
+		t.Fatalf("balances = %d %+v %v", rec.Code, balances, err)
+	}
+	if c := balances[0].Current; c == nil || *c != 70 {
+		t.Errorf("current = %v, want 100 less the 30 since asOf", c)
+	}
+
+	rec = do(mux, "POST", "/api/v1/scheduled", token, `{"name":"Rent","account":"Chequing","amount":200,"frequency":"fortnightly"}`)
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["frequency"] == "" || e.Fields["next"] == "" {
+		t.Errorf("invalid item = %d %+v", rec.Code, e)
+	}
+	rec = do(mux, "POST", "/api/v1/scheduled", token, fmt.Sprintf(`{"name":"Rent","account":"Chequing","amount":200,"frequency":"monthly","next":%q}`, day(5)))
+	var rent ScheduledItem
+	if err := json.NewDecoder(rec.Body).Decode(&rent); err != nil || rec.Code != http.StatusCreated || rent.Kind != "expense" || rent.Next != day(5) {
+		t.Fatalf("create item = %d %+v %v", rec.Code, rent, err)
+	}
+
+	rec = do(mux, "GET", "/api/v1/forecast?days=30", token, "")
+	var f ForecastResponse
+	if err := json.NewDecoder(rec.Body).Decode(&f); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("forecast = %d %v", rec.Code, err)
+	}
+	if f.From != day(0) || f.To != day(29) || len(f.Accounts) != 1 || len(f.Accounts[0].Series) != 30 {
+		t.Fatalf("forecast = %+v", f)
+	}
+	if len(f.Recurring) != 1 || f.Recurring[0].Name != "Streaming" || f.Recurring[0].Amount != -15 || f.Recurring[0].Next != base.AddDate(0, 1, 0).Format("2006-01-02") {
+		t.Errorf("recurring = %+v", f.Recurring)
+	}
+	chq := f.Accounts[0]
+	if chq.Start != 70 || chq.Series[5].Balance != -130 || chq.End != -145 {
+		t.Errorf("chequing = start %v, day 5 %v, end %v", chq.Start, chq.Series[5].Balance, chq.End)
+	}
+	if len(f.Warnings) != 1 || f.Warnings[0].Date != day(5) || f.Warnings[0].Balance != -130 {
+		t.Errorf("warnings = %+v", f.Warnings)
+	}
+
+	rec = do(mux, "GET", "/api/v1/forecast?days=0", token, "")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("days=0 = %d", rec.Code)
+	}
+	rec = do(mux, "GET", "/api/forecast?days=30", token, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("legacy = %d %v", rec.Code, rec.Header())
+	}
+
+	// Scheduled items are private.
+	bob := &store.User{Username: "bob", HashPassword: "x"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(&store.Session{Code: "bobtok", UserID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddConnection(bob.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = do(mux, "PATCH", fmt.Sprintf("/api/v1/scheduled/%d", rent.ID), "bobtok", `{"amount":1}`)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("bob's patch = %d", rec.Code)
+	}
+	rec = do(mux, "PATCH", fmt.Sprintf("/api/v1/scheduled/%d", rent.ID), token, fmt.Sprintf(`{"until":%q}`, day(1)))
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["until"] == "" {
+		t.Errorf("until before next = %d %+v", rec.Code, e)
+	}
+	rec = do(mux, "DELETE", fmt.Sprintf("/api/v1/scheduled/%d", rent.ID), token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d", rec.Code)
+	}
+	rec = do(mux, "DELETE", "/api/v1/balances/chequing", token, "")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("delete balance = %d", rec.Code)
+	}
+}
@@ -8,14 +8,14 @@ import (
 
 func (h WithStore) GetSharingConnections(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	connected, err := h.s.ListConnectedUserIDs(userId)
 	if err != nil {
 		log.Printf("Error querying sharing connections for user %d: %v", userId, err)
-		http.Error(w, "Failed to query sharing connections", http.StatusInternalServerError)
+		writeError(w, r, "Failed to query sharing connections", http.StatusInternalServerError)
 		return
 	}
 
@@ -8,14 +8,14 @@ import (
 
 func (h WithStore) GetSharingTokens(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	tokens, err := h.s.ListTokensForUser(userId)
 	if err != nil {
 		log.Printf("Error querying sharing tokens for user %d: %v", userId, err)
-		http.Error(w, "Failed to query sharing tokens", http.StatusInternalServerError)
+		writeError(w, r, "Failed to query sharing tokens", http.StatusInternalServerError)
 		return
 	}
 
@@ -16,14 +16,14 @@ type Subscription struct {
 
 func (h WithStore) GetSubscriptions(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	subscribers, err := h.s.ListSubscribers(userId)
 	if err != nil {
 		log.Printf("Error querying subscriptions for user %d: %v", userId, err)
-		http.Error(w, "Failed to query subscriptions", http.StatusInternalServerError)
+		writeError(w, r, "Failed to query subscriptions", http.StatusInternalServerError)
 		return
 	}
 
@@ -37,7 +37,7 @@ func (h WithStore) GetSubscriptions(w http.ResponseWriter, r *http.Request, user
 		encryptedUserID, err := src.Encrypt(strconv.FormatUint(sid, 10))
 		if err != nil {
 			log.Printf("Error encrypting user ID %d: %v", sid, err)
-			http.Error(w, "Failed to encrypt user ID", http.StatusInternalServerError)
+			writeError(w, r, "Failed to encrypt user ID", http.StatusInternalServerError)
 			return
 		}
 		subscriptions = append(subscriptions, Subscription{
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
 )
 
 type Transaction struct {
@@ -25,88 +26,75 @@ type Transaction struct {
 	Details    *string  `json:"details"`
 	Tags       []string `json:"tags"`
 	Photos     []string `json:"photos"`
+	Kind       string   `json:"kind"`
+	RefundOf   *uint64  `json:"refundOf,omitempty"`
+	// CommentCount is the length of the transaction's comment thread.
+	CommentCount int `json:"commentCount"`
+	// BaseAmount is Amount converted into the caller's base currency
+	// at ExchangeRate, the rate for OccurredAt. Both are omitted when
+	// no rate is known.
+	BaseAmount   *float64 `json:"baseAmount,omitempty"`
+	ExchangeRate *float64 `json:"exchangeRate,omitempty"`
+	// FITID is the bank's transaction ID, for OFX imports.
+	FITID string `json:"fitid,omitempty"`
+	// MCC is the merchant category code, see store.Transaction.MCC.
+	MCC string `json:"mcc,omitempty"`
+	// BatchID is the import batch that created the transaction.
+	BatchID uint64 `json:"batchId,omitempty"`
+	// RawMerchant is the merchant as entered or imported when Merchant
+	// is a catalog name it was normalized to.
+	RawMerchant string `json:"rawMerchant,omitempty"`
 }
 
 func (h WithStore) GetTransactions(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseTransactionFilter(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Build the set of user IDs whose transactions are visible to userId:
 	// self + every connected user.
-	userIDs := []uint64{userId}
-	connected, err := h.s.ListConnectedUserIDs(userId)
+	userIDs, err := h.visibleUserIDs(userId)
 	if err != nil {
 		log.Printf("Error listing connections: %v", err)
-		http.Error(w, "Failed to query database", http.StatusInternalServerError)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
 		return
 	}
-	userIDs = append(userIDs, connected...)
+
+	baseCurrency := h.baseCurrency(userId)
 
 	var transactions []Transaction
 	for _, uid := range userIDs {
 		rows, err := h.s.ListTransactionsForUser(uid)
 		if err != nil {
 			log.Printf("Error listing transactions for user %d: %v", uid, err)
-			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
 			return
 		}
-		for _, t := range rows {
-			personName := ""
-			if u, err := h.s.GetUserByID(uid); err == nil {
-				personName = u.PersonName
+		for i := range rows {
+			if !filter.match(&rows[i]) {
+				continue
 			}
-			tags, _ := h.s.ListTagsForTransaction(t.ID)
-			photoPaths, _ := h.s.ListPhotosForTransaction(t.ID)
-
-			// Encrypt IDs for photo URLs.
-			encryptedUserId, err := src.Encrypt(strconv.FormatUint(uid, 10))
+			t, err := h.toTransaction(&rows[i], baseCurrency)
 			if err != nil {
-				log.Printf("Error encrypting user ID: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				log.Printf("Error building transaction %d: %v", rows[i].ID, err)
+				writeError(w, r, "Internal server error", http.StatusInternalServerError)
 				return
 			}
-			encryptedTransactionId, err := src.Encrypt(strconv.FormatUint(t.ID, 10))
-			if err != nil {
-				log.Printf("Error encrypting transaction ID: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-			for i, p := range photoPaths {
-				photoPaths[i] = "/uploads/transaction/" + encryptedUserId + "/" + encryptedTransactionId + "/" + filepath.Base(p)
-			}
-			if tags == nil {
-				tags = []string{}
-			}
-			if photoPaths == nil {
-				photoPaths = []string{}
-			}
-			var details *string
-			if t.Details != "" {
-				d := t.Details
-				details = &d
-			}
-			transactions = append(transactions, Transaction{
-				ID:         t.ID,
-				Amount:     t.Amount,
-				Currency:   t.Currency,
-				OccurredAt: t.OccurredAt.Format(time.RFC3339),
-				Merchant:   t.Merchant,
-				PersonName: personName,
-				Card:       t.Card,
-				Category:   t.Category,
-				Details:    details,
-				Tags:       tags,
-				Photos:     photoPaths,
-			})
+			transactions = append(transactions, t)
 		}
 	}
 
 	data, err := json.Marshal(transactions)
 	if err != nil {
 		log.Printf("Error marshaling transactions: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -120,3 +108,94 @@ func (h WithStore) GetTransactions(w http.ResponseWriter, r *http.Request, userI
 	w.Header().Set("ETag", etag)
 	w.Write(data)
 }
+
+// GetTransactionByID is GET /api/v1/transactions/{id}.
+func (h WithStore) GetTransactionByID(w http.ResponseWriter, r *http.Request, userId uint64) {
+	t := h.loadVisibleTransaction(w, r, userId)
+	if t == nil {
+		return
+	}
+	out, err := h.toTransaction(t, h.baseCurrency(userId))
+	if err != nil {
+		log.Printf("Error building transaction %d: %v", t.ID, err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (h WithStore) baseCurrency(userId uint64) string {
+	if u, err := h.s.GetUserByID(userId); err == nil {
+		return u.BaseCurrencyOrDefault()
+	}
+	return store.DefaultBaseCurrency
+}
+
+// toTransaction builds the API view of t, with tags, photo URLs, the
+// comment count and the amount in baseCurrency.
+func (h WithStore) toTransaction(t *store.Transaction, baseCurrency string) (Transaction, error) {
+	personName := ""
+	if u, err := h.s.GetUserByID(t.UserID); err == nil {
+		personName = u.PersonName
+	}
+	tags, _ := h.s.ListTagsForTransaction(t.ID)
+	photoPaths, _ := h.s.ListPhotosForTransaction(t.ID)
+	commentCount, _ := h.s.CountCommentsForTransaction(t.ID)
+
+	if len(photoPaths) > 0 {
+		// Encrypt IDs for photo URLs.
+		encryptedUserId, err := src.Encrypt(strconv.FormatUint(t.UserID, 10))
+		if err != nil {
+			return Transaction{}, fmt.Errorf("encrypt user ID: %w", err)
+		}
+		encryptedTransactionId, err := src.Encrypt(strconv.FormatUint(t.ID, 10))
+		if err != nil {
+			return Transaction{}, fmt.Errorf("encrypt transaction ID: %w", err)
+		}
+		for i, p := range photoPaths {
+			photoPaths[i] = "/uploads/transaction/" + encryptedUserId + "/" + encryptedTransactionId + "/" + filepath.Base(p)
+		}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	if photoPaths == nil {
+		photoPaths = []string{}
+	}
+	var details *string
+	if t.Details != "" {
+		d := t.Details
+		details = &d
+	}
+	var baseAmount, rate *float64
+	if converted, r, err := h.s.ConvertAmount(t.Amount, t.Currency, baseCurrency, t.OccurredAt); err == nil {
+		baseAmount, rate = &converted, &r
+	}
+	var refundOf *uint64
+	if t.RefundOf != 0 {
+		id := t.RefundOf
+		refundOf = &id
+	}
+	return Transaction{
+		ID:           t.ID,
+		Amount:       t.Amount,
+		Currency:     t.Currency,
+		OccurredAt:   t.OccurredAt.Format(time.RFC3339),
+		Merchant:     t.Merchant,
+		PersonName:   personName,
+		Card:         t.Card,
+		Category:     t.Category,
+		Details:      details,
+		Tags:         tags,
+		Photos:       photoPaths,
+		Kind:         t.KindOrDefault(),
+		RefundOf:     refundOf,
+		CommentCount: commentCount,
+		BaseAmount:   baseAmount,
+		ExchangeRate: rate,
+		FITID:        t.FITID,
+		MCC:          t.MCC,
+		BatchID:      t.BatchID,
+		RawMerchant:  t.RawMerchant,
+	}, nil
+}
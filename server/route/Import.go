@@ -0,0 +1,229 @@
+package route
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/importer"
+	"code.sirenko.ca/transaction/store"
+)
+
+// ImportPreviewRow is a parsed row in the shape POST /api/v1/imports/commit
+// takes back. Duplicate is set when the caller already has a matching
+// transaction (see importer.DuplicateKey); commit skips those.
+type ImportPreviewRow struct {
+	AddTransactionPayload
+	Duplicate bool `json:"duplicate"`
+}
+
+type ImportPreview struct {
+	Format string `json:"format"`
+	// FileHash is the hex SHA-256 of the uploaded file, to send back
+	// with the commit.
+	FileHash   string             `json:"fileHash"`
+	Rows       []ImportPreviewRow `json:"rows"`
+	Duplicates int                `json:"duplicates"`
+	// Balances are the statement balances of formats that carry them,
+	// to send back with the commit.
+	Balances []Snapshot `json:"balances,omitempty"`
+}
+
+// ImportCommitPayload is what the commit stores. Source and FileHash
+// are recorded on the import batch; Source is normally the preview's
+// Format and defaults to "import".
+type ImportCommitPayload struct {
+	Source       string                  `json:"source"`
+	FileHash     string                  `json:"fileHash"`
+	Transactions []AddTransactionPayload `json:"transactions"`
+	// Balances are stored as statement snapshots.
+	Balances []Snapshot `json:"balances"`
+}
+
+type ImportCommitResponse struct {
+	Created []Transaction `json:"created"`
+	// Skipped counts rows dropped as duplicates of stored transactions.
+	Skipped int `json:"skipped"`
+	// BatchID is the import batch the rows were stored under; zero when
+	// every row was skipped.
+	BatchID uint64 `json:"batchId,omitempty"`
+	// UndoToken deletes everything the import created, see Undo.
+	UndoToken string `json:"undoToken,omitempty"`
+	// Snapshots counts the statement balances stored.
+	Snapshots int `json:"snapshots"`
+}
+
+// PreviewImport parses the uploaded "file" with the importer named by
+// ?format=, categorizes the rows and flags the ones already stored.
+// Nothing is written.
+func (h WithStore) PreviewImport(w http.ResponseWriter, r *http.Request, userId uint64) {
+	format := r.URL.Query().Get("format")
+	parser, ok := importer.Lookup(format)
+	if !ok {
+		writeError(w, r, "format must be one of "+strings.Join(importer.Names(), ", "), http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB
+		writeError(w, r, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, "A file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	var (
+		rows     []importer.Row
+		balances []importer.Balance
+	)
+	if bp, ok := parser.(importer.BalanceParser); ok {
+		rows, balances, err = bp.ParseBalances(io.TeeReader(file, hash))
+	} else {
+		rows, err = parser.Parse(io.TeeReader(file, hash))
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	importer.Categorize(rows, h.rulesEngine(userId))
+	dups, ok := h.storedDuplicates(w, r, userId)
+	if !ok {
+		return
+	}
+
+	// Parsers may stop before EOF; hash the whole file.
+	if _, err := io.Copy(hash, file); err != nil {
+		writeError(w, r, "Unable to read file", http.StatusBadRequest)
+		return
+	}
+	preview := ImportPreview{
+		Format:   strings.ToLower(format),
+		FileHash: hex.EncodeToString(hash.Sum(nil)),
+		Rows:     make([]ImportPreviewRow, len(rows)),
+	}
+	for i := range rows {
+		row := &rows[i]
+		p := ImportPreviewRow{AddTransactionPayload: AddTransactionPayload{
+			Amount:     row.Amount,
+			Currency:   row.Currency,
+			OccurredAt: row.OccurredAt.UTC().Format(time.RFC3339),
+			Merchant:   row.Merchant,
+			Card:       row.Card,
+			Category:   row.Category,
+			Tags:       row.Tags,
+			Kind:       row.Kind,
+			FITID:      row.FITID,
+			MCC:        row.MCC,
+		}}
+		if row.Details != "" {
+			p.Details = &row.Details
+		}
+		if p.Tags == nil {
+			p.Tags = []string{}
+		}
+		if dups.Contains(row.Transaction(userId)) {
+			p.Duplicate = true
+			preview.Duplicates++
+		}
+		preview.Rows[i] = p
+	}
+	for _, b := range balances {
+		preview.Balances = append(preview.Balances, Snapshot{
+			Account:  b.Card,
+			Balance:  b.Amount,
+			Currency: b.Currency,
+			On:       b.AsOf.Format(dayLayout),
+			Source:   store.SnapshotStatement,
+		})
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
+
+// CommitImport stores the rows of a (possibly edited) preview. Rows
+// matching a stored transaction are skipped again here, so committing
+// the same file twice adds nothing. Balances replace the snapshots of
+// the same account and day.
+func (h WithStore) CommitImport(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload ImportCommitPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	base := h.baseCurrency(userId)
+	snaps := make([]*store.BalanceSnapshot, len(payload.Balances))
+	fields := map[string]string{}
+	for i, b := range payload.Balances {
+		sn, errs := toStoreSnapshot(b, userId, base, store.SnapshotStatement)
+		for k, msg := range errs {
+			fields[fmt.Sprintf("balances[%d].%s", i, k)] = msg
+		}
+		snaps[i] = sn
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	dups, ok := h.storedDuplicates(w, r, userId)
+	if !ok {
+		return
+	}
+	var fresh []AddTransactionPayload
+	skipped := 0
+	for _, t := range payload.Transactions {
+		// Invalid dates are left for createTransactions to report.
+		occurredAt, err := parseOccurredAt(t.OccurredAt)
+		if err == nil && dups.Contains(&store.Transaction{OccurredAt: occurredAt, Amount: t.Amount, Merchant: t.Merchant, Card: t.Card, FITID: t.FITID}) {
+			skipped++
+			continue
+		}
+		fresh = append(fresh, t)
+	}
+
+	// Balances go first: storing them again replaces the same account
+	// and day, so a retry after a failure below is safe, while rows
+	// created before a failed balance write would be left without an
+	// undo token.
+	if err := h.s.PutSnapshots(snaps...); err != nil {
+		log.Printf("Error storing statement balances for user %d: %v", userId, err)
+		writeError(w, r, "Failed to store statement balances", http.StatusInternalServerError)
+		return
+	}
+
+	batch := &store.ImportBatch{
+		Source:   strings.ToLower(strings.TrimSpace(payload.Source)),
+		FileHash: payload.FileHash,
+	}
+	if batch.Source == "" {
+		batch.Source = batchSourceImport
+	}
+	created, ok := h.createTransactions(w, r, userId, "transactions", batch, fresh)
+	if !ok {
+		return
+	}
+	resp := ImportCommitResponse{Skipped: skipped, BatchID: batch.ID}
+	if resp.Created, ok = h.toTransactions(w, r, userId, created); !ok {
+		return
+	}
+	resp.UndoToken = h.recordUndo(w, userId, "import", createdRecords(created))
+	resp.Snapshots = len(snaps)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (h WithStore) storedDuplicates(w http.ResponseWriter, r *http.Request, userId uint64) (*importer.Duplicates, bool) {
+	existing, err := h.s.ListTransactionsForUser(userId)
+	if err != nil {
+		log.Printf("Error listing transactions for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return nil, false
+	}
+	return importer.NewDuplicates(existing), true
+}
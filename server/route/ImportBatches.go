@@ -0,0 +1,147 @@
+package route
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+// Sources recorded on batches that did not come from an importer
+// format.
+const (
+	batchSourceManual = "manual"
+	batchSourceImport = "import"
+)
+
+// ImportBatch is one AddTransactions call or import commit. RowCount is
+// how many transactions it created; Remaining is how many of them still
+// exist.
+type ImportBatch struct {
+	ID           uint64  `json:"id"`
+	Source       string  `json:"source"`
+	CreatedAt    string  `json:"createdAt"`
+	FileHash     string  `json:"fileHash,omitempty"`
+	RowCount     int     `json:"rowCount"`
+	Remaining    int     `json:"remaining"`
+	RolledBackAt *string `json:"rolledBackAt,omitempty"`
+}
+
+type RollbackResponse struct {
+	Batch   ImportBatch `json:"batch"`
+	Deleted int         `json:"deleted"`
+}
+
+func toImportBatch(b *store.ImportBatch) ImportBatch {
+	out := ImportBatch{
+		ID:        b.ID,
+		Source:    b.Source,
+		CreatedAt: b.CreatedAt.Format(time.RFC3339),
+		FileHash:  b.FileHash,
+		RowCount:  b.RowCount,
+		Remaining: b.Remaining,
+	}
+	if b.RolledBackAt != nil {
+		at := b.RolledBackAt.Format(time.RFC3339)
+		out.RolledBackAt = &at
+	}
+	return out
+}
+
+// loadOwnBatch resolves the {id} path value to one of the caller's
+// batches. On failure it has already written the response and returns
+// nil.
+func (h WithStore) loadOwnBatch(w http.ResponseWriter, r *http.Request, userId uint64) *store.ImportBatch {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil
+	}
+	b, err := h.s.GetImportBatch(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error querying import batch %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return nil
+	}
+	if err != nil || b.UserID != userId {
+		writeError(w, r, "Import batch not found", http.StatusNotFound)
+		return nil
+	}
+	return b
+}
+
+// ListImportBatches lists the caller's batches, newest first.
+func (h WithStore) ListImportBatches(w http.ResponseWriter, r *http.Request, userId uint64) {
+	batches, err := h.s.ListImportBatches(userId)
+	if err != nil {
+		log.Printf("Error listing import batches for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	out := make([]ImportBatch, 0, len(batches))
+	for i := range batches {
+		out = append(out, toImportBatch(&batches[i]))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (h WithStore) GetImportBatch(w http.ResponseWriter, r *http.Request, userId uint64) {
+	b := h.loadOwnBatch(w, r, userId)
+	if b == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, toImportBatch(b))
+}
+
+// ListImportBatchTransactions returns the batch's transactions that
+// have not been deleted since.
+func (h WithStore) ListImportBatchTransactions(w http.ResponseWriter, r *http.Request, userId uint64) {
+	b := h.loadOwnBatch(w, r, userId)
+	if b == nil {
+		return
+	}
+	rows, err := h.s.ListBatchTransactions(b.ID)
+	if err != nil {
+		log.Printf("Error listing transactions of import batch %d: %v", b.ID, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	created := make([]*store.Transaction, len(rows))
+	for i := range rows {
+		created[i] = &rows[i]
+	}
+	out, ok := h.toTransactions(w, r, userId, created)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// RollbackImportBatch deletes every remaining transaction of one of the
+// caller's batches in a single write, with the cascades of a delete.
+// Rolling back twice is a 409. The rollback cannot be undone: the batch
+// is the record that it happened.
+func (h WithStore) RollbackImportBatch(w http.ResponseWriter, r *http.Request, userId uint64) {
+	b := h.loadOwnBatch(w, r, userId)
+	if b == nil {
+		return
+	}
+	n, err := h.s.RollbackImportBatch(b.ID, time.Now())
+	if err != nil {
+		if errors.Is(err, store.ErrBatchRolledBack) {
+			writeError(w, r, "Import batch already rolled back", http.StatusConflict)
+			return
+		}
+		log.Printf("Error rolling back import batch %d: %v", b.ID, err)
+		writeError(w, r, "Failed to roll back import batch", http.StatusInternalServerError)
+		return
+	}
+	after, err := h.s.GetImportBatch(b.ID)
+	if err != nil {
+		log.Printf("Error reading import batch %d after rollback: %v", b.ID, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, RollbackResponse{Batch: toImportBatch(after), Deleted: n})
+}
@@ -0,0 +1,65 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestImportBatchRollback(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	body := `[{"amount":5,"currency":"CAD","occurredAt":"2024-03-01T10:00:00Z","merchant":"A","tags":["x"]},
+		{"amount":6,"currency":"CAD","occurredAt":"2024-03-02T10:00:00Z","merchant":"B"}]`
+	rec := do(mux, "POST", "/api/v1/transactions", token, body)
+	var created []Transaction
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil || len(created) != 2 {
+		t.Fatalf("create %d: %v", rec.Code, err)
+	}
+	if created[0].BatchID == 0 || created[1].BatchID != created[0].BatchID {
+		t.Fatalf("batch ids %d %d", created[0].BatchID, created[1].BatchID)
+	}
+	id := created[0].BatchID
+
+	rec = do(mux, "GET", "/api/v1/imports", token, "")
+	var batches []ImportBatch
+	if err := json.NewDecoder(rec.Body).Decode(&batches); err != nil || len(batches) != 1 {
+		t.Fatalf("list %d %+v %v", rec.Code, batches, err)
+	}
+	if b := batches[0]; b.Source != "manual" || b.RowCount != 2 || b.Remaining != 2 || len(b.FileHash) != 64 {
+		t.Errorf("batch = %+v", b)
+	}
+	rec = do(mux, "GET", fmt.Sprintf("/api/v1/imports/%d/transactions", id), token, "")
+	var rows []Transaction
+	if err := json.NewDecoder(rec.Body).Decode(&rows); err != nil || len(rows) != 2 || rows[0].Tags[0] != "x" {
+		t.Fatalf("rows %d %+v %v", rec.Code, rows, err)
+	}
+
+	// Another user cannot see or roll back the batch.
+	bob := &store.User{Username: "bob", HashPassword: "x"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(&store.Session{Code: "bob", UserID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(mux, "POST", fmt.Sprintf("/api/v1/imports/%d/rollback", id), "bob", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("bob rollback = %d", rec.Code)
+	}
+
+	rec = do(mux, "POST", fmt.Sprintf("/api/v1/imports/%d/rollback", id), token, "")
+	var resp RollbackResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Deleted != 2 || resp.Batch.RolledBackAt == nil || resp.Batch.Remaining != 0 {
+		t.Fatalf("rollback %d %+v %v", rec.Code, resp, err)
+	}
+	alice, _ := s.GetUserByUsername("alice")
+	if list, _ := s.ListTransactionsForUser(alice.ID); len(list) != 0 {
+		t.Errorf("expected no transactions, got %d", len(list))
+	}
+	rec = do(mux, "POST", fmt.Sprintf("/api/v1/imports/%d/rollback", id), token, "")
+	if e := decodeError(t, rec); rec.Code != http.StatusConflict || e.Code != CodeConflict {
+		t.Errorf("second rollback = %d %+v", rec.Code, e)
+	}
+}
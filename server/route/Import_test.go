@@ -0,0 +1,164 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/rules"
+	"code.sirenko.ca/transaction/store"
+)
+
+func upload(t *testing.T, mux http.Handler, path, token, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	mw.Close()
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImportPreviewAndCommit(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	u, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := &store.Transaction{UserID: u.ID, Amount: 3.5, Currency: "CAD", OccurredAt: time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local), Merchant: "The Coffee Shop", Card: "visa"}
+	if err := s.CreateTransaction(stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetSetting(rules.CategoriesSetting, json.RawMessage(`{"books": ["book store"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	csv := "date,merchant,amount,card,tags\n2024-01-01,The Coffee Shop,3.50,visa,\n2024-01-02,Book Store,25,visa,gift\n"
+	rec := upload(t, mux, "/api/v1/imports/preview?format=csv", token, csv)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preview: %d %s", rec.Code, rec.Body.String())
+	}
+	var preview ImportPreview
+	if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Rows) != 2 || preview.Duplicates != 1 || !preview.Rows[0].Duplicate || preview.Rows[1].Duplicate {
+		t.Fatalf("preview = %+v", preview)
+	}
+	if row := preview.Rows[1]; row.Category != "books" || len(row.Tags) != 1 || row.Tags[0] != "gift" {
+		t.Errorf("row 1 = %+v", row)
+	}
+	if n, _ := s.ListTransactionsForUser(u.ID); len(n) != 1 {
+		t.Fatal("preview must not write")
+	}
+
+	var commit ImportCommitPayload
+	for _, row := range preview.Rows {
+		commit.Transactions = append(commit.Transactions, row.AddTransactionPayload)
+	}
+	body, _ := json.Marshal(commit)
+	rec = do(mux, "POST", "/api/v1/imports/commit", token, string(body))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("commit: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp ImportCommitResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Created) != 1 || resp.Skipped != 1 || resp.Created[0].Merchant != "Book Store" || resp.UndoToken == "" {
+		t.Fatalf("commit = %+v", resp)
+	}
+
+	// Committing again adds nothing.
+	rec = do(mux, "POST", "/api/v1/imports/commit", token, string(body))
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.Created) != 0 || resp.Skipped != 2 {
+		t.Fatalf("recommit = %+v, %v", resp, err)
+	}
+
+	if rec := upload(t, mux, "/api/v1/imports/preview?format=xlsx", token, csv); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: %d", rec.Code)
+	}
+	if rec := upload(t, mux, "/api/v1/imports/preview?format=csv", token, "merchant\nx\n"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad csv: %d", rec.Code)
+	}
+}
+
+func TestImportOFXTwice(t *testing.T) {
+	_, mux, token := newTestMux(t)
+	ofx := `<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>CAD<BANKACCTFROM><ACCTID>000123456</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>POS<DTPOSTED>20240301<TRNAMT>-4.00<FITID>F1<NAME>Bus</STMTTRN>
+<STMTTRN><TRNTYPE>POS<DTPOSTED>20240301<TRNAMT>-4.00<FITID>F2<NAME>Bus</STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`
+
+	for round, wantCreated := range []int{2, 0} {
+		rec := upload(t, mux, "/api/v1/imports/preview?format=qfx", token, ofx)
+		var preview ImportPreview
+		if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil || len(preview.Rows) != 2 {
+			t.Fatalf("round %d: preview %d %+v %v", round, rec.Code, preview, err)
+		}
+		if preview.Rows[1].FITID != "F2" || preview.Rows[1].Card != "3456" {
+			t.Fatalf("row = %+v", preview.Rows[1])
+		}
+		var commit ImportCommitPayload
+		for _, row := range preview.Rows {
+			commit.Transactions = append(commit.Transactions, row.AddTransactionPayload)
+		}
+		body, _ := json.Marshal(commit)
+		var resp ImportCommitResponse
+		rec = do(mux, "POST", "/api/v1/imports/commit", token, string(body))
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || len(resp.Created) != wantCreated {
+			t.Fatalf("round %d: commit %+v %v", round, resp, err)
+		}
+	}
+}
+
+func TestImportAgainAfterMerchantAlias(t *testing.T) {
+	_, mux, token := newTestMux(t)
+	csv := "date,merchant,amount\n2024-03-01,AMAZON.COM *AB12,20\n2024-03-02,Cafe,4\n"
+	commit := func() ImportCommitResponse {
+		t.Helper()
+		rec := upload(t, mux, "/api/v1/imports/preview?format=csv", token, csv)
+		var preview ImportPreview
+		if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil {
+			t.Fatal(err)
+		}
+		var payload ImportCommitPayload
+		for _, row := range preview.Rows {
+			payload.Transactions = append(payload.Transactions, row.AddTransactionPayload)
+		}
+		body, _ := json.Marshal(payload)
+		var resp ImportCommitResponse
+		rec = do(mux, "POST", "/api/v1/imports/commit", token, string(body))
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusCreated {
+			t.Fatalf("commit = %d %v", rec.Code, err)
+		}
+		return resp
+	}
+	if resp := commit(); len(resp.Created) != 2 {
+		t.Fatalf("first import = %+v", resp)
+	}
+	if rec := do(mux, "POST", "/api/v1/merchants", token, `{"name":"Amazon","aliases":["AMAZON.COM"]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("alias = %d %s", rec.Code, rec.Body)
+	}
+	rec := upload(t, mux, "/api/v1/imports/preview?format=csv", token, csv)
+	var preview ImportPreview
+	if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil || preview.Duplicates != 2 {
+		t.Errorf("preview duplicates = %d %v", preview.Duplicates, err)
+	}
+	if resp := commit(); len(resp.Created) != 0 || resp.Skipped != 2 {
+		t.Errorf("second import = created %d, skipped %d", len(resp.Created), resp.Skipped)
+	}
+}
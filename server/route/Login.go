@@ -15,6 +15,11 @@ type LoginPayload struct {
 	Password string `json:"password"`
 }
 
+// TokenResponse carries a session token (login) or a sharing token.
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
 type User struct {
 	ID           uint64
 	Username     string
@@ -23,13 +28,13 @@ type User struct {
 
 func (h WithStore) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload LoginPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -37,11 +42,11 @@ func (h WithStore) Login(w http.ResponseWriter, r *http.Request) {
 	dbUser, err := h.s.GetUserByUsername(payload.Username)
 	if err != nil {
 		if err == store.ErrNotFound {
-			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+			writeError(w, r, "Invalid username or password", http.StatusUnauthorized)
 			return
 		}
 		log.Printf("Error querying database for user %s: %v", payload.Username, err)
-		http.Error(w, "Failed to query database", http.StatusInternalServerError)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
 		return
 	}
 	user.ID = dbUser.ID
@@ -51,19 +56,19 @@ func (h WithStore) Login(w http.ResponseWriter, r *http.Request) {
 	match, err := src.ComparePasswordAndHash(payload.Password, user.HashPassword)
 	if err != nil {
 		log.Printf("Error comparing password for user %s: %v", payload.Username, err)
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		writeError(w, r, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
 	if !match {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		writeError(w, r, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
 	token, err := generateSecureToken(32)
 	if err != nil {
 		log.Printf("Error generating session token for user %s: %v", payload.Username, err)
-		http.Error(w, "Failed to generate session token", http.StatusInternalServerError)
+		writeError(w, r, "Failed to generate session token", http.StatusInternalServerError)
 		return
 	}
 
@@ -75,10 +80,10 @@ func (h WithStore) Login(w http.ResponseWriter, r *http.Request) {
 		LastUsed: time.Now(),
 	}); err != nil {
 		log.Printf("Error creating session for user %s: %v", payload.Username, err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		writeError(w, r, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": token})
+	json.NewEncoder(w).Encode(TokenResponse{Token: token})
 }
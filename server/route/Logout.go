@@ -8,7 +8,7 @@ import (
 
 func (h WithStore) Logout(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -17,7 +17,7 @@ func (h WithStore) Logout(w http.ResponseWriter, r *http.Request, userId uint64)
 
 	if err := h.s.DeleteSession(tokenString, userId); err != nil {
 		log.Printf("Error deleting session for user %d: %v", userId, err)
-		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		writeError(w, r, "Failed to log out", http.StatusInternalServerError)
 		return
 	}
 
@@ -2,8 +2,11 @@ package route
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+
+	"code.sirenko.ca/transaction/store"
 )
 
 type CategoryPayload struct {
@@ -13,41 +16,55 @@ type CategoryPayload struct {
 
 func (h WithStore) ManageCategory(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload CategoryPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if len(payload.TransactionIDs) == 0 || payload.Category == "" {
-		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		writeError(w, r, "Invalid payload", http.StatusBadRequest)
 		return
 	}
 
-	for _, transactionID := range payload.TransactionIDs {
-		t, err := h.s.GetTransaction(uint64(transactionID))
-		if err != nil {
-			log.Printf("Failed to look up transaction %d: %v", transactionID, err)
-			http.Error(w, "Failed to update category", http.StatusInternalServerError)
-			return
+	ids := make([]uint64, len(payload.TransactionIDs))
+	for i, id := range payload.TransactionIDs {
+		ids[i] = uint64(id)
+	}
+	undo, ok := h.snapshot(w, r, false, ids...)
+	if !ok {
+		return
+	}
+	// Only owned rows change; keep undo to those. The SQL version did
+	// "AND user_id = $3", which silently skipped the others; we honor
+	// the same semantics.
+	owned := undo[:0]
+	var ops []store.BatchOp
+	for _, rec := range undo {
+		if rec.Before.UserID == userId {
+			owned = append(owned, rec)
+			ops = append(ops, store.BatchOp{Action: store.BatchSetCategory, TransactionID: rec.TransactionID, Category: payload.Category})
 		}
+	}
+
+	// All rows change in one write transaction, so a failure leaves
+	// none changed.
+	opErrs, err := h.s.ApplyBatch(ops, func(op *store.BatchOp, t *store.Transaction) error {
 		if t.UserID != userId {
-			// Skip transactions the user does not own. The SQL version
-			// did "AND user_id = $3" which silently affected zero rows;
-			// we honor the same semantics.
-			continue
-		}
-		t.Category = payload.Category
-		if err := h.s.UpdateTransaction(t); err != nil {
-			log.Printf("Failed to update category for transaction %d: %v", transactionID, err)
-			http.Error(w, "Failed to update category", http.StatusInternalServerError)
-			return
+			return errBatchForbidden
 		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to update category for user %d: %v %v", userId, err, errors.Join(opErrs...))
+		writeError(w, r, "Failed to update category", http.StatusInternalServerError)
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	h.recordUndo(w, userId, "set category", owned)
+	writeUndo(w, http.StatusOK)
 }
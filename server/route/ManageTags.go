@@ -2,8 +2,11 @@ package route
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+
+	"code.sirenko.ca/transaction/store"
 )
 
 type TagPayload struct {
@@ -14,45 +17,70 @@ type TagPayload struct {
 
 func (h WithStore) ManageTags(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload TagPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if len(payload.TransactionIDs) == 0 || payload.Tag == "" || (payload.Action != "add" && payload.Action != "remove") {
-		http.Error(w, "Invalid payload", http.StatusBadRequest)
-		return
-	}
-
-	tag, err := h.s.GetOrCreateTag(payload.Tag)
-	if err != nil {
-		log.Printf("Failed to get or create tag %s: %v", payload.Tag, err)
-		http.Error(w, "Failed to get or create tag", http.StatusInternalServerError)
+		writeError(w, r, "Invalid payload", http.StatusBadRequest)
 		return
 	}
 
-	if payload.Action == "add" {
-		for _, transactionID := range payload.TransactionIDs {
-			if err := h.s.AddTagToTransaction(uint64(transactionID), tag.ID); err != nil {
-				log.Printf("Failed to add tag to transaction %d: %v", transactionID, err)
-				http.Error(w, "Failed to add tag to transaction", http.StatusInternalServerError)
+	ids := make([]uint64, len(payload.TransactionIDs))
+	for i, id := range payload.TransactionIDs {
+		ids[i] = uint64(id)
+		t, err := h.s.GetTransaction(ids[i])
+		if err != nil {
+			if err == store.ErrNotFound {
+				writeError(w, r, "Transaction not found", http.StatusNotFound)
 				return
 			}
+			log.Printf("Failed to look up transaction %d: %v", id, err)
+			writeError(w, r, "Failed to check transaction permissions", http.StatusInternalServerError)
+			return
 		}
-	} else if payload.Action == "remove" {
-		for _, transactionID := range payload.TransactionIDs {
-			if err := h.s.RemoveTagFromTransaction(uint64(transactionID), tag.ID); err != nil {
-				log.Printf("Failed to remove tag from transaction %d: %v", transactionID, err)
-				http.Error(w, "Failed to remove tag from transaction", http.StatusInternalServerError)
-				return
-			}
+		if t.UserID != userId {
+			writeError(w, r, "You do not have permission to tag this transaction", http.StatusForbidden)
+			return
 		}
 	}
+	undo, ok := h.snapshot(w, r, false, ids...)
+	if !ok {
+		return
+	}
+	for i := range undo {
+		undo[i].Fields = false
+		undoTag(&undo[i], payload.Tag)
+	}
+
+	action := store.BatchAddTag
+	if payload.Action == "remove" {
+		action = store.BatchRemoveTag
+	}
+	ops := make([]store.BatchOp, len(ids))
+	for i, id := range ids {
+		ops[i] = store.BatchOp{Action: action, TransactionID: id, Tag: payload.Tag}
+	}
+	// All links change in one write transaction, so a failure leaves
+	// none changed.
+	opErrs, err := h.s.ApplyBatch(ops, func(op *store.BatchOp, t *store.Transaction) error {
+		if t.UserID != userId {
+			return errBatchForbidden
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to %s tag %s: %v %v", payload.Action, payload.Tag, err, errors.Join(opErrs...))
+		writeError(w, r, "Failed to "+payload.Action+" tag", http.StatusInternalServerError)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
+	h.recordUndo(w, userId, payload.Action+" tag "+payload.Tag, undo)
+	writeUndo(w, http.StatusOK)
 }
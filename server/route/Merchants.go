@@ -0,0 +1,364 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+const (
+	maxMerchantName = 128
+	maxAliases      = 64
+)
+
+// Merchant is an entry of the caller's merchant catalog: Name is the
+// canonical name for raw merchant strings starting with any of Aliases
+// (see store.Merchant).
+type Merchant struct {
+	ID      uint64   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// MerchantSummary is a merchant of the caller's transactions with its
+// totals. ID is zero for names not in the catalog. Spend is the sum of
+// the spend amounts (see store.Transaction.SpendAmount) in the base
+// currency; Unconverted counts transactions left out of it for lack of
+// an exchange rate.
+type MerchantSummary struct {
+	Merchant
+	Transactions int     `json:"transactions"`
+	Spend        float64 `json:"spend"`
+	Unconverted  int     `json:"unconverted"`
+	LastUsed     string  `json:"lastUsed,omitempty"`
+}
+
+// MerchantFields creates a merchant (Name required) or, on PATCH,
+// changes the fields that are set. Aliases replaces the whole list.
+type MerchantFields struct {
+	Name    *string   `json:"name"`
+	Aliases *[]string `json:"aliases"`
+}
+
+type MergeMerchantPayload struct {
+	// Into is the ID of the merchant that absorbs this one.
+	Into uint64 `json:"into"`
+}
+
+// MerchantChange answers a create, update or merge. Renamed counts the
+// transactions whose merchant was rewritten.
+type MerchantChange struct {
+	Merchant Merchant `json:"merchant"`
+	Renamed  int      `json:"renamed"`
+}
+
+func (p MerchantFields) validate(create bool) map[string]string {
+	fields := map[string]string{}
+	if p.Name == nil && create {
+		fields["name"] = "is required"
+	}
+	if p.Name != nil {
+		switch name := strings.TrimSpace(*p.Name); {
+		case name == "":
+			fields["name"] = "must not be empty"
+		case len(name) > maxMerchantName:
+			fields["name"] = "is too long"
+		}
+	}
+	if p.Aliases != nil {
+		if len(*p.Aliases) > maxAliases {
+			fields["aliases"] = "has too many entries"
+		}
+		for _, a := range *p.Aliases {
+			if a = strings.TrimSpace(a); a == "" || len(a) > maxMerchantName {
+				fields["aliases"] = "must be non-empty and at most 128 characters each"
+			}
+		}
+	}
+	return fields
+}
+
+func (p MerchantFields) apply(m *store.Merchant) {
+	if p.Name != nil {
+		m.Name = strings.TrimSpace(*p.Name)
+	}
+	if p.Aliases != nil {
+		m.Aliases = m.Aliases[:0]
+		for _, a := range *p.Aliases {
+			m.Aliases = append(m.Aliases, strings.TrimSpace(a))
+		}
+	}
+}
+
+func toMerchant(m *store.Merchant) Merchant {
+	aliases := m.Aliases
+	if aliases == nil {
+		aliases = []string{}
+	}
+	return Merchant{ID: m.ID, Name: m.Name, Aliases: aliases}
+}
+
+// GetMerchants lists every merchant of the caller's transactions and
+// catalog with its totals, biggest spend first.
+func (h WithStore) GetMerchants(w http.ResponseWriter, r *http.Request, userId uint64) {
+	catalog, err := h.s.ListMerchants(userId)
+	if err != nil {
+		log.Printf("Error listing merchants of user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	byName := map[string]*MerchantSummary{}
+	var out []*MerchantSummary
+	summary := func(name string) *MerchantSummary {
+		key := strings.ToLower(name)
+		if s, ok := byName[key]; ok {
+			return s
+		}
+		s := &MerchantSummary{Merchant: Merchant{Name: name, Aliases: []string{}}}
+		byName[key] = s
+		out = append(out, s)
+		return s
+	}
+	for i := range catalog {
+		summary(catalog[i].Name).Merchant = toMerchant(&catalog[i])
+	}
+
+	base := h.baseCurrency(userId)
+	lastUsed := map[*MerchantSummary]time.Time{}
+	err = h.s.WalkTransactionsForUser(userId, time.Time{}, time.Time{}, exportBatch, func(t *store.Transaction) error {
+		if t.Merchant == "" {
+			return nil
+		}
+		s := summary(t.Merchant)
+		s.Transactions++
+		if t.OccurredAt.After(lastUsed[s]) {
+			lastUsed[s] = t.OccurredAt
+		}
+		spend, _, err := h.s.ConvertAmount(t.SpendAmount(), t.Currency, base, t.OccurredAt)
+		if errors.Is(err, store.ErrNoExchangeRate) {
+			s.Unconverted++
+			return nil
+		}
+		s.Spend += spend
+		return err
+	})
+	if err != nil {
+		log.Printf("Error summing merchants of user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	for s, at := range lastUsed {
+		s.LastUsed = at.Format(time.RFC3339)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Spend != out[j].Spend {
+			return out[i].Spend > out[j].Spend
+		}
+		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+	})
+	resp := make([]MerchantSummary, len(out))
+	for i, s := range out {
+		s.Spend = src.RoundCents(s.Spend)
+		resp[i] = *s
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// CreateMerchant adds a merchant to the caller's catalog and
+// normalizes the transactions its aliases match.
+func (h WithStore) CreateMerchant(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload MerchantFields
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if fields := payload.validate(true); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	m := &store.Merchant{OwnerID: userId}
+	payload.apply(m)
+	n, err := h.s.CreateMerchant(m)
+	if err != nil {
+		if errors.Is(err, store.ErrMerchantExists) {
+			writeError(w, r, "A merchant with this name already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating merchant: %v", err)
+		writeError(w, r, "Failed to create merchant", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, MerchantChange{Merchant: toMerchant(m), Renamed: n})
+}
+
+// loadOwnMerchant resolves the {id} path value to one of the caller's
+// merchants. On failure it has already written the response and
+// returns nil.
+func (h WithStore) loadOwnMerchant(w http.ResponseWriter, r *http.Request, userId uint64) *store.Merchant {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil
+	}
+	m, err := h.s.GetMerchant(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error querying merchant %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return nil
+	}
+	if err != nil || m.OwnerID != userId {
+		writeError(w, r, "Merchant not found", http.StatusNotFound)
+		return nil
+	}
+	return m
+}
+
+// PatchMerchant changes the given fields. A new name is applied to the
+// transactions under the old one and new aliases to those they match,
+// in the same request.
+func (h WithStore) PatchMerchant(w http.ResponseWriter, r *http.Request, userId uint64) {
+	m := h.loadOwnMerchant(w, r, userId)
+	if m == nil {
+		return
+	}
+	var payload MerchantFields
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if fields := payload.validate(false); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	payload.apply(m)
+	n, err := h.s.UpdateMerchant(m)
+	if err != nil {
+		if errors.Is(err, store.ErrMerchantExists) {
+			writeError(w, r, "A merchant with this name already exists; merge into it instead", http.StatusConflict)
+			return
+		}
+		log.Printf("Error updating merchant %d: %v", m.ID, err)
+		writeError(w, r, "Failed to update merchant", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, MerchantChange{Merchant: toMerchant(m), Renamed: n})
+}
+
+// MergeMerchant folds merchant {id} into merchant into: its name and
+// aliases become aliases of into, its transactions take into's name and
+// {id} is deleted.
+func (h WithStore) MergeMerchant(w http.ResponseWriter, r *http.Request, userId uint64) {
+	from := h.loadOwnMerchant(w, r, userId)
+	if from == nil {
+		return
+	}
+	var payload MergeMerchantPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload.Into == 0 || payload.Into == from.ID {
+		writeValidationError(w, r, map[string]string{"into": "must be another merchant's ID"})
+		return
+	}
+	n, into, err := h.s.MergeMerchant(from.ID, payload.Into)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeValidationError(w, r, map[string]string{"into": "must be one of your merchants"})
+			return
+		}
+		log.Printf("Error merging merchant %d into %d: %v", from.ID, payload.Into, err)
+		writeError(w, r, "Failed to merge merchant", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, MerchantChange{Merchant: toMerchant(into), Renamed: n})
+}
+
+// DeleteMerchant drops a merchant from the catalog. Its transactions
+// keep the name.
+func (h WithStore) DeleteMerchant(w http.ResponseWriter, r *http.Request, userId uint64) {
+	m := h.loadOwnMerchant(w, r, userId)
+	if m == nil {
+		return
+	}
+	if err := h.s.DeleteMerchant(m.ID); err != nil {
+		log.Printf("Error deleting merchant %d: %v", m.ID, err)
+		writeError(w, r, "Failed to delete merchant", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxSuggestions caps the ?limit= of SuggestMerchants.
+const maxSuggestions = 50
+
+// MerchantSuggestion is a merchant to complete a quick-add with and
+// what its latest transaction was filed as.
+type MerchantSuggestion struct {
+	Merchant string   `json:"merchant"`
+	Uses     int      `json:"uses"`
+	LastUsed string   `json:"lastUsed"`
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags"`
+	Amount   float64  `json:"amount"`
+	Currency string   `json:"currency,omitempty"`
+	Kind     string   `json:"kind"`
+}
+
+// SuggestMerchants completes ?q= from the merchants of the caller's and
+// connected users' transactions, most used and most recent first, at
+// most ?limit= (default 10) of them. An empty q lists the top
+// merchants.
+func (h WithStore) SuggestMerchants(w http.ResponseWriter, r *http.Request, userId uint64) {
+	limit := 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSuggestions {
+			writeValidationError(w, r, map[string]string{"limit": "must be a whole number from 1 to " + strconv.Itoa(maxSuggestions)})
+			return
+		}
+		limit = n
+	}
+	userIDs, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	uses, err := h.s.SuggestMerchants(userIDs, strings.TrimLeft(r.URL.Query().Get("q"), " "), time.Now(), limit)
+	if err != nil {
+		log.Printf("Error suggesting merchants for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	out := make([]MerchantSuggestion, 0, len(uses))
+	for _, u := range uses {
+		tags, err := h.s.ListTagsForTransaction(u.Last.ID)
+		if err != nil {
+			log.Printf("Error listing tags of transaction %d: %v", u.Last.ID, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		if tags == nil {
+			tags = []string{}
+		}
+		out = append(out, MerchantSuggestion{
+			Merchant: u.Merchant,
+			Uses:     u.Uses,
+			LastUsed: u.Last.OccurredAt.Format(time.RFC3339),
+			Category: u.Last.Category,
+			Tags:     tags,
+			Amount:   u.Last.Amount,
+			Currency: u.Last.Currency,
+			Kind:     u.Last.KindOrDefault(),
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
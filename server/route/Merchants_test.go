@@ -0,0 +1,122 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestMerchantCatalog(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	rec := do(mux, "POST", "/api/v1/transactions", token, `[
+		{"amount":20,"currency":"CAD","occurredAt":"2024-03-01T10:00:00Z","merchant":"AMZN Mktp CA*1A2B"},
+		{"amount":5,"currency":"CAD","occurredAt":"2024-03-02T10:00:00Z","merchant":"Cafe"}]`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(mux, "POST", "/api/v1/merchants", token, `{"aliases":[""]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid = %d", rec.Code)
+	}
+	rec = do(mux, "POST", "/api/v1/merchants", token, `{"name":"Amazon","aliases":["amzn mktp"]}`)
+	var created MerchantChange
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil || rec.Code != http.StatusCreated || created.Renamed != 1 {
+		t.Fatalf("create merchant = %d %+v %v", rec.Code, created, err)
+	}
+	if rec := do(mux, "POST", "/api/v1/merchants", token, `{"name":"amazon"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate name = %d", rec.Code)
+	}
+
+	// Rules see the canonical name of new inserts.
+	if rec := do(mux, "PUT", "/api/v1/rules", token, `[{"name":"amazon","when":{"merchantContains":"amazon"},"then":{"setCategory":"shopping"}}]`); rec.Code != http.StatusOK {
+		t.Fatalf("rules = %d %s", rec.Code, rec.Body)
+	}
+	rec = do(mux, "POST", "/api/v1/transactions", token, `[{"amount":10,"currency":"CAD","occurredAt":"2024-03-03T10:00:00Z","merchant":"AMZN MKTP CA*9Z"}]`)
+	var inserted []Transaction
+	if err := json.NewDecoder(rec.Body).Decode(&inserted); err != nil || len(inserted) != 1 {
+		t.Fatalf("insert %d: %v", rec.Code, err)
+	}
+	if got := inserted[0]; got.Merchant != "Amazon" || got.RawMerchant != "AMZN MKTP CA*9Z" || got.Category != "shopping" {
+		t.Errorf("inserted = %+v", got)
+	}
+
+	rec = do(mux, "GET", "/api/v1/merchants", token, "")
+	var list []MerchantSummary
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list = %d %v", rec.Code, err)
+	}
+	if len(list) != 2 || list[0].ID != created.Merchant.ID || list[0].Transactions != 2 || list[0].Spend != 30 || list[0].LastUsed == "" ||
+		list[1].ID != 0 || list[1].Name != "Cafe" || list[1].Spend != 5 {
+		t.Fatalf("list = %+v", list)
+	}
+
+	rec = do(mux, "POST", "/api/v1/merchants", token, `{"name":"Amazon Marketplace"}`)
+	var other MerchantChange
+	if err := json.NewDecoder(rec.Body).Decode(&other); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("create second = %d %v", rec.Code, err)
+	}
+	path := fmt.Sprintf("/api/v1/merchants/%d", created.Merchant.ID)
+	rec = do(mux, "POST", path+"/merge", token, fmt.Sprintf(`{"into":%d}`, other.Merchant.ID))
+	var merged MerchantChange
+	if err := json.NewDecoder(rec.Body).Decode(&merged); err != nil || rec.Code != http.StatusOK || merged.Renamed != 2 || len(merged.Merchant.Aliases) != 2 {
+		t.Fatalf("merge = %d %+v %v", rec.Code, merged, err)
+	}
+	if got, _ := s.GetTransaction(inserted[0].ID); got.Merchant != "Amazon Marketplace" {
+		t.Errorf("after merge = %q", got.Merchant)
+	}
+	if rec := do(mux, "DELETE", path, token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete merged = %d", rec.Code)
+	}
+}
+
+func TestSuggestMerchants(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	rec := do(mux, "POST", "/api/v1/transactions", token, `[
+		{"amount":4.5,"currency":"CAD","occurredAt":"2024-03-01T10:00:00Z","merchant":"Blue Bottle","category":"coffee","tags":["work"]},
+		{"amount":5.25,"currency":"CAD","occurredAt":"2024-03-02T10:00:00Z","merchant":"Blue Bottle","category":"coffee","tags":["weekend"]},
+		{"amount":60,"currency":"CAD","occurredAt":"2024-03-03T10:00:00Z","merchant":"Bloom Florist","category":"gifts"},
+		{"amount":9,"currency":"CAD","occurredAt":"2024-03-03T10:00:00Z","merchant":"Cafe"}]`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = do(mux, "GET", "/api/v1/merchants/suggest?q=bl", token, "")
+	var got []MerchantSuggestion
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("suggest = %d %v", rec.Code, err)
+	}
+	if len(got) != 2 || got[0].Merchant != "Blue Bottle" || got[0].Uses != 2 || got[0].Amount != 5.25 || got[0].Category != "coffee" ||
+		len(got[0].Tags) != 1 || got[0].Tags[0] != "weekend" || got[1].Merchant != "Bloom Florist" {
+		t.Fatalf("suggestions = %+v", got)
+	}
+	if rec := do(mux, "GET", "/api/v1/merchants/suggest?limit=0", token, ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("limit=0 = %d", rec.Code)
+	}
+
+	// Connected users' merchants are suggested; others' are not.
+	bob := &store.User{Username: "bob", PersonName: "Bob"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateTransaction(&store.Transaction{UserID: bob.ID, Amount: 30, Currency: "CAD", Merchant: "Blockbuster", OccurredAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(mux, "GET", "/api/v1/merchants/suggest?q=block", token, ""); rec.Body.String() != "[]\n" {
+		t.Errorf("unconnected = %s", rec.Body)
+	}
+	if err := s.AddConnection(alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(mux, "GET", "/api/v1/merchants/suggest?q=block", token, ""); !strings.Contains(rec.Body.String(), "Blockbuster") {
+		t.Errorf("connected = %s", rec.Body)
+	}
+	if rec := do(mux, "GET", "/api/merchants/suggest?q=block", token, ""); !strings.Contains(rec.Body.String(), "Blockbuster") || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("legacy = %s %v", rec.Body, rec.Header())
+	}
+}
@@ -23,6 +23,10 @@ var allowedExtensions = map[string]bool{
 	".png":  true,
 }
 
+type PhotoResponse struct {
+	PhotoURL string `json:"photoUrl"`
+}
+
 type DeletePhotoPayload struct {
 	FilePath string `json:"filePath"`
 }
@@ -30,73 +34,73 @@ type DeletePhotoPayload struct {
 func (h WithStore) AttachPhoto(w http.ResponseWriter, r *http.Request, userId uint64) {
 	transactionIdStr := r.PathValue("id")
 	if transactionIdStr == "" {
-		http.Error(w, "Transaction ID is required", http.StatusBadRequest)
+		writeError(w, r, "Transaction ID is required", http.StatusBadRequest)
 		return
 	}
 	transactionId, err := strconv.ParseUint(transactionIdStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid Transaction ID", http.StatusBadRequest)
+		writeError(w, r, "Invalid Transaction ID", http.StatusBadRequest)
 		return
 	}
 
 	t, err := h.s.GetTransaction(transactionId)
 	if err != nil {
 		if err == store.ErrNotFound {
-			http.Error(w, "Transaction not found", http.StatusNotFound)
+			writeError(w, r, "Transaction not found", http.StatusNotFound)
 			return
 		}
 		log.Printf("Error checking transaction ownership: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	if t.UserID != userId {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		writeError(w, r, "Forbidden", http.StatusForbidden)
 		return
 	}
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		writeError(w, r, "Unable to parse form", http.StatusBadRequest)
 		return
 	}
 
 	file, handler, err := r.FormFile("photo")
 	if err != nil {
-		http.Error(w, "Error retrieving the file", http.StatusBadRequest)
+		writeError(w, r, "Error retrieving the file", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
 	ext := strings.ToLower(filepath.Ext(handler.Filename))
 	if !allowedExtensions[ext] {
-		http.Error(w, fmt.Sprintf("File extension %s is not allowed", ext), http.StatusBadRequest)
+		writeError(w, r, fmt.Sprintf("File extension %s is not allowed", ext), http.StatusBadRequest)
 		return
 	}
 
 	encryptedUserId, err := src.Encrypt(strconv.FormatUint(userId, 10))
 	if err != nil {
 		log.Printf("Error encrypting user ID: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	encryptedTransactionId, err := src.Encrypt(transactionIdStr)
 	if err != nil {
 		log.Printf("Error encrypting transaction ID: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	randomBytes := make([]byte, 16)
 	if _, err := rand.Read(randomBytes); err != nil {
 		log.Printf("Error generating random bytes: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	randomString := hex.EncodeToString(randomBytes)
 
 	dirPath := filepath.Join("uploads", encryptedUserId, encryptedTransactionId)
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		http.Error(w, "Unable to create directory", http.StatusInternalServerError)
+		writeError(w, r, "Unable to create directory", http.StatusInternalServerError)
 		return
 	}
 
@@ -109,7 +113,7 @@ func (h WithStore) AttachPhoto(w http.ResponseWriter, r *http.Request, userId ui
 	}
 	if err := h.s.CreatePhoto(photo); err != nil {
 		log.Printf("Failed to create photo record: %v", err)
-		http.Error(w, "Failed to create photo record", http.StatusInternalServerError)
+		writeError(w, r, "Failed to create photo record", http.StatusInternalServerError)
 		return
 	}
 
@@ -117,7 +121,7 @@ func (h WithStore) AttachPhoto(w http.ResponseWriter, r *http.Request, userId ui
 	if err != nil {
 		// Roll back the photo record since the file write failed.
 		_ = h.s.DeletePhotoByPath(filePath)
-		http.Error(w, "Unable to create the file for writing", http.StatusInternalServerError)
+		writeError(w, r, "Unable to create the file for writing", http.StatusInternalServerError)
 		return
 	}
 	defer dst.Close()
@@ -125,48 +129,48 @@ func (h WithStore) AttachPhoto(w http.ResponseWriter, r *http.Request, userId ui
 	if _, err := io.Copy(dst, file); err != nil {
 		_ = h.s.DeletePhotoByPath(filePath)
 		_ = os.Remove(filePath)
-		http.Error(w, "Unable to save the file", http.StatusInternalServerError)
+		writeError(w, r, "Unable to save the file", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"photoUrl": fmt.Sprintf("/uploads/transaction/%s/%s/%s", encryptedUserId, encryptedTransactionId, fileName),
+	json.NewEncoder(w).Encode(PhotoResponse{
+		PhotoURL: fmt.Sprintf("/uploads/transaction/%s/%s/%s", encryptedUserId, encryptedTransactionId, fileName),
 	})
 }
 
 func (h WithStore) DeletePhotoByPath(w http.ResponseWriter, r *http.Request, userId uint64) {
 	var payload DeletePhotoPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	photo, err := h.s.GetPhotoByPath(payload.FilePath)
 	if err != nil {
 		if err == store.ErrNotFound {
-			http.Error(w, "Photo not found", http.StatusNotFound)
+			writeError(w, r, "Photo not found", http.StatusNotFound)
 			return
 		}
 		log.Printf("Error finding photo: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	t, err := h.s.GetTransaction(photo.TransactionID)
 	if err != nil {
 		log.Printf("Error checking transaction ownership: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	if t.UserID != userId {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		writeError(w, r, "Forbidden", http.StatusForbidden)
 		return
 	}
 
 	if err := h.s.DeletePhotoByPath(payload.FilePath); err != nil {
 		log.Printf("Error deleting photo record: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -184,23 +188,23 @@ func (h WithStore) GetPhotoByPath(w http.ResponseWriter, r *http.Request, userId
 
 	decryptedUserIdStr, err := src.Decrypt(encryptedUserId)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, r, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 	decryptedUserId, err := strconv.ParseUint(decryptedUserIdStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		writeError(w, r, "Invalid user ID format", http.StatusBadRequest)
 		return
 	}
 
 	decryptedTransactionIdStr, err := src.Decrypt(encryptedTransactionId)
 	if err != nil {
-		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		writeError(w, r, "Invalid transaction ID", http.StatusBadRequest)
 		return
 	}
 	decryptedTransactionId, err := strconv.ParseUint(decryptedTransactionIdStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid transaction ID format", http.StatusBadRequest)
+		writeError(w, r, "Invalid transaction ID format", http.StatusBadRequest)
 		return
 	}
 
@@ -208,15 +212,15 @@ func (h WithStore) GetPhotoByPath(w http.ResponseWriter, r *http.Request, userId
 	owner, err := h.s.GetTransaction(decryptedTransactionId)
 	if err != nil {
 		if err == store.ErrNotFound {
-			http.Error(w, "Transaction not found or does not belong to user", http.StatusNotFound)
+			writeError(w, r, "Transaction not found or does not belong to user", http.StatusNotFound)
 			return
 		}
 		log.Printf("Error verifying transaction ownership: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 	if owner.UserID != decryptedUserId {
-		http.Error(w, "Transaction not found or does not belong to user", http.StatusNotFound)
+		writeError(w, r, "Transaction not found or does not belong to user", http.StatusNotFound)
 		return
 	}
 
@@ -230,7 +234,7 @@ func (h WithStore) GetPhotoByPath(w http.ResponseWriter, r *http.Request, userId
 		subscribers, err := h.s.ListSubscribers(owner.UserID)
 		if err != nil {
 			log.Printf("Error checking access: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeError(w, r, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 		for _, sid := range subscribers {
@@ -242,7 +246,7 @@ func (h WithStore) GetPhotoByPath(w http.ResponseWriter, r *http.Request, userId
 	}
 
 	if !hasAccess {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		writeError(w, r, "Forbidden", http.StatusForbidden)
 		return
 	}
 
@@ -0,0 +1,207 @@
+package route
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/reports"
+	"code.sirenko.ca/transaction/store"
+)
+
+const (
+	measureSpend  = "spend"
+	measureIncome = "income"
+)
+
+// Report is a grouped, bucketed summary in the caller's base currency.
+// Unconverted counts rows left out for lack of an exchange rate.
+type Report struct {
+	BaseCurrency string         `json:"baseCurrency"`
+	Measure      string         `json:"measure"`
+	GroupBy      string         `json:"groupBy"`
+	Interval     string         `json:"interval,omitempty"`
+	Unconverted  int            `json:"unconverted"`
+	Periods      []ReportPeriod `json:"periods"`
+}
+
+// ReportPeriod covers From..To, both inclusive (YYYY-MM-DD). Delta and
+// each group's delta compare with the previous period.
+type ReportPeriod struct {
+	From   string          `json:"from"`
+	To     string          `json:"to"`
+	Total  reports.Stats   `json:"total"`
+	Delta  *reports.Delta  `json:"delta,omitempty"`
+	Groups []reports.Group `json:"groups"`
+}
+
+var reportParams = append([]string{"groupBy", "interval", "measure"}, transactionFilterParams...)
+
+// GetReport aggregates the household's transactions. groupBy is
+// category (default), subgroup, tag, person, merchant, card or mcc;
+// interval is day, week, month, year or empty for one period. measure=spend
+// (default) sums SpendAmount, so refunds offset expenses and income and
+// transfers are left out; measure=income sums income. The usual
+// transaction filters narrow the rows.
+func (h WithStore) GetReport(w http.ResponseWriter, r *http.Request, userId uint64) {
+	q := r.URL.Query()
+	groupBy := q.Get("groupBy")
+	if groupBy == "" {
+		groupBy = reports.GroupCategory
+	}
+	interval := q.Get("interval")
+	measure := q.Get("measure")
+	if measure == "" {
+		measure = measureSpend
+	}
+	fields := map[string]string{}
+	if !reports.ValidGroup(groupBy) {
+		fields["groupBy"] = "must be category, subgroup, tag, person, merchant, card or mcc"
+	}
+	if !reports.ValidInterval(interval) {
+		fields["interval"] = "must be day, week, month or year"
+	}
+	if measure != measureSpend && measure != measureIncome {
+		fields["measure"] = "must be spend or income"
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	f, err := parseTransactionFilter(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.s.GetUserByID(userId)
+	if err != nil {
+		log.Printf("Error looking up user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	base := u.BaseCurrencyOrDefault()
+	owners, err := h.visibleUserIDs(userId)
+	if err != nil {
+		log.Printf("Error listing connections: %v", err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+
+	resp := Report{BaseCurrency: base, Measure: measure, GroupBy: groupBy, Interval: interval, Periods: []ReportPeriod{}}
+	var entries []reports.Entry
+	for _, owner := range owners {
+		keyOf, err := h.reportKeys(owner, groupBy)
+		if err != nil {
+			log.Printf("Error preparing report for user %d: %v", owner, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		err = h.s.WalkTransactionsForUser(owner, f.From, f.To, 0, func(t *store.Transaction) error {
+			if !f.match(t) {
+				return nil
+			}
+			var amount float64
+			switch kind := t.KindOrDefault(); {
+			case measure == measureIncome && kind == store.KindIncome:
+				amount = math.Abs(t.Amount)
+			case measure == measureSpend && kind != store.KindIncome && kind != store.KindTransfer:
+				amount = t.SpendAmount()
+			default:
+				return nil
+			}
+			converted, _, err := h.s.ConvertAmount(amount, strings.ToUpper(t.Currency), base, t.OccurredAt)
+			if errors.Is(err, store.ErrNoExchangeRate) {
+				resp.Unconverted++
+				return nil
+			} else if err != nil {
+				return err
+			}
+			keys, err := keyOf(t)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, reports.Entry{Time: t.OccurredAt, Amount: converted, Keys: keys})
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error reading transactions of user %d: %v", owner, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rep, err := reports.Build(entries, reports.Options{GroupBy: groupBy, Interval: interval, From: f.From, To: f.To})
+	if errors.Is(err, reports.ErrTooManyPeriods) {
+		writeValidationError(w, r, map[string]string{"interval": "from..to covers more than " + strconv.Itoa(reports.MaxPeriods) + " periods"})
+		return
+	}
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, p := range rep.Periods {
+		resp.Periods = append(resp.Periods, ReportPeriod{
+			From:   p.Start.Format("2006-01-02"),
+			To:     p.End.Add(-time.Nanosecond).Format("2006-01-02"),
+			Total:  p.Total,
+			Delta:  p.Delta,
+			Groups: p.Groups,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// reportKeys returns the function giving an owner's transaction its
+// keys for groupBy. A subgroup is the parent of the category in the
+// owner's catalog, or the category itself when it has none.
+func (h WithStore) reportKeys(owner uint64, groupBy string) (func(*store.Transaction) ([]string, error), error) {
+	one := func(k string) ([]string, error) {
+		if k == "" {
+			return nil, nil
+		}
+		return []string{k}, nil
+	}
+	switch groupBy {
+	case reports.GroupSubgroup:
+		cats, err := h.s.ListCategories(owner)
+		if err != nil {
+			return nil, err
+		}
+		parents := map[string]string{}
+		for _, c := range cats {
+			if c.Parent != "" {
+				parents[strings.ToLower(c.Name)] = c.Parent
+			}
+		}
+		return func(t *store.Transaction) ([]string, error) {
+			if p, ok := parents[strings.ToLower(t.Category)]; ok {
+				return one(p)
+			}
+			return one(t.Category)
+		}, nil
+	case reports.GroupPerson:
+		u, err := h.s.GetUserByID(owner)
+		if err != nil {
+			return nil, err
+		}
+		name := u.PersonName
+		if name == "" {
+			name = u.Username
+		}
+		return func(*store.Transaction) ([]string, error) { return one(name) }, nil
+	case reports.GroupTag:
+		return func(t *store.Transaction) ([]string, error) { return h.s.ListTagsForTransaction(t.ID) }, nil
+	case reports.GroupMerchant:
+		return func(t *store.Transaction) ([]string, error) { return one(t.Merchant) }, nil
+	case reports.GroupCard:
+		return func(t *store.Transaction) ([]string, error) { return one(t.Card) }, nil
+	case reports.GroupMCC:
+		return func(t *store.Transaction) ([]string, error) { return one(t.MCC) }, nil
+	}
+	return func(t *store.Transaction) ([]string, error) { return one(t.Category) }, nil
+}
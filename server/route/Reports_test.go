@@ -0,0 +1,99 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestReport(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	bob := &store.User{Username: "bob", HashPassword: "x", PersonName: "Bob"}
+	carol := &store.User{Username: "carol", HashPassword: "x"}
+	for _, u := range []*store.User{bob, carol} {
+		if err := s.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddConnection(alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	on := func(m time.Month, d int) time.Time { return time.Date(2024, m, d, 12, 0, 0, 0, time.Local) }
+	for _, txn := range []*store.Transaction{
+		{UserID: alice.ID, Amount: 40, Currency: "CAD", OccurredAt: on(1, 5), Merchant: "Market", Category: "groceries"},
+		{UserID: alice.ID, Amount: 10, Currency: "CAD", OccurredAt: on(1, 9), Merchant: "Market", Category: "groceries", Kind: store.KindRefund},
+		{UserID: alice.ID, Amount: 1000, Currency: "CAD", OccurredAt: on(1, 15), Category: "salary", Kind: store.KindIncome},
+		{UserID: alice.ID, Amount: 90, Currency: "CAD", OccurredAt: on(2, 3), Merchant: "Market", Category: "groceries"},
+		{UserID: bob.ID, Amount: 20, Currency: "CAD", OccurredAt: on(2, 4), Merchant: "Cinema", Category: "movies"},
+		{UserID: bob.ID, Amount: 5, Currency: "USD", OccurredAt: on(2, 5), Merchant: "App", Category: "movies"},
+		{UserID: carol.ID, Amount: 500, Currency: "CAD", OccurredAt: on(2, 6), Category: "groceries"},
+	} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cats, _ := s.ListCategories(alice.ID)
+	for i := range cats {
+		if cats[i].Name == "groceries" {
+			cats[i].Parent = "food"
+			if _, err := s.UpdateCategory(&cats[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	get := func(query string) Report {
+		t.Helper()
+		rec := do(mux, "GET", "/api/v1/reports?"+query, token, "")
+		var rep Report
+		if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("%s = %d %v", query, rec.Code, err)
+		}
+		return rep
+	}
+
+	rep := get("interval=month&from=2024-01-01&to=2024-02-29")
+	if len(rep.Periods) != 2 || rep.Unconverted != 1 || rep.BaseCurrency != "CAD" {
+		t.Fatalf("report = %+v", rep)
+	}
+	jan, feb := rep.Periods[0], rep.Periods[1]
+	if jan.From != "2024-01-01" || jan.To != "2024-01-31" || jan.Total.Sum != 30 || jan.Total.Count != 2 {
+		t.Errorf("jan = %+v, want the refund netted and income left out", jan)
+	}
+	if feb.Total.Sum != 110 || feb.Delta == nil || feb.Delta.Sum != 80 {
+		t.Errorf("feb = %+v, want carol's row left out", feb)
+	}
+	if g := feb.Groups[0]; g.Key != "groceries" || g.Sum != 90 || g.Delta == nil || *g.Delta.Percent != 200 {
+		t.Errorf("feb groceries = %+v", g)
+	}
+
+	rep = get("groupBy=person")
+	if p := rep.Periods[0]; len(rep.Periods) != 1 || len(p.Groups) != 2 || p.Groups[0].Key != "Alice" || p.Groups[1].Key != "Bob" {
+		t.Errorf("by person = %+v", rep.Periods)
+	}
+	rep = get("groupBy=subgroup&measure=spend")
+	if g := rep.Periods[0].Groups; g[0].Key != "food" || g[0].Sum != 120 || g[1].Key != "movies" {
+		t.Errorf("by subgroup = %+v", g)
+	}
+	rep = get("measure=income&groupBy=merchant")
+	if p := rep.Periods[0]; p.Total.Sum != 1000 || p.Groups[0].Key != "" {
+		t.Errorf("income = %+v", p)
+	}
+
+	rec := do(mux, "GET", "/api/v1/reports?groupBy=colour&interval=fortnight", token, "")
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["groupBy"] == "" || e.Fields["interval"] == "" {
+		t.Errorf("invalid = %d %+v", rec.Code, e)
+	}
+	rec = do(mux, "GET", "/api/v1/reports?interval=day&from=0002-01-01&to=9999-01-01", token, "")
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["interval"] == "" {
+		t.Errorf("unbounded = %d %+v", rec.Code, e)
+	}
+	rec = do(mux, "GET", "/api/reports?groupBy=merchant", token, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "" {
+		t.Errorf("legacy = %d %v", rec.Code, rec.Header())
+	}
+}
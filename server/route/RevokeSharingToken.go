@@ -12,19 +12,19 @@ type RevokeTokenPayload struct {
 
 func (h WithStore) RevokeSharingToken(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload RevokeTokenPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if err := h.s.RevokeToken(payload.Token, userId); err != nil {
 		log.Printf("Error revoking sharing token for user %d: %v", userId, err)
-		http.Error(w, "Failed to revoke sharing token", http.StatusInternalServerError)
+		writeError(w, r, "Failed to revoke sharing token", http.StatusInternalServerError)
 		return
 	}
 
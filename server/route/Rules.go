@@ -0,0 +1,278 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"code.sirenko.ca/transaction/rules"
+	"code.sirenko.ca/transaction/store"
+)
+
+// ReapplyRulesPayload controls POST /api/v1/rules/reapply. Overwrite
+// lets rules replace categories and details that are already set,
+// instead of only filling in missing ones.
+type ReapplyRulesPayload struct {
+	DryRun    bool `json:"dryRun"`
+	Overwrite bool `json:"overwrite"`
+}
+
+// RuleFields are the parts of a transaction rules can change.
+type RuleFields struct {
+	Category string   `json:"category"`
+	Details  string   `json:"details"`
+	Kind     string   `json:"kind"`
+	Tags     []string `json:"tags"`
+}
+
+// RuleChange is one transaction the rules would change, or did.
+type RuleChange struct {
+	TransactionID uint64     `json:"transactionId"`
+	Merchant      string     `json:"merchant"`
+	OccurredAt    string     `json:"occurredAt"`
+	Rules         []string   `json:"rules"`
+	Before        RuleFields `json:"before"`
+	After         RuleFields `json:"after"`
+}
+
+type ReapplyRulesResponse struct {
+	DryRun bool `json:"dryRun"`
+	// Scanned counts the transactions the rules were run against.
+	Scanned int          `json:"scanned"`
+	Changes []RuleChange `json:"changes"`
+	// UndoToken reverts the changes, see Undo.
+	UndoToken string `json:"undoToken,omitempty"`
+}
+
+const reapplyBatch = 500
+
+// rulesEngine returns the rules inserts and imports for userId run.
+// Settings that do not parse are logged and skipped.
+func (h WithStore) rulesEngine(userId uint64) *rules.Engine {
+	e, err := rules.Load(h.s, userId)
+	if err != nil {
+		log.Printf("Error loading rules: %v", err)
+	}
+	return e
+}
+
+// GetRules returns the caller's rules, [] when unset.
+func (h WithStore) GetRules(w http.ResponseWriter, r *http.Request, userId uint64) {
+	out := []rules.Rule{}
+	raw, err := rules.UserRules(h.s, userId)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error reading rules of user %d: %v", userId, err)
+		writeError(w, r, "Failed to query settings", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, &out); err != nil {
+			log.Printf("Error parsing rules of user %d: %v", userId, err)
+			writeError(w, r, "Stored rules are invalid", http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// PutRules replaces the caller's ordered rule list; other users keep
+// theirs. It does not touch stored transactions; see ReapplyRules.
+func (h WithStore) PutRules(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload []rules.Rule
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload == nil {
+		payload = []rules.Rule{}
+	}
+	if invalid := rules.Validate(payload); len(invalid) > 0 {
+		fields := make(map[string]string, len(invalid))
+		for k, msg := range invalid {
+			fields["rules"+k] = msg
+		}
+		writeValidationError(w, r, fields)
+		return
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	u, err := h.s.GetUserByID(userId)
+	if err != nil {
+		log.Printf("Error loading user %d: %v", userId, err)
+		writeError(w, r, "Failed to update setting", http.StatusInternalServerError)
+		return
+	}
+	u.Rules = raw
+	if err := h.s.UpdateUser(u); err != nil {
+		log.Printf("Error updating rules of user %d: %v", userId, err)
+		writeError(w, r, "Failed to update setting", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// MCCTables are the merchant category code mappings the rules fall
+// back to: the built-in table and the overrides on top of it (see
+// rules.MCCTable).
+type MCCTables struct {
+	Builtin   rules.MCCTable `json:"builtin"`
+	Overrides rules.MCCTable `json:"overrides"`
+}
+
+// mccOverrides returns the mcc_map setting, empty when unset.
+func (h WithStore) mccOverrides() (rules.MCCTable, error) {
+	over := rules.MCCTable{}
+	raw, err := h.s.GetSetting(rules.MCCSetting)
+	if errors.Is(err, store.ErrNotFound) {
+		return over, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &over); err != nil {
+		return nil, err
+	}
+	return over, nil
+}
+
+// GetMCC returns the built-in MCC table and the overrides.
+func (h WithStore) GetMCC(w http.ResponseWriter, r *http.Request, userId uint64) {
+	over, err := h.mccOverrides()
+	if err != nil {
+		log.Printf("Error reading %s setting: %v", rules.MCCSetting, err)
+		writeError(w, r, "Failed to query settings", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, MCCTables{Builtin: rules.DefaultMCC, Overrides: over})
+}
+
+// PutMCC replaces the overrides of the built-in MCC table. A code or
+// range mapped to "" turns the built-in mapping off. Like PutRules it
+// does not touch stored transactions.
+func (h WithStore) PutMCC(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload rules.MCCTable
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if payload == nil {
+		payload = rules.MCCTable{}
+	}
+	if invalid := rules.ValidateMCCTable(payload); len(invalid) > 0 {
+		writeValidationError(w, r, invalid)
+		return
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.s.SetSetting(rules.MCCSetting, raw); err != nil {
+		log.Printf("Error updating %s setting: %v", rules.MCCSetting, err)
+		writeError(w, r, "Failed to update setting", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, MCCTables{Builtin: rules.DefaultMCC, Overrides: payload})
+}
+
+// ReapplyRules runs the rules over the caller's transactions in the
+// ?from= and ?to= range and reports what changes. Unless dryRun is
+// set the changes are written in one batch and can be undone.
+func (h WithStore) ReapplyRules(w http.ResponseWriter, r *http.Request, userId uint64) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var payload ReapplyRulesPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	engine := h.rulesEngine(userId)
+	resp := ReapplyRulesResponse{DryRun: payload.DryRun, Changes: []RuleChange{}}
+	var ops []store.BatchOp
+	err = h.s.WalkTransactionsForUser(userId, from, to, reapplyBatch, func(t *store.Transaction) error {
+		resp.Scanned++
+		tags, err := h.s.ListTagsForTransaction(t.ID)
+		if err != nil {
+			return err
+		}
+		before := RuleFields{Category: t.Category, Details: t.Details, Kind: t.KindOrDefault(), Tags: tags}
+		if before.Tags == nil {
+			before.Tags = []string{}
+		}
+		after := *t
+		afterTags := engine.Apply(&after, slices.Clone(before.Tags), payload.Overwrite)
+		if after.Category == t.Category && after.Details == t.Details && after.Kind == t.Kind && len(afterTags) == len(before.Tags) {
+			return nil
+		}
+		resp.Changes = append(resp.Changes, RuleChange{
+			TransactionID: t.ID,
+			Merchant:      t.Merchant,
+			OccurredAt:    t.OccurredAt.Format(time.RFC3339),
+			Rules:         engine.Eval(t).Rules,
+			Before:        before,
+			After:         RuleFields{Category: after.Category, Details: after.Details, Kind: after.KindOrDefault(), Tags: afterTags},
+		})
+		ops = append(ops, store.BatchOp{
+			Action:        store.BatchUpdate,
+			TransactionID: t.ID,
+			Update: func(t *store.Transaction) {
+				t.Category, t.Details, t.Kind = after.Category, after.Details, after.Kind
+			},
+		})
+		for _, tag := range afterTags[len(before.Tags):] {
+			ops = append(ops, store.BatchOp{Action: store.BatchAddTag, TransactionID: t.ID, Tag: tag})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error running rules over transactions of user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	if payload.DryRun || len(ops) == 0 {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	ids := make([]uint64, len(resp.Changes))
+	for i, c := range resp.Changes {
+		ids[i] = c.TransactionID
+	}
+	undo, ok := h.snapshot(w, r, false, ids...)
+	if !ok {
+		return
+	}
+	byID := make(map[uint64]*store.UndoRecord, len(undo))
+	for i := range undo {
+		byID[undo[i].TransactionID] = &undo[i]
+	}
+	for _, op := range ops {
+		if rec := byID[op.TransactionID]; rec != nil && op.Action == store.BatchAddTag {
+			undoTag(rec, op.Tag)
+		}
+	}
+	opErrs, err := h.s.ApplyBatch(ops, func(op *store.BatchOp, t *store.Transaction) error {
+		if t.UserID != userId {
+			return errBatchForbidden
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error applying rules for user %d: %v %v", userId, err, errors.Join(opErrs...))
+		writeError(w, r, "Failed to apply rules", http.StatusInternalServerError)
+		return
+	}
+	resp.UndoToken = h.recordUndo(w, userId, "reapply rules", undo)
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,145 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestRulesOnInsertAndReapply(t *testing.T) {
+	_, mux, token := newTestMux(t)
+	rec := do(mux, "PUT", "/api/v1/rules", token, `[{"name":"bad","when":{"merchantRegex":"("},"then":{}}]`)
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["rules[0].when.merchantRegex"] == "" || e.Fields["rules[0].then"] == "" {
+		t.Fatalf("invalid rules = %d %+v", rec.Code, e)
+	}
+
+	// Stored before the rule exists: no default rule matches.
+	rec = do(mux, "POST", "/api/v1/transactions", token, `[{"amount":12,"currency":"CAD","occurredAt":"2024-03-02T10:00:00Z","merchant":"Corner Gym"}]`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+
+	rules := `[{"name":"gym","when":{"merchantContains":"gym","weekdays":["sat","sun"]},"then":{"setCategory":"sport","addTags":["weekend"]}}]`
+	if rec := do(mux, "PUT", "/api/v1/rules", token, rules); rec.Code != http.StatusOK {
+		t.Fatalf("put = %d %s", rec.Code, rec.Body)
+	}
+
+	// New inserts run the rules but keep what the payload set.
+	rec = do(mux, "POST", "/api/v1/transactions", token, `[
+		{"amount":12,"currency":"CAD","occurredAt":"2024-03-09T10:00:00Z","merchant":"Corner Gym"},
+		{"amount":12,"currency":"CAD","occurredAt":"2024-03-10T10:00:00Z","merchant":"Corner Gym","category":"health"}]`)
+	var created []Transaction
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil || len(created) != 2 {
+		t.Fatalf("create %d: %v", rec.Code, err)
+	}
+	if created[0].Category != "sport" || len(created[0].Tags) != 1 || created[1].Category != "health" {
+		t.Errorf("created = %+v", created)
+	}
+
+	rec = do(mux, "POST", "/api/v1/rules/reapply?to=2024-03-05", token, `{"dryRun":true}`)
+	var dry ReapplyRulesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&dry); err != nil || dry.Scanned != 1 || len(dry.Changes) != 1 {
+		t.Fatalf("dry run %d %+v %v", rec.Code, dry, err)
+	}
+	c := dry.Changes[0]
+	if c.Before.Category != "" || c.After.Category != "sport" || c.After.Tags[0] != "weekend" || c.Rules[0] != "gym" || dry.UndoToken != "" {
+		t.Errorf("change = %+v", c)
+	}
+
+	rec = do(mux, "POST", "/api/v1/rules/reapply", token, `{"overwrite":true}`)
+	var applied ReapplyRulesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&applied); err != nil || len(applied.Changes) != 2 || applied.UndoToken == "" {
+		t.Fatalf("apply %d %+v %v", rec.Code, applied, err)
+	}
+	rec = do(mux, "POST", "/api/v1/rules/reapply", token, `{"overwrite":true,"dryRun":true}`)
+	var again ReapplyRulesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&again); err != nil || len(again.Changes) != 0 {
+		t.Errorf("second run should change nothing: %+v %v", again, err)
+	}
+}
+
+func TestRulesArePerUser(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	bob := &store.User{Username: "bob", HashPassword: "x"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(&store.Session{Code: "bob", UserID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	rules := `[{"name":"gym","when":{"merchantContains":"gym"},"then":{"setCategory":"sport"}}]`
+	if rec := do(mux, "PUT", "/api/v1/rules", token, rules); rec.Code != http.StatusOK {
+		t.Fatalf("put = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, "GET", "/api/v1/rules", "bob", ""); rec.Body.String() != "[]\n" {
+		t.Errorf("bob's rules = %s", rec.Body)
+	}
+	rec := do(mux, "POST", "/api/v1/transactions", "bob", `[{"amount":12,"currency":"CAD","occurredAt":"2024-03-02T10:00:00Z","merchant":"Corner Gym"}]`)
+	var created []Transaction
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil || len(created) != 1 {
+		t.Fatalf("create %d: %v", rec.Code, err)
+	}
+	if created[0].Category == "sport" {
+		t.Errorf("alice's rule categorized bob's transaction")
+	}
+}
+
+func TestMCCFallback(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	if rec := do(mux, "PUT", "/api/v1/mcc", token, `{"58":"x"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid override = %d", rec.Code)
+	}
+	if rec := do(mux, "PUT", "/api/v1/mcc", token, `{"5813":"bars","5814":""}`); rec.Code != http.StatusOK {
+		t.Fatalf("put mcc = %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, "POST", "/api/v1/transactions", token, `[{"amount":1,"currency":"CAD","occurredAt":"2024-03-01T10:00:00Z","merchant":"x","mcc":"58a2"}]`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid mcc = %d", rec.Code)
+	}
+
+	rec := do(mux, "POST", "/api/v1/transactions", token, `[
+		{"amount":30,"currency":"CAD","occurredAt":"2024-03-01T10:00:00Z","merchant":"Noodle Bar","mcc":"5812"},
+		{"amount":12,"currency":"CAD","occurredAt":"2024-03-01T11:00:00Z","merchant":"The Pub","mcc":"5813"},
+		{"amount":8,"currency":"CAD","occurredAt":"2024-03-01T12:00:00Z","merchant":"Drive Thru","mcc":"5814"},
+		{"amount":5,"currency":"CAD","occurredAt":"2024-03-01T13:00:00Z","merchant":"STARBUCKS","mcc":"5411"}]`)
+	var created []Transaction
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil || len(created) != 4 {
+		t.Fatalf("create %d: %v", rec.Code, err)
+	}
+	for i, want := range []string{"takeouts", "bars", "", "takeouts"} {
+		if created[i].Category != want || created[i].MCC == "" {
+			t.Errorf("%s = %q (mcc %q), want %q", created[i].Merchant, created[i].Category, created[i].MCC, want)
+		}
+	}
+
+	// Renaming a category is the owner's own business: the shared
+	// overrides are left alone.
+	cats, _ := s.ListCategories(alice.ID)
+	for _, c := range cats {
+		if c.Name == "takeouts" {
+			if rec := do(mux, "PATCH", fmt.Sprintf("/api/v1/categories/%d", c.ID), token, `{"name":"eating out"}`); rec.Code != http.StatusOK {
+				t.Fatalf("rename = %d %s", rec.Code, rec.Body)
+			}
+		}
+	}
+	rec = do(mux, "GET", "/api/v1/mcc", token, "")
+	var tables MCCTables
+	if err := json.NewDecoder(rec.Body).Decode(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables.Overrides["5812"] != "" || tables.Overrides["5813"] != "bars" || tables.Builtin["5812"] != "takeouts" {
+		t.Errorf("overrides = %v", tables.Overrides)
+	}
+
+	rec = do(mux, "GET", "/api/v1/reports?groupBy=mcc", token, "")
+	var rep Report
+	if err := json.NewDecoder(rec.Body).Decode(&rep); err != nil || rec.Code != http.StatusOK || len(rep.Periods) != 1 {
+		t.Fatalf("report = %d %+v %v", rec.Code, rep, err)
+	}
+	if g := rep.Periods[0].Groups; len(g) != 4 || g[0].Key != "5812" || g[0].Sum != 30 {
+		t.Errorf("groups = %+v", g)
+	}
+}
@@ -0,0 +1,207 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/forecast"
+	"code.sirenko.ca/transaction/store"
+)
+
+// ScheduledItem is a future bill or income the forecast includes:
+// Amount on Account from Next (YYYY-MM-DD) every Frequency, through
+// Until when set. Amount is positive; Kind is expense or income.
+type ScheduledItem struct {
+	ID        uint64  `json:"id"`
+	Name      string  `json:"name"`
+	Account   string  `json:"account"`
+	Amount    float64 `json:"amount"`
+	Kind      string  `json:"kind"`
+	Frequency string  `json:"frequency"`
+	Next      string  `json:"next"`
+	Until     string  `json:"until,omitempty"`
+}
+
+// ScheduledItemFields creates an item (name, account, amount, frequency
+// and next required) or, on PATCH, changes the fields that are set. An
+// empty until clears it.
+type ScheduledItemFields struct {
+	Name      *string  `json:"name"`
+	Account   *string  `json:"account"`
+	Amount    *float64 `json:"amount"`
+	Kind      *string  `json:"kind"`
+	Frequency *string  `json:"frequency"`
+	Next      *string  `json:"next"`
+	Until     *string  `json:"until"`
+}
+
+// apply validates p and sets its fields on it.
+func (p ScheduledItemFields) apply(it *store.ScheduledItem, create bool) map[string]string {
+	fields := map[string]string{}
+	required := func(name string, set bool) bool {
+		if !set && create {
+			fields[name] = "is required"
+		}
+		return set
+	}
+	if required("name", p.Name != nil) {
+		if it.Name = strings.TrimSpace(*p.Name); it.Name == "" {
+			fields["name"] = "must not be empty"
+		}
+	}
+	if required("account", p.Account != nil) {
+		if it.Account = strings.TrimSpace(*p.Account); it.Account == "" {
+			fields["account"] = "must not be empty"
+		}
+	}
+	if required("amount", p.Amount != nil) {
+		if it.Amount = *p.Amount; it.Amount <= 0 {
+			fields["amount"] = "must be positive"
+		}
+	}
+	if p.Kind != nil {
+		it.Kind = *p.Kind
+	}
+	if it.Kind == "" {
+		it.Kind = store.KindExpense
+	}
+	if it.Kind != store.KindExpense && it.Kind != store.KindIncome {
+		fields["kind"] = "must be expense or income"
+	}
+	if required("frequency", p.Frequency != nil) {
+		if it.Frequency = *p.Frequency; !forecast.ValidFrequency(it.Frequency) {
+			fields["frequency"] = "must be once, weekly, biweekly, monthly, quarterly or yearly"
+		}
+	}
+	if required("next", p.Next != nil) {
+		day, err := parseDay(*p.Next)
+		if err != nil {
+			fields["next"] = "must be YYYY-MM-DD"
+		}
+		it.Next = day
+	}
+	if p.Until != nil {
+		it.Until = nil
+		if *p.Until != "" {
+			day, err := parseDay(*p.Until)
+			if err != nil {
+				fields["until"] = "must be YYYY-MM-DD"
+			}
+			it.Until = &day
+		}
+	}
+	if it.Until != nil && fields["until"] == "" && fields["next"] == "" && it.Until.Before(it.Next) {
+		fields["until"] = "must not be before next"
+	}
+	return fields
+}
+
+func toScheduledItem(it *store.ScheduledItem) ScheduledItem {
+	out := ScheduledItem{
+		ID:        it.ID,
+		Name:      it.Name,
+		Account:   it.Account,
+		Amount:    it.Amount,
+		Kind:      it.Kind,
+		Frequency: it.Frequency,
+		Next:      it.Next.In(time.Local).Format(dayLayout),
+	}
+	if it.Until != nil {
+		out.Until = it.Until.In(time.Local).Format(dayLayout)
+	}
+	return out
+}
+
+// loadOwnScheduledItem fetches item {id}. Items are private: other
+// users' answer 404. On failure the response is written and it returns
+// nil.
+func (h WithStore) loadOwnScheduledItem(w http.ResponseWriter, r *http.Request, userId uint64) *store.ScheduledItem {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return nil
+	}
+	it, err := h.s.GetScheduledItem(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error querying scheduled item %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return nil
+	}
+	if err != nil || it.UserID != userId {
+		writeError(w, r, "Scheduled item not found", http.StatusNotFound)
+		return nil
+	}
+	return it
+}
+
+// ListScheduledItems lists the caller's scheduled items.
+func (h WithStore) ListScheduledItems(w http.ResponseWriter, r *http.Request, userId uint64) {
+	items, err := h.s.ListScheduledItems(userId)
+	if err != nil {
+		log.Printf("Error listing scheduled items for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	out := make([]ScheduledItem, len(items))
+	for i := range items {
+		out[i] = toScheduledItem(&items[i])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (h WithStore) CreateScheduledItem(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload ScheduledItemFields
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	it := &store.ScheduledItem{UserID: userId}
+	if fields := payload.apply(it, true); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	if err := h.s.CreateScheduledItem(it); err != nil {
+		log.Printf("Error creating scheduled item for user %d: %v", userId, err)
+		writeError(w, r, "Failed to create scheduled item", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toScheduledItem(it))
+}
+
+func (h WithStore) PatchScheduledItem(w http.ResponseWriter, r *http.Request, userId uint64) {
+	it := h.loadOwnScheduledItem(w, r, userId)
+	if it == nil {
+		return
+	}
+	var payload ScheduledItemFields
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if fields := payload.apply(it, false); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	if err := h.s.UpdateScheduledItem(it); err != nil {
+		log.Printf("Error updating scheduled item %d: %v", it.ID, err)
+		writeError(w, r, "Failed to update scheduled item", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, toScheduledItem(it))
+}
+
+func (h WithStore) DeleteScheduledItem(w http.ResponseWriter, r *http.Request, userId uint64) {
+	it := h.loadOwnScheduledItem(w, r, userId)
+	if it == nil {
+		return
+	}
+	if err := h.s.DeleteScheduledItem(it.ID); err != nil {
+		log.Printf("Error deleting scheduled item %d: %v", it.ID, err)
+		writeError(w, r, "Failed to delete scheduled item", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
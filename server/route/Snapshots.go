@@ -0,0 +1,405 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/forecast"
+	"code.sirenko.ca/transaction/reports"
+	"code.sirenko.ca/transaction/src"
+	"code.sirenko.ca/transaction/store"
+)
+
+// Snapshot is the balance of an account at the end of On (YYYY-MM-DD).
+// Source is manual, statement or computed.
+type Snapshot struct {
+	ID       uint64  `json:"id,omitempty"`
+	Account  string  `json:"account"`
+	Balance  float64 `json:"balance"`
+	Currency string  `json:"currency"`
+	On       string  `json:"on"`
+	Source   string  `json:"source,omitempty"`
+}
+
+// ComputeSnapshotsPayload picks the day (default today) and accounts
+// (default every account with a balance or snapshot) to compute.
+type ComputeSnapshotsPayload struct {
+	On       string   `json:"on"`
+	Accounts []string `json:"accounts"`
+}
+
+type NetWorthAccount struct {
+	Account  string  `json:"account"`
+	Balance  float64 `json:"balance"`
+	Currency string  `json:"currency"`
+	// Converted is Balance in the base currency; nil without a rate.
+	Converted *float64 `json:"converted"`
+	// On is the day of the snapshot the balance comes from.
+	On string `json:"on"`
+}
+
+// NetWorthPoint is the net worth at the end of Date. Assets sums the
+// positive balances and Liabilities the negative ones, as a positive
+// amount; NetWorth is their difference.
+type NetWorthPoint struct {
+	Date        string            `json:"date"`
+	Assets      float64           `json:"assets"`
+	Liabilities float64           `json:"liabilities"`
+	NetWorth    float64           `json:"netWorth"`
+	Accounts    []NetWorthAccount `json:"accounts"`
+}
+
+type NetWorth struct {
+	BaseCurrency string          `json:"baseCurrency"`
+	Interval     string          `json:"interval"`
+	Points       []NetWorthPoint `json:"points"`
+	// Unconverted counts account balances left out of the sums for
+	// lack of an exchange rate.
+	Unconverted int `json:"unconverted"`
+}
+
+func toSnapshot(sn *store.BalanceSnapshot) Snapshot {
+	return Snapshot{
+		ID:       sn.ID,
+		Account:  sn.Account,
+		Balance:  sn.Balance,
+		Currency: sn.Currency,
+		On:       sn.On.In(time.Local).Format(dayLayout),
+		Source:   sn.Source,
+	}
+}
+
+// dayAfter is the local midnight that ends t's local day.
+func dayAfter(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.Local)
+}
+
+// toStoreSnapshot validates s for userId. Currency defaults to base.
+func toStoreSnapshot(s Snapshot, userId uint64, base, source string) (*store.BalanceSnapshot, map[string]string) {
+	fields := map[string]string{}
+	sn := &store.BalanceSnapshot{
+		UserID:   userId,
+		Account:  strings.TrimSpace(s.Account),
+		Balance:  s.Balance,
+		Currency: strings.ToUpper(strings.TrimSpace(s.Currency)),
+		Source:   source,
+	}
+	if sn.Account == "" {
+		fields["account"] = "is required"
+	}
+	if sn.Currency == "" {
+		sn.Currency = base
+	} else if !currencyCodeRe.MatchString(sn.Currency) {
+		fields["currency"] = "must be a 3-letter ISO 4217 code"
+	}
+	day, err := parseDay(s.On)
+	if err != nil {
+		fields["on"] = "must be YYYY-MM-DD"
+	}
+	sn.On = day
+	return sn, fields
+}
+
+// balanceAnchors returns userId's manual and statement snapshots by
+// lower-cased account, oldest first. Computed snapshots are derived
+// from these and never anchor another computation.
+func (h WithStore) balanceAnchors(userId uint64) (map[string][]store.BalanceSnapshot, error) {
+	all, err := h.s.ListSnapshots(userId, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][]store.BalanceSnapshot{}
+	for _, sn := range all {
+		if sn.Source != store.SnapshotComputed {
+			key := strings.ToLower(sn.Account)
+			out[key] = append(out[key], sn)
+		}
+	}
+	return out, nil
+}
+
+// balanceOn computes the balance of account at the end of day from
+// the anchor nearest to it: the anchor's balance plus the effect (see
+// forecast.Effect) of the caller's transactions on the account after
+// it, or minus those up to it when day is earlier. Without anchors it
+// sums every transaction up to day in fallback currency. It returns
+// the balance, its currency and how many transactions had no rate into
+// it.
+func (h WithStore) balanceOn(userId uint64, account string, anchors []store.BalanceSnapshot, fallback string, day time.Time) (float64, string, int, error) {
+	end := dayAfter(day)
+	bal, currency := 0.0, fallback
+	from, to, sign := time.Time{}, end, 1.0
+	if len(anchors) > 0 {
+		a := anchors[0]
+		for _, c := range anchors[1:] {
+			if math.Abs(dayAfter(c.On).Sub(end).Hours()) < math.Abs(dayAfter(a.On).Sub(end).Hours()) {
+				a = c
+			}
+		}
+		bal, currency = a.Balance, a.Currency
+		if from, to = dayAfter(a.On), end; to.Before(from) {
+			from, to, sign = to, from, -1
+		}
+	}
+	unconverted := 0
+	err := h.s.WalkTransactionsForUser(userId, from, to, 0, func(t *store.Transaction) error {
+		if !strings.EqualFold(t.Card, account) {
+			return nil
+		}
+		amount, _, err := h.s.ConvertAmount(t.Amount, strings.ToUpper(t.Currency), currency, t.OccurredAt)
+		if errors.Is(err, store.ErrNoExchangeRate) {
+			unconverted++
+			return nil
+		} else if err != nil {
+			return err
+		}
+		c := *t
+		c.Amount = amount
+		bal += sign * forecast.Effect(&c)
+		return nil
+	})
+	return src.RoundCents(bal), currency, unconverted, err
+}
+
+// ListSnapshots lists the caller's snapshots, oldest first, optionally
+// for one account and within from/to (YYYY-MM-DD, inclusive).
+func (h WithStore) ListSnapshots(w http.ResponseWriter, r *http.Request, userId uint64) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	account := r.URL.Query().Get("account")
+	all, err := h.s.ListSnapshots(userId, from, to)
+	if err != nil {
+		log.Printf("Error listing snapshots for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	out := []Snapshot{}
+	for i := range all {
+		if account == "" || strings.EqualFold(all[i].Account, account) {
+			out = append(out, toSnapshot(&all[i]))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// CreateSnapshot records a manual snapshot, replacing the account's
+// snapshot of the same day.
+func (h WithStore) CreateSnapshot(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload Snapshot
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	sn, fields := toStoreSnapshot(payload, userId, h.baseCurrency(userId), store.SnapshotManual)
+	if len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return
+	}
+	if err := h.s.PutSnapshots(sn); err != nil {
+		log.Printf("Error storing snapshot for user %d: %v", userId, err)
+		writeError(w, r, "Failed to store snapshot", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toSnapshot(sn))
+}
+
+func (h WithStore) DeleteSnapshot(w http.ResponseWriter, r *http.Request, userId uint64) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	sn, err := h.s.GetSnapshot(id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("Error querying snapshot %d: %v", id, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || sn.UserID != userId {
+		writeError(w, r, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	if err := h.s.DeleteSnapshot(id); err != nil {
+		log.Printf("Error deleting snapshot %d: %v", id, err)
+		writeError(w, r, "Failed to delete snapshot", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ComputeSnapshots records computed snapshots of the caller's accounts
+// at the end of a day, see balanceOn. Accounts with no balance or
+// snapshot at all are summed from their whole history in the base
+// currency.
+func (h WithStore) ComputeSnapshots(w http.ResponseWriter, r *http.Request, userId uint64) {
+	var payload ComputeSnapshotsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	on := forecastToday()
+	if payload.On != "" {
+		day, err := parseDay(payload.On)
+		if err != nil {
+			writeValidationError(w, r, map[string]string{"on": "must be YYYY-MM-DD"})
+			return
+		}
+		on = day
+	}
+	anchors, err := h.balanceAnchors(userId)
+	if err != nil {
+		log.Printf("Error listing snapshots for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	balances, err := h.s.ListAccountBalances(userId)
+	if err != nil {
+		log.Printf("Error listing balances for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	base := h.baseCurrency(userId)
+	fallback := map[string]string{}
+	for _, b := range balances {
+		fallback[strings.ToLower(b.Account)] = b.Currency
+		if len(anchors[strings.ToLower(b.Account)]) == 0 {
+			anchors[strings.ToLower(b.Account)] = []store.BalanceSnapshot{{Account: b.Account, Balance: b.Balance, Currency: b.Currency, On: b.AsOf}}
+		}
+	}
+	accounts := payload.Accounts
+	if len(accounts) == 0 {
+		for _, own := range anchors {
+			accounts = append(accounts, own[len(own)-1].Account)
+		}
+		sort.Strings(accounts)
+	}
+
+	var snaps []*store.BalanceSnapshot
+	for _, account := range accounts {
+		account = strings.TrimSpace(account)
+		if account == "" {
+			continue
+		}
+		cur := base
+		if c, ok := fallback[strings.ToLower(account)]; ok {
+			cur = c
+		}
+		bal, cur, _, err := h.balanceOn(userId, account, anchors[strings.ToLower(account)], cur, on)
+		if err != nil {
+			log.Printf("Error computing balance of %q for user %d: %v", account, userId, err)
+			writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+			return
+		}
+		snaps = append(snaps, &store.BalanceSnapshot{UserID: userId, Account: account, Balance: bal, Currency: cur, On: on, Source: store.SnapshotComputed})
+	}
+	if err := h.s.PutSnapshots(snaps...); err != nil {
+		log.Printf("Error storing snapshots for user %d: %v", userId, err)
+		writeError(w, r, "Failed to store snapshots", http.StatusInternalServerError)
+		return
+	}
+	out := make([]Snapshot, len(snaps))
+	for i, sn := range snaps {
+		out[i] = toSnapshot(sn)
+	}
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// GetNetWorth reports the caller's net worth at the end of each period
+// (interval day, week, month or year; default month) between from and
+// to, which default to the first snapshot and today. Each account
+// counts with its latest snapshot on or before the day, converted into
+// the base currency at that day's rate. Like a report it covers at most
+// reports.MaxPeriods periods.
+func (h WithStore) GetNetWorth(w http.ResponseWriter, r *http.Request, userId uint64) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = reports.IntervalMonth
+	}
+	if interval == reports.IntervalNone || !reports.ValidInterval(interval) {
+		writeValidationError(w, r, map[string]string{"interval": "must be day, week, month or year"})
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		writeError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if to.IsZero() {
+		to = dayAfter(time.Now())
+	}
+	all, err := h.s.ListSnapshots(userId, time.Time{}, to)
+	if err != nil {
+		log.Printf("Error listing snapshots for user %d: %v", userId, err)
+		writeError(w, r, "Failed to query database", http.StatusInternalServerError)
+		return
+	}
+	base := h.baseCurrency(userId)
+	resp := NetWorth{BaseCurrency: base, Interval: interval, Points: []NetWorthPoint{}}
+	if len(all) == 0 {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	if from.IsZero() {
+		from = all[0].On
+	}
+
+	n := 0
+	for start := reports.Truncate(from.In(time.Local), interval); start.Before(to); start = reports.Next(start, interval) {
+		if n++; n > reports.MaxPeriods {
+			writeValidationError(w, r, map[string]string{"interval": "from..to covers more than " + strconv.Itoa(reports.MaxPeriods) + " periods"})
+			return
+		}
+	}
+
+	latest := map[string]*store.BalanceSnapshot{}
+	next := 0
+	for start := reports.Truncate(from.In(time.Local), interval); start.Before(to); start = reports.Next(start, interval) {
+		end := reports.Next(start, interval)
+		if end.After(to) {
+			end = to
+		}
+		for ; next < len(all) && all[next].On.Before(end); next++ {
+			latest[strings.ToLower(all[next].Account)] = &all[next]
+		}
+		day := end.AddDate(0, 0, -1)
+		p := NetWorthPoint{Date: day.Format(dayLayout), Accounts: []NetWorthAccount{}}
+		for _, sn := range latest {
+			a := NetWorthAccount{Account: sn.Account, Balance: sn.Balance, Currency: sn.Currency, On: sn.On.In(time.Local).Format(dayLayout)}
+			converted, _, err := h.s.ConvertAmount(sn.Balance, sn.Currency, base, day)
+			if errors.Is(err, store.ErrNoExchangeRate) {
+				resp.Unconverted++
+			} else if err != nil {
+				log.Printf("Error converting snapshot %d: %v", sn.ID, err)
+				writeError(w, r, "Failed to convert amounts", http.StatusInternalServerError)
+				return
+			} else {
+				converted = src.RoundCents(converted)
+				a.Converted = &converted
+				if converted >= 0 {
+					p.Assets += converted
+				} else {
+					p.Liabilities -= converted
+				}
+			}
+			p.Accounts = append(p.Accounts, a)
+		}
+		sort.Slice(p.Accounts, func(i, j int) bool {
+			return strings.ToLower(p.Accounts[i].Account) < strings.ToLower(p.Accounts[j].Account)
+		})
+		p.Assets, p.Liabilities = src.RoundCents(p.Assets), src.RoundCents(p.Liabilities)
+		p.NetWorth = src.RoundCents(p.Assets - p.Liabilities)
+		resp.Points = append(resp.Points, p)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,128 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestSnapshotsAndNetWorth(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	bob := &store.User{Username: "bob", PersonName: "Bob"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(&store.Session{Code: "bobtok", UserID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := do(mux, "POST", "/api/v1/snapshots", token, `{"account":"","on":"Jan 31"}`)
+	if e := decodeError(t, rec); rec.Code != http.StatusUnprocessableEntity || e.Fields["account"] == "" || e.Fields["on"] == "" {
+		t.Errorf("invalid snapshot = %d %+v", rec.Code, e)
+	}
+	rec = do(mux, "POST", "/api/v1/snapshots", token, `{"account":"Chequing","balance":1000,"on":"2024-01-31"}`)
+	var manual Snapshot
+	if err := json.NewDecoder(rec.Body).Decode(&manual); err != nil || rec.Code != http.StatusCreated || manual.Currency != "CAD" || manual.Source != store.SnapshotManual {
+		t.Fatalf("create snapshot = %d %+v %v", rec.Code, manual, err)
+	}
+
+	day := func(m time.Month, d int) time.Time { return time.Date(2024, m, d, 12, 0, 0, 0, time.Local) }
+	for _, txn := range []*store.Transaction{
+		{UserID: alice.ID, Amount: 200, Currency: "CAD", Card: "Chequing", Merchant: "Before", OccurredAt: day(1, 20)},
+		{UserID: alice.ID, Amount: 100, Currency: "CAD", Card: "Chequing", Merchant: "Grocer", OccurredAt: day(2, 10)},
+		{UserID: alice.ID, Amount: 500, Currency: "CAD", Card: "chequing", Merchant: "Payroll", Kind: store.KindIncome, OccurredAt: day(2, 15)},
+		{UserID: alice.ID, Amount: 50, Currency: "CAD", Card: "Visa", Merchant: "Cafe", OccurredAt: day(2, 5)},
+	} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	compute := func(body string) []Snapshot {
+		t.Helper()
+		rec := do(mux, "POST", "/api/v1/snapshots/compute", token, body)
+		var out []Snapshot
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil || rec.Code != http.StatusCreated {
+			t.Fatalf("compute %s = %d %v", body, rec.Code, err)
+		}
+		return out
+	}
+	if got := compute(`{"on":"2024-02-29"}`); len(got) != 1 || got[0].Account != "Chequing" || got[0].Balance != 1400 || got[0].Source != store.SnapshotComputed {
+		t.Errorf("computed forward = %+v", got)
+	}
+	if got := compute(`{"on":"2024-01-15"}`); len(got) != 1 || got[0].Balance != 1200 {
+		t.Errorf("computed backward = %+v, want 1000 plus the 200 spent after", got)
+	}
+	if got := compute(`{"on":"2024-02-29","accounts":["Visa"]}`); len(got) != 1 || got[0].Balance != -50 || got[0].Currency != "CAD" {
+		t.Errorf("computed without anchor = %+v", got)
+	}
+
+	rec = do(mux, "GET", "/api/v1/networth?from=2024-01-01&to=2024-02-29", token, "")
+	var nw NetWorth
+	if err := json.NewDecoder(rec.Body).Decode(&nw); err != nil || rec.Code != http.StatusOK || nw.Interval != "month" || len(nw.Points) != 2 {
+		t.Fatalf("net worth = %d %+v %v", rec.Code, nw, err)
+	}
+	if p := nw.Points[0]; p.Date != "2024-01-31" || p.Assets != 1000 || p.Liabilities != 0 || len(p.Accounts) != 1 || p.Accounts[0].On != "2024-01-31" {
+		t.Errorf("january = %+v", p)
+	}
+	if p := nw.Points[1]; p.Date != "2024-02-29" || p.Assets != 1400 || p.Liabilities != 50 || p.NetWorth != 1350 || len(p.Accounts) != 2 {
+		t.Errorf("february = %+v", p)
+	}
+	if rec := do(mux, "GET", "/api/v1/networth?interval=fortnight", token, ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("bad interval = %d", rec.Code)
+	}
+	if rec := do(mux, "GET", "/api/v1/networth?interval=day&from=0002-01-01&to=9999-01-01", token, ""); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("unbounded = %d", rec.Code)
+	}
+
+	rec = do(mux, "GET", "/api/v1/snapshots?account=chequing", token, "")
+	var list []Snapshot
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list) != 3 || list[0].On != "2024-01-15" {
+		t.Fatalf("list = %d %+v %v", rec.Code, list, err)
+	}
+	path := fmt.Sprintf("/api/v1/snapshots/%d", manual.ID)
+	if rec := do(mux, "DELETE", path, "bobtok", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete by another user = %d", rec.Code)
+	}
+	if rec := do(mux, "DELETE", path, token, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d", rec.Code)
+	}
+}
+
+func TestImportStatementBalances(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	ofx := `<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS><CURDEF>CAD<CCACCTFROM><ACCTID>4500123456789876</CCACCTFROM>
+<BANKTRANLIST><STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240301<TRNAMT>-42.10<FITID>1<NAME>SAVE ON FOODS
+</STMTTRN></BANKTRANLIST><LEDGERBAL><BALAMT>-42.10<DTASOF>20240305</LEDGERBAL>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
+	rec := upload(t, mux, "/api/v1/imports/preview?format=ofx", token, ofx)
+	var preview ImportPreview
+	if err := json.NewDecoder(rec.Body).Decode(&preview); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("preview = %d %v", rec.Code, err)
+	}
+	if len(preview.Balances) != 1 || preview.Balances[0].Balance != -42.1 || preview.Balances[0].On != "2024-03-05" {
+		t.Fatalf("balances = %+v", preview.Balances)
+	}
+
+	body, _ := json.Marshal(ImportCommitPayload{Source: "ofx", Transactions: []AddTransactionPayload{preview.Rows[0].AddTransactionPayload}, Balances: preview.Balances})
+	rec = do(mux, "POST", "/api/v1/imports/commit", token, string(body))
+	var resp ImportCommitResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusCreated || resp.Snapshots != 1 {
+		t.Fatalf("commit = %d %+v %v", rec.Code, resp, err)
+	}
+	snaps, err := s.ListSnapshots(alice.ID, time.Time{}, time.Time{})
+	if err != nil || len(snaps) != 1 || snaps[0].Source != store.SnapshotStatement || snaps[0].Account != preview.Rows[0].Card {
+		t.Errorf("stored = %+v %v", snaps, err)
+	}
+
+	bad := `{"transactions":[],"balances":[{"account":"visa","currency":"dollars","on":"2024-03-05"}]}`
+	if e := decodeError(t, do(mux, "POST", "/api/v1/imports/commit", token, bad)); e.Fields["balances[0].currency"] == "" {
+		t.Errorf("invalid balance = %+v", e)
+	}
+}
@@ -15,44 +15,44 @@ type UnsubscribePayload struct {
 
 func (h WithStore) Unsubscribe(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload UnsubscribePayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if payload.EncryptedUserID == "" {
-		http.Error(w, "Encrypted user ID is required", http.StatusBadRequest)
+		writeError(w, r, "Encrypted user ID is required", http.StatusBadRequest)
 		return
 	}
 
 	decryptedUserIDStr, err := src.Decrypt(payload.EncryptedUserID)
 	if err != nil {
 		log.Printf("Error decrypting user ID: %v", err)
-		http.Error(w, "Failed to decrypt user ID", http.StatusInternalServerError)
+		writeError(w, r, "Failed to decrypt user ID", http.StatusInternalServerError)
 		return
 	}
 
 	connectedUserId, err := strconv.ParseUint(decryptedUserIDStr, 10, 64)
 	if err != nil {
 		log.Printf("Error converting decrypted user ID to int: %v", err)
-		http.Error(w, "Invalid decrypted user ID format", http.StatusInternalServerError)
+		writeError(w, r, "Invalid decrypted user ID format", http.StatusInternalServerError)
 		return
 	}
 
 	removed, err := h.s.RemoveConnection(userId, connectedUserId)
 	if err != nil {
 		log.Printf("Error unsubscribing user %d from %d: %v", userId, connectedUserId, err)
-		http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
+		writeError(w, r, "Failed to unsubscribe", http.StatusInternalServerError)
 		return
 	}
 
 	if !removed {
-		http.Error(w, "Subscription not found or already unsubscribed", http.StatusNotFound)
+		writeError(w, r, "Subscription not found or already unsubscribed", http.StatusNotFound)
 		return
 	}
 
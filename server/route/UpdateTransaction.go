@@ -2,9 +2,11 @@ package route
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
+	"code.sirenko.ca/transaction/rules"
 	"code.sirenko.ca/transaction/store"
 )
 
@@ -18,110 +20,191 @@ type UpdateTransactionPayload struct {
 	Category   *string  `json:"category"`
 	Details    *string  `json:"details"`
 	Tags       []string `json:"tags"`
+	Kind       *string  `json:"kind"`
+	// RefundOf links a refund to the purchase it reverses; 0 unlinks.
+	RefundOf *uint64 `json:"refundOf"`
+	// MCC sets the merchant category code; "" clears it.
+	MCC *string `json:"mcc"`
+}
+
+// validate reports malformed fields. It does not touch the store.
+func (p UpdateTransactionPayload) validate() map[string]string {
+	fields := map[string]string{}
+	if p.OccurredAt != nil {
+		if _, err := parseOccurredAt(*p.OccurredAt); err != nil {
+			fields["occurredAt"] = err.Error()
+		}
+	}
+	if p.Kind != nil && !store.ValidKind(*p.Kind) {
+		fields["kind"] = "must be one of expense, income, refund, transfer"
+	}
+	if p.MCC != nil && *p.MCC != "" && !rules.ValidMCC(*p.MCC) {
+		fields["mcc"] = "must be four digits"
+	}
+	return fields
 }
 
 func (h WithStore) UpdateTransaction(w http.ResponseWriter, r *http.Request, userId uint64) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	var payload UpdateTransactionPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if payload.ID == 0 {
-		http.Error(w, "Transaction ID is required", http.StatusBadRequest)
+		writeError(w, r, "Transaction ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if h.applyTransactionUpdate(w, r, userId, payload) == nil {
+		return
+	}
+	writeUndo(w, http.StatusOK)
+}
+
+// PatchTransaction is PATCH /api/v1/transactions/{id}: UpdateTransaction
+// with the ID taken from the path. It replies with the updated
+// transaction.
+func (h WithStore) PatchTransaction(w http.ResponseWriter, r *http.Request, userId uint64) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
 		return
 	}
+	var payload UpdateTransactionPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, r, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	payload.ID = id
+
+	t := h.applyTransactionUpdate(w, r, userId, payload)
+	if t == nil {
+		return
+	}
+	out, err := h.toTransaction(t, h.baseCurrency(userId))
+	if err != nil {
+		log.Printf("Error building transaction %d: %v", t.ID, err)
+		writeError(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// applyTransactionUpdate checks access and applies the non-nil fields
+// of payload. On failure it has already written the response and
+// returns nil.
+func (h WithStore) applyTransactionUpdate(w http.ResponseWriter, r *http.Request, userId uint64, payload UpdateTransactionPayload) *store.Transaction {
+	if fields := payload.validate(); len(fields) > 0 {
+		writeValidationError(w, r, fields)
+		return nil
+	}
 
 	// Ownership + access check.
 	transaction, err := h.s.GetTransaction(payload.ID)
 	if err != nil {
 		if err == store.ErrNotFound {
-			http.Error(w, "Transaction not found", http.StatusNotFound)
-			return
+			writeError(w, r, "Transaction not found", http.StatusNotFound)
+			return nil
 		}
 		log.Printf("Error querying transaction: %v", err)
-		http.Error(w, "Failed to check transaction permissions", http.StatusInternalServerError)
-		return
+		writeError(w, r, "Failed to check transaction permissions", http.StatusInternalServerError)
+		return nil
 	}
 
-	hasAccess := userId == transaction.UserID
-	if !hasAccess {
-		connected, err := h.s.ListConnectedUserIDs(transaction.UserID)
-		if err != nil {
-			log.Printf("Error checking user connection: %v", err)
-			http.Error(w, "Failed to check transaction permissions", http.StatusInternalServerError)
-			return
-		}
-		for _, cid := range connected {
-			if cid == userId {
-				hasAccess = true
-				break
-			}
-		}
+	hasAccess, err := h.canAccessOwner(userId, transaction.UserID)
+	if err != nil {
+		log.Printf("Error checking user connection: %v", err)
+		writeError(w, r, "Failed to check transaction permissions", http.StatusInternalServerError)
+		return nil
 	}
 
 	if !hasAccess {
-		http.Error(w, "You do not have permission to update this transaction", http.StatusForbidden)
-		return
+		writeError(w, r, "You do not have permission to update this transaction", http.StatusForbidden)
+		return nil
 	}
 
-	// Reconcile tag set if the caller provided one.
-	if payload.Tags != nil {
-		if err := h.s.ReplaceTagsForTransaction(payload.ID, payload.Tags); err != nil {
-			log.Printf("Error replacing tags for transaction %d: %v", payload.ID, err)
-			http.Error(w, "Failed to update tags", http.StatusInternalServerError)
-			return
+	undo, ok := h.snapshot(w, r, false, payload.ID)
+	if !ok {
+		return nil
+	}
+	for i := range undo {
+		undo[i].TagSet = payload.Tags != nil
+	}
+
+	if payload.RefundOf != nil && *payload.RefundOf != 0 {
+		if status, msg := h.checkRefundTarget(userId, *payload.RefundOf); status != 0 {
+			writeError(w, r, msg, status)
+			return nil
+		}
+	}
+	// Fields and the tag set, if the caller provided one, are written
+	// together.
+	if applyFields(transaction, payload) || payload.Tags != nil {
+		if err := h.s.UpdateTransactionAndTags(transaction, payload.Tags); err != nil {
+			if errors.Is(err, store.ErrInvalidRefund) {
+				writeError(w, r, "refundOf must point at an expense and kind must be refund", http.StatusBadRequest)
+				return nil
+			}
+			log.Printf("Error updating transaction %d: %v", payload.ID, err)
+			writeError(w, r, "Failed to update transaction", http.StatusInternalServerError)
+			return nil
 		}
 	}
 
-	// Apply field updates.
+	h.recordUndo(w, userId, "update transaction", undo)
+	return transaction
+}
+
+// applyFields copies the non-nil fields of payload (other than ID and
+// Tags) onto t and reports whether any were set. payload must have
+// passed validate.
+func applyFields(t *store.Transaction, payload UpdateTransactionPayload) bool {
 	changed := false
 	if payload.Merchant != nil {
-		transaction.Merchant = *payload.Merchant
+		t.Merchant = *payload.Merchant
 		changed = true
 	}
 	if payload.Amount != nil {
-		transaction.Amount = *payload.Amount
+		t.Amount = *payload.Amount
 		changed = true
 	}
 	if payload.OccurredAt != nil {
-		occurredAt, err := parseOccurredAt(*payload.OccurredAt)
-		if err != nil {
-			http.Error(w, "Invalid occurredAt: "+err.Error(), http.StatusBadRequest)
-			return
-		}
-		transaction.OccurredAt = occurredAt
+		occurredAt, _ := parseOccurredAt(*payload.OccurredAt)
+		t.OccurredAt = occurredAt
 		changed = true
 	}
 	if payload.Card != nil {
-		transaction.Card = *payload.Card
+		t.Card = *payload.Card
 		changed = true
 	}
 	if payload.Category != nil {
-		transaction.Category = *payload.Category
+		t.Category = *payload.Category
 		changed = true
 	}
 	if payload.Details != nil {
-		transaction.Details = *payload.Details
+		t.Details = *payload.Details
 		changed = true
 	}
 	if payload.Currency != nil {
-		transaction.Currency = *payload.Currency
+		t.Currency = *payload.Currency
 		changed = true
 	}
-
-	if changed {
-		if err := h.s.UpdateTransaction(transaction); err != nil {
-			log.Printf("Error updating transaction %d: %v", payload.ID, err)
-			http.Error(w, "Failed to update transaction", http.StatusInternalServerError)
-			return
-		}
+	if payload.Kind != nil {
+		t.Kind = *payload.Kind
+		changed = true
 	}
-
-	w.WriteHeader(http.StatusOK)
+	if payload.MCC != nil {
+		t.MCC = *payload.MCC
+		changed = true
+	}
+	if payload.RefundOf != nil {
+		t.RefundOf = *payload.RefundOf
+		changed = true
+	}
+	return changed
 }
@@ -0,0 +1,76 @@
+package route
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+// visibleUserIDs returns the IDs whose transactions userId can read:
+// the caller plus every user they are connected to.
+func (h WithStore) visibleUserIDs(userId uint64) ([]uint64, error) {
+	connected, err := h.s.ListConnectedUserIDs(userId)
+	if err != nil {
+		return nil, err
+	}
+	return append([]uint64{userId}, connected...), nil
+}
+
+// canAccessOwner reports whether userId may modify data owned by
+// ownerID: either it is their own, or the owner has connected to them.
+func (h WithStore) canAccessOwner(userId, ownerID uint64) (bool, error) {
+	if userId == ownerID {
+		return true, nil
+	}
+	connected, err := h.s.ListConnectedUserIDs(ownerID)
+	if err != nil {
+		return false, err
+	}
+	for _, cid := range connected {
+		if cid == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkRefundTarget validates that originalID exists and is visible to
+// userId. It returns a zero status when the link is acceptable, or the
+// HTTP status and message to reply with.
+func (h WithStore) checkRefundTarget(userId, originalID uint64) (int, string) {
+	orig, err := h.s.GetTransaction(originalID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return http.StatusBadRequest, "refundOf: transaction not found"
+		}
+		log.Printf("Error looking up transaction %d: %v", originalID, err)
+		return http.StatusInternalServerError, "Failed to query database"
+	}
+	ok, err := h.canAccessOwner(userId, orig.UserID)
+	if err != nil {
+		log.Printf("Error checking user connection: %v", err)
+		return http.StatusInternalServerError, "Failed to check transaction permissions"
+	}
+	if !ok {
+		return http.StatusForbidden, "You do not have permission to link to this transaction"
+	}
+	return 0, ""
+}
+
+// canSeeTransaction reports whether userId may read (and discuss)
+// transaction t: it belongs to the caller or to someone the caller is
+// connected to, or its owner has connected to the caller.
+func (h WithStore) canSeeTransaction(userId uint64, t *store.Transaction) (bool, error) {
+	visible, err := h.visibleUserIDs(userId)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range visible {
+		if id == t.UserID {
+			return true, nil
+		}
+	}
+	return h.canAccessOwner(userId, t.UserID)
+}
@@ -0,0 +1,113 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const apiV1Prefix = "/api/v1/"
+
+// Machine-readable error codes returned in the v1 error envelope.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeGone             = "gone"
+	CodeTooLarge         = "too_large"
+	CodeInternal         = "internal"
+)
+
+// APIError is the body of every /api/v1 error response, wrapped as
+// {"error": {...}}. Fields maps request fields to what is wrong with
+// them and is only set for validation failures.
+type APIError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+type errorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+func isV1(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiV1Prefix)
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnprocessableEntity:
+		return CodeValidation
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// writeError replies with the JSON envelope on /api/v1 routes and with
+// plain text (as http.Error) on the legacy ones, which clients already
+// parse that way.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if !isV1(r) {
+		http.Error(w, message, status)
+		return
+	}
+	writeAPIError(w, status, APIError{Code: codeForStatus(status), Message: message})
+}
+
+// writeValidationError reports per-field problems: 422 with the fields
+// map on /api/v1, 400 with the messages joined on legacy routes.
+func writeValidationError(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	if !isV1(r) {
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		msgs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			msgs = append(msgs, k+": "+fields[k])
+		}
+		http.Error(w, strings.Join(msgs, "; "), http.StatusBadRequest)
+		return
+	}
+	writeAPIError(w, http.StatusUnprocessableEntity, APIError{
+		Code:    CodeValidation,
+		Message: "Request validation failed",
+		Fields:  fields,
+	})
+}
+
+func writeAPIError(w http.ResponseWriter, status int, e APIError) {
+	writeJSON(w, status, errorEnvelope{Error: e})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
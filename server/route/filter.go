@@ -0,0 +1,46 @@
+package route
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+// transactionFilter holds the query filters shared by the transaction
+// list and export endpoints: from/to (see parseDateRange), kind and
+// category. Zero fields match everything.
+type transactionFilter struct {
+	From, To time.Time
+	Kind     string
+	Category string
+}
+
+func parseTransactionFilter(r *http.Request) (transactionFilter, error) {
+	var f transactionFilter
+	var err error
+	if f.From, f.To, err = parseDateRange(r); err != nil {
+		return f, err
+	}
+	q := r.URL.Query()
+	f.Kind = q.Get("kind")
+	if f.Kind != "" && !store.ValidKind(f.Kind) {
+		return f, errors.New("invalid kind: want expense, income, refund or transfer")
+	}
+	f.Category = q.Get("category")
+	return f, nil
+}
+
+func (f transactionFilter) match(t *store.Transaction) bool {
+	if !f.From.IsZero() && t.OccurredAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !t.OccurredAt.Before(f.To) {
+		return false
+	}
+	if f.Kind != "" && t.KindOrDefault() != f.Kind {
+		return false
+	}
+	return f.Category == "" || t.Category == f.Category
+}
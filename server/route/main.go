@@ -16,11 +16,18 @@ import (
 )
 
 type WithStore struct {
-	s *store.Store
+	s          *store.Store
+	undoWindow time.Duration
 }
 
 func NewWithStore(s *store.Store) WithStore {
-	return WithStore{s: s}
+	return WithStore{s: s, undoWindow: DefaultUndoWindow}
+}
+
+// WithUndoWindow sets how long undo tokens stay valid.
+func (h WithStore) WithUndoWindow(d time.Duration) WithStore {
+	h.undoWindow = d
+	return h
 }
 
 func generateSecureToken(length int) (string, error) {
@@ -122,31 +129,76 @@ func getFileSystem() http.FileSystem {
 	return http.Dir("./dist")
 }
 
+// routeMux is a ServeMux that remembers the patterns registered on
+// it, so tests can check them against the OpenAPI document.
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (m *routeMux) Handle(pattern string, handler http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
 func (h WithStore) GetMux() http.Handler {
-	mux := http.NewServeMux()
+	return h.newMux().ServeMux
+}
+
+func (h WithStore) newMux() *routeMux {
+	mux := &routeMux{ServeMux: http.NewServeMux()}
 	a := h.AuthMiddleware
 
-	mux.HandleFunc("/api/login", h.Login)
-	mux.Handle("POST /api/transaction/{id}/photo", a(h.AttachPhoto))
-	mux.Handle("DELETE /api/photo", a(h.DeletePhotoByPath))
+	mux.HandleFunc("GET /api/openapi.json", ServeOpenAPI)
+
+	h.registerV1(mux)
+
+	// Unversioned paths of endpoints that were added with /api/v1. No
+	// old client depends on them, so they are plain routes rather than
+	// deprecated aliases.
+	mux.Handle("GET /api/reports", a(h.GetReport))
+	mux.Handle("GET /api/forecast", a(h.GetForecast))
+	mux.Handle("GET /api/alerts", a(h.ListAlerts))
+	mux.Handle("GET /api/merchants/suggest", a(h.SuggestMerchants))
+
+	// Legacy routes, kept as deprecated aliases of /api/v1. They answer
+	// errors in plain text.
+	legacy := func(pattern, successor string, next http.Handler) {
+		mux.Handle(pattern, deprecated(successor, next))
+	}
+	legacy("/api/login", "/api/v1/login", http.HandlerFunc(h.Login))
+	legacy("POST /api/transaction/{id}/photo", "/api/v1/transactions/{id}/photos", a(h.AttachPhoto))
+	legacy("DELETE /api/photo", "/api/v1/photos", a(h.DeletePhotoByPath))
+	legacy("GET /api/transaction/{id}/comments", "/api/v1/transactions/{id}/comments", a(h.ListComments))
+	legacy("POST /api/transaction/{id}/comments", "/api/v1/transactions/{id}/comments", a(h.AddComment))
+	legacy("DELETE /api/transaction/{id}/comments/{commentId}", "/api/v1/transactions/{id}/comments/{commentId}", a(h.DeleteComment))
 	mux.Handle("GET /uploads/transaction/{encrypted_user_id}/{encrypted_transaction_id}/{filename}", a(h.GetPhotoByPath))
-	mux.Handle("/api/transactions/add", a(h.AddTransactions))
-	mux.Handle("/api/transactions", a(h.GetTransactions))
-	mux.Handle("/api/transaction/update", a(h.UpdateTransaction))
-	mux.Handle("/api/transaction/delete", a(h.DeleteTransaction))
-	mux.Handle("/api/transactions/tags", a(h.ManageTags))
-	mux.Handle("/api/transactions/category", a(h.ManageCategory))
-	mux.Handle("/api/categories", a(h.GetCategories))
-	mux.Handle("/api/sharing/token", a(h.GenerateSharingToken))
-	mux.Handle("/api/sharing/connections", a(h.GetSharingConnections))
-	mux.Handle("/api/sharing/connections/add", a(h.AddSharingConnection))
-	mux.Handle("/api/sharing/token/revoke", a(h.RevokeSharingToken))
-	mux.Handle("/api/sharing/tokens", a(h.GetSharingTokens))
-	mux.Handle("/api/sharing/subscriptions", a(h.GetSubscriptions))
-	mux.Handle("/api/sharing/unsubscribe", a(h.Unsubscribe))
-	mux.Handle("GET /api/settings", a(h.GetSettings))
-	mux.Handle("POST /api/settings", a(h.UpdateSetting))
-	mux.Handle("/api/logout", a(h.Logout))
+	legacy("/api/transactions/add", "/api/v1/transactions", a(h.AddTransactions))
+	legacy("/api/transactions", "/api/v1/transactions", a(h.GetTransactions))
+	legacy("/api/transaction/update", "/api/v1/transactions/{id}", a(h.UpdateTransaction))
+	legacy("/api/transaction/delete", "/api/v1/transactions/{id}", a(h.DeleteTransaction))
+	legacy("POST /api/transactions/batch", "/api/v1/transactions/batch", a(h.BatchTransactions))
+	legacy("POST /api/undo/{token}", "/api/v1/undo/{token}", a(h.Undo))
+	legacy("/api/transactions/tags", "/api/v1/transactions/tags", a(h.ManageTags))
+	legacy("/api/transactions/category", "/api/v1/transactions/category", a(h.ManageCategory))
+	legacy("/api/categories", "/api/v1/categories", a(h.GetCategories))
+	legacy("/api/sharing/token", "/api/v1/sharing/tokens", a(h.GenerateSharingToken))
+	legacy("/api/sharing/connections", "/api/v1/sharing/connections", a(h.GetSharingConnections))
+	legacy("/api/sharing/connections/add", "/api/v1/sharing/connections", a(h.AddSharingConnection))
+	legacy("/api/sharing/token/revoke", "/api/v1/sharing/tokens/revoke", a(h.RevokeSharingToken))
+	legacy("/api/sharing/tokens", "/api/v1/sharing/tokens", a(h.GetSharingTokens))
+	legacy("/api/sharing/subscriptions", "/api/v1/sharing/subscriptions", a(h.GetSubscriptions))
+	legacy("/api/sharing/unsubscribe", "/api/v1/sharing/unsubscribe", a(h.Unsubscribe))
+	legacy("GET /api/settings", "/api/v1/settings", a(h.GetSettings))
+	legacy("POST /api/settings", "/api/v1/settings", a(h.UpdateSetting))
+	legacy("GET /api/currency", "/api/v1/currency", a(h.GetBaseCurrency))
+	legacy("POST /api/currency", "/api/v1/currency", a(h.UpdateBaseCurrency))
+	legacy("GET /api/totals", "/api/v1/totals", a(h.GetTotals))
+	legacy("/api/logout", "/api/v1/logout", a(h.Logout))
 	mux.Handle("/", http.FileServer(getFileSystem()))
 
 	return mux
@@ -0,0 +1,369 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.sirenko.ca/transaction/rules"
+)
+
+// apiOperation documents one registered route for the OpenAPI
+// document. Request and Response are zero values of the Go types the
+// handler decodes and encodes; their schemas are derived by reflection
+// so the spec follows the structs.
+type apiOperation struct {
+	// Pattern is exactly as registered on the mux.
+	Pattern string
+	// Method is the method the handler accepts, for legacy patterns
+	// registered without one.
+	Method  string
+	Summary string
+	// Public routes need no bearer token.
+	Public bool
+	Query  []string
+	// Request is the JSON body; Multipart names a file field instead.
+	Request   any
+	Multipart string
+	Response  any
+	// Status is the success status; 0 means 200.
+	Status int
+	// Raw is the content type of a non-JSON response body. With
+	// Response set, it is the schema of each record in it.
+	Raw string
+}
+
+var transactionFilterParams = []string{"from", "to", "kind", "category"}
+
+// apiOperations lists every route in newMux except the static file
+// server and the /api/v1/ fallback. TestOpenAPICoversMux keeps it in
+// sync.
+var apiOperations = []apiOperation{
+	{Pattern: "GET /api/openapi.json", Summary: "This document", Public: true, Response: map[string]any{}},
+
+	{Pattern: "POST /api/v1/login", Summary: "Exchange credentials for a session token", Public: true, Request: LoginPayload{}, Response: TokenResponse{}},
+	{Pattern: "POST /api/v1/logout", Summary: "End the current session"},
+	{Pattern: "GET /api/v1/transactions", Summary: "List the caller's and connected users' transactions", Query: transactionFilterParams, Response: []Transaction{}},
+	{Pattern: "POST /api/v1/transactions", Summary: "Create transactions as one import batch", Request: []AddTransactionPayload{}, Response: []Transaction{}, Status: http.StatusCreated},
+	{Pattern: "GET /api/v1/transactions/export", Summary: "Stream transactions as NDJSON, one per line, or download them as csv, ofx, qif, ledger, hledger or beancount with format; gzipped if accepted", Query: append([]string{"format", "columns"}, transactionFilterParams...), Response: Transaction{}, Raw: "application/x-ndjson"},
+	{Pattern: "GET /api/v1/transactions/duplicates", Summary: "Pairs of transactions that look like one purchase recorded twice: similar merchant, amounts within 1%, at most days apart", Query: []string{"from", "to", "days"}, Response: []DuplicateCandidate{}},
+	{Pattern: "GET /api/v1/transactions/{id}", Summary: "Get one transaction", Response: Transaction{}},
+	{Pattern: "PATCH /api/v1/transactions/{id}", Summary: "Update the given fields of a transaction", Request: UpdateTransactionPayload{}, Response: Transaction{}},
+	{Pattern: "DELETE /api/v1/transactions/{id}", Summary: "Delete one of the caller's transactions", Status: http.StatusNoContent},
+	{Pattern: "POST /api/v1/transactions/batch", Summary: "Apply update, tag, category and delete operations atomically", Request: BatchPayload{}, Response: BatchResponse{}},
+	{Pattern: "POST /api/v1/transactions/tags", Summary: "Add or remove a tag on several transactions", Request: TagPayload{}},
+	{Pattern: "POST /api/v1/transactions/category", Summary: "Set the category of several transactions", Request: CategoryPayload{}},
+	{Pattern: "POST /api/v1/transactions/{id}/photos", Summary: "Attach a receipt photo", Multipart: "photo", Response: PhotoResponse{}},
+	{Pattern: "POST /api/v1/transactions/{id}/merge", Summary: "Merge another transaction into this one: empty fields are filled from it, its tags, photos and comments move over, and it is deleted", Request: MergeTransactionPayload{}, Response: MergeTransactionResponse{}},
+	{Pattern: "DELETE /api/v1/photos", Summary: "Delete a photo by path", Request: DeletePhotoPayload{}},
+	{Pattern: "GET /api/v1/transactions/{id}/comments", Summary: "List a transaction's comments", Response: []Comment{}},
+	{Pattern: "POST /api/v1/transactions/{id}/comments", Summary: "Comment on a transaction", Request: CommentPayload{}, Response: Comment{}, Status: http.StatusCreated},
+	{Pattern: "DELETE /api/v1/transactions/{id}/comments/{commentId}", Summary: "Delete a comment"},
+	{Pattern: "POST /api/v1/imports/preview", Summary: "Parse an uploaded csv, cibc, wealthsimple or ofx file and flag rows already stored; nothing is written", Query: []string{"format"}, Multipart: "file", Response: ImportPreview{}},
+	{Pattern: "POST /api/v1/imports/commit", Summary: "Store previewed rows as one import batch, skipping ones already stored", Request: ImportCommitPayload{}, Response: ImportCommitResponse{}, Status: http.StatusCreated},
+	{Pattern: "GET /api/v1/imports", Summary: "List the caller's import batches, newest first", Response: []ImportBatch{}},
+	{Pattern: "GET /api/v1/imports/{id}", Summary: "Get one import batch", Response: ImportBatch{}},
+	{Pattern: "GET /api/v1/imports/{id}/transactions", Summary: "List the transactions an import batch created that still exist", Response: []Transaction{}},
+	{Pattern: "POST /api/v1/imports/{id}/rollback", Summary: "Delete every transaction of an import batch atomically", Response: RollbackResponse{}},
+	{Pattern: "POST /api/v1/undo/{token}", Summary: "Revert the request that returned this undo token", Response: UndoResult{}},
+	{Pattern: "GET /api/v1/categories", Summary: "List the categories of the caller's household; archived ones only with archived=true", Query: []string{"archived"}, Response: []Category{}},
+	{Pattern: "POST /api/v1/categories", Summary: "Add a category to the caller's catalog", Request: CategoryFields{}, Response: Category{}, Status: http.StatusCreated},
+	{Pattern: "GET /api/v1/categories/{id}", Summary: "Get one category", Response: Category{}},
+	{Pattern: "PATCH /api/v1/categories/{id}", Summary: "Update a category; a rename rewrites its transactions", Request: CategoryFields{}, Response: CategoryChange{}},
+	{Pattern: "DELETE /api/v1/categories/{id}", Summary: "Remove a category from the catalog; transactions keep the name", Status: http.StatusNoContent},
+	{Pattern: "POST /api/v1/categories/{id}/merge", Summary: "Move a category's transactions into another and delete it", Request: MergeCategoryPayload{}, Response: CategoryChange{}},
+	{Pattern: "GET /api/v1/merchants", Summary: "Every merchant of the caller's transactions and catalog with its transaction count, spend in the base currency and last use, biggest spend first", Response: []MerchantSummary{}},
+	{Pattern: "POST /api/v1/merchants", Summary: "Add a merchant with alias prefixes to the caller's catalog; matching transactions are normalized to its name", Request: MerchantFields{}, Response: MerchantChange{}, Status: http.StatusCreated},
+	{Pattern: "GET /api/v1/merchants/suggest", Summary: "Complete ?q= from the merchants of the caller's and connected users' transactions, most used and most recent first, with the latest category, tags and amount; limit defaults to 10", Query: []string{"q", "limit"}, Response: []MerchantSuggestion{}},
+	{Pattern: "PATCH /api/v1/merchants/{id}", Summary: "Rename a merchant or replace its aliases; its transactions follow", Request: MerchantFields{}, Response: MerchantChange{}},
+	{Pattern: "DELETE /api/v1/merchants/{id}", Summary: "Remove a merchant from the catalog; transactions keep the name", Status: http.StatusNoContent},
+	{Pattern: "POST /api/v1/merchants/{id}/merge", Summary: "Fold a merchant into another: its name and aliases become the other's aliases and its transactions take the other's name", Request: MergeMerchantPayload{}, Response: MerchantChange{}},
+	{Pattern: "GET /api/v1/rules", Summary: "The caller's ordered categorization rules", Response: []rules.Rule{}},
+	{Pattern: "PUT /api/v1/rules", Summary: "Replace the caller's ordered categorization rules", Request: []rules.Rule{}, Response: []rules.Rule{}},
+	{Pattern: "GET /api/v1/mcc", Summary: "The built-in merchant category code to category table and the overrides on top of it", Response: MCCTables{}},
+	{Pattern: "PUT /api/v1/mcc", Summary: "Replace the MCC overrides; keys are a four-digit code or a lo-hi range, and an empty category turns a built-in mapping off", Request: rules.MCCTable{}, Response: MCCTables{}},
+	{Pattern: "POST /api/v1/rules/reapply", Summary: "Run the rules over stored transactions and report the changes; dryRun writes nothing", Query: []string{"from", "to"}, Request: ReapplyRulesPayload{}, Response: ReapplyRulesResponse{}},
+	{Pattern: "GET /api/v1/sharing/tokens", Summary: "List the caller's sharing tokens", Response: []string{}},
+	{Pattern: "POST /api/v1/sharing/tokens", Summary: "Generate a sharing token", Response: TokenResponse{}},
+	{Pattern: "POST /api/v1/sharing/tokens/revoke", Summary: "Revoke a sharing token", Request: RevokeTokenPayload{}},
+	{Pattern: "GET /api/v1/sharing/connections", Summary: "Names of users sharing with the caller", Response: []string{}},
+	{Pattern: "POST /api/v1/sharing/connections", Summary: "Connect to a user with their sharing token", Request: AddConnectionPayload{}, Status: http.StatusCreated},
+	{Pattern: "GET /api/v1/sharing/subscriptions", Summary: "Users the caller is connected to", Response: []Subscription{}},
+	{Pattern: "POST /api/v1/sharing/unsubscribe", Summary: "Drop a connection", Request: UnsubscribePayload{}},
+	{Pattern: "GET /api/v1/settings", Summary: "All settings, or the one named by key", Query: []string{"key"}, Response: map[string]json.RawMessage{}},
+	{Pattern: "POST /api/v1/settings", Summary: "Set the setting named by key to the JSON body", Query: []string{"key"}, Request: json.RawMessage{}},
+	{Pattern: "GET /api/v1/currency", Summary: "The caller's base currency", Response: BaseCurrencyPayload{}},
+	{Pattern: "POST /api/v1/currency", Summary: "Set the caller's base currency", Request: BaseCurrencyPayload{}},
+	{Pattern: "GET /api/v1/totals", Summary: "Spend and income converted to the base currency", Query: []string{"from", "to"}, Response: TotalsResponse{}},
+	{Pattern: "GET /api/v1/reports", Summary: "Spend or income grouped by a dimension and bucketed by period, with deltas against the previous period", Query: reportParams, Response: Report{}},
+	{Pattern: "GET /api/v1/forecast", Summary: "Projected daily balances of the caller's accounts from current balances, recurring transactions and scheduled items, with warnings for projected negative balances", Query: []string{"days"}, Response: ForecastResponse{}},
+	{Pattern: "GET /api/v1/balances", Summary: "The caller's entered account balances and their current values", Response: []AccountBalance{}},
+	{Pattern: "PUT /api/v1/balances", Summary: "Set an account's balance as of a day", Request: AccountBalance{}, Response: AccountBalance{}},
+	{Pattern: "DELETE /api/v1/balances/{account}", Summary: "Forget an account's balance", Status: http.StatusNoContent},
+	{Pattern: "GET /api/v1/scheduled", Summary: "The caller's scheduled bills and income", Response: []ScheduledItem{}},
+	{Pattern: "POST /api/v1/scheduled", Summary: "Add a scheduled bill or income", Request: ScheduledItemFields{}, Response: ScheduledItem{}, Status: http.StatusCreated},
+	{Pattern: "PATCH /api/v1/scheduled/{id}", Summary: "Update a scheduled item", Request: ScheduledItemFields{}, Response: ScheduledItem{}},
+	{Pattern: "DELETE /api/v1/scheduled/{id}", Summary: "Delete a scheduled item", Status: http.StatusNoContent},
+	{Pattern: "GET /api/v1/snapshots", Summary: "The caller's balance snapshots, oldest first", Query: []string{"account", "from", "to"}, Response: []Snapshot{}},
+	{Pattern: "POST /api/v1/snapshots", Summary: "Record an account's balance at the end of a day", Request: Snapshot{}, Response: Snapshot{}, Status: http.StatusCreated},
+	{Pattern: "POST /api/v1/snapshots/compute", Summary: "Compute and record account balances from transactions", Request: ComputeSnapshotsPayload{}, Response: []Snapshot{}, Status: http.StatusCreated},
+	{Pattern: "DELETE /api/v1/snapshots/{id}", Summary: "Delete a balance snapshot", Status: http.StatusNoContent},
+	{Pattern: "GET /api/v1/networth", Summary: "Assets, liabilities and net worth at the end of each period, from balance snapshots", Query: []string{"from", "to", "interval"}, Response: NetWorth{}},
+	{Pattern: "GET /api/v1/alerts", Summary: "The caller's alerts on unusual transactions, newest first; open ones unless status is acknowledged, dismissed or all", Query: []string{"status"}, Response: []Alert{}},
+	{Pattern: "POST /api/v1/alerts/{id}/acknowledge", Summary: "Mark an alert as seen", Response: Alert{}},
+	{Pattern: "POST /api/v1/alerts/{id}/dismiss", Summary: "Dismiss an alert as a false alarm", Response: Alert{}},
+
+	{Pattern: "/api/login", Method: "POST", Summary: "Use POST /api/v1/login", Public: true, Request: LoginPayload{}, Response: TokenResponse{}},
+	{Pattern: "POST /api/transaction/{id}/photo", Summary: "Use POST /api/v1/transactions/{id}/photos", Multipart: "photo", Response: PhotoResponse{}},
+	{Pattern: "DELETE /api/photo", Summary: "Use DELETE /api/v1/photos", Request: DeletePhotoPayload{}},
+	{Pattern: "GET /api/transaction/{id}/comments", Summary: "Use GET /api/v1/transactions/{id}/comments", Response: []Comment{}},
+	{Pattern: "POST /api/transaction/{id}/comments", Summary: "Use POST /api/v1/transactions/{id}/comments", Request: CommentPayload{}, Response: Comment{}, Status: http.StatusCreated},
+	{Pattern: "DELETE /api/transaction/{id}/comments/{commentId}", Summary: "Use DELETE /api/v1/transactions/{id}/comments/{commentId}"},
+	{Pattern: "GET /uploads/transaction/{encrypted_user_id}/{encrypted_transaction_id}/{filename}", Summary: "Download a receipt photo", Raw: "image/*"},
+	{Pattern: "/api/transactions/add", Method: "POST", Summary: "Use POST /api/v1/transactions", Request: []AddTransactionPayload{}, Response: UndoResponse{}, Status: http.StatusCreated},
+	{Pattern: "/api/transactions", Method: "GET", Summary: "Use GET /api/v1/transactions", Query: transactionFilterParams, Response: []Transaction{}},
+	{Pattern: "/api/transaction/update", Method: "POST", Summary: "Use PATCH /api/v1/transactions/{id}", Request: UpdateTransactionPayload{}, Response: UndoResponse{}},
+	{Pattern: "/api/transaction/delete", Method: "POST", Summary: "Use DELETE /api/v1/transactions/{id}", Request: DeleteTransactionPayload{}, Response: UndoResponse{}},
+	{Pattern: "POST /api/transactions/batch", Summary: "Use POST /api/v1/transactions/batch", Request: BatchPayload{}, Response: BatchResponse{}},
+	{Pattern: "POST /api/undo/{token}", Summary: "Use POST /api/v1/undo/{token}", Response: UndoResult{}},
+	{Pattern: "/api/transactions/tags", Method: "POST", Summary: "Use POST /api/v1/transactions/tags", Request: TagPayload{}, Response: UndoResponse{}},
+	{Pattern: "/api/transactions/category", Method: "POST", Summary: "Use POST /api/v1/transactions/category", Request: CategoryPayload{}, Response: UndoResponse{}},
+	{Pattern: "/api/categories", Method: "GET", Summary: "Use GET /api/v1/categories; replies with the distinct names", Query: []string{"archived"}, Response: []string{}},
+	{Pattern: "/api/sharing/token", Method: "POST", Summary: "Use POST /api/v1/sharing/tokens", Response: TokenResponse{}},
+	{Pattern: "/api/sharing/connections", Method: "GET", Summary: "Use GET /api/v1/sharing/connections", Response: []string{}},
+	{Pattern: "/api/sharing/connections/add", Method: "POST", Summary: "Use POST /api/v1/sharing/connections", Request: AddConnectionPayload{}, Status: http.StatusCreated},
+	{Pattern: "/api/sharing/token/revoke", Method: "POST", Summary: "Use POST /api/v1/sharing/tokens/revoke", Request: RevokeTokenPayload{}},
+	{Pattern: "/api/sharing/tokens", Method: "GET", Summary: "Use GET /api/v1/sharing/tokens", Response: []string{}},
+	{Pattern: "/api/sharing/subscriptions", Method: "GET", Summary: "Use GET /api/v1/sharing/subscriptions", Response: []Subscription{}},
+	{Pattern: "/api/sharing/unsubscribe", Method: "POST", Summary: "Use POST /api/v1/sharing/unsubscribe", Request: UnsubscribePayload{}},
+	{Pattern: "GET /api/settings", Summary: "Use GET /api/v1/settings", Query: []string{"key"}, Response: map[string]json.RawMessage{}},
+	{Pattern: "POST /api/settings", Summary: "Use POST /api/v1/settings", Query: []string{"key"}, Request: json.RawMessage{}},
+	{Pattern: "GET /api/currency", Summary: "Use GET /api/v1/currency", Response: BaseCurrencyPayload{}},
+	{Pattern: "POST /api/currency", Summary: "Use POST /api/v1/currency", Request: BaseCurrencyPayload{}},
+	{Pattern: "GET /api/totals", Summary: "Use GET /api/v1/totals", Query: []string{"from", "to"}, Response: TotalsResponse{}},
+	{Pattern: "GET /api/reports", Summary: "Same as GET /api/v1/reports", Query: reportParams, Response: Report{}},
+	{Pattern: "GET /api/forecast", Summary: "Same as GET /api/v1/forecast", Query: []string{"days"}, Response: ForecastResponse{}},
+	{Pattern: "GET /api/alerts", Summary: "Same as GET /api/v1/alerts", Query: []string{"status"}, Response: []Alert{}},
+	{Pattern: "GET /api/merchants/suggest", Summary: "Same as GET /api/v1/merchants/suggest", Query: []string{"q", "limit"}, Response: []MerchantSuggestion{}},
+	{Pattern: "/api/logout", Method: "POST", Summary: "Use POST /api/v1/logout"},
+}
+
+// splitPattern splits a mux pattern into method (possibly empty) and
+// path.
+func splitPattern(pattern string) (method, path string) {
+	if i := strings.IndexByte(pattern, ' '); i >= 0 {
+		return pattern[:i], pattern[i+1:]
+	}
+	return "", pattern
+}
+
+// specBuilder collects named struct schemas into components while
+// walking operation types.
+type specBuilder struct {
+	schemas map[string]any
+}
+
+func (b *specBuilder) schema(t reflect.Type) map[string]any {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := b.schema(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = nil // break cycles
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func (b *specBuilder) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	b.addFields(t, props, &required)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// addFields adds the JSON fields of t to props, flattening untagged
+// embedded structs the way encoding/json does.
+func (b *specBuilder) addFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.addFields(f.Type, props, required)
+			continue
+		}
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func (b *specBuilder) operation(op apiOperation, path string) map[string]any {
+	out := map[string]any{"summary": op.Summary}
+	_, p := splitPattern(op.Pattern)
+	if !strings.HasPrefix(p, apiV1Prefix) && strings.HasPrefix(p, "/api/") && p != "/api/openapi.json" {
+		out["deprecated"] = true
+	}
+	if op.Public {
+		out["security"] = []any{}
+	}
+
+	var params []any
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			params = append(params, map[string]any{
+				"name": strings.Trim(seg, "{}"), "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+	}
+	for _, q := range op.Query {
+		params = append(params, map[string]any{
+			"name": q, "in": "query", "schema": map[string]any{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	switch {
+	case op.Multipart != "":
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{"multipart/form-data": map[string]any{
+				"schema": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{op.Multipart: map[string]any{"type": "string", "format": "binary"}},
+					"required":   []string{op.Multipart},
+				},
+			}},
+		}
+	case op.Request != nil:
+		out["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(op.Request))}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case op.Raw != "" && op.Response != nil:
+		ok["content"] = map[string]any{op.Raw: map[string]any{"schema": b.schema(reflect.TypeOf(op.Response))}}
+	case op.Raw != "":
+		ok["content"] = map[string]any{op.Raw: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+	case op.Response != nil:
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(op.Response))}}
+	}
+	out["responses"] = map[string]any{
+		strconv.Itoa(status): ok,
+		"default":            map[string]any{"$ref": "#/components/responses/Error"},
+	}
+	return out
+}
+
+// OpenAPI builds the OpenAPI 3 document for apiOperations.
+func OpenAPI() map[string]any {
+	b := &specBuilder{schemas: map[string]any{}}
+	paths := map[string]map[string]any{}
+	ops := append([]apiOperation(nil), apiOperations...)
+	sort.SliceStable(ops, func(i, j int) bool { return ops[i].Pattern < ops[j].Pattern })
+	for _, op := range ops {
+		method, path := splitPattern(op.Pattern)
+		if method == "" {
+			method = op.Method
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(method)] = b.operation(op, path)
+	}
+	errSchema := b.schema(reflect.TypeOf(errorEnvelope{}))
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Transaction API",
+			"version":     "1",
+			"description": "Errors on /api/v1 routes use the Error envelope; the deprecated unversioned routes answer errors in plain text.",
+		},
+		"paths":    paths,
+		"security": []any{map[string]any{"bearer": []any{}}},
+		"components": map[string]any{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+			"responses": map[string]any{
+				"Error": map[string]any{
+					"description": "Error",
+					"content":     map[string]any{"application/json": map[string]any{"schema": errSchema}},
+				},
+			},
+		},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// ServeOpenAPI serves the OpenAPI document. It is built once: the
+// routes and types cannot change at runtime.
+func ServeOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIJSON, _ = json.MarshalIndent(OpenAPI(), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
@@ -0,0 +1,69 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPICoversMux fails when a route is registered in newMux
+// without an entry in apiOperations, or the other way round.
+func TestOpenAPICoversMux(t *testing.T) {
+	s, _, _ := newTestMux(t)
+	mux := NewWithStore(s).newMux()
+
+	spec := OpenAPI()
+	paths := spec["paths"].(map[string]map[string]any)
+	registered := map[string]bool{}
+	for _, pattern := range mux.patterns {
+		registered[pattern] = true
+		if pattern == "/" || pattern == apiV1Prefix {
+			continue
+		}
+		method, path := splitPattern(pattern)
+		ops, ok := paths[path]
+		if !ok {
+			t.Errorf("route %q is not in the OpenAPI document", pattern)
+			continue
+		}
+		if method != "" {
+			if _, ok := ops[strings.ToLower(method)]; !ok {
+				t.Errorf("route %q: no %s operation in the OpenAPI document", pattern, method)
+			}
+		}
+	}
+	for _, op := range apiOperations {
+		if !registered[op.Pattern] {
+			t.Errorf("apiOperations has %q, which is not registered", op.Pattern)
+		}
+		if method, _ := splitPattern(op.Pattern); method == "" && op.Method == "" {
+			t.Errorf("%q: method-less pattern needs Method", op.Pattern)
+		}
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	_, mux, _ := newTestMux(t)
+	rec := do(mux, "GET", "/api/openapi.json", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Fatalf("openapi = %q", doc.OpenAPI)
+	}
+	for _, name := range []string{"AddTransactionPayload", "UpdateTransactionPayload", "TagPayload", "CategoryPayload", "Transaction"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s missing", name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package route
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+// DefaultUndoWindow is how long an undo token stays valid unless the
+// server is started with another window.
+const DefaultUndoWindow = 10 * time.Minute
+
+// undoHeader carries the undo token on every response to a request
+// that recorded one, whatever the body.
+const undoHeader = "X-Undo-Token"
+
+// UndoResponse is the body of mutating legacy requests that used to
+// reply with an empty body.
+type UndoResponse struct {
+	UndoToken string `json:"undoToken,omitempty"`
+}
+
+type UndoResult struct {
+	Label    string `json:"label"`
+	Restored int    `json:"restored"`
+}
+
+// snapshot captures ids for an undo entry. On failure it has already
+// written a 500 and returns false; the caller must not go on to mutate
+// anything it could not undo.
+func (h WithStore) snapshot(w http.ResponseWriter, r *http.Request, cascade bool, ids ...uint64) ([]store.UndoRecord, bool) {
+	records, err := h.s.SnapshotTransactions(cascade, ids...)
+	if err != nil {
+		log.Printf("Error snapshotting transactions for undo: %v", err)
+		writeError(w, r, "Failed to record undo state", http.StatusInternalServerError)
+		return nil, false
+	}
+	return records, true
+}
+
+// recordUndo stores records under a new token and sets undoHeader. The
+// change it undoes has already been made, so a failure here is logged
+// and leaves the response without a token rather than failing it.
+func (h WithStore) recordUndo(w http.ResponseWriter, userId uint64, label string, records []store.UndoRecord) string {
+	if len(records) == 0 {
+		return ""
+	}
+	token, err := generateSecureToken(16)
+	if err != nil {
+		log.Printf("Error generating undo token: %v", err)
+		return ""
+	}
+	now := time.Now()
+	e := &store.UndoEntry{
+		Token:     token,
+		UserID:    userId,
+		Label:     label,
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.undoWindow),
+		Records:   records,
+	}
+	if err := h.s.PutUndo(e); err != nil {
+		log.Printf("Error recording undo for %s: %v", label, err)
+		return ""
+	}
+	w.Header().Set(undoHeader, token)
+	return token
+}
+
+// writeUndo ends an otherwise empty response with the undo token
+// recordUndo set, if any.
+func writeUndo(w http.ResponseWriter, status int) {
+	writeJSON(w, status, UndoResponse{UndoToken: w.Header().Get(undoHeader)})
+}
+
+// undoTag makes rec put back whether the transaction had tag, as it
+// was when snapshotted. A later add or remove of the same tag in one
+// request does not overwrite that.
+func undoTag(rec *store.UndoRecord, tag string) {
+	if _, ok := rec.TagLinks[tag]; ok {
+		return
+	}
+	if rec.TagLinks == nil {
+		rec.TagLinks = map[string]bool{}
+	}
+	rec.TagLinks[tag] = slices.Contains(rec.Tags, tag)
+}
+
+// createdRecords are the undo records for newly created transactions:
+// undoing them deletes them.
+func createdRecords(txns []*store.Transaction) []store.UndoRecord {
+	records := make([]store.UndoRecord, 0, len(txns))
+	for _, t := range txns {
+		records = append(records, store.UndoRecord{TransactionID: t.ID})
+	}
+	return records
+}
+
+// Undo restores the state recorded under {token}. A token works once,
+// only for the user whose request recorded it, and only within the
+// undo window.
+func (h WithStore) Undo(w http.ResponseWriter, r *http.Request, userId uint64) {
+	e, err := h.s.ApplyUndo(r.PathValue("token"), userId, time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, r, "Unknown or already used undo token", http.StatusNotFound)
+		case errors.Is(err, store.ErrUndoExpired):
+			writeError(w, r, "Undo window has passed", http.StatusGone)
+		default:
+			log.Printf("Error applying undo: %v", err)
+			writeError(w, r, "Failed to undo", http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, UndoResult{Label: e.Label, Restored: len(e.Records)})
+}
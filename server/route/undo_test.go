@@ -0,0 +1,114 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+func TestUndoCategoryChange(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		txn := &store.Transaction{UserID: alice.ID, Amount: 5, Currency: "CAD", OccurredAt: time.Now(), Category: "Food"}
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, txn.ID)
+	}
+
+	rec := do(mux, "POST", "/api/transactions/category", token,
+		fmt.Sprintf(`{"transaction_ids":[%d,%d,%d],"category":"Travel"}`, ids[0], ids[1], ids[2]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp UndoResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.UndoToken == "" || resp.UndoToken != rec.Header().Get(undoHeader) {
+		t.Fatalf("token %q, header %q", resp.UndoToken, rec.Header().Get(undoHeader))
+	}
+
+	rec = do(mux, "POST", "/api/v1/undo/"+resp.UndoToken, token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("undo: status %d: %s", rec.Code, rec.Body)
+	}
+	for _, id := range ids {
+		if got, _ := s.GetTransaction(id); got.Category != "Food" {
+			t.Fatalf("transaction %d category %q", id, got.Category)
+		}
+	}
+	if rec := do(mux, "POST", "/api/v1/undo/"+resp.UndoToken, token, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("second undo: status %d", rec.Code)
+	}
+}
+
+func TestUndoWindow(t *testing.T) {
+	s, _, token := newTestMux(t)
+	mux := NewWithStore(s).WithUndoWindow(-time.Second).GetMux()
+	rec := do(mux, "POST", "/api/v1/transactions", token, `[{"amount":1,"occurredAt":"2026-01-02T10:00:00Z"}]`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	rec = do(mux, "POST", "/api/v1/undo/"+rec.Header().Get(undoHeader), token, "")
+	if rec.Code != http.StatusGone || decodeError(t, rec).Code != CodeGone {
+		t.Fatalf("status %d", rec.Code)
+	}
+}
+
+func TestUndoTagChange(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	alice, _ := s.GetUserByUsername("alice")
+	bob := &store.User{Username: "bob", HashPassword: "x"}
+	if err := s.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	mine := &store.Transaction{UserID: alice.ID, Amount: 5, Currency: "CAD", OccurredAt: time.Now()}
+	theirs := &store.Transaction{UserID: bob.ID, Amount: 5, Currency: "CAD", OccurredAt: time.Now()}
+	for _, txn := range []*store.Transaction{mine, theirs} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := do(mux, "POST", "/api/v1/transactions/tags", token,
+		fmt.Sprintf(`{"transaction_ids":[%d,%d],"tag":"trip","action":"add"}`, mine.ID, theirs.ID))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("other user's transaction: status %d", rec.Code)
+	}
+	if tags, _ := s.ListTagsForTransaction(mine.ID); len(tags) != 0 {
+		t.Fatalf("rejected request tagged %v", tags)
+	}
+
+	rec = do(mux, "POST", "/api/v1/transactions/tags", token,
+		fmt.Sprintf(`{"transaction_ids":[%d],"tag":"trip","action":"add"}`, mine.ID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	// Changes made after the tag was added survive its undo.
+	mine.Category = "Travel"
+	if err := s.UpdateTransaction(mine); err != nil {
+		t.Fatal(err)
+	}
+	tag, _ := s.GetOrCreateTag("later")
+	if err := s.AddTagToTransaction(mine.ID, tag.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = do(mux, "POST", "/api/v1/undo/"+rec.Header().Get(undoHeader), token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("undo: status %d: %s", rec.Code, rec.Body)
+	}
+	if tags, _ := s.ListTagsForTransaction(mine.ID); len(tags) != 1 || tags[0] != "later" {
+		t.Fatalf("tags %v", tags)
+	}
+	if got, _ := s.GetTransaction(mine.ID); got.Category != "Travel" {
+		t.Fatalf("category %q", got.Category)
+	}
+}
@@ -0,0 +1,141 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// registerV1 adds the /api/v1 routes. Methods are part of every
+// pattern, so the mux rejects wrong methods before the handler runs;
+// anything under /api/v1/ that matches no route gets a JSON 404 or 405
+// from v1Fallback instead of the SPA's index.html.
+func (h WithStore) registerV1(mux *routeMux) {
+	a := h.AuthMiddleware
+
+	mux.HandleFunc("POST /api/v1/login", h.Login)
+	mux.Handle("POST /api/v1/logout", a(h.Logout))
+
+	mux.Handle("GET /api/v1/transactions", a(h.GetTransactions))
+	mux.Handle("POST /api/v1/transactions", a(h.AddTransactions))
+	mux.Handle("GET /api/v1/transactions/export", a(h.ExportTransactions))
+	mux.Handle("GET /api/v1/transactions/duplicates", a(h.GetDuplicateCandidates))
+	mux.Handle("GET /api/v1/transactions/{id}", a(h.GetTransactionByID))
+	mux.Handle("PATCH /api/v1/transactions/{id}", a(h.PatchTransaction))
+	mux.Handle("DELETE /api/v1/transactions/{id}", a(h.DeleteTransactionByID))
+	mux.Handle("POST /api/v1/transactions/batch", a(h.BatchTransactions))
+	mux.Handle("POST /api/v1/transactions/tags", a(h.ManageTags))
+	mux.Handle("POST /api/v1/transactions/category", a(h.ManageCategory))
+	mux.Handle("POST /api/v1/transactions/{id}/photos", a(h.AttachPhoto))
+	mux.Handle("POST /api/v1/transactions/{id}/merge", a(h.MergeTransaction))
+	mux.Handle("DELETE /api/v1/photos", a(h.DeletePhotoByPath))
+	mux.Handle("GET /api/v1/transactions/{id}/comments", a(h.ListComments))
+	mux.Handle("POST /api/v1/transactions/{id}/comments", a(h.AddComment))
+	mux.Handle("DELETE /api/v1/transactions/{id}/comments/{commentId}", a(h.DeleteComment))
+
+	mux.Handle("POST /api/v1/imports/preview", a(h.PreviewImport))
+	mux.Handle("POST /api/v1/imports/commit", a(h.CommitImport))
+	mux.Handle("GET /api/v1/imports", a(h.ListImportBatches))
+	mux.Handle("GET /api/v1/imports/{id}", a(h.GetImportBatch))
+	mux.Handle("GET /api/v1/imports/{id}/transactions", a(h.ListImportBatchTransactions))
+	mux.Handle("POST /api/v1/imports/{id}/rollback", a(h.RollbackImportBatch))
+
+	mux.Handle("POST /api/v1/undo/{token}", a(h.Undo))
+
+	mux.Handle("GET /api/v1/categories", a(h.GetCategories))
+	mux.Handle("POST /api/v1/categories", a(h.CreateCategory))
+	mux.Handle("GET /api/v1/categories/{id}", a(h.GetCategoryByID))
+	mux.Handle("PATCH /api/v1/categories/{id}", a(h.PatchCategory))
+	mux.Handle("DELETE /api/v1/categories/{id}", a(h.DeleteCategory))
+	mux.Handle("POST /api/v1/categories/{id}/merge", a(h.MergeCategory))
+	mux.Handle("GET /api/v1/merchants", a(h.GetMerchants))
+	mux.Handle("POST /api/v1/merchants", a(h.CreateMerchant))
+	mux.Handle("GET /api/v1/merchants/suggest", a(h.SuggestMerchants))
+	mux.Handle("PATCH /api/v1/merchants/{id}", a(h.PatchMerchant))
+	mux.Handle("DELETE /api/v1/merchants/{id}", a(h.DeleteMerchant))
+	mux.Handle("POST /api/v1/merchants/{id}/merge", a(h.MergeMerchant))
+	mux.Handle("GET /api/v1/rules", a(h.GetRules))
+	mux.Handle("PUT /api/v1/rules", a(h.PutRules))
+	mux.Handle("GET /api/v1/mcc", a(h.GetMCC))
+	mux.Handle("PUT /api/v1/mcc", a(h.PutMCC))
+	mux.Handle("POST /api/v1/rules/reapply", a(h.ReapplyRules))
+
+	mux.Handle("GET /api/v1/sharing/tokens", a(h.GetSharingTokens))
+	mux.Handle("POST /api/v1/sharing/tokens", a(h.GenerateSharingToken))
+	mux.Handle("POST /api/v1/sharing/tokens/revoke", a(h.RevokeSharingToken))
+	mux.Handle("GET /api/v1/sharing/connections", a(h.GetSharingConnections))
+	mux.Handle("POST /api/v1/sharing/connections", a(h.AddSharingConnection))
+	mux.Handle("GET /api/v1/sharing/subscriptions", a(h.GetSubscriptions))
+	mux.Handle("POST /api/v1/sharing/unsubscribe", a(h.Unsubscribe))
+
+	mux.Handle("GET /api/v1/settings", a(h.GetSettings))
+	mux.Handle("POST /api/v1/settings", a(h.UpdateSetting))
+	mux.Handle("GET /api/v1/currency", a(h.GetBaseCurrency))
+	mux.Handle("POST /api/v1/currency", a(h.UpdateBaseCurrency))
+	mux.Handle("GET /api/v1/totals", a(h.GetTotals))
+	mux.Handle("GET /api/v1/reports", a(h.GetReport))
+	mux.Handle("GET /api/v1/forecast", a(h.GetForecast))
+	mux.Handle("GET /api/v1/balances", a(h.GetAccountBalances))
+	mux.Handle("PUT /api/v1/balances", a(h.PutAccountBalance))
+	mux.Handle("DELETE /api/v1/balances/{account}", a(h.DeleteAccountBalance))
+	mux.Handle("GET /api/v1/scheduled", a(h.ListScheduledItems))
+	mux.Handle("POST /api/v1/scheduled", a(h.CreateScheduledItem))
+	mux.Handle("PATCH /api/v1/scheduled/{id}", a(h.PatchScheduledItem))
+	mux.Handle("DELETE /api/v1/scheduled/{id}", a(h.DeleteScheduledItem))
+	mux.Handle("GET /api/v1/snapshots", a(h.ListSnapshots))
+	mux.Handle("POST /api/v1/snapshots", a(h.CreateSnapshot))
+	mux.Handle("POST /api/v1/snapshots/compute", a(h.ComputeSnapshots))
+	mux.Handle("DELETE /api/v1/snapshots/{id}", a(h.DeleteSnapshot))
+	mux.Handle("GET /api/v1/networth", a(h.GetNetWorth))
+	mux.Handle("GET /api/v1/alerts", a(h.ListAlerts))
+	mux.Handle("POST /api/v1/alerts/{id}/acknowledge", a(h.AcknowledgeAlert))
+	mux.Handle("POST /api/v1/alerts/{id}/dismiss", a(h.DismissAlert))
+
+	mux.Handle(apiV1Prefix, v1Fallback(mux.ServeMux))
+}
+
+var probeMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// v1Fallback answers requests that no /api/v1 route matched. If the
+// path exists under another method it replies 405 with Allow, else 404.
+func v1Fallback(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var allow []string
+		for _, m := range probeMethods {
+			probe := r.Clone(r.Context())
+			probe.Method = m
+			if _, pattern := mux.Handler(probe); pattern != "" && pattern != apiV1Prefix {
+				allow = append(allow, m)
+			}
+		}
+		if len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeError(w, r, "No such endpoint", http.StatusNotFound)
+	})
+}
+
+// deprecated marks a legacy route's responses with the route that
+// replaces it.
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// pathID parses a positive integer path value. On failure it has
+// already written a 400 and returns false.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (uint64, bool) {
+	id, err := strconv.ParseUint(r.PathValue(name), 10, 64)
+	if err != nil || id == 0 {
+		writeError(w, r, "Invalid "+name, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
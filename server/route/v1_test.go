@@ -0,0 +1,137 @@
+package route
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"code.sirenko.ca/transaction/store"
+)
+
+// newTestMux returns the full mux over a fresh store and a bearer
+// token for a user in it.
+func newTestMux(t *testing.T) (*store.Store, http.Handler, string) {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	u := &store.User{Username: "alice", HashPassword: "x", PersonName: "Alice"}
+	if err := s.CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateSession(&store.Session{Code: "tok", UserID: u.ID}); err != nil {
+		t.Fatal(err)
+	}
+	return s, NewWithStore(s).GetMux(), "tok"
+}
+
+func do(mux http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json (body %q)", ct, rec.Body.String())
+	}
+	var env errorEnvelope
+	if err := json.NewDecoder(rec.Body).Decode(&env); err != nil {
+		t.Fatal(err)
+	}
+	return env.Error
+}
+
+func TestV1ErrorsAreJSON(t *testing.T) {
+	_, mux, token := newTestMux(t)
+
+	rec := do(mux, "GET", "/api/v1/transactions", "", "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no token: status %d", rec.Code)
+	}
+	if e := decodeError(t, rec); e.Code != CodeUnauthorized {
+		t.Fatalf("code = %q", e.Code)
+	}
+
+	rec = do(mux, "GET", "/api/v1/nope", token, "")
+	if rec.Code != http.StatusNotFound || decodeError(t, rec).Code != CodeNotFound {
+		t.Fatalf("unknown route: status %d", rec.Code)
+	}
+
+	rec = do(mux, "PUT", "/api/v1/transactions/1", token, "{}")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("PUT: status %d", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, PATCH, DELETE" {
+		t.Fatalf("Allow = %q", allow)
+	}
+	if decodeError(t, rec).Code != CodeMethodNotAllowed {
+		t.Fatal("want method_not_allowed")
+	}
+
+	rec = do(mux, "DELETE", "/api/v1/transactions/abc", token, "")
+	if rec.Code != http.StatusBadRequest || decodeError(t, rec).Code != CodeBadRequest {
+		t.Fatalf("bad id: status %d", rec.Code)
+	}
+}
+
+func TestV1Validation(t *testing.T) {
+	_, mux, token := newTestMux(t)
+
+	rec := do(mux, "POST", "/api/v1/transactions", token,
+		`[{"amount":1,"occurredAt":"yesterday","kind":"gift"}]`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	e := decodeError(t, rec)
+	if e.Code != CodeValidation || e.Fields["[0].occurredAt"] == "" || e.Fields["[0].kind"] == "" {
+		t.Fatalf("got %+v", e)
+	}
+
+	// The legacy route reports the same problem as a plain 400.
+	rec = do(mux, "POST", "/api/transactions/add", token,
+		`[{"amount":1,"occurredAt":"yesterday"}]`)
+	if rec.Code != http.StatusBadRequest || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("legacy: status %d, %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestV1DeleteAndLegacyDeprecation(t *testing.T) {
+	s, mux, token := newTestMux(t)
+	u, err := s.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := &store.Transaction{UserID: u.ID, Amount: 5, Currency: "CAD", OccurredAt: time.Now(), Merchant: "Cafe"}
+	if err := s.CreateTransaction(txn); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/v1/transactions/" + strconv.FormatUint(txn.ID, 10)
+
+	if rec := do(mux, "DELETE", path, token, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(mux, "DELETE", path, token, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("second delete: status %d", rec.Code)
+	}
+
+	rec := do(mux, "GET", "/api/categories", token, "")
+	if rec.Header().Get("Deprecation") != "true" || !strings.Contains(rec.Header().Get("Link"), "/api/v1/categories") {
+		t.Fatalf("legacy headers: %v", rec.Header())
+	}
+}
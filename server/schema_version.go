@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"code.sirenko.ca/transaction/server/migrations_bbolt"
+	"code.sirenko.ca/transaction/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNewerSchema is returned at startup when the database has
+// migrations applied that this build does not know: it was last
+// migrated by a newer binary.
+var ErrNewerSchema = errors.New("database schema is newer than this build")
+
+// MigrateOptions tunes ApplyMigrationsBboltWith.
+type MigrateOptions struct {
+	// AllowDowngrade lets an older binary run against a database with
+	// unknown applied migrations. Use only after checking that those
+	// migrations are compatible (or rolling them back with cli/schema
+	// from the newer build).
+	AllowDowngrade bool
+}
+
+// Meta keys written by recordSchemaWriter.
+const (
+	metaSchemaVersion = "schema_version"
+	metaSchemaWriter  = "schema_writer"
+)
+
+// SchemaWriter identifies the binary that last migrated the database.
+type SchemaWriter struct {
+	GitCommit string    `json:"git_commit"`
+	BuildTime string    `json:"build_time"`
+	At        time.Time `json:"at"`
+}
+
+// SchemaInfo is what the meta bucket says about the database as a
+// whole, as opposed to MigrationStatus which is per migration.
+type SchemaInfo struct {
+	// Version is the newest applied migration, known to this build
+	// or not. Empty for a fresh database.
+	Version string
+	Writer  *SchemaWriter
+	// Unknown lists applied migrations this build does not have.
+	Unknown []string
+}
+
+// ReadSchemaInfo reports the recorded schema version and writer, and
+// any applied migrations missing from migrationsbbolt.All.
+func ReadSchemaInfo(s *store.Store) (SchemaInfo, error) {
+	return readSchemaInfo(s, migrationsbbolt.All)
+}
+
+func readSchemaInfo(s *store.Store, all []migrationsbbolt.Migration) (SchemaInfo, error) {
+	var info SchemaInfo
+	known := map[string]bool{}
+	for _, m := range all {
+		known[m.Version] = true
+	}
+	err := s.View(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if meta == nil {
+			return nil
+		}
+		c := meta.Cursor()
+		prefix := []byte("applied:")
+		for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+			v := strings.TrimPrefix(string(k), string(prefix))
+			if !known[v] {
+				info.Unknown = append(info.Unknown, v)
+			}
+			if v > info.Version {
+				info.Version = v
+			}
+		}
+		if raw := meta.Get([]byte(metaSchemaWriter)); raw != nil {
+			var w SchemaWriter
+			if err := json.Unmarshal(raw, &w); err != nil {
+				return fmt.Errorf("decode %s: %w", metaSchemaWriter, err)
+			}
+			info.Writer = &w
+		}
+		return nil
+	})
+	sort.Strings(info.Unknown)
+	return info, err
+}
+
+// checkSchemaNotNewer fails with ErrNewerSchema if the database has
+// applied migrations that `all` does not contain, unless the caller
+// opted into a downgrade.
+func checkSchemaNotNewer(s *store.Store, all []migrationsbbolt.Migration, opts MigrateOptions) error {
+	info, err := readSchemaInfo(s, all)
+	if err != nil {
+		return err
+	}
+	if len(info.Unknown) == 0 {
+		return nil
+	}
+	writer := "an unknown build"
+	if info.Writer != nil {
+		writer = fmt.Sprintf("build %s (%s)", info.Writer.GitCommit, info.Writer.BuildTime)
+	}
+	newest := ""
+	if len(all) > 0 {
+		newest = all[len(all)-1].Version
+	}
+	if opts.AllowDowngrade {
+		log.Printf("WARNING: running against a newer schema (%s, last written by %s); unknown migrations: %s",
+			info.Version, writer, strings.Join(info.Unknown, ", "))
+		return nil
+	}
+	return fmt.Errorf("%w: database is at %s, last written by %s, but this build (%s) only knows up to %s; unknown migrations: %s. "+
+		"Deploy the newer build, roll those migrations back with its cli/schema, or pass the downgrade override",
+		ErrNewerSchema, info.Version, writer, GitCommit, newest, strings.Join(info.Unknown, ", "))
+}
+
+// recordSchemaWriter stamps meta with the newest applied migration and
+// the identity of the running binary.
+func recordSchemaWriter(s *store.Store) error {
+	info, err := ReadSchemaInfo(s)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(SchemaWriter{GitCommit: GitCommit, BuildTime: BuildTime, At: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	return s.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte("meta"))
+		if err := meta.Put([]byte(metaSchemaVersion), []byte(info.Version)); err != nil {
+			return err
+		}
+		return meta.Put([]byte(metaSchemaWriter), buf)
+	})
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"code.sirenko.ca/transaction/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestRefusesNewerSchema(t *testing.T) {
+	s, err := store.Open(filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := ApplyMigrationsBbolt(s); err != nil {
+		t.Fatal(err)
+	}
+	info, err := ReadSchemaInfo(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Writer == nil || info.Version == "" || len(info.Unknown) != 0 {
+		t.Fatalf("after migrate: %+v", info)
+	}
+
+	// Simulate a newer build having applied a migration we don't have.
+	if err := s.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("meta")).Put([]byte("applied:999_from_the_future"), []byte("1"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyMigrationsBbolt(s); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("expected ErrNewerSchema, got %v", err)
+	}
+	if err := ApplyMigrationsBboltWith(s, MigrateOptions{AllowDowngrade: true}); err != nil {
+		t.Fatalf("override: %v", err)
+	}
+	info, _ = ReadSchemaInfo(s)
+	if info.Version != "999_from_the_future" {
+		t.Errorf("schema version = %q", info.Version)
+	}
+}
@@ -1,20 +1,7 @@
 package src
 
-import (
-	"database/sql"
-	"strings"
-	"time"
-)
-
-type Transaction struct {
-	Amount     float64   `json:"amount"`
-	Currency   string    `json:"currency"`
-	OccurredAt time.Time `json:"occurredAt"`
-	Merchant   string    `json:"merchant"`
-	Card       string    `json:"card"`
-	PersonName string    `json:"personName"`
-}
-
+// Categories are the built-in category → merchant substrings, run as
+// rules.Defaults after the user's own rules.
 var Categories = map[string][]string{
 	"mobile internet": {"KOODO AIRTIME", "KOODO MOBILE"},
 	"internet":        {"NOVUS"},
@@ -39,29 +26,70 @@ var Categories = map[string][]string{
 	"visa":            {"Ups"},
 }
 
-func GetCategory(merchant string) string {
-	for category, patterns := range Categories {
-		for _, pattern := range patterns {
-			if strings.Contains(strings.ToLower(merchant), strings.ToLower(pattern)) {
-				return category
-			}
-		}
-	}
-	return "Unknown"
-}
-
-func GetStatement(db *sql.DB) (*sql.Stmt, error) {
-	stmt, err := db.Prepare("INSERT INTO transactions(amount, currency, occurred_at, merchant, card, category, person_name) VALUES($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (merchant, occurred_at) DO UPDATE SET amount = $1, currency = $2, card = $5, category = $6, person_name = $7")
-	if err != nil {
-		return nil, err
-	}
-	return stmt, nil
-}
-
-func InsertTransaction(stmt *sql.Stmt, t Transaction) error {
-	_, err := stmt.Exec(t.Amount, t.Currency, t.OccurredAt, t.Merchant, t.Card, GetCategory(t.Merchant), t.PersonName)
-	if err != nil {
-		return err
-	}
-	return nil
+// MCCCategories are the built-in merchant category code → category
+// mappings, consulted when no rule sets a category. Keys are ISO 18245
+// codes or inclusive ranges of them (see rules.MCCTable).
+var MCCCategories = map[string]string{
+	"3000-3299": "travel",         // airlines
+	"3351-3441": "transportation", // car rental
+	"3501-3999": "hotel",
+	"4011":      "travel", // railroads
+	"4111":      "transportation",
+	"4112":      "travel", // passenger rail
+	"4121":      "transportation",
+	"4131":      "transportation",
+	"4411":      "travel", // cruise lines
+	"4511":      "travel",
+	"4722":      "travel",
+	"4784":      "transportation", // tolls
+	"4789":      "transportation",
+	"4812":      "mobile internet",
+	"4814":      "mobile internet",
+	"4816":      "internet",
+	"4899":      "internet",
+	"5200":      "home goods",
+	"5251":      "home goods",
+	"5310":      "home goods",
+	"5311":      "home goods",
+	"5331":      "home goods",
+	"5411":      "food & other",
+	"5422":      "food & other",
+	"5441":      "food & other",
+	"5451":      "food & other",
+	"5462":      "food & other",
+	"5499":      "food & other",
+	"5541":      "transportation",
+	"5542":      "transportation",
+	"5611":      "clothes",
+	"5621":      "clothes",
+	"5651":      "clothes",
+	"5661":      "clothes",
+	"5691":      "clothes",
+	"5699":      "clothes",
+	"5712":      "home goods",
+	"5719":      "home goods",
+	"5811":      "takeouts",
+	"5812":      "takeouts",
+	"5813":      "takeouts",
+	"5814":      "takeouts",
+	"5815":      "film",
+	"5912":      "london drugs",
+	"5921":      "food & other",
+	"5942":      "home goods",
+	"5945":      "presents",
+	"5947":      "presents",
+	"5992":      "home goods",
+	"7011":      "hotel",
+	"7230":      "haircut",
+	"7523":      "transportation",
+	"7832":      "events",
+	"7922":      "events",
+	"7929":      "events",
+	"7991":      "events",
+	"8011":      "health",
+	"8021":      "health",
+	"8042":      "health",
+	"8062":      "health",
+	"8099":      "health",
+	"8398":      "donations",
 }
@@ -0,0 +1,31 @@
+package src
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// MerchantWords splits a merchant name into lowercase words, dropping
+// digits and punctuation.
+func MerchantWords(m string) []string {
+	return strings.FieldsFunc(strings.ToLower(m), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+// NormalizeMerchant is MerchantWords joined by spaces, so spellings
+// that differ only in case, digits or punctuation ("NETFLIX.COM 8341",
+// "Netflix.com") compare equal.
+func NormalizeMerchant(m string) string {
+	return strings.Join(MerchantWords(m), " ")
+}
+
+// RoundCents rounds v to two decimals, never returning -0.
+func RoundCents(v float64) float64 {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,24 @@
+package src
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeMerchant(t *testing.T) {
+	if a, b := NormalizeMerchant("NETFLIX.COM 8341"), NormalizeMerchant("Netflix.com"); a != "netflix com" || a != b {
+		t.Errorf("got %q, %q", a, b)
+	}
+	if got := NormalizeMerchant("#1234"); got != "" {
+		t.Errorf("digits only = %q", got)
+	}
+}
+
+func TestRoundCents(t *testing.T) {
+	if got := RoundCents(2.345); got != 2.35 {
+		t.Errorf("RoundCents(2.345) = %v", got)
+	}
+	if got := RoundCents(-0.001); got != 0 || math.Signbit(got) {
+		t.Errorf("RoundCents(-0.001) = %v", got)
+	}
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Alert states. New alerts are open; acknowledging keeps an alert on
+// record as seen, dismissing marks it a false alarm.
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertDismissed    = "dismissed"
+)
+
+// Alert flags one transaction, see package alerts for the kinds.
+// RelatedID is the other transaction of a duplicate charge.
+type Alert struct {
+	ID            uint64     `json:"id"`
+	UserID        uint64     `json:"user_id"`
+	TransactionID uint64     `json:"transaction_id"`
+	Kind          string     `json:"kind"`
+	Score         float64    `json:"score"`
+	Reason        string     `json:"reason"`
+	RelatedID     uint64     `json:"related_id,omitempty"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+// alertKey is the key of both indexes: alerts_by_user is
+// itob(user_id) | itob(id) and alerts_by_txn itob(transaction_id) |
+// itob(id).
+func alertKey(owner, id uint64) []byte {
+	return append(itob(owner), itob(id)...)
+}
+
+func putAlertTx(tx *bolt.Tx, a *Alert) error {
+	buf, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("alerts")).Put(itob(a.ID), buf)
+}
+
+func getAlertTx(tx *bolt.Tx, id uint64) (*Alert, error) {
+	raw := tx.Bucket([]byte("alerts")).Get(itob(id))
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	var a Alert
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// CreateAlert stores a, assigning a.ID and, if unset, a.Status and
+// a.CreatedAt. Returns ErrNotFound if the transaction does not exist.
+func (s *Store) CreateAlert(a *Alert) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("transactions")).Get(itob(a.TransactionID)) == nil {
+			return ErrNotFound
+		}
+		id, err := tx.Bucket([]byte("seq_alerts")).NextSequence()
+		if err != nil {
+			return err
+		}
+		a.ID = id
+		if a.Status == "" {
+			a.Status = AlertOpen
+		}
+		if a.CreatedAt.IsZero() {
+			a.CreatedAt = time.Now()
+		}
+		if err := putAlertTx(tx, a); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte("alerts_by_user")).Put(alertKey(a.UserID, a.ID), nil); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("alerts_by_txn")).Put(alertKey(a.TransactionID, a.ID), nil)
+	})
+}
+
+// GetAlert returns the alert with id, or ErrNotFound.
+func (s *Store) GetAlert(id uint64) (*Alert, error) {
+	var a *Alert
+	err := s.View(func(tx *bolt.Tx) error {
+		var err error
+		a, err = getAlertTx(tx, id)
+		return err
+	})
+	return a, err
+}
+
+// ListAlerts returns userID's alerts, newest first.
+func (s *Store) ListAlerts(userID uint64) ([]Alert, error) {
+	var out []Alert
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("alerts_by_user")).Cursor()
+		prefix := itob(userID)
+		k, _ := c.Seek(itob(userID + 1))
+		if k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+		for ; k != nil && hasPrefix(k, prefix); k, _ = c.Prev() {
+			a, err := getAlertTx(tx, btoi(k[8:]))
+			if err != nil {
+				return err
+			}
+			out = append(out, *a)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// ListAlertsForTransaction returns txnID's alerts in creation order.
+func (s *Store) ListAlertsForTransaction(txnID uint64) ([]Alert, error) {
+	var out []Alert
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("alerts_by_txn")).Cursor()
+		prefix := itob(txnID)
+		for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+			a, err := getAlertTx(tx, btoi(k[8:]))
+			if err != nil {
+				return err
+			}
+			out = append(out, *a)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// SetAlertStatus changes the alert's status, setting ResolvedAt when
+// it leaves AlertOpen and clearing it when it is reopened. Returns the
+// updated alert, or ErrNotFound.
+func (s *Store) SetAlertStatus(id uint64, status string) (*Alert, error) {
+	var a *Alert
+	err := s.Update(func(tx *bolt.Tx) error {
+		var err error
+		if a, err = getAlertTx(tx, id); err != nil {
+			return err
+		}
+		if a.Status != status {
+			a.Status, a.ResolvedAt = status, nil
+			if status != AlertOpen {
+				now := time.Now()
+				a.ResolvedAt = &now
+			}
+		}
+		return putAlertTx(tx, a)
+	})
+	return a, err
+}
+
+// restoreAlertTx puts back a, a snapshot of an alert, unless an alert
+// with its ID is still stored.
+func restoreAlertTx(tx *bolt.Tx, a *Alert) error {
+	if tx.Bucket([]byte("alerts")).Get(itob(a.ID)) != nil {
+		return nil
+	}
+	if err := putAlertTx(tx, a); err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("alerts_by_user")).Put(alertKey(a.UserID, a.ID), nil); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("alerts_by_txn")).Put(alertKey(a.TransactionID, a.ID), nil)
+}
+
+// deleteAlertsTx drops txnID's alerts. Used by the DeleteTransaction
+// cascade.
+func deleteAlertsTx(tx *bolt.Tx, txnID uint64) error {
+	c := tx.Bucket([]byte("alerts_by_txn")).Cursor()
+	prefix := itob(txnID)
+	for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+		a, err := getAlertTx(tx, btoi(k[8:]))
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte("alerts_by_user")).Delete(alertKey(a.UserID, a.ID)); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte("alerts")).Delete(itob(a.ID)); err != nil {
+			return err
+		}
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
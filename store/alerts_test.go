@@ -0,0 +1,62 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlerts(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	add := func(userID uint64) *Transaction {
+		t.Helper()
+		tx := &Transaction{UserID: userID, Amount: 1, Merchant: "m", OccurredAt: time.Now()}
+		if err := s.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	t1, t2, t3 := add(a.ID), add(a.ID), add(b.ID)
+	for _, al := range []*Alert{
+		{UserID: a.ID, TransactionID: t1.ID, Kind: "duplicate_charge"},
+		{UserID: b.ID, TransactionID: t3.ID, Kind: "new_merchant"},
+		{UserID: a.ID, TransactionID: t2.ID, Kind: "merchant_outlier"},
+	} {
+		if err := s.CreateAlert(al); err != nil {
+			t.Fatal(err)
+		}
+		if al.Status != AlertOpen {
+			t.Errorf("status = %q", al.Status)
+		}
+	}
+	if err := s.CreateAlert(&Alert{UserID: a.ID, TransactionID: 999}); err != ErrNotFound {
+		t.Errorf("alert on a missing transaction: %v", err)
+	}
+
+	list, err := s.ListAlerts(a.ID)
+	if err != nil || len(list) != 2 || list[0].TransactionID != t2.ID || list[1].TransactionID != t1.ID {
+		t.Fatalf("list = %+v %v", list, err)
+	}
+	if bobs, _ := s.ListAlerts(b.ID); len(bobs) != 1 {
+		t.Errorf("bob's alerts = %+v", bobs)
+	}
+
+	got, err := s.SetAlertStatus(list[0].ID, AlertDismissed)
+	if err != nil || got.Status != AlertDismissed || got.ResolvedAt == nil {
+		t.Fatalf("dismiss = %+v %v", got, err)
+	}
+	if got, _ = s.SetAlertStatus(list[0].ID, AlertOpen); got.ResolvedAt != nil {
+		t.Errorf("reopened alert still resolved: %+v", got)
+	}
+
+	if _, err := s.DeleteTransaction(t1.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetAlert(list[1].ID); err != ErrNotFound {
+		t.Errorf("alert survived its transaction: %v", err)
+	}
+	if left, _ := s.ListAlerts(a.ID); len(left) != 1 {
+		t.Errorf("after delete = %+v", left)
+	}
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// AccountBalance is a user-entered balance of one account on a date.
+// Accounts are the Card names transactions carry. Transactions on the
+// account after AsOf move the balance on from there, so it only needs
+// re-entering when it drifts.
+type AccountBalance struct {
+	UserID   uint64    `json:"user_id"`
+	Account  string    `json:"account"`
+	Balance  float64   `json:"balance"`
+	Currency string    `json:"currency"`
+	AsOf     time.Time `json:"as_of"`
+}
+
+// balanceKey is the account_balances key:
+// itob(user_id) | lower(account).
+func balanceKey(userID uint64, account string) []byte {
+	return append(itob(userID), strings.ToLower(account)...)
+}
+
+// PutAccountBalance stores b, replacing the balance of the same account
+// (compared case-insensitively).
+func (s *Store) PutAccountBalance(b *AccountBalance) error {
+	buf, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return s.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("account_balances")).Put(balanceKey(b.UserID, b.Account), buf)
+	})
+}
+
+// ListAccountBalances returns userID's balances in case-insensitive
+// account order.
+func (s *Store) ListAccountBalances(userID uint64) ([]AccountBalance, error) {
+	var out []AccountBalance
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("account_balances")).Cursor()
+		prefix := itob(userID)
+		for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+			var b AccountBalance
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+			out = append(out, b)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// DeleteAccountBalance removes the balance of account, or returns
+// ErrNotFound.
+func (s *Store) DeleteAccountBalance(userID uint64, account string) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("account_balances"))
+		if b.Get(balanceKey(userID, account)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete(balanceKey(userID, account))
+	})
+}
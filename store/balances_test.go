@@ -0,0 +1,41 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAccountBalances(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, ab := range []*AccountBalance{
+		{UserID: a.ID, Account: "Visa", Balance: -200, Currency: "CAD", AsOf: day},
+		{UserID: a.ID, Account: "Chequing", Balance: 1500, Currency: "CAD", AsOf: day},
+		{UserID: a.ID, Account: "visa", Balance: -250, Currency: "CAD", AsOf: day.AddDate(0, 0, 1)},
+		{UserID: b.ID, Account: "Visa", Balance: 10, Currency: "USD", AsOf: day},
+	} {
+		if err := s.PutAccountBalance(ab); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := s.ListAccountBalances(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Account != "Chequing" || got[1].Balance != -250 || !got[1].AsOf.Equal(day.AddDate(0, 0, 1)) {
+		t.Fatalf("balances = %+v, want the second Visa entry to replace the first", got)
+	}
+
+	if err := s.DeleteAccountBalance(a.ID, "VISA"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAccountBalance(a.ID, "visa"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second delete = %v", err)
+	}
+	if got, _ := s.ListAccountBalances(b.ID); len(got) != 1 {
+		t.Fatalf("bob's balances = %+v", got)
+	}
+}
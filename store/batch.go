@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Batch actions, see BatchOp.
+const (
+	BatchUpdate      = "update"
+	BatchAddTag      = "add_tag"
+	BatchRemoveTag   = "remove_tag"
+	BatchSetCategory = "set_category"
+	BatchDelete      = "delete"
+)
+
+// ErrBatchFailed is returned by ApplyBatch when at least one operation
+// failed and the batch was rolled back; the per-operation errors say
+// which.
+var ErrBatchFailed = errors.New("store: batch rolled back")
+
+// BatchOp is one step of ApplyBatch.
+type BatchOp struct {
+	Action        string
+	TransactionID uint64
+	// Tag is the tag name for BatchAddTag and BatchRemoveTag.
+	Tag string
+	// Category is the new category for BatchSetCategory.
+	Category string
+	// Update edits the transaction in place for BatchUpdate.
+	Update func(*Transaction)
+}
+
+// ApplyBatch runs ops in order inside one write transaction. authorize
+// is called with each op and the transaction it targets (as left by
+// earlier ops) and may veto it by returning an error; it runs inside the
+// write transaction, so it must not call back into the store.
+//
+// The returned slice has one entry per op: nil for success, or why the
+// op failed (ErrNotFound, ErrInvalidRefund, an authorize error, ...).
+// Every op is attempted so all failures are reported; if any failed,
+// nothing is written and ApplyBatch returns ErrBatchFailed.
+func (s *Store) ApplyBatch(ops []BatchOp, authorize func(op *BatchOp, t *Transaction) error) ([]error, error) {
+	results := make([]error, len(ops))
+	err := s.Update(func(tx *bolt.Tx) error {
+		failed := false
+		for i := range ops {
+			opErr, err := applyBatchOpTx(tx, &ops[i], authorize)
+			if err != nil {
+				return fmt.Errorf("op %d: %w", i, err)
+			}
+			results[i] = opErr
+			failed = failed || opErr != nil
+		}
+		if failed {
+			return ErrBatchFailed
+		}
+		return nil
+	})
+	return results, err
+}
+
+// applyBatchOpTx returns the op's own failure as opErr; err is reserved
+// for storage errors that abort the whole batch.
+func applyBatchOpTx(tx *bolt.Tx, op *BatchOp, authorize func(*BatchOp, *Transaction) error) (opErr, err error) {
+	raw := tx.Bucket([]byte("transactions")).Get(itob(op.TransactionID))
+	if raw == nil {
+		return ErrNotFound, nil
+	}
+	var t Transaction
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	if err := authorize(op, &t); err != nil {
+		return err, nil
+	}
+
+	switch op.Action {
+	case BatchUpdate, BatchSetCategory:
+		if op.Action == BatchSetCategory {
+			t.Category = op.Category
+		} else if op.Update != nil {
+			op.Update(&t)
+		}
+		if !ValidKind(t.Kind) {
+			return fmt.Errorf("unknown transaction kind %q", t.Kind), nil
+		}
+		if err := checkRefundTx(tx, &t); err != nil {
+			if errors.Is(err, ErrInvalidRefund) {
+				return err, nil
+			}
+			if errors.Is(err, ErrNotFound) {
+				// The target may be deleted earlier in the batch.
+				return fmt.Errorf("refund of missing transaction %d: %w", t.RefundOf, ErrInvalidRefund), nil
+			}
+			return nil, err
+		}
+		return nil, updateTransactionTx(tx, &t)
+	case BatchAddTag:
+		if op.Tag == "" {
+			return errors.New("tag is required"), nil
+		}
+		tag, err := getOrCreateTagTx(tx, op.Tag)
+		if err != nil {
+			return nil, err
+		}
+		return nil, tx.Bucket([]byte("txn_tags")).Put(append(itob(t.ID), itob(tag.ID)...), []byte{})
+	case BatchRemoveTag:
+		raw := tx.Bucket([]byte("tags")).Get([]byte(op.Tag))
+		if raw == nil {
+			return nil, nil // never existed, so not on this transaction
+		}
+		var tag Tag
+		if err := json.Unmarshal(raw, &tag); err != nil {
+			return nil, err
+		}
+		return nil, tx.Bucket([]byte("txn_tags")).Delete(append(itob(t.ID), itob(tag.ID)...))
+	case BatchDelete:
+		return nil, deleteTransactionTx(tx, &t)
+	}
+	return fmt.Errorf("unknown action %q", op.Action), nil
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApplyBatch(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	mk := func(merchant string) *Transaction {
+		txn := &Transaction{UserID: u.ID, Amount: 10, Currency: "CAD", Merchant: merchant, OccurredAt: time.Now()}
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+		return txn
+	}
+	a, b := mk("A"), mk("B")
+	allow := func(*BatchOp, *Transaction) error { return nil }
+
+	ops := []BatchOp{
+		{Action: BatchUpdate, TransactionID: a.ID, Update: func(t *Transaction) { t.Merchant = "A2" }},
+		{Action: BatchAddTag, TransactionID: a.ID, Tag: "trip"},
+		{Action: BatchSetCategory, TransactionID: a.ID, Category: "Food"},
+		{Action: BatchDelete, TransactionID: b.ID},
+	}
+	results, err := s.ApplyBatch(ops, allow)
+	if err != nil {
+		t.Fatalf("%v %v", err, results)
+	}
+	got, _ := s.GetTransaction(a.ID)
+	if got.Merchant != "A2" || got.Category != "Food" {
+		t.Fatalf("got %+v", got)
+	}
+	if tags, _ := s.ListTagsForTransaction(a.ID); len(tags) != 1 || tags[0] != "trip" {
+		t.Fatalf("tags %v", tags)
+	}
+	if _, err := s.GetTransaction(b.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatal("b should be deleted")
+	}
+
+	// One bad op rolls everything back and every failure is reported.
+	denied := errors.New("denied")
+	results, err = s.ApplyBatch([]BatchOp{
+		{Action: BatchSetCategory, TransactionID: a.ID, Category: "Travel"},
+		{Action: BatchRemoveTag, TransactionID: a.ID, Tag: "trip"},
+		{Action: BatchDelete, TransactionID: b.ID},
+		{Action: BatchDelete, TransactionID: a.ID},
+	}, func(op *BatchOp, _ *Transaction) error {
+		if op.Action == BatchDelete {
+			return denied
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrBatchFailed) {
+		t.Fatalf("err = %v", err)
+	}
+	if results[0] != nil || results[1] != nil || !errors.Is(results[2], ErrNotFound) || !errors.Is(results[3], denied) {
+		t.Fatalf("results %v", results)
+	}
+	got, _ = s.GetTransaction(a.ID)
+	if got.Category != "Food" {
+		t.Fatalf("category changed to %q despite rollback", got.Category)
+	}
+	if tags, _ := s.ListTagsForTransaction(a.ID); len(tags) != 1 {
+		t.Fatalf("tag removed despite rollback: %v", tags)
+	}
+}
+
+func TestApplyBatchRefundOfDeleted(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	orig := &Transaction{UserID: u.ID, Amount: 10, Currency: "CAD", Merchant: "Shop", OccurredAt: time.Now()}
+	refund := &Transaction{UserID: u.ID, Amount: 10, Currency: "CAD", Merchant: "Shop", OccurredAt: time.Now(), Kind: KindRefund}
+	for _, txn := range []*Transaction{orig, refund} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := s.ApplyBatch([]BatchOp{
+		{Action: BatchDelete, TransactionID: orig.ID},
+		{Action: BatchUpdate, TransactionID: refund.ID, Update: func(t *Transaction) { t.RefundOf = orig.ID }},
+	}, func(*BatchOp, *Transaction) error { return nil })
+	if !errors.Is(err, ErrBatchFailed) {
+		t.Fatalf("err = %v", err)
+	}
+	if results[0] != nil || !errors.Is(results[1], ErrInvalidRefund) {
+		t.Fatalf("results %v", results)
+	}
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrCategoryExists is returned when a category name is already taken
+// by another of the owner's categories. Names compare case-
+// insensitively.
+var ErrCategoryExists = errors.New("store: category already exists")
+
+// Category is an entry of a user's category catalog. Transactions
+// refer to categories by name, so renaming or merging one rewrites
+// Transaction.Category on the owner's transactions.
+type Category struct {
+	ID      uint64 `json:"id"`
+	OwnerID uint64 `json:"owner_id"`
+	Name    string `json:"name"`
+	// Parent is the name of the group the category rolls up into in
+	// reports, the role subgroup_map used to play. Empty for top-level
+	// categories.
+	Parent string `json:"parent,omitempty"`
+	Color  string `json:"color,omitempty"`
+	Icon   string `json:"icon,omitempty"`
+	// Archived categories are hidden from pickers but stay on the
+	// transactions that use them.
+	Archived  bool      `json:"archived,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// categoryKey is the categories_by_owner key:
+// itob(owner_id) | lower(name). A prefix scan lists an owner's catalog
+// in name order.
+func categoryKey(ownerID uint64, name string) []byte {
+	return append(itob(ownerID), strings.ToLower(name)...)
+}
+
+func putCategoryTx(tx *bolt.Tx, c *Category) error {
+	buf, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("categories")).Put(itob(c.ID), buf)
+}
+
+func getCategoryTx(tx *bolt.Tx, id uint64) (*Category, error) {
+	raw := tx.Bucket([]byte("categories")).Get(itob(id))
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	var c Category
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func createCategoryTx(tx *bolt.Tx, c *Category) error {
+	idx := tx.Bucket([]byte("categories_by_owner"))
+	if idx.Get(categoryKey(c.OwnerID, c.Name)) != nil {
+		return ErrCategoryExists
+	}
+	id, err := tx.Bucket([]byte("seq_categories")).NextSequence()
+	if err != nil {
+		return err
+	}
+	c.ID = id
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+	if err := putCategoryTx(tx, c); err != nil {
+		return err
+	}
+	return idx.Put(categoryKey(c.OwnerID, c.Name), itob(c.ID))
+}
+
+// ensureCategoryTx adds name to ownerID's catalog unless it is empty
+// or already there, so every category in use has an entry.
+func ensureCategoryTx(tx *bolt.Tx, ownerID uint64, name string) error {
+	if name == "" || tx.Bucket([]byte("categories_by_owner")).Get(categoryKey(ownerID, name)) != nil {
+		return nil
+	}
+	return createCategoryTx(tx, &Category{OwnerID: ownerID, Name: name})
+}
+
+// CreateCategory stores c, assigning c.ID and, if unset, c.CreatedAt.
+func (s *Store) CreateCategory(c *Category) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		return createCategoryTx(tx, c)
+	})
+}
+
+// GetCategory returns the category with id, or ErrNotFound.
+func (s *Store) GetCategory(id uint64) (*Category, error) {
+	var c *Category
+	err := s.View(func(tx *bolt.Tx) error {
+		var err error
+		c, err = getCategoryTx(tx, id)
+		return err
+	})
+	return c, err
+}
+
+// ListCategories returns ownerID's catalog in case-insensitive name
+// order.
+func (s *Store) ListCategories(ownerID uint64) ([]Category, error) {
+	var out []Category
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("categories_by_owner")).Cursor()
+		prefix := itob(ownerID)
+		for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+			cat, err := getCategoryTx(tx, btoi(v))
+			if err != nil {
+				return err
+			}
+			out = append(out, *cat)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// UpdateCategory overwrites the stored category with c. If the name
+// changed, the owner's transactions in the old category move to the
+// new name in the same write; it returns how many did. The owner
+// cannot change.
+func (s *Store) UpdateCategory(c *Category) (int, error) {
+	n := 0
+	err := s.Update(func(tx *bolt.Tx) error {
+		old, err := getCategoryTx(tx, c.ID)
+		if err != nil {
+			return err
+		}
+		c.OwnerID, c.CreatedAt = old.OwnerID, old.CreatedAt
+		if !strings.EqualFold(old.Name, c.Name) {
+			idx := tx.Bucket([]byte("categories_by_owner"))
+			if idx.Get(categoryKey(c.OwnerID, c.Name)) != nil {
+				return ErrCategoryExists
+			}
+			if err := idx.Delete(categoryKey(old.OwnerID, old.Name)); err != nil {
+				return err
+			}
+			if err := idx.Put(categoryKey(c.OwnerID, c.Name), itob(c.ID)); err != nil {
+				return err
+			}
+		}
+		if old.Name != c.Name {
+			if n, err = recategorizeTx(tx, c.OwnerID, old.Name, c.Name); err != nil {
+				return err
+			}
+		}
+		return putCategoryTx(tx, c)
+	})
+	return n, err
+}
+
+// MergeCategory moves the owner's transactions in category fromID to
+// category intoID and deletes fromID, in one write. Both must belong to
+// the same owner. It returns how many transactions moved.
+func (s *Store) MergeCategory(fromID, intoID uint64) (int, error) {
+	n := 0
+	err := s.Update(func(tx *bolt.Tx) error {
+		from, err := getCategoryTx(tx, fromID)
+		if err != nil {
+			return err
+		}
+		into, err := getCategoryTx(tx, intoID)
+		if err != nil {
+			return err
+		}
+		if from.OwnerID != into.OwnerID || from.ID == into.ID {
+			return ErrNotFound
+		}
+		if n, err = recategorizeTx(tx, from.OwnerID, from.Name, into.Name); err != nil {
+			return err
+		}
+		return deleteCategoryTx(tx, from)
+	})
+	return n, err
+}
+
+// DeleteCategory removes a category from the catalog. Transactions
+// keep the name; archive a category instead to hide it but keep it.
+func (s *Store) DeleteCategory(id uint64) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		c, err := getCategoryTx(tx, id)
+		if err != nil {
+			return err
+		}
+		return deleteCategoryTx(tx, c)
+	})
+}
+
+func deleteCategoryTx(tx *bolt.Tx, c *Category) error {
+	if err := tx.Bucket([]byte("categories_by_owner")).Delete(categoryKey(c.OwnerID, c.Name)); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("categories")).Delete(itob(c.ID))
+}
+
+// recategorizeTx sets Category to `to` on each of ownerID's
+// transactions whose category equals `from`, ignoring case. The
+// category is not indexed, so only the records change.
+func recategorizeTx(tx *bolt.Tx, ownerID uint64, from, to string) (int, error) {
+	txns := tx.Bucket([]byte("transactions"))
+	c := tx.Bucket([]byte("txn_by_user_time")).Cursor()
+	prefix := itob(ownerID)
+	n := 0
+	for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+		raw := txns.Get(v)
+		if raw == nil {
+			continue
+		}
+		var t Transaction
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return n, err
+		}
+		if !strings.EqualFold(t.Category, from) {
+			continue
+		}
+		t.Category = to
+		buf, err := json.Marshal(&t)
+		if err != nil {
+			return n, err
+		}
+		if err := txns.Put(itob(t.ID), buf); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
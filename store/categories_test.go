@@ -0,0 +1,68 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCategoryCatalog(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	add := func(userID uint64, category string) *Transaction {
+		t.Helper()
+		tx := &Transaction{UserID: userID, Amount: 1, Merchant: "m", Category: category, OccurredAt: time.Now()}
+		if err := s.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	food := add(a.ID, "food")
+	add(a.ID, "Food")
+	add(b.ID, "food")
+	eats := add(a.ID, "eats")
+
+	cats, err := s.ListCategories(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cats) != 2 || cats[0].Name != "eats" || cats[1].Name != "food" {
+		t.Fatalf("inserts should fill the catalog: %+v", cats)
+	}
+	if err := s.CreateCategory(&Category{OwnerID: a.ID, Name: "FOOD"}); err != ErrCategoryExists {
+		t.Errorf("expected ErrCategoryExists, got %v", err)
+	}
+
+	// Renaming rewrites alice's transactions in any case, not bob's.
+	c := cats[1]
+	c.Name, c.Color = "groceries", "#0a0"
+	n, err := s.UpdateCategory(&c)
+	if err != nil || n != 2 {
+		t.Fatalf("rename: n=%d err=%v", n, err)
+	}
+	if got, _ := s.GetTransaction(food.ID); got.Category != "groceries" {
+		t.Errorf("category = %q", got.Category)
+	}
+	if bobs, _ := s.ListTransactionsForUser(b.ID); bobs[0].Category != "food" {
+		t.Errorf("bob's category = %q", bobs[0].Category)
+	}
+	c.Name = "eats"
+	if _, err := s.UpdateCategory(&c); err != ErrCategoryExists {
+		t.Errorf("rename onto a taken name: %v", err)
+	}
+
+	n, err = s.MergeCategory(cats[0].ID, c.ID)
+	if err != nil || n != 1 {
+		t.Fatalf("merge: n=%d err=%v", n, err)
+	}
+	if got, _ := s.GetTransaction(eats.ID); got.Category != "groceries" {
+		t.Errorf("merged category = %q", got.Category)
+	}
+	if _, err := s.GetCategory(cats[0].ID); err != ErrNotFound {
+		t.Errorf("merged-away category still there: %v", err)
+	}
+	bobCats, _ := s.ListCategories(b.ID)
+	if _, err := s.MergeCategory(c.ID, bobCats[0].ID); err != ErrNotFound {
+		t.Errorf("cross-owner merge: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Comment is one entry in a transaction's discussion thread.
+type Comment struct {
+	ID            uint64    `json:"id"`
+	TransactionID uint64    `json:"transaction_id"`
+	AuthorID      uint64    `json:"author_id"`
+	Text          string    `json:"text"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// commentKey is the comments key: itob(transaction_id) | itob(comment_id).
+// Comment IDs are allocated from one sequence, so a prefix scan returns
+// a thread in creation order.
+func commentKey(txnID, commentID uint64) []byte {
+	return append(itob(txnID), itob(commentID)...)
+}
+
+// CreateComment appends c to its transaction's thread, assigning c.ID
+// and, if unset, c.CreatedAt. Returns ErrNotFound if the transaction
+// does not exist.
+func (s *Store) CreateComment(c *Comment) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("transactions")).Get(itob(c.TransactionID)) == nil {
+			return ErrNotFound
+		}
+		id, err := tx.Bucket([]byte("seq_comments")).NextSequence()
+		if err != nil {
+			return err
+		}
+		c.ID = id
+		if c.CreatedAt.IsZero() {
+			c.CreatedAt = time.Now()
+		}
+		buf, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("comments")).Put(commentKey(c.TransactionID, c.ID), buf)
+	})
+}
+
+// GetComment returns one comment of txnID's thread, or ErrNotFound.
+func (s *Store) GetComment(txnID, commentID uint64) (*Comment, error) {
+	var c Comment
+	err := s.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket([]byte("comments")).Get(commentKey(txnID, commentID))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, &c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListCommentsForTransaction returns the thread oldest first.
+func (s *Store) ListCommentsForTransaction(txnID uint64) ([]Comment, error) {
+	var out []Comment
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("comments")).Cursor()
+		prefix := itob(txnID)
+		for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+			var cm Comment
+			if err := json.Unmarshal(v, &cm); err != nil {
+				return err
+			}
+			out = append(out, cm)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// CountCommentsForTransaction counts the thread without decoding it.
+func (s *Store) CountCommentsForTransaction(txnID uint64) (int, error) {
+	n := 0
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("comments")).Cursor()
+		prefix := itob(txnID)
+		for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// DeleteComment removes one comment. Deleting a missing comment is a
+// no-op.
+func (s *Store) DeleteComment(txnID, commentID uint64) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("comments")).Delete(commentKey(txnID, commentID))
+	})
+}
+
+// deleteCommentsTx drops txnID's whole thread. Used by the
+// DeleteTransaction cascade.
+func deleteCommentsTx(tx *bolt.Tx, txnID uint64) error {
+	c := tx.Bucket([]byte("comments")).Cursor()
+	prefix := itob(txnID)
+	for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
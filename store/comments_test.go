@@ -0,0 +1,52 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommentsThread(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	tx := &Transaction{UserID: a.ID, Amount: 10, Currency: "CAD", Merchant: "M", OccurredAt: time.Now()}
+	if err := s.CreateTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*Comment{
+		{TransactionID: tx.ID, AuthorID: a.ID, Text: "dinner with Bob"},
+		{TransactionID: tx.ID, AuthorID: b.ID, Text: "I owe you half"},
+	} {
+		if err := s.CreateComment(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := s.ListCommentsForTransaction(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].AuthorID != a.ID || got[1].Text != "I owe you half" {
+		t.Fatalf("got %+v", got)
+	}
+	if err := s.DeleteComment(tx.ID, got[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.CountCommentsForTransaction(tx.ID); n != 1 {
+		t.Errorf("expected 1 comment after delete, got %d", n)
+	}
+
+	// Deleting the transaction drops the thread.
+	if _, err := s.DeleteTransaction(tx.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.CountCommentsForTransaction(tx.ID); n != 0 {
+		t.Errorf("expected thread gone, got %d", n)
+	}
+}
+
+func TestCreateCommentMissingTransaction(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.CreateComment(&Comment{TransactionID: 42, Text: "x"}); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
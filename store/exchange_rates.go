@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNoExchangeRate is returned by ConvertAmount when no rate on or
+// before the requested date is known for the pair, either directly,
+// inverted, or through the pivot currency.
+var ErrNoExchangeRate = errors.New("store: no exchange rate")
+
+// PivotCurrency is the currency rates are cross-computed through when
+// a pair has no direct quote. ECB reference rates are all quoted
+// against EUR, so importing an ECB file is enough to convert between
+// any two of its currencies.
+const PivotCurrency = "EUR"
+
+const rateDateLayout = "2006-01-02"
+
+// ExchangeRate records that on Date, 1 unit of Base bought Rate units
+// of Quote. Date is truncated to the day; one rate per pair per day.
+type ExchangeRate struct {
+	Base   string    `json:"base"`
+	Quote  string    `json:"quote"`
+	Date   time.Time `json:"date"`
+	Rate   float64   `json:"rate"`
+	Source string    `json:"source,omitempty"`
+}
+
+// exchangeRateKey builds the exchange_rates key. Layout:
+//
+//	BASE "/" QUOTE "|" YYYY-MM-DD
+//
+// The date is last and zero-padded so a cursor over one pair walks it
+// in chronological order.
+func exchangeRateKey(base, quote string, date time.Time) []byte {
+	return []byte(exchangeRatePrefix(base, quote) + date.UTC().Format(rateDateLayout))
+}
+
+func exchangeRatePrefix(base, quote string) string {
+	return strings.ToUpper(base) + "/" + strings.ToUpper(quote) + "|"
+}
+
+// PutExchangeRates upserts rates in a single write transaction. An
+// existing rate for the same (pair, day) is overwritten, so re-importing
+// a corrected file is safe.
+func (s *Store) PutExchangeRates(rates []ExchangeRate) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("exchange_rates"))
+		for _, r := range rates {
+			r.Base = strings.ToUpper(r.Base)
+			r.Quote = strings.ToUpper(r.Quote)
+			r.Date = time.Date(r.Date.Year(), r.Date.Month(), r.Date.Day(), 0, 0, 0, 0, time.UTC)
+			buf, err := json.Marshal(&r)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(exchangeRateKey(r.Base, r.Quote, r.Date), buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListExchangeRates returns every stored rate for base/quote, oldest
+// first.
+func (s *Store) ListExchangeRates(base, quote string) ([]ExchangeRate, error) {
+	var out []ExchangeRate
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("exchange_rates")).Cursor()
+		prefix := []byte(exchangeRatePrefix(base, quote))
+		for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+			var r ExchangeRate
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			out = append(out, r)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// ConvertAmount converts amount from one currency to another using the
+// most recent rate on or before `on`. It returns the converted amount
+// and the effective rate applied (to = amount * rate). Identical
+// currencies convert at 1 without touching the store.
+func (s *Store) ConvertAmount(amount float64, from, to string, on time.Time) (float64, float64, error) {
+	if strings.EqualFold(from, to) {
+		return amount, 1, nil
+	}
+	var rate float64
+	err := s.View(func(tx *bolt.Tx) error {
+		r, err := rateTx(tx, from, to, on)
+		rate = r
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return amount * rate, rate, nil
+}
+
+// rateTx resolves from→to inside an open transaction. It tries the
+// direct quote, then the inverse, then a cross rate through
+// PivotCurrency.
+func rateTx(tx *bolt.Tx, from, to string, on time.Time) (float64, error) {
+	b := tx.Bucket([]byte("exchange_rates"))
+	if r, ok := latestRate(b, from, to, on); ok {
+		return r, nil
+	}
+	if r, ok := latestRate(b, to, from, on); ok && r != 0 {
+		return 1 / r, nil
+	}
+	if strings.EqualFold(from, PivotCurrency) || strings.EqualFold(to, PivotCurrency) {
+		return 0, ErrNoExchangeRate
+	}
+	fromPivot, err := rateTx(tx, from, PivotCurrency, on)
+	if err != nil {
+		return 0, err
+	}
+	pivotTo, err := rateTx(tx, PivotCurrency, to, on)
+	if err != nil {
+		return 0, err
+	}
+	return fromPivot * pivotTo, nil
+}
+
+// latestRate finds the newest base/quote rate dated on or before `on`.
+func latestRate(b *bolt.Bucket, base, quote string, on time.Time) (float64, bool) {
+	prefix := []byte(exchangeRatePrefix(base, quote))
+	target := exchangeRateKey(base, quote, on)
+	c := b.Cursor()
+	k, v := c.Seek(target)
+	if k == nil || !bytes.Equal(k, target) {
+		// Seek landed past the target day (or off the end); the
+		// previous key is the newest one before it.
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+	}
+	if k == nil || !hasPrefix(k, prefix) {
+		return 0, false
+	}
+	var r ExchangeRate
+	if err := json.Unmarshal(v, &r); err != nil {
+		return 0, false
+	}
+	return r.Rate, true
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestConvertAmountUsesLatestRateOnOrBefore(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.PutExchangeRates([]ExchangeRate{
+		{Base: "usd", Quote: "cad", Date: day(2026, 1, 1), Rate: 1.30},
+		{Base: "USD", Quote: "CAD", Date: day(2026, 1, 5), Rate: 1.40},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		on   time.Time
+		want float64
+	}{
+		{day(2026, 1, 1), 1.30},
+		{day(2026, 1, 3).Add(15 * time.Hour), 1.30},
+		{day(2026, 1, 5), 1.40},
+		{day(2026, 3, 1), 1.40},
+	}
+	for _, tc := range cases {
+		got, rate, err := s.ConvertAmount(10, "USD", "CAD", tc.on)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.on, err)
+		}
+		if rate != tc.want || math.Abs(got-10*tc.want) > 1e-9 {
+			t.Errorf("%v: got %v at %v, want rate %v", tc.on, got, rate, tc.want)
+		}
+	}
+	if _, _, err := s.ConvertAmount(10, "USD", "CAD", day(2025, 12, 31)); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("expected ErrNoExchangeRate before first rate, got %v", err)
+	}
+}
+
+func TestConvertAmountInverseAndPivot(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.PutExchangeRates([]ExchangeRate{
+		{Base: "EUR", Quote: "USD", Date: day(2026, 1, 1), Rate: 1.10},
+		{Base: "EUR", Quote: "CAD", Date: day(2026, 1, 1), Rate: 1.50},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, rate, err := s.ConvertAmount(1, "USD", "EUR", day(2026, 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rate-1/1.10) > 1e-9 {
+		t.Errorf("inverse rate = %v", rate)
+	}
+	_, rate, err = s.ConvertAmount(1, "USD", "CAD", day(2026, 1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rate-1.50/1.10) > 1e-9 {
+		t.Errorf("cross rate = %v", rate)
+	}
+	if _, rate, _ := s.ConvertAmount(5, "cad", "CAD", time.Time{}); rate != 1 {
+		t.Errorf("same currency rate = %v", rate)
+	}
+}
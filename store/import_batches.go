@@ -0,0 +1,244 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrBatchRolledBack is returned by RollbackImportBatch for a batch
+// that was already rolled back.
+var ErrBatchRolledBack = errors.New("store: import batch already rolled back")
+
+// ImportBatch records one AddTransactions call or import. Every
+// transaction it created carries its ID in Transaction.BatchID.
+type ImportBatch struct {
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"user_id"`
+	// Source is where the rows came from: an importer format such as
+	// "csv" or "ofx", "manual" for the API, or a CLI name.
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+	// FileHash is the hex SHA-256 of the uploaded file or request body.
+	FileHash string `json:"file_hash,omitempty"`
+	// RowCount is how many transactions the batch created.
+	RowCount int `json:"row_count"`
+	// RolledBackAt is set once RollbackImportBatch has run.
+	RolledBackAt *time.Time `json:"rolled_back_at,omitempty"`
+	// Remaining is how many of its transactions still exist. It is
+	// counted when the batch is read, not stored.
+	Remaining int `json:"-"`
+}
+
+// batchKey is the txn_by_batch key: itob(batch_id) | itob(txn_id).
+func batchKey(batchID, txnID uint64) []byte {
+	return append(itob(batchID), itob(txnID)...)
+}
+
+// CreateImportBatch stores b, assigning b.ID and, if unset,
+// b.CreatedAt.
+func (s *Store) CreateImportBatch(b *ImportBatch) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket([]byte("seq_import_batches")).NextSequence()
+		if err != nil {
+			return err
+		}
+		b.ID = id
+		if b.CreatedAt.IsZero() {
+			b.CreatedAt = time.Now()
+		}
+		return putImportBatchTx(tx, b)
+	})
+}
+
+// CreateImportBatchWithTransactions stores b and txns as its rows in one
+// write, so either all of them are stored or none is. It sets b.ID,
+// b.RowCount and each transaction's ID and BatchID; tags[i], if
+// present, are the tag names of txns[i], created as needed.
+func (s *Store) CreateImportBatchWithTransactions(b *ImportBatch, txns []*Transaction, tags [][]string) error {
+	for _, t := range txns {
+		if !ValidKind(t.Kind) {
+			return fmt.Errorf("store: unknown transaction kind %q", t.Kind)
+		}
+	}
+	return s.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket([]byte("seq_import_batches")).NextSequence()
+		if err != nil {
+			return err
+		}
+		b.ID = id
+		if b.CreatedAt.IsZero() {
+			b.CreatedAt = time.Now()
+		}
+		b.RowCount = len(txns)
+		if err := putImportBatchTx(tx, b); err != nil {
+			return err
+		}
+		for i, t := range txns {
+			t.BatchID = b.ID
+			if err := createTransactionTx(tx, t); err != nil {
+				return err
+			}
+			if i < len(tags) {
+				for _, name := range tags[i] {
+					if name == "" {
+						continue
+					}
+					tag, err := getOrCreateTagTx(tx, name)
+					if err != nil {
+						return err
+					}
+					if err := tx.Bucket([]byte("txn_tags")).Put(append(itob(t.ID), itob(tag.ID)...), []byte{}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateImportBatch overwrites the stored batch with b.
+func (s *Store) UpdateImportBatch(b *ImportBatch) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("import_batches")).Get(itob(b.ID)) == nil {
+			return ErrNotFound
+		}
+		return putImportBatchTx(tx, b)
+	})
+}
+
+func putImportBatchTx(tx *bolt.Tx, b *ImportBatch) error {
+	buf, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("import_batches")).Put(itob(b.ID), buf)
+}
+
+// GetImportBatch returns the batch with id, or ErrNotFound.
+func (s *Store) GetImportBatch(id uint64) (*ImportBatch, error) {
+	var b ImportBatch
+	err := s.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket([]byte("import_batches")).Get(itob(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		b.Remaining = countBatchTransactionsTx(tx, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListImportBatches returns userID's batches, newest first.
+func (s *Store) ListImportBatches(userID uint64) ([]ImportBatch, error) {
+	var out []ImportBatch
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("import_batches")).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var b ImportBatch
+			if err := json.Unmarshal(v, &b); err != nil {
+				return err
+			}
+			if b.UserID == userID {
+				b.Remaining = countBatchTransactionsTx(tx, b.ID)
+				out = append(out, b)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// ListBatchTransactions returns the transactions of batchID that still
+// exist, in creation order.
+func (s *Store) ListBatchTransactions(batchID uint64) ([]Transaction, error) {
+	var out []Transaction
+	err := s.View(func(tx *bolt.Tx) error {
+		return forEachBatchTransactionTx(tx, batchID, func(t *Transaction) error {
+			out = append(out, *t)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// countBatchTransactionsTx counts batchID's txn_by_batch entries, which
+// deletes keep in step, without loading the transactions.
+func countBatchTransactionsTx(tx *bolt.Tx, batchID uint64) int {
+	n := 0
+	c := tx.Bucket([]byte("txn_by_batch")).Cursor()
+	prefix := itob(batchID)
+	for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+		n++
+	}
+	return n
+}
+
+func forEachBatchTransactionTx(tx *bolt.Tx, batchID uint64, fn func(*Transaction) error) error {
+	txns := tx.Bucket([]byte("transactions"))
+	c := tx.Bucket([]byte("txn_by_batch")).Cursor()
+	prefix := itob(batchID)
+	for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+		raw := txns.Get(k[8:])
+		if raw == nil {
+			continue // dangling reference; skip
+		}
+		var t Transaction
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+		if err := fn(&t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollbackImportBatch deletes every remaining transaction of the batch
+// in one write transaction, with the same cascades as
+// DeleteTransaction, and marks the batch rolled back at now. It returns
+// how many transactions were deleted.
+func (s *Store) RollbackImportBatch(batchID uint64, now time.Time) (int, error) {
+	deleted := 0
+	err := s.Update(func(tx *bolt.Tx) error {
+		raw := tx.Bucket([]byte("import_batches")).Get(itob(batchID))
+		if raw == nil {
+			return ErrNotFound
+		}
+		var b ImportBatch
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		if b.RolledBackAt != nil {
+			return ErrBatchRolledBack
+		}
+		// Collect first: deleting edits txn_by_batch under the cursor.
+		var rows []Transaction
+		err := forEachBatchTransactionTx(tx, batchID, func(t *Transaction) error {
+			rows = append(rows, *t)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range rows {
+			if err := deleteTransactionTx(tx, &rows[i]); err != nil {
+				return err
+			}
+		}
+		deleted = len(rows)
+		b.RolledBackAt = &now
+		return putImportBatchTx(tx, &b)
+	})
+	return deleted, err
+}
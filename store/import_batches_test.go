@@ -0,0 +1,133 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestImportBatchRollback(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := &ImportBatch{UserID: a.ID, Source: "csv", FileHash: "abc", RowCount: 2}
+	if err := s.CreateImportBatch(b); err != nil {
+		t.Fatal(err)
+	}
+	keep := &Transaction{UserID: a.ID, Amount: 1, Merchant: "Keep", OccurredAt: time.Now()}
+	if err := s.CreateTransaction(keep); err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint64
+	for _, m := range []string{"A", "B"} {
+		tx := &Transaction{UserID: a.ID, Amount: 5, Merchant: m, OccurredAt: time.Now(), BatchID: b.ID}
+		if err := s.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tx.ID)
+	}
+	tag, err := s.GetOrCreateTag("trip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddTagToTransaction(ids[0], tag.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := s.ListBatchTransactions(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].ID != ids[0] || rows[1].Merchant != "B" {
+		t.Fatalf("got %+v", rows)
+	}
+	list, _ := s.ListImportBatches(a.ID)
+	if len(list) != 1 || list[0].FileHash != "abc" || list[0].Remaining != 2 {
+		t.Fatalf("got %+v", list)
+	}
+
+	n, err := s.RollbackImportBatch(b.ID, time.Now())
+	if err != nil || n != 2 {
+		t.Fatalf("rollback: n=%d err=%v", n, err)
+	}
+	if _, err := s.GetTransaction(ids[0]); err != ErrNotFound {
+		t.Errorf("expected batch row gone, got %v", err)
+	}
+	if _, err := s.GetTransaction(keep.ID); err != nil {
+		t.Errorf("unrelated row: %v", err)
+	}
+	if got, _ := s.GetImportBatch(b.ID); got.RolledBackAt == nil {
+		t.Error("expected RolledBackAt set")
+	}
+	if _, err := s.RollbackImportBatch(b.ID, time.Now()); !errors.Is(err, ErrBatchRolledBack) {
+		t.Errorf("expected ErrBatchRolledBack, got %v", err)
+	}
+}
+
+func TestImportBatchIndexFollowsDelete(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := &ImportBatch{UserID: a.ID, Source: "manual"}
+	if err := s.CreateImportBatch(b); err != nil {
+		t.Fatal(err)
+	}
+	tx := &Transaction{UserID: a.ID, Amount: 5, Merchant: "A", OccurredAt: time.Now(), BatchID: b.ID}
+	if err := s.CreateTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeleteTransaction(tx.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if rows, _ := s.ListBatchTransactions(b.ID); len(rows) != 0 {
+		t.Errorf("expected no rows, got %+v", rows)
+	}
+	if got, _ := s.GetImportBatch(b.ID); got.Remaining != 0 {
+		t.Errorf("remaining = %d", got.Remaining)
+	}
+	if n, err := s.RollbackImportBatch(b.ID, time.Now()); err != nil || n != 0 {
+		t.Errorf("rollback: n=%d err=%v", n, err)
+	}
+}
+
+func TestCreateImportBatchWithTransactions(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	income := &Transaction{UserID: a.ID, Amount: 100, Kind: KindIncome, OccurredAt: time.Now()}
+	if err := s.CreateTransaction(income); err != nil {
+		t.Fatal(err)
+	}
+
+	// A bad row stores none of the batch.
+	bad := &ImportBatch{UserID: a.ID, Source: "csv"}
+	txns := []*Transaction{
+		{UserID: a.ID, Amount: 5, Merchant: "A", OccurredAt: time.Now()},
+		{UserID: a.ID, Amount: 1, Merchant: "B", Kind: KindRefund, RefundOf: income.ID, OccurredAt: time.Now()},
+	}
+	if err := s.CreateImportBatchWithTransactions(bad, txns, [][]string{{"trip"}}); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("expected ErrInvalidRefund, got %v", err)
+	}
+	if batches, _ := s.ListImportBatches(a.ID); len(batches) != 0 {
+		t.Errorf("batches after failure = %+v", batches)
+	}
+	if all, _ := s.ListTransactionsForUser(a.ID); len(all) != 1 {
+		t.Errorf("transactions after failure = %+v", all)
+	}
+
+	b := &ImportBatch{UserID: a.ID, Source: "csv"}
+	txns = []*Transaction{
+		{UserID: a.ID, Amount: 5, Merchant: "A", OccurredAt: time.Now()},
+		{UserID: a.ID, Amount: 6, Merchant: "B", OccurredAt: time.Now()},
+	}
+	if err := s.CreateImportBatchWithTransactions(b, txns, [][]string{{"trip"}}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := s.ListBatchTransactions(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.RowCount != 2 || len(rows) != 2 || rows[0].BatchID != b.ID {
+		t.Errorf("batch %+v rows %+v", b, rows)
+	}
+	if tags, _ := s.ListTagsForTransaction(txns[0].ID); len(tags) != 1 || tags[0] != "trip" {
+		t.Errorf("tags = %v", tags)
+	}
+}
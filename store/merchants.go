@@ -0,0 +1,473 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrMerchantExists is returned when a merchant name is already taken
+// by another of the owner's merchants. Names compare case-
+// insensitively.
+var ErrMerchantExists = errors.New("store: merchant already exists")
+
+// Merchant is an entry of a user's merchant catalog: the canonical Name
+// for every raw merchant string that starts with one of its Aliases,
+// ignoring case and runs of spaces ("AMAZON.COM" covers
+// "Amazon.com *AB12CD"). When several aliases match, the longest wins.
+//
+// Transactions refer to merchants by name. A transaction normalized to
+// a merchant has its Merchant set to the Name and keeps what it was
+// entered or imported with in RawMerchant.
+type Merchant struct {
+	ID        uint64    `json:"id"`
+	OwnerID   uint64    `json:"owner_id"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// merchantKey is the merchants_by_owner key:
+// itob(owner_id) | lower(name). A prefix scan lists an owner's catalog
+// in name order.
+func merchantKey(ownerID uint64, name string) []byte {
+	return append(itob(ownerID), strings.ToLower(name)...)
+}
+
+// aliasForm is how raw strings and aliases are compared.
+func aliasForm(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// merchantMatcher resolves raw merchant strings against one owner's
+// catalog.
+type merchantMatcher []Merchant
+
+func listMerchantsTx(tx *bolt.Tx, ownerID uint64) (merchantMatcher, error) {
+	var out merchantMatcher
+	c := tx.Bucket([]byte("merchants_by_owner")).Cursor()
+	prefix := itob(ownerID)
+	for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+		m, err := getMerchantTx(tx, btoi(v))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	return out, nil
+}
+
+// match returns the merchant whose longest alias starts raw, or nil.
+func (mm merchantMatcher) match(raw string) *Merchant {
+	raw = aliasForm(raw)
+	var best *Merchant
+	bestLen := 0
+	for i := range mm {
+		for _, a := range mm[i].Aliases {
+			a = aliasForm(a)
+			if a != "" && len(a) > bestLen && strings.HasPrefix(raw, a) {
+				best, bestLen = &mm[i], len(a)
+			}
+		}
+	}
+	return best
+}
+
+// normalize sets t.Merchant to the canonical name of the merchant its
+// raw string matches, keeping the raw string in t.RawMerchant. It
+// reports whether t changed.
+func (mm merchantMatcher) normalize(t *Transaction) bool {
+	raw := t.RawMerchant
+	if raw == "" {
+		raw = t.Merchant
+	}
+	m := mm.match(raw)
+	if m == nil || t.Merchant == m.Name {
+		return false
+	}
+	t.RawMerchant, t.Merchant = raw, m.Name
+	if t.RawMerchant == t.Merchant {
+		t.RawMerchant = ""
+	}
+	return true
+}
+
+func normalizeMerchantTx(tx *bolt.Tx, t *Transaction) error {
+	mm, err := listMerchantsTx(tx, t.UserID)
+	if err != nil {
+		return err
+	}
+	mm.normalize(t)
+	return nil
+}
+
+// NormalizeMerchant applies t.UserID's merchant catalog to t (see
+// Merchant) without storing it, so rules can see the canonical name
+// before the insert. CreateTransaction does the same.
+func (s *Store) NormalizeMerchant(t *Transaction) error {
+	return s.View(func(tx *bolt.Tx) error {
+		return normalizeMerchantTx(tx, t)
+	})
+}
+
+func putMerchantTx(tx *bolt.Tx, m *Merchant) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("merchants")).Put(itob(m.ID), buf)
+}
+
+func getMerchantTx(tx *bolt.Tx, id uint64) (*Merchant, error) {
+	raw := tx.Bucket([]byte("merchants")).Get(itob(id))
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	var m Merchant
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// CreateMerchant stores m, assigning m.ID and, if unset, m.CreatedAt,
+// and normalizes the owner's transactions its aliases match. It returns
+// how many changed.
+func (s *Store) CreateMerchant(m *Merchant) (int, error) {
+	n := 0
+	err := s.Update(func(tx *bolt.Tx) error {
+		idx := tx.Bucket([]byte("merchants_by_owner"))
+		if idx.Get(merchantKey(m.OwnerID, m.Name)) != nil {
+			return ErrMerchantExists
+		}
+		id, err := tx.Bucket([]byte("seq_merchants")).NextSequence()
+		if err != nil {
+			return err
+		}
+		m.ID = id
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = time.Now()
+		}
+		if err := putMerchantTx(tx, m); err != nil {
+			return err
+		}
+		if err := idx.Put(merchantKey(m.OwnerID, m.Name), itob(m.ID)); err != nil {
+			return err
+		}
+		n, err = remerchantTx(tx, m, "")
+		return err
+	})
+	return n, err
+}
+
+// GetMerchant returns the merchant with id, or ErrNotFound.
+func (s *Store) GetMerchant(id uint64) (*Merchant, error) {
+	var m *Merchant
+	err := s.View(func(tx *bolt.Tx) error {
+		var err error
+		m, err = getMerchantTx(tx, id)
+		return err
+	})
+	return m, err
+}
+
+// ListMerchants returns ownerID's catalog in case-insensitive name
+// order.
+func (s *Store) ListMerchants(ownerID uint64) ([]Merchant, error) {
+	var out []Merchant
+	err := s.View(func(tx *bolt.Tx) error {
+		var err error
+		out, err = listMerchantsTx(tx, ownerID)
+		return err
+	})
+	return out, err
+}
+
+// UpdateMerchant overwrites the stored merchant with m. The owner's
+// transactions under the old name take the new one, and those the new
+// aliases match are normalized, in the same write; it returns how many
+// changed. The owner cannot change.
+func (s *Store) UpdateMerchant(m *Merchant) (int, error) {
+	n := 0
+	err := s.Update(func(tx *bolt.Tx) error {
+		old, err := getMerchantTx(tx, m.ID)
+		if err != nil {
+			return err
+		}
+		m.OwnerID, m.CreatedAt = old.OwnerID, old.CreatedAt
+		if !strings.EqualFold(old.Name, m.Name) {
+			idx := tx.Bucket([]byte("merchants_by_owner"))
+			if idx.Get(merchantKey(m.OwnerID, m.Name)) != nil {
+				return ErrMerchantExists
+			}
+			if err := idx.Delete(merchantKey(old.OwnerID, old.Name)); err != nil {
+				return err
+			}
+			if err := idx.Put(merchantKey(m.OwnerID, m.Name), itob(m.ID)); err != nil {
+				return err
+			}
+		}
+		if err := putMerchantTx(tx, m); err != nil {
+			return err
+		}
+		n, err = remerchantTx(tx, m, old.Name)
+		return err
+	})
+	return n, err
+}
+
+// MergeMerchant folds merchant fromID into intoID, in one write:
+// fromID's name and aliases become aliases of intoID, the owner's
+// transactions under fromID's name take intoID's, and fromID is
+// deleted. Both must belong to the same owner. It returns how many
+// transactions changed and the updated intoID.
+func (s *Store) MergeMerchant(fromID, intoID uint64) (int, *Merchant, error) {
+	n := 0
+	var into *Merchant
+	err := s.Update(func(tx *bolt.Tx) error {
+		from, err := getMerchantTx(tx, fromID)
+		if err != nil {
+			return err
+		}
+		if into, err = getMerchantTx(tx, intoID); err != nil {
+			return err
+		}
+		if from.OwnerID != into.OwnerID || from.ID == into.ID {
+			return ErrNotFound
+		}
+		seen := map[string]bool{}
+		for _, a := range into.Aliases {
+			seen[aliasForm(a)] = true
+		}
+		for _, a := range append([]string{from.Name}, from.Aliases...) {
+			if !seen[aliasForm(a)] {
+				seen[aliasForm(a)] = true
+				into.Aliases = append(into.Aliases, a)
+			}
+		}
+		if err := deleteMerchantTx(tx, from); err != nil {
+			return err
+		}
+		if err := putMerchantTx(tx, into); err != nil {
+			return err
+		}
+		n, err = remerchantTx(tx, into, from.Name)
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, into, nil
+}
+
+// DeleteMerchant removes a merchant from the catalog. Transactions keep
+// their names.
+func (s *Store) DeleteMerchant(id uint64) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		m, err := getMerchantTx(tx, id)
+		if err != nil {
+			return err
+		}
+		return deleteMerchantTx(tx, m)
+	})
+}
+
+func deleteMerchantTx(tx *bolt.Tx, m *Merchant) error {
+	if err := tx.Bucket([]byte("merchants_by_owner")).Delete(merchantKey(m.OwnerID, m.Name)); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("merchants")).Delete(itob(m.ID))
+}
+
+// remerchantTx rewrites m's owner's transactions that now belong to m:
+// those named oldName (when set) and those whose raw string the
+// catalog resolves to m, moving their merchant_index entries along.
+func remerchantTx(tx *bolt.Tx, m *Merchant, oldName string) (int, error) {
+	mm, err := listMerchantsTx(tx, m.OwnerID)
+	if err != nil {
+		return 0, err
+	}
+	txns := tx.Bucket([]byte("transactions"))
+	c := tx.Bucket([]byte("txn_by_user_time")).Cursor()
+	prefix := itob(m.OwnerID)
+	n := 0
+	for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+		raw := txns.Get(v)
+		if raw == nil {
+			continue
+		}
+		var t Transaction
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return n, err
+		}
+		before := t
+		changed := false
+		if oldName != "" && t.Merchant != m.Name && strings.EqualFold(t.Merchant, oldName) {
+			if t.RawMerchant == "" {
+				t.RawMerchant = t.Merchant
+			}
+			t.Merchant, changed = m.Name, true
+		} else if match := mm.match(firstNonEmpty(t.RawMerchant, t.Merchant)); match != nil && match.ID == m.ID {
+			changed = mm.normalize(&t)
+		}
+		if !changed {
+			continue
+		}
+		if err := reindexMerchantTx(tx, &before, &t); err != nil {
+			return n, err
+		}
+		buf, err := json.Marshal(&t)
+		if err != nil {
+			return n, err
+		}
+		if err := txns.Put(itob(t.ID), buf); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func firstNonEmpty(vs ...string) string {
+	for _, v := range vs {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// merchantIndexKey is the merchant_index key:
+// itob(user_id) | lower(merchant) | 0x00 | itob(occurred_at_unix_nano) |
+// itob(txn_id). A prefix scan of itob(user_id) | lower(q) finds the
+// user's merchants starting with q, each merchant's uses oldest first.
+func merchantIndexKey(t *Transaction) []byte {
+	out := append(itob(t.UserID), strings.ToLower(t.Merchant)...)
+	out = append(out, 0)
+	out = append(out, itob(uint64(t.OccurredAt.UnixNano()))...)
+	return append(out, itob(t.ID)...)
+}
+
+// merchantIndexSuffix is the length of the 0x00 | time | id tail of a
+// merchant_index key.
+const merchantIndexSuffix = 17
+
+func indexMerchantTx(tx *bolt.Tx, t *Transaction) error {
+	if t.Merchant == "" {
+		return nil
+	}
+	return tx.Bucket([]byte("merchant_index")).Put(merchantIndexKey(t), []byte{})
+}
+
+// reindexMerchantTx moves t's merchant_index entry from how it was
+// (old) to how it is.
+func reindexMerchantTx(tx *bolt.Tx, old, t *Transaction) error {
+	if old.UserID == t.UserID && old.ID == t.ID && old.OccurredAt.Equal(t.OccurredAt) && strings.EqualFold(old.Merchant, t.Merchant) {
+		return nil
+	}
+	if err := unindexMerchantTx(tx, old); err != nil {
+		return err
+	}
+	return indexMerchantTx(tx, t)
+}
+
+func unindexMerchantTx(tx *bolt.Tx, t *Transaction) error {
+	if t.Merchant == "" {
+		return nil
+	}
+	return tx.Bucket([]byte("merchant_index")).Delete(merchantIndexKey(t))
+}
+
+// merchantUseHalfLife is how fast a use counts less in MerchantUse.Score.
+const merchantUseHalfLife = 90 * 24 * time.Hour
+
+// MerchantUse is a merchant as SuggestMerchants ranks it: how often and
+// how recently it was used, and the latest transaction with it.
+type MerchantUse struct {
+	// Merchant is spelled as in Last.
+	Merchant string
+	Uses     int
+	// Score sums one per use, halved for every 90 days of its age, so
+	// frequent and recent merchants come first.
+	Score float64
+	Last  *Transaction
+}
+
+// SuggestMerchants returns the merchants of userIDs' transactions whose
+// name starts with prefix, ignoring case, best Score first and at most
+// limit of them (limit <= 0 means all). Spellings differing only in
+// case, and the same merchant across users, are one suggestion.
+func (s *Store) SuggestMerchants(userIDs []uint64, prefix string, now time.Time, limit int) ([]MerchantUse, error) {
+	type use struct {
+		MerchantUse
+		lastAt, lastID uint64
+	}
+	byName := map[string]*use{}
+	var order []string
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("merchant_index")).Cursor()
+		for _, uid := range userIDs {
+			seek := append(itob(uid), strings.ToLower(prefix)...)
+			for k, _ := c.Seek(seek); k != nil && hasPrefix(k, seek); k, _ = c.Next() {
+				if len(k) < 8+merchantIndexSuffix {
+					continue
+				}
+				tail := k[len(k)-merchantIndexSuffix:]
+				name := string(k[8 : len(k)-merchantIndexSuffix])
+				at := btoi(tail[1:9])
+				u, ok := byName[name]
+				if !ok {
+					u = &use{}
+					byName[name] = u
+					order = append(order, name)
+				}
+				u.Uses++
+				if age := now.Sub(time.Unix(0, int64(at))); age > 0 {
+					u.Score += math.Pow(0.5, float64(age)/float64(merchantUseHalfLife))
+				} else {
+					u.Score++
+				}
+				if at >= u.lastAt {
+					u.lastAt, u.lastID = at, btoi(tail[9:])
+				}
+			}
+		}
+		for _, name := range order {
+			u := byName[name]
+			raw := tx.Bucket([]byte("transactions")).Get(itob(u.lastID))
+			if raw == nil {
+				continue
+			}
+			u.Last = &Transaction{}
+			if err := json.Unmarshal(raw, u.Last); err != nil {
+				return err
+			}
+			u.Merchant = u.Last.Merchant
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]MerchantUse, 0, len(order))
+	for _, name := range order {
+		if u := byName[name]; u.Last != nil {
+			out = append(out, u.MerchantUse)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Last.OccurredAt.After(out[j].Last.OccurredAt)
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMerchantCatalog(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	add := func(userID uint64, merchant string) *Transaction {
+		t.Helper()
+		tx := &Transaction{UserID: userID, Amount: 1, Merchant: merchant, OccurredAt: time.Now()}
+		if err := s.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	before := add(a.ID, "AMAZON.COM *AB12")
+	bobs := add(b.ID, "AMAZON.COM *ZZ")
+
+	amazon := &Merchant{OwnerID: a.ID, Name: "Amazon", Aliases: []string{"amazon.com", "AMZN  MKTP"}}
+	n, err := s.CreateMerchant(amazon)
+	if err != nil || n != 1 {
+		t.Fatalf("create: n=%d err=%v", n, err)
+	}
+	if got, _ := s.GetTransaction(before.ID); got.Merchant != "Amazon" || got.RawMerchant != "AMAZON.COM *AB12" {
+		t.Errorf("existing transaction = %q/%q", got.Merchant, got.RawMerchant)
+	}
+	if got, _ := s.GetTransaction(bobs.ID); got.Merchant != "AMAZON.COM *ZZ" {
+		t.Errorf("bob's merchant = %q", got.Merchant)
+	}
+	if _, err := s.CreateMerchant(&Merchant{OwnerID: a.ID, Name: "AMAZON"}); err != ErrMerchantExists {
+		t.Errorf("expected ErrMerchantExists, got %v", err)
+	}
+
+	inserted := add(a.ID, "amzn mktp ca*1x")
+	if inserted.Merchant != "Amazon" || inserted.RawMerchant != "amzn mktp ca*1x" {
+		t.Errorf("inserted = %q/%q", inserted.Merchant, inserted.RawMerchant)
+	}
+	plain := &Transaction{UserID: a.ID, Merchant: "Cafe"}
+	if err := s.NormalizeMerchant(plain); err != nil || plain.Merchant != "Cafe" || plain.RawMerchant != "" {
+		t.Errorf("unmatched = %+v %v", plain, err)
+	}
+
+	// A longer alias of another merchant wins.
+	kindle := &Merchant{OwnerID: a.ID, Name: "Kindle", Aliases: []string{"AMAZON.COM *KINDLE"}}
+	if _, err := s.CreateMerchant(kindle); err != nil {
+		t.Fatal(err)
+	}
+	if got := add(a.ID, "Amazon.com *Kindle Unlimited"); got.Merchant != "Kindle" {
+		t.Errorf("longest alias = %q", got.Merchant)
+	}
+
+	amazon.Name = "Amazon.ca"
+	if n, err := s.UpdateMerchant(amazon); err != nil || n != 2 {
+		t.Fatalf("rename: n=%d err=%v", n, err)
+	}
+	if got, _ := s.GetTransaction(before.ID); got.Merchant != "Amazon.ca" || got.RawMerchant != "AMAZON.COM *AB12" {
+		t.Errorf("renamed = %q/%q", got.Merchant, got.RawMerchant)
+	}
+
+	n, into, err := s.MergeMerchant(kindle.ID, amazon.ID)
+	if err != nil || n != 1 || len(into.Aliases) != 4 {
+		t.Fatalf("merge: n=%d into=%+v err=%v", n, into, err)
+	}
+	if _, err := s.GetMerchant(kindle.ID); err != ErrNotFound {
+		t.Errorf("merged-away merchant still there: %v", err)
+	}
+	if got := add(a.ID, "amazon.com *kindle"); got.Merchant != "Amazon.ca" {
+		t.Errorf("after merge = %q", got.Merchant)
+	}
+	if list, _ := s.ListMerchants(a.ID); len(list) != 1 {
+		t.Errorf("catalog = %+v", list)
+	}
+}
+
+func TestSuggestMerchants(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	add := func(userID uint64, merchant string, daysAgo int) *Transaction {
+		t.Helper()
+		tx := &Transaction{UserID: userID, Amount: float64(daysAgo), Merchant: merchant, Category: "c" + merchant, OccurredAt: now.AddDate(0, 0, -daysAgo)}
+		if err := s.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	// Three old uses of Costco score below two recent uses of Coffee.
+	for _, d := range []int{400, 380, 360} {
+		add(a.ID, "Costco", d)
+	}
+	add(a.ID, "Coffee Bar", 3)
+	add(b.ID, "coffee bar", 1)
+	add(a.ID, "Bakery", 1)
+	moved := add(a.ID, "Cobbler", 2)
+
+	got, err := s.SuggestMerchants([]uint64{a.ID, b.ID}, "CO", now, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Merchant != "coffee bar" || got[0].Uses != 2 || got[0].Last.UserID != b.ID ||
+		got[1].Merchant != "Cobbler" || got[2].Merchant != "Costco" || got[2].Uses != 3 || got[2].Last.Amount != 360 {
+		t.Fatalf("suggestions = %+v", got)
+	}
+	if only, _ := s.SuggestMerchants([]uint64{a.ID}, "coff", now, 1); len(only) != 1 || only[0].Merchant != "Coffee Bar" || only[0].Uses != 1 {
+		t.Errorf("alice only = %+v", only)
+	}
+
+	// Renames and deletes move the index along.
+	moved.Merchant = "Shoe Repair"
+	if err := s.UpdateTransaction(moved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeleteTransaction(got[2].Last.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = s.SuggestMerchants([]uint64{a.ID}, "co", now, 0)
+	if len(got) != 2 || got[1].Merchant != "Costco" || got[1].Uses != 2 || got[1].Last.Amount != 380 {
+		t.Errorf("after update and delete = %+v", got)
+	}
+	if got, _ := s.SuggestMerchants([]uint64{a.ID}, "shoe", now, 0); len(got) != 1 {
+		t.Errorf("renamed = %+v", got)
+	}
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ScheduledItem is a user-entered future bill or income for the
+// forecast: Amount on Account every Frequency from Next, up to Until
+// when set. Amount is positive; Kind (expense or income) gives the
+// direction, as on transactions.
+type ScheduledItem struct {
+	ID        uint64     `json:"id"`
+	UserID    uint64     `json:"user_id"`
+	Name      string     `json:"name"`
+	Account   string     `json:"account"`
+	Amount    float64    `json:"amount"`
+	Kind      string     `json:"kind"`
+	Frequency string     `json:"frequency"`
+	Next      time.Time  `json:"next"`
+	Until     *time.Time `json:"until,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// scheduledKey is the scheduled_by_user key: itob(user_id) | itob(id).
+func scheduledKey(userID, id uint64) []byte {
+	return append(itob(userID), itob(id)...)
+}
+
+func putScheduledItemTx(tx *bolt.Tx, it *ScheduledItem) error {
+	buf, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("scheduled_items")).Put(itob(it.ID), buf)
+}
+
+func getScheduledItemTx(tx *bolt.Tx, id uint64) (*ScheduledItem, error) {
+	raw := tx.Bucket([]byte("scheduled_items")).Get(itob(id))
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	var it ScheduledItem
+	if err := json.Unmarshal(raw, &it); err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// CreateScheduledItem stores it, assigning it.ID and, if unset,
+// it.CreatedAt.
+func (s *Store) CreateScheduledItem(it *ScheduledItem) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket([]byte("seq_scheduled_items")).NextSequence()
+		if err != nil {
+			return err
+		}
+		it.ID = id
+		if it.CreatedAt.IsZero() {
+			it.CreatedAt = time.Now()
+		}
+		if err := putScheduledItemTx(tx, it); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("scheduled_by_user")).Put(scheduledKey(it.UserID, it.ID), nil)
+	})
+}
+
+// GetScheduledItem returns the item with id, or ErrNotFound.
+func (s *Store) GetScheduledItem(id uint64) (*ScheduledItem, error) {
+	var it *ScheduledItem
+	err := s.View(func(tx *bolt.Tx) error {
+		var err error
+		it, err = getScheduledItemTx(tx, id)
+		return err
+	})
+	return it, err
+}
+
+// ListScheduledItems returns userID's items in creation order.
+func (s *Store) ListScheduledItems(userID uint64) ([]ScheduledItem, error) {
+	var out []ScheduledItem
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("scheduled_by_user")).Cursor()
+		prefix := itob(userID)
+		for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+			it, err := getScheduledItemTx(tx, btoi(k[8:]))
+			if err != nil {
+				return err
+			}
+			out = append(out, *it)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// UpdateScheduledItem overwrites the stored item with it. The owner and
+// creation time cannot change.
+func (s *Store) UpdateScheduledItem(it *ScheduledItem) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		old, err := getScheduledItemTx(tx, it.ID)
+		if err != nil {
+			return err
+		}
+		it.UserID, it.CreatedAt = old.UserID, old.CreatedAt
+		return putScheduledItemTx(tx, it)
+	})
+}
+
+// DeleteScheduledItem removes the item with id, or returns ErrNotFound.
+func (s *Store) DeleteScheduledItem(id uint64) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		it, err := getScheduledItemTx(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte("scheduled_by_user")).Delete(scheduledKey(it.UserID, it.ID)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("scheduled_items")).Delete(itob(id))
+	})
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestScheduledItems(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	next := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	rent := &ScheduledItem{UserID: a.ID, Name: "Rent", Account: "Chequing", Amount: 1800, Kind: KindExpense, Frequency: "monthly", Next: next}
+	pay := &ScheduledItem{UserID: a.ID, Name: "Pay", Account: "Chequing", Amount: 2500, Kind: KindIncome, Frequency: "biweekly", Next: next}
+	other := &ScheduledItem{UserID: b.ID, Name: "Gym", Account: "Visa", Amount: 40, Kind: KindExpense, Frequency: "monthly", Next: next}
+	for _, it := range []*ScheduledItem{rent, pay, other} {
+		if err := s.CreateScheduledItem(it); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rent.ID == 0 || rent.CreatedAt.IsZero() {
+		t.Fatalf("create did not assign ID and time: %+v", rent)
+	}
+
+	got, err := s.ListScheduledItems(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Name != "Rent" || got[1].Name != "Pay" {
+		t.Fatalf("list = %+v", got)
+	}
+
+	until := next.AddDate(1, 0, 0)
+	upd := *rent
+	upd.UserID, upd.Amount, upd.Until = b.ID, 1900, &until
+	if err := s.UpdateScheduledItem(&upd); err != nil {
+		t.Fatal(err)
+	}
+	if it, _ := s.GetScheduledItem(rent.ID); it.Amount != 1900 || it.UserID != a.ID || it.Until == nil || !it.Until.Equal(until) {
+		t.Fatalf("after update = %+v", it)
+	}
+
+	if err := s.DeleteScheduledItem(rent.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetScheduledItem(rent.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get deleted = %v", err)
+	}
+	if got, _ := s.ListScheduledItems(a.ID); len(got) != 1 || got[0].ID != pay.ID {
+		t.Fatalf("list after delete = %+v", got)
+	}
+}
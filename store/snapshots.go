@@ -0,0 +1,143 @@
+package store
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Where a balance snapshot came from.
+const (
+	SnapshotManual    = "manual"
+	SnapshotStatement = "statement"
+	SnapshotComputed  = "computed"
+)
+
+// BalanceSnapshot is the balance of one account at the end of the day
+// On, in the account's currency. Accounts are the Card names
+// transactions carry; a balance is what the account holds, so a credit
+// card that is owed money is negative. A user has at most one snapshot
+// per account and day: storing another replaces it.
+type BalanceSnapshot struct {
+	ID       uint64    `json:"id"`
+	UserID   uint64    `json:"user_id"`
+	Account  string    `json:"account"`
+	Balance  float64   `json:"balance"`
+	Currency string    `json:"currency"`
+	On       time.Time `json:"on"`
+	// Source is SnapshotManual, SnapshotStatement or SnapshotComputed.
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// snapshotKey is the snapshots_by_user key:
+// itob(user_id) | itob(on, unix seconds) | lower(account). A prefix
+// scan lists a user's snapshots oldest first.
+func snapshotKey(userID uint64, on time.Time, account string) []byte {
+	return append(append(itob(userID), itob(uint64(on.Unix()))...), strings.ToLower(account)...)
+}
+
+func getSnapshotTx(tx *bolt.Tx, id uint64) (*BalanceSnapshot, error) {
+	raw := tx.Bucket([]byte("snapshots")).Get(itob(id))
+	if raw == nil {
+		return nil, ErrNotFound
+	}
+	var sn BalanceSnapshot
+	if err := json.Unmarshal(raw, &sn); err != nil {
+		return nil, err
+	}
+	return &sn, nil
+}
+
+// putSnapshotTx stores sn, taking over the ID of the snapshot it
+// replaces or assigning a new one.
+func putSnapshotTx(tx *bolt.Tx, sn *BalanceSnapshot) error {
+	idx := tx.Bucket([]byte("snapshots_by_user"))
+	key := snapshotKey(sn.UserID, sn.On, sn.Account)
+	if v := idx.Get(key); v != nil {
+		sn.ID = btoi(v)
+	} else {
+		id, err := tx.Bucket([]byte("seq_snapshots")).NextSequence()
+		if err != nil {
+			return err
+		}
+		sn.ID = id
+	}
+	if sn.CreatedAt.IsZero() {
+		sn.CreatedAt = time.Now()
+	}
+	buf, err := json.Marshal(sn)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("snapshots")).Put(itob(sn.ID), buf); err != nil {
+		return err
+	}
+	return idx.Put(key, itob(sn.ID))
+}
+
+// PutSnapshots stores snapshots in one write, each replacing the
+// user's snapshot of the same account (ignoring case) and day.
+func (s *Store) PutSnapshots(snapshots ...*BalanceSnapshot) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		for _, sn := range snapshots {
+			if err := putSnapshotTx(tx, sn); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetSnapshot returns the snapshot with id, or ErrNotFound.
+func (s *Store) GetSnapshot(id uint64) (*BalanceSnapshot, error) {
+	var sn *BalanceSnapshot
+	err := s.View(func(tx *bolt.Tx) error {
+		var err error
+		sn, err = getSnapshotTx(tx, id)
+		return err
+	})
+	return sn, err
+}
+
+// ListSnapshots returns userID's snapshots with On in [from, to),
+// oldest first. Zero bounds are open.
+func (s *Store) ListSnapshots(userID uint64, from, to time.Time) ([]BalanceSnapshot, error) {
+	var out []BalanceSnapshot
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("snapshots_by_user")).Cursor()
+		prefix := itob(userID)
+		start := prefix
+		if !from.IsZero() {
+			start = append(itob(userID), itob(uint64(from.Unix()))...)
+		}
+		for k, v := c.Seek(start); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+			sn, err := getSnapshotTx(tx, btoi(v))
+			if err != nil {
+				return err
+			}
+			if !to.IsZero() && !sn.On.Before(to) {
+				break
+			}
+			out = append(out, *sn)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// DeleteSnapshot removes the snapshot with id, or returns ErrNotFound.
+func (s *Store) DeleteSnapshot(id uint64) error {
+	return s.Update(func(tx *bolt.Tx) error {
+		sn, err := getSnapshotTx(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte("snapshots_by_user")).Delete(snapshotKey(sn.UserID, sn.On, sn.Account)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("snapshots")).Delete(itob(id))
+	})
+}
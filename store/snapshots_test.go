@@ -0,0 +1,57 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnapshots(t *testing.T) {
+	s := newTestStore(t)
+	a := newUser(t, s, "alice")
+	b := newUser(t, s, "bob")
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	visa := &BalanceSnapshot{UserID: a.ID, Account: "Visa", Balance: -120, Currency: "CAD", On: day(5), Source: SnapshotStatement}
+	err := s.PutSnapshots(
+		visa,
+		&BalanceSnapshot{UserID: a.ID, Account: "Chequing", Balance: 900, Currency: "CAD", On: day(1), Source: SnapshotManual},
+		&BalanceSnapshot{UserID: a.ID, Account: "Chequing", Balance: 700, Currency: "CAD", On: day(9), Source: SnapshotComputed},
+		&BalanceSnapshot{UserID: b.ID, Account: "Visa", Balance: 1, Currency: "CAD", On: day(5), Source: SnapshotManual},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.ListSnapshots(a.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Balance != 900 || got[1].Account != "Visa" || got[2].Balance != 700 {
+		t.Fatalf("list = %+v, want alice's oldest first", got)
+	}
+	if got, _ := s.ListSnapshots(a.ID, day(2), day(9)); len(got) != 1 || got[0].ID != visa.ID {
+		t.Fatalf("range = %+v", got)
+	}
+
+	// Same account and day replaces, keeping the ID.
+	again := &BalanceSnapshot{UserID: a.ID, Account: "VISA", Balance: -80, Currency: "CAD", On: day(5), Source: SnapshotManual}
+	if err := s.PutSnapshots(again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != visa.ID {
+		t.Errorf("replacement ID = %d, want %d", again.ID, visa.ID)
+	}
+	if sn, _ := s.GetSnapshot(visa.ID); sn.Balance != -80 || sn.Source != SnapshotManual {
+		t.Errorf("after replace = %+v", sn)
+	}
+
+	if err := s.DeleteSnapshot(visa.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSnapshot(visa.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get deleted = %v", err)
+	}
+	if got, _ := s.ListSnapshots(a.ID, time.Time{}, time.Time{}); len(got) != 2 {
+		t.Fatalf("after delete = %+v", got)
+	}
+}
@@ -33,6 +33,18 @@ var topLevelBuckets = []string{
 	"sharing_tokens", "sharing_tokens_by_user",
 	"user_connections", "subscriptions_by_user",
 	"settings",
+	"exchange_rates",
+	"refunds_by_txn",
+	"seq_comments", "comments",
+	"undo",
+	"seq_import_batches", "import_batches", "txn_by_batch",
+	"seq_categories", "categories", "categories_by_owner",
+	"account_balances",
+	"seq_scheduled_items", "scheduled_items", "scheduled_by_user",
+	"seq_snapshots", "snapshots", "snapshots_by_user",
+	"seq_alerts", "alerts", "alerts_by_user", "alerts_by_txn",
+	"seq_merchants", "merchants", "merchants_by_owner",
+	"merchant_index",
 }
 
 type Store struct {
@@ -73,3 +85,17 @@ func (s *Store) View(fn func(*bolt.Tx) error) error { return s.db.View(fn) }
 
 // Update runs fn inside a read-write transaction.
 func (s *Store) Update(fn func(*bolt.Tx) error) error { return s.db.Update(fn) }
+
+// Path returns the file the store was opened from.
+func (s *Store) Path() string { return s.db.Path() }
+
+// Backup writes a consistent copy of the database to path. It runs in
+// a read transaction, so it is safe while the store is in use.
+func (s *Store) Backup(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create backup dir: %w", err)
+	}
+	return s.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, fileMode)
+	})
+}
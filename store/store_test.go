@@ -34,3 +34,20 @@ func TestOpenCreatesFile(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestBackupIsOpenable(t *testing.T) {
+	s := newTestStore(t)
+	newUser(t, s, "alice")
+	dst := filepath.Join(t.TempDir(), "backup", "copy.db")
+	if err := s.Backup(dst); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.GetUserByUsername("alice"); err != nil {
+		t.Errorf("backup missing user: %v", err)
+	}
+}
@@ -2,7 +2,9 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
@@ -18,6 +20,103 @@ type Transaction struct {
 	Card       string    `json:"card"`
 	Category   string    `json:"category"`
 	Details    string    `json:"details"`
+	// Kind is the direction of the money: one of the Kind* constants.
+	// Records written before kinds existed have it empty, which reads
+	// as KindExpense.
+	Kind string `json:"kind,omitempty"`
+	// RefundOf is the ID of the purchase a KindRefund transaction
+	// reverses. Zero when unlinked.
+	RefundOf uint64 `json:"refund_of,omitempty"`
+	// FITID is the bank's ID for the transaction from an OFX import,
+	// unique per Card. Re-imports match on it.
+	FITID string `json:"fitid,omitempty"`
+	// BatchID is the ImportBatch that created the transaction. Zero for
+	// transactions written before batches existed.
+	BatchID uint64 `json:"batch_id,omitempty"`
+	// RawMerchant is the merchant string as entered or imported when
+	// Merchant was normalized to a catalog name (see Merchant); empty
+	// otherwise.
+	RawMerchant string `json:"raw_merchant,omitempty"`
+	// MCC is the four-digit ISO 18245 merchant category code the card
+	// network gave the merchant. Empty when unknown.
+	MCC string `json:"mcc,omitempty"`
+}
+
+const (
+	KindExpense  = "expense"
+	KindIncome   = "income"
+	KindRefund   = "refund"
+	KindTransfer = "transfer"
+)
+
+// ErrInvalidRefund is returned when RefundOf is set on a transaction
+// that is not a refund, points at itself, or points at a transaction
+// that is not an expense.
+var ErrInvalidRefund = errors.New("store: invalid refund link")
+
+// ErrInvalidMerge is returned by MergeTransactions for a transaction
+// merged into itself or into its own refund or purchase.
+var ErrInvalidMerge = errors.New("store: invalid merge")
+
+// ValidKind reports whether k is empty or one of the Kind* constants.
+func ValidKind(k string) bool {
+	switch k {
+	case "", KindExpense, KindIncome, KindRefund, KindTransfer:
+		return true
+	}
+	return false
+}
+
+// KindOrDefault returns t.Kind, treating empty as KindExpense.
+func (t *Transaction) KindOrDefault() string {
+	if t.Kind == "" {
+		return KindExpense
+	}
+	return t.Kind
+}
+
+// SpendAmount is the transaction's contribution to spending totals.
+// Expenses count as-is (importers store credits on a card as negative
+// expenses, which keeps netting them out), refunds subtract, and
+// income and transfers do not count as spending at all.
+func (t *Transaction) SpendAmount() float64 {
+	switch t.KindOrDefault() {
+	case KindRefund:
+		if t.Amount < 0 {
+			return t.Amount
+		}
+		return -t.Amount
+	case KindIncome, KindTransfer:
+		return 0
+	}
+	return t.Amount
+}
+
+// refundKey is the refunds_by_txn key: itob(original_id) | itob(refund_id).
+func refundKey(originalID, refundID uint64) []byte {
+	return append(itob(originalID), itob(refundID)...)
+}
+
+// checkRefundTx validates t.RefundOf against the stored original.
+func checkRefundTx(tx *bolt.Tx, t *Transaction) error {
+	if t.RefundOf == 0 {
+		return nil
+	}
+	if t.Kind != KindRefund || t.RefundOf == t.ID {
+		return ErrInvalidRefund
+	}
+	raw := tx.Bucket([]byte("transactions")).Get(itob(t.RefundOf))
+	if raw == nil {
+		return fmt.Errorf("refund of transaction %d: %w", t.RefundOf, ErrNotFound)
+	}
+	var orig Transaction
+	if err := json.Unmarshal(raw, &orig); err != nil {
+		return err
+	}
+	if orig.KindOrDefault() != KindExpense {
+		return ErrInvalidRefund
+	}
+	return nil
 }
 
 // CreateTransaction inserts a new transaction and indexes it under
@@ -25,22 +124,55 @@ type Transaction struct {
 // unique constraint from postgres (user_id, merchant, occurred_at, amount)
 // is enforced at the application layer by callers (see AddTransactions
 // in the route layer); CreateTransaction itself does not deduplicate.
+// A category new to the user is added to their catalog (see Category)
+// and the merchant is normalized (see Merchant).
 func (s *Store) CreateTransaction(t *Transaction) error {
+	if !ValidKind(t.Kind) {
+		return fmt.Errorf("store: unknown transaction kind %q", t.Kind)
+	}
 	return s.Update(func(tx *bolt.Tx) error {
-		id, err := tx.Bucket([]byte("seq_transactions")).NextSequence()
-		if err != nil {
-			return err
-		}
-		t.ID = id
-		buf, err := json.Marshal(t)
-		if err != nil {
+		return createTransactionTx(tx, t)
+	})
+}
+
+// createTransactionTx is the in-transaction form of CreateTransaction;
+// the caller has validated t.Kind.
+func createTransactionTx(tx *bolt.Tx, t *Transaction) error {
+	if err := checkRefundTx(tx, t); err != nil {
+		return err
+	}
+	if err := normalizeMerchantTx(tx, t); err != nil {
+		return err
+	}
+	id, err := tx.Bucket([]byte("seq_transactions")).NextSequence()
+	if err != nil {
+		return err
+	}
+	t.ID = id
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket([]byte("transactions")).Put(itob(id), buf); err != nil {
+		return err
+	}
+	if err := indexMerchantTx(tx, t); err != nil {
+		return err
+	}
+	if t.RefundOf != 0 {
+		if err := tx.Bucket([]byte("refunds_by_txn")).Put(refundKey(t.RefundOf, t.ID), []byte{}); err != nil {
 			return err
 		}
-		if err := tx.Bucket([]byte("transactions")).Put(itob(id), buf); err != nil {
+	}
+	if t.BatchID != 0 {
+		if err := tx.Bucket([]byte("txn_by_batch")).Put(batchKey(t.BatchID, t.ID), []byte{}); err != nil {
 			return err
 		}
-		return tx.Bucket([]byte("txn_by_user_time")).Put(TxByUserTimeKey(t.UserID, t.OccurredAt, t.ID), itob(t.ID))
-	})
+	}
+	if err := ensureCategoryTx(tx, t.UserID, t.Category); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("txn_by_user_time")).Put(TxByUserTimeKey(t.UserID, t.OccurredAt, t.ID), itob(t.ID))
 }
 
 // ListTransactionsForUser returns transactions belonging to userID, ordered
@@ -76,6 +208,66 @@ func (s *Store) ListTransactionsForUser(userID uint64) ([]Transaction, error) {
 	return out, err
 }
 
+// WalkTransactionsForUser calls fn for each of userID's transactions
+// with occurred_at in [from, to), oldest first. Zero bounds are open.
+// It reads batch rows per read transaction and calls fn outside of it,
+// so memory stays bounded by batch and fn may use the store (or block
+// on a slow client) without pinning a read transaction. Rows written
+// while the walk is in progress may or may not be seen. A non-nil
+// error from fn stops the walk and is returned.
+func (s *Store) WalkTransactionsForUser(userID uint64, from, to time.Time, batch int, fn func(*Transaction) error) error {
+	if batch <= 0 {
+		batch = 256
+	}
+	prefix := itob(userID)
+	start := prefix
+	if !from.IsZero() {
+		start = TxByUserTimeKey(userID, from, 0)
+	}
+	var after []byte
+	for {
+		var page []Transaction
+		err := s.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket([]byte("txn_by_user_time")).Cursor()
+			k, v := c.Seek(start)
+			if after != nil {
+				k, v = c.Seek(after)
+				if k != nil && string(k) == string(after) {
+					k, v = c.Next()
+				}
+			}
+			byID := tx.Bucket([]byte("transactions"))
+			for ; k != nil && hasPrefix(k, prefix) && len(page) < batch; k, v = c.Next() {
+				if !to.IsZero() && btoi(k[8:16]) >= uint64(to.UnixNano()) {
+					break
+				}
+				raw := byID.Get(v)
+				if raw == nil {
+					return fmt.Errorf("txn_by_user_time references missing txn %d", btoi(v))
+				}
+				var t Transaction
+				if err := json.Unmarshal(raw, &t); err != nil {
+					return err
+				}
+				page = append(page, t)
+				after = append(after[:0], k...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := range page {
+			if err := fn(&page[i]); err != nil {
+				return err
+			}
+		}
+		if len(page) < batch {
+			return nil
+		}
+	}
+}
+
 func hasPrefix(b, prefix []byte) bool {
 	if len(b) < len(prefix) {
 		return false
@@ -104,33 +296,87 @@ func (s *Store) GetTransaction(id uint64) (*Transaction, error) {
 }
 
 func (s *Store) UpdateTransaction(t *Transaction) error {
+	if !ValidKind(t.Kind) {
+		return fmt.Errorf("store: unknown transaction kind %q", t.Kind)
+	}
 	return s.Update(func(tx *bolt.Tx) error {
-		// Update the index entry if (user_id, occurred_at) changed.
-		old, err := s.GetTransaction(t.ID)
-		if err != nil {
+		return updateTransactionTx(tx, t)
+	})
+}
+
+// UpdateTransactionAndTags is UpdateTransaction and, unless tags is
+// nil, ReplaceTagsForTransaction in one write, so neither is stored if
+// the other fails.
+func (s *Store) UpdateTransactionAndTags(t *Transaction, tags []string) error {
+	if !ValidKind(t.Kind) {
+		return fmt.Errorf("store: unknown transaction kind %q", t.Kind)
+	}
+	return s.Update(func(tx *bolt.Tx) error {
+		if err := updateTransactionTx(tx, t); err != nil {
 			return err
 		}
-		if old.UserID != t.UserID || !old.OccurredAt.Equal(t.OccurredAt) {
-			if err := tx.Bucket([]byte("txn_by_user_time")).Delete(TxByUserTimeKey(old.UserID, old.OccurredAt, old.ID)); err != nil {
+		if tags == nil {
+			return nil
+		}
+		return replaceTagsTx(tx, t.ID, tags)
+	})
+}
+
+// updateTransactionTx is the in-transaction form of UpdateTransaction;
+// the caller has validated t.Kind.
+func updateTransactionTx(tx *bolt.Tx, t *Transaction) error {
+	raw := tx.Bucket([]byte("transactions")).Get(itob(t.ID))
+	if raw == nil {
+		return ErrNotFound
+	}
+	old := &Transaction{}
+	if err := json.Unmarshal(raw, old); err != nil {
+		return err
+	}
+	if err := checkRefundTx(tx, t); err != nil {
+		return err
+	}
+	if old.RefundOf != t.RefundOf {
+		refunds := tx.Bucket([]byte("refunds_by_txn"))
+		if old.RefundOf != 0 {
+			if err := refunds.Delete(refundKey(old.RefundOf, t.ID)); err != nil {
 				return err
 			}
-			if err := tx.Bucket([]byte("txn_by_user_time")).Put(TxByUserTimeKey(t.UserID, t.OccurredAt, t.ID), itob(t.ID)); err != nil {
+		}
+		if t.RefundOf != 0 {
+			if err := refunds.Put(refundKey(t.RefundOf, t.ID), []byte{}); err != nil {
 				return err
 			}
 		}
-		buf, err := json.Marshal(t)
-		if err != nil {
+	}
+	if old.UserID != t.UserID || old.Category != t.Category {
+		if err := ensureCategoryTx(tx, t.UserID, t.Category); err != nil {
 			return err
 		}
-		return tx.Bucket([]byte("transactions")).Put(itob(t.ID), buf)
-	})
+	}
+	// Update the index entry if (user_id, occurred_at) changed.
+	if old.UserID != t.UserID || !old.OccurredAt.Equal(t.OccurredAt) {
+		if err := tx.Bucket([]byte("txn_by_user_time")).Delete(TxByUserTimeKey(old.UserID, old.OccurredAt, old.ID)); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte("txn_by_user_time")).Put(TxByUserTimeKey(t.UserID, t.OccurredAt, t.ID), itob(t.ID)); err != nil {
+			return err
+		}
+	}
+	if err := reindexMerchantTx(tx, old, t); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte("transactions")).Put(itob(t.ID), buf)
 }
 
 func (s *Store) DeleteTransaction(id, userID uint64) (bool, error) {
 	var deleted bool
 	err := s.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("transactions"))
-		raw := b.Get(itob(id))
+		raw := tx.Bucket([]byte("transactions")).Get(itob(id))
 		if raw == nil {
 			return nil
 		}
@@ -141,22 +387,266 @@ func (s *Store) DeleteTransaction(id, userID uint64) (bool, error) {
 		if t.UserID != userID {
 			return nil
 		}
-		if err := tx.Bucket([]byte("txn_by_user_time")).Delete(TxByUserTimeKey(t.UserID, t.OccurredAt, t.ID)); err != nil {
+		deleted = true
+		return deleteTransactionTx(tx, &t)
+	})
+	return deleted, err
+}
+
+// deleteTransactionTx removes t and everything hanging off it. The
+// caller has checked ownership.
+func deleteTransactionTx(tx *bolt.Tx, t *Transaction) error {
+	if err := tx.Bucket([]byte("txn_by_user_time")).Delete(TxByUserTimeKey(t.UserID, t.OccurredAt, t.ID)); err != nil {
+		return err
+	}
+	if err := unindexMerchantTx(tx, t); err != nil {
+		return err
+	}
+	// Cascade: drop every txn_tags link for this transaction.
+	tagsB := tx.Bucket([]byte("txn_tags"))
+	c := tagsB.Cursor()
+	prefix := itob(t.ID)
+	for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	// Cascade: drop the comment thread.
+	if err := deleteCommentsTx(tx, t.ID); err != nil {
+		return err
+	}
+	// Cascade: drop the alerts raised on it.
+	if err := deleteAlertsTx(tx, t.ID); err != nil {
+		return err
+	}
+	// Cascade: unlink refunds. Refunds of this transaction keep
+	// their kind but lose RefundOf; if this is itself a refund,
+	// drop its entry under the original.
+	if err := unlinkRefundsTx(tx, t.ID); err != nil {
+		return err
+	}
+	if t.RefundOf != 0 {
+		if err := tx.Bucket([]byte("refunds_by_txn")).Delete(refundKey(t.RefundOf, t.ID)); err != nil {
 			return err
 		}
-		// Cascade: drop every txn_tags link for this transaction.
-		tagsB := tx.Bucket([]byte("txn_tags"))
-		c := tagsB.Cursor()
-		prefix := itob(t.ID)
+	}
+	if t.BatchID != 0 {
+		if err := tx.Bucket([]byte("txn_by_batch")).Delete(batchKey(t.BatchID, t.ID)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket([]byte("transactions")).Delete(itob(t.ID))
+}
+
+// ListRefunds returns the refunds linked to the purchase originalID,
+// in ID order.
+func (s *Store) ListRefunds(originalID uint64) ([]Transaction, error) {
+	var out []Transaction
+	err := s.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("refunds_by_txn")).Cursor()
+		byID := tx.Bucket([]byte("transactions"))
+		prefix := itob(originalID)
 		for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
-			if err := c.Delete(); err != nil {
+			raw := byID.Get(k[8:])
+			if raw == nil {
+				continue // dangling reference; skip
+			}
+			var t Transaction
+			if err := json.Unmarshal(raw, &t); err != nil {
 				return err
 			}
+			out = append(out, t)
 		}
-		deleted = true
-		return b.Delete(itob(id))
+		return nil
 	})
-	return deleted, err
+	return out, err
+}
+
+// unlinkRefundsTx clears RefundOf on every refund pointing at
+// originalID and removes their refunds_by_txn entries.
+func unlinkRefundsTx(tx *bolt.Tx, originalID uint64) error {
+	refunds := tx.Bucket([]byte("refunds_by_txn"))
+	byID := tx.Bucket([]byte("transactions"))
+	prefix := itob(originalID)
+	var refundIDs []uint64
+	c := refunds.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+		refundIDs = append(refundIDs, btoi(k[8:]))
+	}
+	for _, id := range refundIDs {
+		if err := refunds.Delete(refundKey(originalID, id)); err != nil {
+			return err
+		}
+		raw := byID.Get(itob(id))
+		if raw == nil {
+			continue
+		}
+		var r Transaction
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return err
+		}
+		r.RefundOf = 0
+		buf, err := json.Marshal(&r)
+		if err != nil {
+			return err
+		}
+		if err := byID.Put(itob(id), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeTransactions folds the transaction dropID into keepID, both
+// owned by userID, and deletes dropID. Fields keepID has left empty
+// take dropID's values, so an entry typed by hand picks up the card,
+// FITID and details of its imported copy. dropID's tags are added to
+// keepID's, its photos, comments and refunds move to keepID (refunds
+// only when keepID is an expense; otherwise they are unlinked) and its
+// alerts are dropped. Returns the merged transaction, ErrNotFound if
+// either is missing or not userID's, or ErrInvalidMerge.
+func (s *Store) MergeTransactions(keepID, dropID, userID uint64) (*Transaction, error) {
+	var keep Transaction
+	err := s.Update(func(tx *bolt.Tx) error {
+		txns := tx.Bucket([]byte("transactions"))
+		var drop Transaction
+		for _, t := range []struct {
+			id  uint64
+			out *Transaction
+		}{{keepID, &keep}, {dropID, &drop}} {
+			raw := txns.Get(itob(t.id))
+			if raw == nil {
+				return ErrNotFound
+			}
+			if err := json.Unmarshal(raw, t.out); err != nil {
+				return err
+			}
+			if t.out.UserID != userID {
+				return ErrNotFound
+			}
+		}
+		if keep.ID == drop.ID || keep.RefundOf == drop.ID || drop.RefundOf == keep.ID {
+			return ErrInvalidMerge
+		}
+
+		if keep.Merchant == "" {
+			keep.Merchant = drop.Merchant
+		}
+		if keep.Card == "" {
+			keep.Card = drop.Card
+		}
+		if keep.Category == "" {
+			keep.Category = drop.Category
+		}
+		if keep.Details == "" {
+			keep.Details = drop.Details
+		}
+		if keep.Kind == "" {
+			keep.Kind = drop.Kind
+		}
+		if keep.FITID == "" {
+			keep.FITID = drop.FITID
+		}
+		if keep.MCC == "" {
+			keep.MCC = drop.MCC
+		}
+		if keep.RawMerchant == "" && !strings.EqualFold(drop.Merchant, keep.Merchant) {
+			keep.RawMerchant = firstNonEmpty(drop.RawMerchant, drop.Merchant)
+		}
+		if keep.RefundOf == 0 && keep.Kind == KindRefund {
+			keep.RefundOf = drop.RefundOf
+		}
+		if err := updateTransactionTx(tx, &keep); err != nil {
+			return err
+		}
+
+		// Collect before writing: a bucket must not change under its
+		// own cursor.
+		links := tx.Bucket([]byte("txn_tags"))
+		c := links.Cursor()
+		prefix := itob(drop.ID)
+		var tagIDs [][]byte
+		for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+			tagIDs = append(tagIDs, append([]byte(nil), k[8:]...))
+		}
+		for _, tagID := range tagIDs {
+			if err := links.Put(append(itob(keep.ID), tagID...), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		photos := tx.Bucket([]byte("txn_photos"))
+		var moved []Photo
+		err := photos.ForEach(func(_, v []byte) error {
+			var p Photo
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			if p.TransactionID == drop.ID {
+				moved = append(moved, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, p := range moved {
+			p.TransactionID = keep.ID
+			buf, err := json.Marshal(&p)
+			if err != nil {
+				return err
+			}
+			if err := photos.Put(itob(p.ID), buf); err != nil {
+				return err
+			}
+		}
+
+		comments := tx.Bucket([]byte("comments"))
+		var thread []Comment
+		c = comments.Cursor()
+		for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+			var cm Comment
+			if err := json.Unmarshal(v, &cm); err != nil {
+				return err
+			}
+			thread = append(thread, cm)
+		}
+		for _, cm := range thread {
+			cm.TransactionID = keep.ID
+			buf, err := json.Marshal(&cm)
+			if err != nil {
+				return err
+			}
+			if err := comments.Put(commentKey(keep.ID, cm.ID), buf); err != nil {
+				return err
+			}
+		}
+
+		if keep.KindOrDefault() == KindExpense {
+			var refunds []Transaction
+			c = tx.Bucket([]byte("refunds_by_txn")).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+				var r Transaction
+				if raw := txns.Get(k[8:]); raw != nil {
+					if err := json.Unmarshal(raw, &r); err != nil {
+						return err
+					}
+					refunds = append(refunds, r)
+				}
+			}
+			for _, r := range refunds {
+				r.RefundOf = keep.ID
+				if err := updateTransactionTx(tx, &r); err != nil {
+					return err
+				}
+			}
+		}
+		return deleteTransactionTx(tx, &drop)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &keep, nil
 }
 
 // TxByUserTimeKey builds the secondary index key for txn_by_user_time.
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -89,3 +91,203 @@ func TestUpdateTransactionRewritesIndex(t *testing.T) {
 		t.Errorf("expected new time, got %v", got[0].OccurredAt)
 	}
 }
+
+func TestRefundLinking(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	buy := &Transaction{UserID: u.ID, Amount: 50, Currency: "CAD", Merchant: "M", Category: "clothes", OccurredAt: time.Now()}
+	if err := s.CreateTransaction(buy); err != nil {
+		t.Fatal(err)
+	}
+	refund := &Transaction{UserID: u.ID, Amount: 20, Currency: "CAD", Merchant: "M", Kind: KindRefund, RefundOf: buy.ID, OccurredAt: time.Now()}
+	if err := s.CreateTransaction(refund); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.ListRefunds(buy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != refund.ID {
+		t.Fatalf("expected refund %d, got %+v", refund.ID, got)
+	}
+	if net := buy.SpendAmount() + refund.SpendAmount(); net != 30 {
+		t.Errorf("net spend = %v, want 30", net)
+	}
+
+	// A refund of a refund is rejected.
+	bad := &Transaction{UserID: u.ID, Amount: 1, Kind: KindRefund, RefundOf: refund.ID, OccurredAt: time.Now()}
+	if err := s.CreateTransaction(bad); !errors.Is(err, ErrInvalidRefund) {
+		t.Errorf("expected ErrInvalidRefund, got %v", err)
+	}
+
+	// Deleting the purchase unlinks the refund.
+	if _, err := s.DeleteTransaction(buy.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.GetTransaction(refund.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RefundOf != 0 || r.Kind != KindRefund {
+		t.Errorf("after delete: %+v", r)
+	}
+}
+
+func TestUpdateTransactionAndTagsIsAtomic(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	income := &Transaction{UserID: u.ID, Amount: 100, Kind: KindIncome, OccurredAt: time.Now()}
+	txn := &Transaction{UserID: u.ID, Amount: 5, Merchant: "M", OccurredAt: time.Now()}
+	for _, tr := range []*Transaction{income, txn} {
+		if err := s.CreateTransaction(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.ReplaceTagsForTransaction(txn.ID, []string{"old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	txn.Kind, txn.RefundOf = KindRefund, income.ID
+	if err := s.UpdateTransactionAndTags(txn, []string{"new"}); !errors.Is(err, ErrInvalidRefund) {
+		t.Fatalf("expected ErrInvalidRefund, got %v", err)
+	}
+	if tags, _ := s.ListTagsForTransaction(txn.ID); len(tags) != 1 || tags[0] != "old" {
+		t.Errorf("tags after failed update = %v", tags)
+	}
+
+	txn.Kind, txn.RefundOf, txn.Merchant = "", 0, "N"
+	if err := s.UpdateTransactionAndTags(txn, []string{"new"}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := s.GetTransaction(txn.ID)
+	if tags, _ := s.ListTagsForTransaction(txn.ID); got.Merchant != "N" || len(tags) != 1 || tags[0] != "new" {
+		t.Errorf("after update: %+v %v", got, tags)
+	}
+}
+
+func TestCreateTransactionRejectsUnknownKind(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	if err := s.CreateTransaction(&Transaction{UserID: u.ID, Kind: "gift", OccurredAt: time.Now()}); err == nil {
+		t.Error("expected error for unknown kind")
+	}
+}
+
+func TestWalkTransactionsForUser(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	other := newUser(t, s, "bob")
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var ids []uint64
+	for i := 0; i < 5; i++ {
+		txn := &Transaction{UserID: u.ID, Amount: float64(i), Currency: "CAD", OccurredAt: day.AddDate(0, 0, i)}
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, txn.ID)
+	}
+	if err := s.CreateTransaction(&Transaction{UserID: other.ID, Amount: 1, OccurredAt: day}); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(from, to time.Time, batch int) []uint64 {
+		var got []uint64
+		err := s.WalkTransactionsForUser(u.ID, from, to, batch, func(txn *Transaction) error {
+			got = append(got, txn.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := walk(time.Time{}, time.Time{}, 2); !reflect.DeepEqual(got, ids) {
+		t.Fatalf("all, batch 2: got %v, want %v", got, ids)
+	}
+	if got := walk(day.AddDate(0, 0, 1), day.AddDate(0, 0, 3), 1); !reflect.DeepEqual(got, ids[1:3]) {
+		t.Fatalf("range: got %v, want %v", got, ids[1:3])
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err := s.WalkTransactionsForUser(u.ID, time.Time{}, time.Time{}, 0, func(*Transaction) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Fatalf("err %v after %d calls", err, n)
+	}
+}
+
+func TestMergeTransactions(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	other := newUser(t, s, "bob")
+	at := time.Now()
+	add := func(tx *Transaction) *Transaction {
+		t.Helper()
+		tx.UserID = u.ID
+		if tx.OccurredAt.IsZero() {
+			tx.OccurredAt = at
+		}
+		if err := s.CreateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	tag := func(txnID uint64, name string) {
+		t.Helper()
+		tg, err := s.GetOrCreateTag(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddTagToTransaction(txnID, tg.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keep := add(&Transaction{Amount: 6.5, Merchant: "Blue Bottle", Category: "coffee"})
+	drop := add(&Transaction{Amount: 6.5, Merchant: "SQ *BLUE BOTTLE", Card: "Visa", Category: "Unknown", Details: "latte", FITID: "F1", OccurredAt: at.Add(time.Hour)})
+	refund := add(&Transaction{Amount: 6.5, Merchant: "Blue Bottle", Kind: KindRefund, RefundOf: drop.ID})
+	tag(keep.ID, "work")
+	tag(drop.ID, "travel")
+	tag(drop.ID, "work")
+	if err := s.CreatePhoto(&Photo{TransactionID: drop.ID, FilePath: "receipt.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateComment(&Comment{TransactionID: drop.ID, AuthorID: u.ID, Text: "double?"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.MergeTransactions(keep.ID, drop.ID, other.ID); err != ErrNotFound {
+		t.Errorf("merge by another user: %v", err)
+	}
+	if _, err := s.MergeTransactions(drop.ID, refund.ID, u.ID); err != ErrInvalidMerge {
+		t.Errorf("merge with its own refund: %v", err)
+	}
+
+	got, err := s.MergeTransactions(keep.ID, drop.ID, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Merchant != "Blue Bottle" || got.Category != "coffee" || got.Card != "Visa" || got.Details != "latte" || got.FITID != "F1" || !got.OccurredAt.Equal(keep.OccurredAt) {
+		t.Errorf("merged = %+v", got)
+	}
+	if _, err := s.GetTransaction(drop.ID); err != ErrNotFound {
+		t.Errorf("dropped transaction still there: %v", err)
+	}
+	if tags, _ := s.ListTagsForTransaction(keep.ID); len(tags) != 2 || tags[0] != "travel" || tags[1] != "work" {
+		t.Errorf("tags = %v", tags)
+	}
+	if photos, _ := s.ListPhotosForTransaction(keep.ID); len(photos) != 1 {
+		t.Errorf("photos = %v", photos)
+	}
+	if thread, _ := s.ListCommentsForTransaction(keep.ID); len(thread) != 1 || thread[0].TransactionID != keep.ID {
+		t.Errorf("comments = %+v", thread)
+	}
+	if r, _ := s.GetTransaction(refund.ID); r.RefundOf != keep.ID {
+		t.Errorf("refund links %d", r.RefundOf)
+	}
+	if refunds, _ := s.ListRefunds(keep.ID); len(refunds) != 1 {
+		t.Errorf("refunds of the merged transaction = %+v", refunds)
+	}
+}
@@ -0,0 +1,383 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrUndoExpired is returned by ApplyUndo for a token past its window.
+var ErrUndoExpired = errors.New("store: undo window has passed")
+
+// UndoRecord is the state of one transaction before an operation, and
+// which parts of it undoing the operation puts back, so that changes
+// made since to other parts survive. Before is nil when the operation
+// created the transaction, so undoing it means deleting it.
+type UndoRecord struct {
+	TransactionID uint64       `json:"transaction_id"`
+	Before        *Transaction `json:"before,omitempty"`
+	Tags          []string     `json:"tags,omitempty"`
+	Comments      []Comment    `json:"comments,omitempty"`
+	Alerts        []Alert      `json:"alerts,omitempty"`
+	// Photos are the IDs of the photos attached when a Whole record
+	// was taken.
+	Photos []uint64 `json:"photos,omitempty"`
+	// Whole is set for deletes and merges: undo brings back the row,
+	// its tags and comment thread as recorded, its alerts, and its
+	// photos if a merge moved them away.
+	Whole bool `json:"whole,omitempty"`
+	// Fields restores Before's fields only.
+	Fields bool `json:"fields,omitempty"`
+	// TagSet rebuilds the tags from Tags, for operations that replaced
+	// the whole set.
+	TagSet bool `json:"tag_set,omitempty"`
+	// TagLinks are single tags an operation added or removed, each with
+	// whether it was on the transaction before.
+	TagLinks map[string]bool `json:"tag_links,omitempty"`
+}
+
+// UndoEntry is the inverse of one mutating request, stored in the
+// `undo` bucket under its Token until ExpiresAt.
+type UndoEntry struct {
+	Token     string       `json:"token"`
+	UserID    uint64       `json:"user_id"`
+	Label     string       `json:"label"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Records   []UndoRecord `json:"records"`
+}
+
+// SnapshotTransactions records the current state of each transaction
+// in ids, with its tags, comments and alerts, for an UndoEntry. IDs
+// that do not exist are skipped. The records restore Fields; with
+// cascade set, for a delete or merge, they are Whole instead, and the
+// refunds linked to each one, whose refundOf the delete clears, are
+// snapshotted too with Fields set.
+//
+// The snapshot is taken in its own read transaction: take it right
+// before the mutation it is meant to undo.
+func (s *Store) SnapshotTransactions(cascade bool, ids ...uint64) ([]UndoRecord, error) {
+	var out []UndoRecord
+	seen := map[uint64]int{}
+	err := s.View(func(tx *bolt.Tx) error {
+		var add func(id uint64, whole bool) error
+		add = func(id uint64, whole bool) error {
+			if i, ok := seen[id]; ok {
+				if whole && i >= 0 && !out[i].Whole {
+					out[i].Whole, out[i].Fields = true, false
+					photos, err := photoIDsTx(tx, id)
+					out[i].Photos = photos
+					return err
+				}
+				return nil
+			}
+			seen[id] = -1
+			raw := tx.Bucket([]byte("transactions")).Get(itob(id))
+			if raw == nil {
+				return nil
+			}
+			rec := UndoRecord{TransactionID: id, Before: &Transaction{}, Whole: whole, Fields: !whole}
+			if err := json.Unmarshal(raw, rec.Before); err != nil {
+				return err
+			}
+			prefix := itob(id)
+			c := tx.Bucket([]byte("txn_tags")).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+				if name := tx.Bucket([]byte("tags_by_id")).Get(k[8:]); name != nil {
+					rec.Tags = append(rec.Tags, string(name))
+				}
+			}
+			c = tx.Bucket([]byte("comments")).Cursor()
+			for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+				var cm Comment
+				if err := json.Unmarshal(v, &cm); err != nil {
+					return err
+				}
+				rec.Comments = append(rec.Comments, cm)
+			}
+			c = tx.Bucket([]byte("alerts_by_txn")).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+				a, err := getAlertTx(tx, btoi(k[8:]))
+				if err != nil {
+					return err
+				}
+				rec.Alerts = append(rec.Alerts, *a)
+			}
+			if whole {
+				photos, err := photoIDsTx(tx, id)
+				if err != nil {
+					return err
+				}
+				rec.Photos = photos
+			}
+			seen[id] = len(out)
+			out = append(out, rec)
+			if !cascade {
+				return nil
+			}
+			c = tx.Bucket([]byte("refunds_by_txn")).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+				if err := add(btoi(k[8:]), false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for _, id := range ids {
+			if err := add(id, cascade); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+// photoIDsTx lists the photos attached to txnID. Photos are keyed by
+// their own ID, so this scans them all.
+func photoIDsTx(tx *bolt.Tx, txnID uint64) ([]uint64, error) {
+	var ids []uint64
+	err := tx.Bucket([]byte("txn_photos")).ForEach(func(_, v []byte) error {
+		var p Photo
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		if p.TransactionID == txnID {
+			ids = append(ids, p.ID)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// PutUndo stores e under e.Token and drops entries that have expired
+// by e.CreatedAt.
+func (s *Store) PutUndo(e *UndoEntry) error {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.Update(func(tx *bolt.Tx) error {
+		if err := pruneUndoTx(tx, e.CreatedAt); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("undo")).Put([]byte(e.Token), buf)
+	})
+}
+
+func pruneUndoTx(tx *bolt.Tx, now time.Time) error {
+	b := tx.Bucket([]byte("undo"))
+	var expired [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var e UndoEntry
+		if err := json.Unmarshal(v, &e); err != nil || now.After(e.ExpiresAt) {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyUndo restores every record of the entry under token, in one
+// write transaction, and deletes the entry so it cannot be replayed.
+// Only the parts each record names are restored: a later edit to a
+// part the operation did not touch survives, one to a part it did is
+// overwritten. It returns ErrNotFound
+// for an unknown token or one recorded for another user, and
+// ErrUndoExpired after the window.
+func (s *Store) ApplyUndo(token string, userID uint64, now time.Time) (*UndoEntry, error) {
+	var e UndoEntry
+	err := s.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("undo"))
+		raw := b.Get([]byte(token))
+		if raw == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		if e.UserID != userID {
+			return ErrNotFound
+		}
+		if now.After(e.ExpiresAt) {
+			return b.Delete([]byte(token))
+		}
+		// Undo in reverse: a transaction touched twice ends up as it
+		// was before the first touch.
+		for i := len(e.Records) - 1; i >= 0; i-- {
+			if err := restoreTx(tx, &e.Records[i]); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte(token))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if now.After(e.ExpiresAt) {
+		return nil, ErrUndoExpired
+	}
+	return &e, nil
+}
+
+func restoreTx(tx *bolt.Tx, rec *UndoRecord) error {
+	var current *Transaction
+	if raw := tx.Bucket([]byte("transactions")).Get(itob(rec.TransactionID)); raw != nil {
+		current = &Transaction{}
+		if err := json.Unmarshal(raw, current); err != nil {
+			return err
+		}
+	}
+	if rec.Before == nil {
+		if current == nil {
+			return nil
+		}
+		return deleteTransactionTx(tx, current)
+	}
+	if current == nil && !rec.Whole {
+		// Deleted since; only undoing that delete brings it back.
+		return nil
+	}
+
+	if rec.Whole || rec.Fields {
+		if err := restoreRowTx(tx, current, rec.Before); err != nil {
+			return err
+		}
+	}
+	id := rec.TransactionID
+	if rec.Whole || rec.TagSet {
+		if err := replaceTagsTx(tx, id, rec.Tags); err != nil {
+			return err
+		}
+	}
+	links := tx.Bucket([]byte("txn_tags"))
+	for name, linked := range rec.TagLinks {
+		tag, err := getOrCreateTagTx(tx, name)
+		if err != nil {
+			return err
+		}
+		key := append(itob(id), itob(tag.ID)...)
+		if linked {
+			err = links.Put(key, []byte{})
+		} else {
+			err = links.Delete(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !rec.Whole {
+		return nil
+	}
+
+	// The thread is restored wholesale too: comments merged in from
+	// another transaction go, the recorded ones come back.
+	if err := deleteCommentsTx(tx, id); err != nil {
+		return err
+	}
+	comments := tx.Bucket([]byte("comments"))
+	for _, cm := range rec.Comments {
+		buf, err := json.Marshal(&cm)
+		if err != nil {
+			return err
+		}
+		if err := comments.Put(commentKey(cm.TransactionID, cm.ID), buf); err != nil {
+			return err
+		}
+	}
+
+	// Alerts the delete or merge cascade dropped come back; ones still
+	// stored keep their current status.
+	for i := range rec.Alerts {
+		if err := restoreAlertTx(tx, &rec.Alerts[i]); err != nil {
+			return err
+		}
+	}
+
+	// Photos a merge moved to the kept transaction come back; ones
+	// deleted since stay deleted.
+	photos := tx.Bucket([]byte("txn_photos"))
+	for _, photoID := range rec.Photos {
+		raw := photos.Get(itob(photoID))
+		if raw == nil {
+			continue
+		}
+		var p Photo
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return err
+		}
+		p.TransactionID = id
+		buf, err := json.Marshal(&p)
+		if err != nil {
+			return err
+		}
+		if err := photos.Put(itob(p.ID), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreRowTx writes t back over current, which is nil if the row
+// was deleted, moving its index entries.
+func restoreRowTx(tx *bolt.Tx, current, t *Transaction) error {
+	txns := tx.Bucket([]byte("transactions"))
+	idx := tx.Bucket([]byte("txn_by_user_time"))
+	refunds := tx.Bucket([]byte("refunds_by_txn"))
+	batches := tx.Bucket([]byte("txn_by_batch"))
+	if current != nil {
+		if err := idx.Delete(TxByUserTimeKey(current.UserID, current.OccurredAt, current.ID)); err != nil {
+			return err
+		}
+		if err := unindexMerchantTx(tx, current); err != nil {
+			return err
+		}
+		if current.RefundOf != 0 {
+			if err := refunds.Delete(refundKey(current.RefundOf, current.ID)); err != nil {
+				return err
+			}
+		}
+		if current.BatchID != 0 {
+			if err := batches.Delete(batchKey(current.BatchID, current.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := txns.Put(itob(t.ID), buf); err != nil {
+		return err
+	}
+	if err := idx.Put(TxByUserTimeKey(t.UserID, t.OccurredAt, t.ID), itob(t.ID)); err != nil {
+		return err
+	}
+	if err := indexMerchantTx(tx, t); err != nil {
+		return err
+	}
+	if t.RefundOf != 0 {
+		if err := refunds.Put(refundKey(t.RefundOf, t.ID), []byte{}); err != nil {
+			return err
+		}
+	}
+	if t.BatchID != 0 {
+		if err := batches.Put(batchKey(t.BatchID, t.ID), []byte{}); err != nil {
+			return err
+		}
+	}
+	if err := ensureCategoryTx(tx, t.UserID, t.Category); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUndoRestoresDeletedTransaction(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	orig := &Transaction{UserID: u.ID, Amount: 50, Currency: "CAD", Merchant: "Shop", OccurredAt: time.Now().Add(-time.Hour)}
+	if err := s.CreateTransaction(orig); err != nil {
+		t.Fatal(err)
+	}
+	refund := &Transaction{UserID: u.ID, Amount: -10, Currency: "CAD", Merchant: "Shop", OccurredAt: time.Now(), Kind: KindRefund, RefundOf: orig.ID}
+	if err := s.CreateTransaction(refund); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReplaceTagsForTransaction(orig.ID, []string{"gift"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateComment(&Comment{TransactionID: orig.ID, AuthorID: u.ID, Text: "for mom"}); err != nil {
+		t.Fatal(err)
+	}
+	alert := &Alert{UserID: u.ID, TransactionID: orig.ID, Kind: "new_merchant", Status: AlertAcknowledged}
+	if err := s.CreateAlert(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.SnapshotTransactions(true, orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("want original and its refund, got %d records", len(records))
+	}
+	if _, err := s.DeleteTransaction(orig.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := s.PutUndo(&UndoEntry{Token: "tok", UserID: u.ID, CreatedAt: now, ExpiresAt: now.Add(time.Minute), Records: records}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ApplyUndo("tok", u.ID+1, now); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("other user: %v", err)
+	}
+	if _, err := s.ApplyUndo("tok", u.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetTransaction(orig.ID)
+	if err != nil || got.Merchant != "Shop" {
+		t.Fatalf("not restored: %v %v", got, err)
+	}
+	if tags, _ := s.ListTagsForTransaction(orig.ID); len(tags) != 1 || tags[0] != "gift" {
+		t.Fatalf("tags %v", tags)
+	}
+	if n, _ := s.CountCommentsForTransaction(orig.ID); n != 1 {
+		t.Fatalf("comments %d", n)
+	}
+	if alerts, _ := s.ListAlerts(u.ID); len(alerts) != 1 || alerts[0].ID != alert.ID || alerts[0].Status != AlertAcknowledged {
+		t.Fatalf("alerts %+v", alerts)
+	}
+	if alerts, _ := s.ListAlertsForTransaction(orig.ID); len(alerts) != 1 {
+		t.Fatalf("alerts by transaction %+v", alerts)
+	}
+	if refunds, _ := s.ListRefunds(orig.ID); len(refunds) != 1 {
+		t.Fatalf("refund link not restored: %v", refunds)
+	}
+	if list, _ := s.ListTransactionsForUser(u.ID); len(list) != 2 {
+		t.Fatalf("index has %d rows", len(list))
+	}
+	if _, err := s.ApplyUndo("tok", u.ID, now); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("replay: %v", err)
+	}
+}
+
+func TestUndoKeepsLaterChangesToOtherParts(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	txn := &Transaction{UserID: u.ID, Amount: 50, Currency: "CAD", Merchant: "Shop", Category: "misc", OccurredAt: time.Now()}
+	if err := s.CreateTransaction(txn); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.SnapshotTransactions(false, txn.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Category = "food"
+	if err := s.UpdateTransaction(txn); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReplaceTagsForTransaction(txn.ID, []string{"later"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateComment(&Comment{TransactionID: txn.ID, AuthorID: u.ID, Text: "later"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := s.PutUndo(&UndoEntry{Token: "tok", UserID: u.ID, CreatedAt: now, ExpiresAt: now.Add(time.Minute), Records: records}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ApplyUndo("tok", u.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetTransaction(txn.ID); got.Category != "misc" {
+		t.Fatalf("category %q", got.Category)
+	}
+	if tags, _ := s.ListTagsForTransaction(txn.ID); len(tags) != 1 || tags[0] != "later" {
+		t.Fatalf("tags %v", tags)
+	}
+	if n, _ := s.CountCommentsForTransaction(txn.ID); n != 1 {
+		t.Fatalf("comments %d", n)
+	}
+}
+
+func TestUndoMergeMovesPhotosBack(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	keep := &Transaction{UserID: u.ID, Amount: 5, Currency: "CAD", Merchant: "Cafe", OccurredAt: time.Now()}
+	drop := &Transaction{UserID: u.ID, Amount: 5, Currency: "CAD", Merchant: "CAFE 42", OccurredAt: time.Now()}
+	for _, txn := range []*Transaction{keep, drop} {
+		if err := s.CreateTransaction(txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.CreatePhoto(&Photo{TransactionID: drop.ID, FilePath: "receipt.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.SnapshotTransactions(true, keep.ID, drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MergeTransactions(keep.ID, drop.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := s.PutUndo(&UndoEntry{Token: "tok", UserID: u.ID, CreatedAt: now, ExpiresAt: now.Add(time.Minute), Records: records}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ApplyUndo("tok", u.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if photos, _ := s.ListPhotosForTransaction(drop.ID); len(photos) != 1 {
+		t.Fatalf("photos %v", photos)
+	}
+	if photos, _ := s.ListPhotosForTransaction(keep.ID); len(photos) != 0 {
+		t.Fatalf("kept photos %v", photos)
+	}
+}
+
+func TestUndoExpires(t *testing.T) {
+	s := newTestStore(t)
+	u := newUser(t, s, "alice")
+	txn := &Transaction{UserID: u.ID, Amount: 1, OccurredAt: time.Now()}
+	if err := s.CreateTransaction(txn); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	e := &UndoEntry{Token: "tok", UserID: u.ID, CreatedAt: now, ExpiresAt: now.Add(time.Minute),
+		Records: []UndoRecord{{TransactionID: txn.ID}}}
+	if err := s.PutUndo(e); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ApplyUndo("tok", u.ID, now.Add(2*time.Minute)); !errors.Is(err, ErrUndoExpired) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := s.GetTransaction(txn.ID); err != nil {
+		t.Fatal("expired undo must not delete")
+	}
+}
@@ -21,6 +21,24 @@ type User struct {
 	HashPassword string `json:"hash_password"`
 	PersonName   string `json:"person_name"`
 	OTPEnabled   string `json:"otp_enabled,omitempty"`
+	// BaseCurrency is the ISO 4217 code totals are converted into for
+	// this user. Empty means DefaultBaseCurrency.
+	BaseCurrency string `json:"base_currency,omitempty"`
+	// Rules is this user's []rules.Rule as JSON. Nil means the shared
+	// rules setting applies.
+	Rules json.RawMessage `json:"rules,omitempty"`
+}
+
+// DefaultBaseCurrency is used for users who never picked one.
+const DefaultBaseCurrency = "CAD"
+
+// BaseCurrencyOrDefault returns u.BaseCurrency, falling back to
+// DefaultBaseCurrency.
+func (u *User) BaseCurrencyOrDefault() string {
+	if u.BaseCurrency == "" {
+		return DefaultBaseCurrency
+	}
+	return u.BaseCurrency
 }
 
 // CreateUser inserts a new user, assigning u.ID from the seq_users